@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	appConfig "gohst/app/config"
+	"gohst/internal/config"
+	"gohst/internal/ratelimit"
+)
+
+// ratelimitd runs the rate-limit stores and policies as a standalone
+// service, so non-Go services can share limits over HTTP.
+func main() {
+	config.RegisterAppConfig(appConfig.InitAppConfig())
+	config.InitConfig()
+	cfg := config.RateLimit
+
+	policies, err := ratelimit.ConfiguredPolicies()
+	if err != nil {
+		log.Fatal("Invalid policies in ", cfg.ConfigFile, ": ", err)
+	}
+	custom, err := ratelimit.ParsePolicies(cfg.DaemonPolicies)
+	if err != nil {
+		log.Fatal("Invalid RATE_LIMIT_DAEMON_POLICIES: ", err)
+	}
+	for name, p := range custom {
+		policies[name] = p
+	}
+
+	store := ratelimit.NewStore()
+	if cfg.DaemonTimeline > 0 {
+		store = ratelimit.NewTimelineStore(store, cfg.DaemonTimeline, 15*time.Minute)
+	}
+	if cfg.DaemonTuner {
+		store = ratelimit.NewTunerStore(store, ratelimit.NewPolicyTuner(ratelimit.TunerGuardrails{}))
+	}
+	defer store.Close()
+
+	if cfg.DaemonToken == "" {
+		log.Println("[ratelimitd] warning: RATE_LIMIT_DAEMON_TOKEN is empty; the API is unauthenticated")
+	}
+
+	server := &http.Server{
+		Addr:              cfg.DaemonAddr,
+		Handler:           ratelimit.NewDecisionServer(store, policies, cfg.DaemonToken),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("[ratelimitd] shutdown error:", err)
+		}
+	}()
+
+	log.Printf("[ratelimitd] listening on %s (%d policies)", cfg.DaemonAddr, len(policies))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+-- Policy overrides by scope; NULL columns keep the policy from code
+CREATE TABLE rate_limit_policies (
+    scope           VARCHAR(50) PRIMARY KEY,
+    request_limit   INTEGER CHECK (request_limit > 0),
+    window_seconds  INTEGER CHECK (window_seconds > 0),
+    burst           INTEGER CHECK (burst >= 0),
+    cost            INTEGER CHECK (cost >= 0),
+    concurrency     INTEGER CHECK (concurrency >= 0),
+    max_body_bytes  BIGINT CHECK (max_body_bytes >= 0),
+    fail_mode       VARCHAR(10) CHECK (fail_mode IN ('open', 'closed')),
+    enabled         BOOLEAN,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
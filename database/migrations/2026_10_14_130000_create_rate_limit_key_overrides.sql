@@ -0,0 +1,15 @@
+-- Per-key limit overrides; a NULL scope applies in every scope, NULL columns keep the policy
+CREATE TABLE rate_limit_key_overrides (
+    id              SERIAL PRIMARY KEY,
+    rate_key        VARCHAR(255) NOT NULL,
+    scope           VARCHAR(50),
+    request_limit   INTEGER CHECK (request_limit > 0),
+    window_seconds  INTEGER CHECK (window_seconds > 0),
+    burst           INTEGER CHECK (burst >= 0),
+    enabled         BOOLEAN,
+    note            TEXT,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE UNIQUE INDEX idx_rate_limit_key_overrides_key_scope
+    ON rate_limit_key_overrides (rate_key, COALESCE(scope, ''));
@@ -0,0 +1,2 @@
+-- Denials a shadowed limiter only observed; the request was let through
+ALTER TABLE rate_limit_logs ADD COLUMN shadow BOOLEAN NOT NULL DEFAULT FALSE;
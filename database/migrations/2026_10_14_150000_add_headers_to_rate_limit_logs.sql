@@ -0,0 +1,2 @@
+-- Headers a shadowed limiter's denial would have sent; NULL when enforced
+ALTER TABLE rate_limit_logs ADD COLUMN headers JSONB;
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvSource says where an effective setting came from.
+type EnvSource string
+
+const (
+	EnvFromDefault EnvSource = "default"
+	EnvFromEnv     EnvSource = "env"
+	EnvFromFile    EnvSource = "file"
+	EnvFromPreset  EnvSource = "preset"
+	EnvInvalid     EnvSource = "invalid" // the env value was rejected; the default is used
+)
+
+// EnvEntry is one setting in an EnvReader's report.
+type EnvEntry struct {
+	Key    string
+	Value  string // effective value; secrets are masked
+	Source EnvSource
+	Error  string // why the env value was rejected (EnvInvalid only)
+}
+
+// EnvReader reads typed, validated settings from the environment. Unlike
+// GetEnv it never panics: malformed values are logged and replaced by the
+// default, and every read is recorded for a startup report.
+type EnvReader struct {
+	entries []EnvEntry
+	// file holds settings from a config file, by env name. The environment
+	// overrides them.
+	file map[string]string
+	// preset holds the defaults of an environment preset, by env name. The
+	// environment and the config file override them.
+	preset map[string]string
+}
+
+// raw returns the trimmed value of key, and whether it is set.
+func (e *EnvReader) raw(key string) (string, bool) {
+	v, _ := e.lookup(key)
+	return v, v != ""
+}
+
+// lookup returns the value of key and where it came from: the environment,
+// then the config file, then the preset.
+func (e *EnvReader) lookup(key string) (string, EnvSource) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v, EnvFromEnv
+	}
+	if v := strings.TrimSpace(e.file[key]); v != "" {
+		return v, EnvFromFile
+	}
+	if v := e.preset[key]; v != "" {
+		return v, EnvFromPreset
+	}
+	return "", EnvFromDefault
+}
+
+func (e *EnvReader) record(key, value string, src EnvSource, err error) {
+	if src == EnvFromEnv {
+		_, src = e.lookup(key)
+	}
+	entry := EnvEntry{Key: key, Value: value, Source: src}
+	if err != nil {
+		entry.Error = err.Error()
+		log.Printf("[config] invalid %s: %v; using default %s", key, err, value)
+	}
+	e.entries = append(e.entries, entry)
+}
+
+// String reads a string setting.
+func (e *EnvReader) String(key, def string) string {
+	v, ok := e.raw(key)
+	if !ok {
+		e.record(key, def, EnvFromDefault, nil)
+		return def
+	}
+	e.record(key, v, EnvFromEnv, nil)
+	return v
+}
+
+// Secret reads a string setting that is masked in the report.
+func (e *EnvReader) Secret(key, def string) string {
+	v, ok := e.raw(key)
+	src := EnvFromEnv
+	if !ok {
+		v, src = def, EnvFromDefault
+	}
+	masked := ""
+	if v != "" {
+		masked = "****"
+	}
+	e.record(key, masked, src, nil)
+	return v
+}
+
+// Enum reads a string setting that must be one of allowed.
+func (e *EnvReader) Enum(key, def string, allowed ...string) string {
+	v, ok := e.raw(key)
+	if !ok {
+		e.record(key, def, EnvFromDefault, nil)
+		return def
+	}
+	v = strings.ToLower(v)
+	for _, a := range allowed {
+		if v == a {
+			e.record(key, v, EnvFromEnv, nil)
+			return v
+		}
+	}
+	e.record(key, def, EnvInvalid, fmt.Errorf("%q is not one of %s", v, strings.Join(allowed, ", ")))
+	return def
+}
+
+// Bool reads a boolean setting ("true", "false", "1", "0", ...).
+func (e *EnvReader) Bool(key string, def bool) bool {
+	v, ok := e.raw(key)
+	if !ok {
+		e.record(key, strconv.FormatBool(def), EnvFromDefault, nil)
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.record(key, strconv.FormatBool(def), EnvInvalid, fmt.Errorf("%q is not a boolean", v))
+		return def
+	}
+	e.record(key, strconv.FormatBool(b), EnvFromEnv, nil)
+	return b
+}
+
+// Int reads a non-negative integer setting.
+func (e *EnvReader) Int(key string, def int) int {
+	v, ok := e.raw(key)
+	if !ok {
+		e.record(key, strconv.Itoa(def), EnvFromDefault, nil)
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		e.record(key, strconv.Itoa(def), EnvInvalid, fmt.Errorf("%q is not a non-negative integer", v))
+		return def
+	}
+	e.record(key, strconv.Itoa(n), EnvFromEnv, nil)
+	return n
+}
+
+// Seconds reads a duration setting as whole seconds. Bare numbers are
+// seconds; Go durations such as "90s", "5m" or "1h30m" are also accepted.
+func (e *EnvReader) Seconds(key string, def int) int {
+	return e.duration(key, def, time.Second, "s")
+}
+
+// Millis reads a duration setting as milliseconds. Bare numbers are
+// milliseconds; Go durations such as "250ms" or "2s" are also accepted.
+func (e *EnvReader) Millis(key string, def int) int {
+	return e.duration(key, def, time.Millisecond, "ms")
+}
+
+func (e *EnvReader) duration(key string, def int, unit time.Duration, suffix string) int {
+	v, ok := e.raw(key)
+	if !ok {
+		e.record(key, strconv.Itoa(def)+suffix, EnvFromDefault, nil)
+		return def
+	}
+	n, err := parseDuration(v, unit)
+	if err != nil {
+		e.record(key, strconv.Itoa(def)+suffix, EnvInvalid, err)
+		return def
+	}
+	e.record(key, strconv.Itoa(n)+suffix, EnvFromEnv, nil)
+	return n
+}
+
+// parseDuration parses a bare number of units or a Go duration, and
+// returns it in whole units. Values that do not divide evenly are rejected
+// rather than silently truncated.
+func parseDuration(v string, unit time.Duration) (int, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("%q is negative", v)
+		}
+		return n, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number or duration (e.g. \"90s\")", v)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%q is negative", v)
+	}
+	if d%unit != 0 {
+		return 0, fmt.Errorf("%q is not a whole number of %s", v, unit)
+	}
+	return int(d / unit), nil
+}
+
+// List reads a comma-separated list setting.
+func (e *EnvReader) List(key string) []string {
+	v, ok := e.raw(key)
+	src := EnvFromEnv
+	if !ok {
+		src = EnvFromDefault
+	}
+	list := splitCSV(v)
+	e.record(key, strings.Join(list, ","), src, nil)
+	return list
+}
+
+// Entries returns every setting read so far, in read order.
+func (e *EnvReader) Entries() []EnvEntry {
+	return append([]EnvEntry(nil), e.entries...)
+}
+
+// LogReport logs a one-line summary plus every setting that was set in the
+// environment, a config file or a preset, or rejected, so the effective
+// configuration is visible at startup.
+func (e *EnvReader) LogReport(name string) {
+	var fromEnv, fromFile, fromPreset, invalid int
+	for _, entry := range e.entries {
+		switch entry.Source {
+		case EnvFromEnv:
+			fromEnv++
+		case EnvFromFile:
+			fromFile++
+		case EnvFromPreset:
+			fromPreset++
+		case EnvInvalid:
+			invalid++
+		}
+	}
+	log.Printf("[config] %s: %d settings, %d from env, %d from file, %d from preset, %d invalid (defaults used)", name, len(e.entries), fromEnv, fromFile, fromPreset, invalid)
+	for _, entry := range e.entries {
+		if entry.Source != EnvFromDefault {
+			log.Printf("[config]   %s=%s (%s)", entry.Key, entry.Value, entry.Source)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testEnvKey = "GOHST_TEST_SETTING"
+
+func TestEnvReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string // "" leaves the variable unset
+		read    func(e *EnvReader) any
+		want    any
+		wantSrc EnvSource
+	}{
+		{"string default", "", func(e *EnvReader) any { return e.String(testEnvKey, "def") }, "def", EnvFromDefault},
+		{"string set", "  value ", func(e *EnvReader) any { return e.String(testEnvKey, "def") }, "value", EnvFromEnv},
+
+		{"bool default", "", func(e *EnvReader) any { return e.Bool(testEnvKey, true) }, true, EnvFromDefault},
+		{"bool set", "0", func(e *EnvReader) any { return e.Bool(testEnvKey, true) }, false, EnvFromEnv},
+		{"bool invalid", "yes please", func(e *EnvReader) any { return e.Bool(testEnvKey, true) }, true, EnvInvalid},
+
+		{"int default", "", func(e *EnvReader) any { return e.Int(testEnvKey, 7) }, 7, EnvFromDefault},
+		{"int set", "42", func(e *EnvReader) any { return e.Int(testEnvKey, 7) }, 42, EnvFromEnv},
+		{"int negative", "-1", func(e *EnvReader) any { return e.Int(testEnvKey, 7) }, 7, EnvInvalid},
+		{"int invalid", "4x", func(e *EnvReader) any { return e.Int(testEnvKey, 7) }, 7, EnvInvalid},
+
+		{"seconds default", "", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 60, EnvFromDefault},
+		{"seconds bare", "90", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 90, EnvFromEnv},
+		{"seconds duration", "1h30m", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 5400, EnvFromEnv},
+		{"seconds fractional", "1500ms", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 60, EnvInvalid},
+		{"seconds negative", "-5s", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 60, EnvInvalid},
+		{"seconds invalid", "soon", func(e *EnvReader) any { return e.Seconds(testEnvKey, 60) }, 60, EnvInvalid},
+		{"millis duration", "2s", func(e *EnvReader) any { return e.Millis(testEnvKey, 250) }, 2000, EnvFromEnv},
+
+		{"list default", "", func(e *EnvReader) any { return e.List(testEnvKey) }, []string(nil), EnvFromDefault},
+		{"list set", "a, b,,c ", func(e *EnvReader) any { return e.List(testEnvKey) }, []string{"a", "b", "c"}, EnvFromEnv},
+
+		{"enum default", "", func(e *EnvReader) any { return e.Enum(testEnvKey, "memory", "memory", "redis") }, "memory", EnvFromDefault},
+		{"enum set", "Redis", func(e *EnvReader) any { return e.Enum(testEnvKey, "memory", "memory", "redis") }, "redis", EnvFromEnv},
+		{"enum invalid", "etcd", func(e *EnvReader) any { return e.Enum(testEnvKey, "memory", "memory", "redis") }, "memory", EnvInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(testEnvKey, tt.env)
+			e := &EnvReader{}
+			if got := tt.read(e); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+			entries := e.Entries()
+			if len(entries) != 1 || entries[0].Key != testEnvKey || entries[0].Source != tt.wantSrc {
+				t.Fatalf("expected one %s entry, got %+v", tt.wantSrc, entries)
+			}
+			if invalid := tt.wantSrc == EnvInvalid; invalid != (entries[0].Error != "") {
+				t.Errorf("expected an error only for invalid values, got %q", entries[0].Error)
+			}
+		})
+	}
+}
+
+func TestEnvReader_Sources(t *testing.T) {
+	t.Setenv(testEnvKey, "")
+	e := &EnvReader{
+		file:   map[string]string{testEnvKey: "from-file"},
+		preset: map[string]string{testEnvKey: "from-preset", "GOHST_TEST_PRESET": "5"},
+	}
+	if got := e.String(testEnvKey, "def"); got != "from-file" {
+		t.Errorf("expected the file to override the preset, got %q", got)
+	}
+	t.Setenv("GOHST_TEST_PRESET", "")
+	if got := e.Int("GOHST_TEST_PRESET", 1); got != 5 {
+		t.Errorf("expected the preset to override the default, got %d", got)
+	}
+	t.Setenv(testEnvKey, "from-env")
+	if got := e.String(testEnvKey, "def"); got != "from-env" {
+		t.Errorf("expected the environment to override the file, got %q", got)
+	}
+
+	t.Setenv("GOHST_TEST_SECRET", "hunter2")
+	if got := e.Secret("GOHST_TEST_SECRET", ""); got != "hunter2" {
+		t.Errorf("expected the secret value, got %q", got)
+	}
+
+	var sources []EnvSource
+	for _, entry := range e.Entries() {
+		sources = append(sources, entry.Source)
+	}
+	want := []EnvSource{EnvFromFile, EnvFromPreset, EnvFromEnv, EnvFromEnv}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("expected sources %v, got %v", want, sources)
+	}
+	if v := e.Entries()[3].Value; v != "****" {
+		t.Errorf("expected the secret masked in the report, got %q", v)
+	}
+}
@@ -1,63 +1,502 @@
 package config
 
+import (
+	"encoding/json"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+)
+
 // RateLimitConfig holds all rate-limiter related configuration
 type RateLimitConfig struct {
 	// Enabled toggles the rate limiter on/off globally
 	Enabled bool
 
-	// Store is the backing store type: "memory" or "redis"
+	// Preset is the environment preset whose defaults apply: "dev",
+	// "staging", "prod" or empty (built-in defaults only)
+	Preset string
+
+	// Store is the backing store type: "memory", "redis", "tiered" or "gossip"
 	Store string
 
+	// Gossip store settings (Store == "gossip")
+	GossipBind       string   // UDP listen address, e.g. ":7946"
+	GossipPeers      []string // peer "host:port" addresses
+	GossipIntervalMs int      // how often deltas are sent
+	GossipSecret     string   // HMAC key shared by all peers
+
+	// MemoryMaxKeys caps the in-memory store's and the tiered store's local key count (LRU eviction); 0 = unbounded
+	MemoryMaxKeys int
+
+	// MemorySnapshotPath persists in-memory buckets across restarts; empty disables
+	MemorySnapshotPath string
+
+	// MemorySnapshotInterval is how often the snapshot is written, in seconds
+	// (0 = only on shutdown)
+	MemorySnapshotInterval int
+
+	// DenyCacheMinRetry enables local caching of deny decisions whose
+	// retry-after is at least this many seconds (0 disables)
+	DenyCacheMinRetry int
+
+	// DenyCacheTTL caps how long a cached deny is served, in seconds
+	DenyCacheTTL int
+
+	// TieredSyncMs is how often the tiered store pushes local consumption to Redis
+	TieredSyncMs int
+
+	// LatencyBudgetMs is the store p99 latency above which a scope switches to
+	// LatencyBudgetMode; 0 disables the budget
+	LatencyBudgetMs int
+
+	// LatencyBudgetSustain is how long, in seconds, the p99 must stay over
+	// budget before the switch
+	LatencyBudgetSustain int
+
+	// LatencyBudgetMode is the fallback for over-budget scopes: "local" or "bypass"
+	LatencyBudgetMode string
+
+	// MigrateFrom names a store kind to dual-write alongside Store while
+	// switching backends; empty disables migration mode
+	MigrateFrom string
+
+	// MigrateFromPrefix is the Redis key prefix of a Redis-backed old store.
+	// It must be set, and differ from RedisPrefix when the new store uses
+	// Redis too, or migration stays off
+	MigrateFromPrefix string
+
+	// MigrateRead selects which store answers during migration: "new" or "old"
+	MigrateRead string
+
 	// RedisPrefix is the key prefix for all rate-limit keys in Redis
 	RedisPrefix string
 
 	// Redis holds the Redis connection config (shared with session if desired)
 	Redis *RedisConfig
 
+	// RedisTimeoutMs bounds every Redis command (dial, read, write) in milliseconds.
+	// 0 disables the deadline and relies solely on the request context.
+	RedisTimeoutMs int
+
 	// TrustedProxies is a list of CIDR ranges or IPs that are trusted reverse proxies.
 	// X-Forwarded-For / X-Real-IP headers are only honoured from these peers.
 	TrustedProxies []string
 
+	// ClientIPHeaders lists the headers the client IP is read from when the
+	// peer is a trusted proxy, highest priority first, e.g.
+	// "CF-Connecting-IP", "True-Client-IP" or "Fly-Client-IP" before
+	// "X-Forwarded-For". Empty means X-Real-IP, then X-Forwarded-For.
+	ClientIPHeaders []string
+
+	// TrustedHops switches to hop-count trust: exactly this many proxies sit
+	// in front of the server, and the client IP is the X-Forwarded-For entry
+	// this many places from the right. TrustedProxies and ClientIPHeaders are
+	// then ignored. 0 (the default) uses TrustedProxies.
+	TrustedHops int
+
+	// ForwardedSkip lists address classes never taken from forwarding headers
+	// as the client IP: "private", "loopback", "linklocal" and "bogon".
+	ForwardedSkip []string
+
+	// ProxyRanges lists published proxy range sources trusted next to
+	// TrustedProxies: "cloudflare", "fastly" or "aws:<service>[:<region>...]".
+	ProxyRanges []string
+
+	// ProxyRangesRefresh is how often the published ranges are refetched, in seconds
+	ProxyRangesRefresh int
+
+	// ProxyRangesCache is a file keeping the last fetched ranges across
+	// restarts; empty disables it
+	ProxyRangesCache string
+
 	// DefaultResponseFormat is the content type for 429 responses: "json" or "html"
 	DefaultResponseFormat string
 
+	// DenyTemplate is the view rendered for HTML rate-limit denials through
+	// the render package, e.g. "errors/429"; empty uses the built-in page
+	DenyTemplate string
+
+	// Headers selects the rate-limit response headers: "x-ratelimit"
+	// (X-RateLimit-*), "ietf" (the IETF draft RateLimit and RateLimit-Policy
+	// fields, plus RateLimit-Limit/-Remaining/-Reset) or "both"
+	Headers string
+
+	// HeaderPrefix replaces "X-RateLimit-" in the X-RateLimit-* header
+	// names, e.g. "X-Rate-Limit-" for a legacy header contract
+	HeaderPrefix string
+
+	// HeaderCase is how rate-limit header names are written: "canonical"
+	// (X-Ratelimit-Limit, Go's default), "lower" or "preserve" (exactly as
+	// HeaderPrefix and the IETF draft spell them)
+	HeaderCase string
+
+	// HeaderOmit lists the header values never sent: "limit", "remaining"
+	// and/or "reset"
+	HeaderOmit []string
+
+	// HeaderHideAnonymous sends no limit values to anonymous clients, those
+	// keyed by IP, TLS fingerprint, header, cookie or origin; their denials
+	// still carry Retry-After
+	HeaderHideAnonymous bool
+
+	// RetryAfterFormat is how Retry-After is written: "seconds" (delay) or
+	// "http-date" (RFC 9110 IMF-fixdate)
+	RetryAfterFormat string
+
+	// RetryAfterMax caps the Retry-After sent to clients, in seconds; 0
+	// disables the cap. JSON bodies still carry the uncapped delay.
+	RetryAfterMax int
+
+	// EscalationMax caps the backoff of escalating policies, in seconds; 0
+	// leaves only RetryAfterMax. A key never backs off for longer than
+	// either cap, however high its level.
+	EscalationMax int
+
+	// FailMode is what happens when the store is unreachable: "open" (allow)
+	// or "closed" (reject). Policies can override it.
+	FailMode string
+
+	// Fallback switches a failing Redis store to per-instance memory
+	// limiting until Redis answers again, instead of applying FailMode
+	Fallback bool
+
+	// FallbackRetry is how often Redis is pinged while degraded, in seconds
+	FallbackRetry int
+
 	// LogTableEnabled controls whether denied requests are logged to the database
 	LogTableEnabled bool
 
+	// LogLevel sets which decisions are logged: "quiet" (none), "deny"
+	// (denied requests) or "debug" (every decision)
+	LogLevel string
+
+	// BypassLocal exempts requests from loopback addresses from every limiter
+	BypassLocal bool
+
+	// ShadowScopes lists policy scopes whose limiters only observe: denials
+	// are logged and counted tagged "shadow", but nothing is blocked
+	ShadowScopes []string
+
+	// HashSecret keys the HMAC used to hash identifiers, tokens and headers in
+	// rate-limit keys; empty keeps the legacy unkeyed hash
+	HashSecret string
+
+	// HashMode is "hmac" (full-length HMAC-SHA256 when HashSecret is set) or
+	// "legacy" (truncated SHA-256, for compatibility with existing keys)
+	HashMode string
+
+	// Anonymize hashes whole keys (IPs included) before they reach the store,
+	// and the key and client IP written to the log table
+	Anonymize bool
+
+	// AnonymizeSecret derives the rotating salt; shared by all instances
+	AnonymizeSecret string
+
+	// AnonymizeRotate is how often the salt rotates, in seconds
+	AnonymizeRotate int
+
 	// --- Default policy values (used when no per-route policy is set) ---
 	DefaultLimit  int
 	DefaultWindow int // seconds
 	DefaultBurst  int
+
+	// --- Config file ---
+	ConfigFile     string          // YAML settings file; env vars override its values
+	Policies       json.RawMessage // named policies from the file, as JSON overrides by scope
+	AllowlistIPs   []string        // IPs and CIDR ranges no limiter limits; invalid entries are dropped
+	AllowlistPaths []string        // path prefixes no limiter limits
+
+	// --- Policy overrides file ---
+	PolicyFile        string // JSON or YAML policy overrides by scope, reloaded when it changes; empty disables
+	PolicyFileRefresh int    // seconds between checks of the file for changes
+
+	// --- Database policies ---
+	PolicyTableEnabled bool // read policy overrides from the rate_limit_policies table
+	PolicyTableTTL     int  // seconds the table is cached between reloads
+
+	// --- Per-key overrides ---
+	KeyOverrides    string // source of per-key limit overrides: "redis", "db" or empty (off)
+	KeyOverridesTTL int    // seconds the overrides are cached between reloads
+
+	// --- Emergency lockdown ---
+	Lockdown               bool // start in lockdown
+	LockdownFactor         int  // limits are divided by this during a lockdown
+	LockdownBlockAnonymous bool // reject anonymous (IP, fingerprint, header, cookie or origin keyed) requests during a lockdown
+	LockdownRedis          bool // follow the lockdown flag in Redis
+	LockdownRefresh        int  // seconds between checks of the Redis flag
+
+	// --- Connection-level protections ---
+	TLSHandshakeLimit         int // handshakes per peer IP per window; 0 disables
+	TLSHandshakeWindow        int // seconds
+	TLSHandshakeBurst         int
+	HTTP2MaxConcurrentStreams int // per-connection stream cap; 0 keeps the Go default
+
+	// --- Standalone daemon (cmd/ratelimitd) ---
+	DaemonAddr     string // listen address for the decision API
+	DaemonToken    string // bearer token required by the API; empty disables auth
+	DaemonPolicies string // extra "name=limit/window[/burst]" policies, comma-separated
+	DaemonTimeline int    // decisions kept per key for GET /v1/timeline; 0 disables
+	DaemonTuner    bool   // serve limit suggestions on /v1/tuner
+
+	// --- Slow-request protection and penalty box (WithPenaltyBox, WithAutoBan) ---
+	SlowHeaderTimeout int // seconds to receive request headers; 0 disables
+	SlowBodyTimeout   int // seconds to receive the request body; 0 disables
+	PenaltyStrikes    int // strikes within PenaltyWindow before a ban
+	PenaltyWindow     int // seconds
+	PenaltyBan        int // ban duration in seconds
+
+	// --- Greylisting (WithGreylist) ---
+	GreylistDelay    int // seconds a new key must wait before retrying
+	GreylistRemember int // seconds a key stays known after its last request
+
+	// --- Blocklist (NewBlocklistFromConfig) ---
+	BlocklistRefresh int // seconds between reloads of the blocklist entries
+
+	// TarpitMaxConns caps the denials held by tarpitting policies at once,
+	// across the process; further denials are answered at once. 0 disables
+	// tarpitting.
+	TarpitMaxConns int
+
+	// TarpitMaxKeys caps the keys whose denials the tarpit counts; denials
+	// of further keys are answered at once until old keys expire. 0 means
+	// no cap.
+	TarpitMaxKeys int
 }
 
 var RateLimit *RateLimitConfig
 
+// RateLimitReport lists every rate-limit setting with its effective value
+// and where it came from. Secrets are masked.
+var RateLimitReport []EnvEntry
+
+// initRateLimit reads the RATE_LIMIT_* settings. Malformed values never
+// abort startup: they are logged and replaced by their defaults. Durations
+// accept a bare number (seconds, or milliseconds for *_MS settings) or a
+// Go duration such as "90s", "5m" or "250ms".
 func initRateLimit() {
-	proxyStr := GetEnv("RATE_LIMIT_TRUSTED_PROXIES", "").(string)
-	var proxies []string
-	if proxyStr != "" {
-		for _, p := range splitCSV(proxyStr) {
-			proxies = append(proxies, p)
-		}
-	}
+	env, configFile, file := newRateLimitEnv()
+	preset := env.Enum("RATE_LIMIT_PRESET", "", "dev", "staging", "prod")
+	env.preset = rateLimitPresets[preset]
+
+	redisPrefix := env.String("RATE_LIMIT_REDIS_PREFIX", "gohst:rl:")
 
 	RateLimit = &RateLimitConfig{
-		Enabled:               GetEnv("RATE_LIMIT_ENABLED", true).(bool),
-		Store:                 GetEnv("RATE_LIMIT_STORE", "memory").(string),
-		RedisPrefix:           GetEnv("RATE_LIMIT_REDIS_PREFIX", "gohst:rl:").(string),
-		DefaultResponseFormat: GetEnv("RATE_LIMIT_RESPONSE_FORMAT", "json").(string),
-		LogTableEnabled:       GetEnv("RATE_LIMIT_LOG_TABLE", false).(bool),
-		DefaultLimit:          GetEnv("RATE_LIMIT_DEFAULT_LIMIT", 300).(int),
-		DefaultWindow:         GetEnv("RATE_LIMIT_DEFAULT_WINDOW", 60).(int),
-		DefaultBurst:          GetEnv("RATE_LIMIT_DEFAULT_BURST", 60).(int),
-		TrustedProxies:        proxies,
+		Enabled:               env.Bool("RATE_LIMIT_ENABLED", true),
+		Store:                 env.Enum("RATE_LIMIT_STORE", "memory", "memory", "redis", "tiered", "gossip"),
+		TieredSyncMs:          env.Millis("RATE_LIMIT_TIERED_SYNC_MS", 250),
+		MemoryMaxKeys:         env.Int("RATE_LIMIT_MEMORY_MAX_KEYS", 100000),
+		DenyCacheMinRetry:     env.Seconds("RATE_LIMIT_DENY_CACHE_MIN_RETRY", 0),
+		DenyCacheTTL:          env.Seconds("RATE_LIMIT_DENY_CACHE_TTL", 30),
+		RedisPrefix:           redisPrefix,
+		RedisTimeoutMs:        env.Millis("RATE_LIMIT_REDIS_TIMEOUT_MS", 100),
+		DefaultResponseFormat: env.Enum("RATE_LIMIT_RESPONSE_FORMAT", "json", "json", "html"),
+		FailMode:              env.Enum("RATE_LIMIT_FAIL_MODE", "open", "open", "closed"),
+		LogTableEnabled:       env.Bool("RATE_LIMIT_LOG_TABLE", false),
+		HashSecret:            env.Secret("RATE_LIMIT_HASH_SECRET", ""),
+		HashMode:              env.Enum("RATE_LIMIT_HASH_MODE", "hmac", "hmac", "legacy"),
+		Anonymize:             env.Bool("RATE_LIMIT_ANONYMIZE", false),
+		AnonymizeSecret:       env.Secret("RATE_LIMIT_ANONYMIZE_SECRET", ""),
+		AnonymizeRotate:       env.Seconds("RATE_LIMIT_ANONYMIZE_ROTATE", 86400),
+		DefaultLimit:          env.Int("RATE_LIMIT_DEFAULT_LIMIT", 300),
+		DefaultWindow:         env.Seconds("RATE_LIMIT_DEFAULT_WINDOW", 60),
+		DefaultBurst:          env.Int("RATE_LIMIT_DEFAULT_BURST", 60),
+		PolicyFile:            env.String("RATE_LIMIT_POLICY_FILE", ""),
+		PolicyFileRefresh:     env.Seconds("RATE_LIMIT_POLICY_FILE_REFRESH", 5),
+		PolicyTableEnabled:    env.Bool("RATE_LIMIT_POLICY_TABLE", false),
+		PolicyTableTTL:        env.Seconds("RATE_LIMIT_POLICY_TABLE_TTL", 10),
+		TrustedProxies:        env.List("RATE_LIMIT_TRUSTED_PROXIES"),
+		ClientIPHeaders:       env.List("RATE_LIMIT_CLIENT_IP_HEADERS"),
+		TrustedHops:           env.Int("RATE_LIMIT_TRUSTED_HOPS", 0),
+		ForwardedSkip:         env.List("RATE_LIMIT_FORWARDED_SKIP"),
+		ProxyRanges:           env.List("RATE_LIMIT_PROXY_RANGES"),
+		ProxyRangesRefresh:    env.Seconds("RATE_LIMIT_PROXY_RANGES_REFRESH", 86400),
+		ProxyRangesCache:      env.String("RATE_LIMIT_PROXY_RANGES_CACHE", ""),
+
+		Headers:      env.Enum("RATE_LIMIT_HEADERS", "x-ratelimit", "x-ratelimit", "ietf", "both"),
+		DenyTemplate: env.String("RATE_LIMIT_DENY_TEMPLATE", ""),
+
+		HeaderPrefix:        env.String("RATE_LIMIT_HEADER_PREFIX", "X-RateLimit-"),
+		HeaderCase:          env.Enum("RATE_LIMIT_HEADER_CASE", "canonical", "canonical", "lower", "preserve"),
+		HeaderOmit:          env.List("RATE_LIMIT_HEADER_OMIT"),
+		HeaderHideAnonymous: env.Bool("RATE_LIMIT_HEADER_HIDE_ANONYMOUS", false),
+
+		RetryAfterFormat: env.Enum("RATE_LIMIT_RETRY_AFTER_FORMAT", "seconds", "seconds", "http-date"),
+		RetryAfterMax:    env.Seconds("RATE_LIMIT_RETRY_AFTER_MAX", 0),
+		EscalationMax:    env.Seconds("RATE_LIMIT_ESCALATION_MAX", 86400),
+
+		Fallback:      env.Bool("RATE_LIMIT_FALLBACK", false),
+		FallbackRetry: env.Seconds("RATE_LIMIT_FALLBACK_RETRY", 5),
+
+		Preset:      preset,
+		LogLevel:    env.Enum("RATE_LIMIT_LOG_LEVEL", "deny", "quiet", "deny", "debug"),
+		BypassLocal: env.Bool("RATE_LIMIT_BYPASS_LOCAL", false),
+
+		ShadowScopes: env.List("RATE_LIMIT_SHADOW_SCOPES"),
+
+		ConfigFile:     configFile,
+		AllowlistIPs:   env.List("RATE_LIMIT_ALLOWLIST_IPS"),
+		AllowlistPaths: env.List("RATE_LIMIT_ALLOWLIST_PATHS"),
+
+		KeyOverrides:    env.Enum("RATE_LIMIT_KEY_OVERRIDES", "", "redis", "db"),
+		KeyOverridesTTL: env.Seconds("RATE_LIMIT_KEY_OVERRIDES_TTL", 30),
+
+		Lockdown:               env.Bool("RATE_LIMIT_LOCKDOWN", false),
+		LockdownFactor:         env.Int("RATE_LIMIT_LOCKDOWN_FACTOR", 4),
+		LockdownBlockAnonymous: env.Bool("RATE_LIMIT_LOCKDOWN_BLOCK_ANONYMOUS", false),
+		LockdownRedis:          env.Bool("RATE_LIMIT_LOCKDOWN_REDIS", false),
+		LockdownRefresh:        env.Seconds("RATE_LIMIT_LOCKDOWN_REFRESH", 5),
+
+		TLSHandshakeLimit:         env.Int("RATE_LIMIT_TLS_HANDSHAKE_LIMIT", 0),
+		TLSHandshakeWindow:        env.Seconds("RATE_LIMIT_TLS_HANDSHAKE_WINDOW", 60),
+		TLSHandshakeBurst:         env.Int("RATE_LIMIT_TLS_HANDSHAKE_BURST", 10),
+		HTTP2MaxConcurrentStreams: env.Int("RATE_LIMIT_HTTP2_MAX_STREAMS", 0),
+
+		LatencyBudgetMs:      env.Millis("RATE_LIMIT_LATENCY_BUDGET_MS", 0),
+		LatencyBudgetSustain: env.Seconds("RATE_LIMIT_LATENCY_BUDGET_SUSTAIN", 30),
+		LatencyBudgetMode:    env.Enum("RATE_LIMIT_LATENCY_BUDGET_MODE", "local", "local", "bypass"),
+
+		MigrateFrom:       env.Enum("RATE_LIMIT_MIGRATE_FROM", "", "memory", "redis", "tiered", "gossip"),
+		MigrateFromPrefix: env.String("RATE_LIMIT_MIGRATE_FROM_PREFIX", ""),
+		MigrateRead:       env.Enum("RATE_LIMIT_MIGRATE_READ", "new", "new", "old"),
+
+		MemorySnapshotPath:     env.String("RATE_LIMIT_MEMORY_SNAPSHOT_PATH", ""),
+		MemorySnapshotInterval: env.Seconds("RATE_LIMIT_MEMORY_SNAPSHOT_INTERVAL", 30),
+
+		GossipBind:       env.String("RATE_LIMIT_GOSSIP_BIND", ":7946"),
+		GossipPeers:      env.List("RATE_LIMIT_GOSSIP_PEERS"),
+		GossipIntervalMs: env.Millis("RATE_LIMIT_GOSSIP_INTERVAL_MS", 200),
+		GossipSecret:     env.Secret("RATE_LIMIT_GOSSIP_SECRET", ""),
+
+		DaemonAddr:     env.String("RATE_LIMIT_DAEMON_ADDR", ":7070"),
+		DaemonToken:    env.Secret("RATE_LIMIT_DAEMON_TOKEN", ""),
+		DaemonPolicies: env.String("RATE_LIMIT_DAEMON_POLICIES", ""),
+		DaemonTimeline: env.Int("RATE_LIMIT_DAEMON_TIMELINE", 0),
+		DaemonTuner:    env.Bool("RATE_LIMIT_DAEMON_TUNER", false),
+
+		SlowHeaderTimeout: env.Seconds("RATE_LIMIT_SLOW_HEADER_TIMEOUT", 10),
+		SlowBodyTimeout:   env.Seconds("RATE_LIMIT_SLOW_BODY_TIMEOUT", 30),
+		PenaltyStrikes:    env.Int("RATE_LIMIT_PENALTY_STRIKES", 5),
+		PenaltyWindow:     env.Seconds("RATE_LIMIT_PENALTY_WINDOW", 300),
+		PenaltyBan:        env.Seconds("RATE_LIMIT_PENALTY_BAN", 900),
+
+		GreylistDelay:    env.Seconds("RATE_LIMIT_GREYLIST_DELAY", 5),
+		GreylistRemember: env.Seconds("RATE_LIMIT_GREYLIST_REMEMBER", 86400),
+
+		BlocklistRefresh: env.Seconds("RATE_LIMIT_BLOCKLIST_REFRESH", 10),
+
+		TarpitMaxConns: env.Int("RATE_LIMIT_TARPIT_MAX_CONNS", 100),
+		TarpitMaxKeys:  env.Int("RATE_LIMIT_TARPIT_MAX_KEYS", 100000),
 		Redis: &RedisConfig{
-			DB:       GetEnv("RATE_LIMIT_REDIS_DB", 0).(int),
-			Host:     GetEnv("RATE_LIMIT_REDIS_HOST", GetEnv("SESSION_REDIS_HOST", "localhost").(string)).(string),
-			Password: GetEnv("RATE_LIMIT_REDIS_PASSWORD", GetEnv("SESSION_REDIS_PASSWORD", "").(string)).(string),
-			Port:     GetEnv("RATE_LIMIT_REDIS_PORT", GetEnv("SESSION_REDIS_PORT", 6379).(int)).(int),
+			DB:       env.Int("RATE_LIMIT_REDIS_DB", 0),
+			Host:     env.String("RATE_LIMIT_REDIS_HOST", env.String("SESSION_REDIS_HOST", "localhost")),
+			Password: env.Secret("RATE_LIMIT_REDIS_PASSWORD", env.Secret("SESSION_REDIS_PASSWORD", "")),
+			Port:     env.Int("RATE_LIMIT_REDIS_PORT", env.Int("SESSION_REDIS_PORT", 6379)),
+			Username: env.String("RATE_LIMIT_REDIS_USERNAME", ""),
+			TLS:      rateLimitRedisTLS(env),
 		},
 	}
+
+	if RateLimit.DefaultWindow == 0 {
+		log.Println("[config] RATE_LIMIT_DEFAULT_WINDOW must be positive; using 60s")
+		RateLimit.DefaultWindow = 60
+	}
+	if RateLimit.LockdownFactor < 1 {
+		log.Println("[config] RATE_LIMIT_LOCKDOWN_FACTOR must be at least 1; using 4")
+		RateLimit.LockdownFactor = 4
+	}
+	if RateLimit.TLSHandshakeWindow == 0 {
+		log.Println("[config] RATE_LIMIT_TLS_HANDSHAKE_WINDOW must be positive; using 60s")
+		RateLimit.TLSHandshakeWindow = 60
+	}
+	RateLimit.AllowlistIPs = validIPEntries("RATE_LIMIT_ALLOWLIST_IPS", RateLimit.AllowlistIPs)
+	for i, field := range RateLimit.HeaderOmit {
+		field = strings.ToLower(field)
+		RateLimit.HeaderOmit[i] = field
+		if field != "limit" && field != "remaining" && field != "reset" {
+			log.Printf("[config] RATE_LIMIT_HEADER_OMIT: unknown header %q (want limit, remaining or reset)", field)
+		}
+	}
+
+	if from := RateLimit.MigrateFrom; redisBacked(from) {
+		switch prefix := RateLimit.MigrateFromPrefix; {
+		case prefix == "":
+			log.Printf("[config] RATE_LIMIT_MIGRATE_FROM=%s needs RATE_LIMIT_MIGRATE_FROM_PREFIX; migration disabled", from)
+			RateLimit.MigrateFrom = ""
+		case prefix == RateLimit.RedisPrefix && redisBacked(RateLimit.Store):
+			log.Println("[config] RATE_LIMIT_MIGRATE_FROM_PREFIX equals RATE_LIMIT_REDIS_PREFIX; migration disabled")
+			RateLimit.MigrateFrom = ""
+		}
+	}
+
+	if file != nil {
+		RateLimit.Policies = file.policies
+		for _, key := range file.unusedKeys(env) {
+			log.Printf("[config] unknown or unused setting %s in %s", key, configFile)
+		}
+	}
+
+	RateLimitReport = env.Entries()
+	env.LogReport("rate limit")
+}
+
+// redisBacked reports whether the store kind keeps its buckets in Redis.
+func redisBacked(kind string) bool {
+	return kind == "redis" || kind == "tiered"
+}
+
+// validIPEntries returns the entries that are an IP or a CIDR range,
+// logging the others.
+func validIPEntries(name string, entries []string) []string {
+	valid := entries[:0]
+	for _, e := range entries {
+		if _, err := netip.ParsePrefix(e); err != nil {
+			if _, err := netip.ParseAddr(e); err != nil {
+				log.Printf("[config] %s: ignoring %q (want an IP or CIDR)", name, e)
+				continue
+			}
+		}
+		valid = append(valid, e)
+	}
+	return valid
+}
+
+// newRateLimitEnv returns a reader over the environment and the rate-limit
+// config file, with the path of the file and its contents, if any.
+func newRateLimitEnv() (*EnvReader, string, *rateLimitFile) {
+	env := &EnvReader{}
+	configFile := env.String("RATE_LIMIT_CONFIG_FILE", defaultRateLimitFile)
+	file, err := loadRateLimitFile(configFile, os.Getenv("RATE_LIMIT_CONFIG_FILE") != "")
+	if err != nil {
+		log.Printf("[config] ignoring rate limit config file %s: %v", configFile, err)
+	}
+	if file != nil {
+		env.file = file.settings
+	}
+	return env, configFile, file
+}
+
+// ReadTrustedProxies reads RATE_LIMIT_TRUSTED_PROXIES again, from the
+// environment or the current contents of the config file, without
+// reloading any other setting.
+func ReadTrustedProxies() []string {
+	env, _, _ := newRateLimitEnv()
+	return env.List("RATE_LIMIT_TRUSTED_PROXIES")
+}
+
+// rateLimitRedisTLS reads the RATE_LIMIT_REDIS_TLS_* settings. It returns nil
+// when TLS is disabled so callers can treat a nil config as plain TCP.
+func rateLimitRedisTLS(env *EnvReader) *TLSConfig {
+	if !env.Bool("RATE_LIMIT_REDIS_TLS", false) {
+		return nil
+	}
+	return &TLSConfig{
+		CAFile:             env.String("RATE_LIMIT_REDIS_TLS_CA_FILE", ""),
+		CertFile:           env.String("RATE_LIMIT_REDIS_TLS_CERT_FILE", ""),
+		KeyFile:            env.String("RATE_LIMIT_REDIS_TLS_KEY_FILE", ""),
+		ServerName:         env.String("RATE_LIMIT_REDIS_TLS_SERVER_NAME", ""),
+		InsecureSkipVerify: env.Bool("RATE_LIMIT_REDIS_TLS_INSECURE", false),
+	}
 }
 
 // splitCSV is a small helper to split a comma-separated string
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultRateLimitFile is read from the working directory when
+// RATE_LIMIT_CONFIG_FILE is not set.
+const defaultRateLimitFile = "ratelimit.yaml"
+
+// rateLimitFile is a parsed rate-limit config file.
+type rateLimitFile struct {
+	// settings holds every scalar or list of the file by the env name it
+	// stands for: redis.host is RATE_LIMIT_REDIS_HOST.
+	settings map[string]string
+	// policies is the "policies" block as a JSON object of overrides.
+	policies json.RawMessage
+}
+
+// loadRateLimitFile reads the rate-limit config file at path. A missing
+// file returns nil, and an error only when it was asked for explicitly.
+func loadRateLimitFile(path string, explicit bool) (*rateLimitFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &rateLimitFile{settings: make(map[string]string)}
+	if p, ok := doc["policies"]; ok {
+		if _, isMap := p.(map[string]any); !isMap && p != nil {
+			return nil, fmt.Errorf("policies: want a mapping of scope to policy")
+		}
+		if f.policies, err = json.Marshal(p); err != nil {
+			return nil, fmt.Errorf("policies: %w", err)
+		}
+		delete(doc, "policies")
+	}
+	if err := flattenRateLimitFile("RATE_LIMIT", doc, f.settings); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// flattenRateLimitFile stores every value below v under its env name.
+// Lists of scalars are joined with commas, as in the environment.
+func flattenRateLimitFile(name string, v any, out map[string]string) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+			if err := flattenRateLimitFile(name+"_"+key, child, out); err != nil {
+				return err
+			}
+		}
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, ok := yamlScalarString(item)
+			if !ok {
+				return fmt.Errorf("%s: lists may only hold scalars", name)
+			}
+			parts[i] = s
+		}
+		out[name] = strings.Join(parts, ",")
+	default:
+		s, _ := yamlScalarString(v)
+		out[name] = s
+	}
+	return nil
+}
+
+func yamlScalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// unusedKeys returns the file settings no reader asked for, sorted.
+func (f *rateLimitFile) unusedKeys(e *EnvReader) []string {
+	read := make(map[string]bool, len(e.entries))
+	for _, entry := range e.entries {
+		read[entry.Key] = true
+	}
+	var unused []string
+	for key := range f.settings {
+		if !read[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
@@ -0,0 +1,32 @@
+package config
+
+// rateLimitPresets are the defaults selected by RATE_LIMIT_PRESET, by env
+// name. They only replace built-in defaults: the environment and the config
+// file still override every one of them.
+var rateLimitPresets = map[string]map[string]string{
+	// dev runs on one machine without Redis, logs every decision and never
+	// limits requests from localhost.
+	"dev": {
+		"RATE_LIMIT_STORE":        "memory",
+		"RATE_LIMIT_FAIL_MODE":    "open",
+		"RATE_LIMIT_LOG_LEVEL":    "debug",
+		"RATE_LIMIT_BYPASS_LOCAL": "true",
+	},
+	// staging matches prod, so limits behave the same before a release.
+	"staging": {
+		"RATE_LIMIT_STORE":        "redis",
+		"RATE_LIMIT_FAIL_MODE":    "open",
+		"RATE_LIMIT_FALLBACK":     "true",
+		"RATE_LIMIT_LOG_LEVEL":    "deny",
+		"RATE_LIMIT_BYPASS_LOCAL": "false",
+	},
+	// prod shares buckets across instances in Redis, and limits per instance
+	// while Redis is down.
+	"prod": {
+		"RATE_LIMIT_STORE":        "redis",
+		"RATE_LIMIT_FAIL_MODE":    "open",
+		"RATE_LIMIT_FALLBACK":     "true",
+		"RATE_LIMIT_LOG_LEVEL":    "deny",
+		"RATE_LIMIT_BYPASS_LOCAL": "false",
+	},
+}
@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestInitRateLimit_MigrateFromPrefix(t *testing.T) {
+	tests := []struct {
+		name, store, from, prefix string
+		want                      string
+	}{
+		{"memory to redis", "redis", "memory", "", "memory"},
+		{"redis without a prefix", "redis", "redis", "", ""},
+		{"redis to the same prefix", "redis", "redis", "gohst:rl:", ""},
+		{"tiered to the same prefix", "tiered", "redis", "gohst:rl:", ""},
+		{"redis to a new prefix", "redis", "redis", "gohst:old:", "redis"},
+		{"redis to memory", "memory", "redis", "gohst:rl:", "redis"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_STORE", tt.store)
+			t.Setenv("RATE_LIMIT_REDIS_PREFIX", "gohst:rl:")
+			t.Setenv("RATE_LIMIT_MIGRATE_FROM", tt.from)
+			t.Setenv("RATE_LIMIT_MIGRATE_FROM_PREFIX", tt.prefix)
+			initRateLimit()
+			if got := RateLimit.MigrateFrom; got != tt.want {
+				t.Errorf("expected MigrateFrom %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -9,6 +9,17 @@ type RedisConfig struct {
 	Host 		string
 	Password 	string
 	Port 		int
+	Username 	string		// ACL username (Redis 6+); empty uses the default user
+	TLS 		*TLSConfig	// nil disables TLS
+}
+
+// TLSConfig holds client-side TLS settings for outbound connections.
+type TLSConfig struct {
+	CAFile 				string	// PEM bundle used to verify the server; empty uses system roots
+	CertFile 			string	// client certificate for mutual TLS (optional)
+	KeyFile 			string	// client private key for mutual TLS (optional)
+	ServerName 			string	// overrides SNI / verification hostname
+	InsecureSkipVerify 	bool	// disables server verification (never use in production)
 }
 
 type SessionConfig struct {
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseYAML parses a YAML document in the subset parseYAML supports, for
+// other packages' config files.
+func ParseYAML(data []byte) (map[string]any, error) {
+	return parseYAML(data)
+}
+
+// parseYAML parses the subset of YAML used by config files: mappings and
+// sequences nested by indentation, flow sequences ([a, b]) and flow
+// mappings ({a: 1, b: x}) of scalars, quoted and plain scalars, and
+// comments. Anchors, tags, multi-line strings and multiple documents are
+// not supported.
+func parseYAML(data []byte) (map[string]any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	p := &yamlParser{lines: lines}
+	out, err := p.mapping(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return out, nil
+}
+
+type yamlLine struct {
+	num, indent int
+	text        string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.lines[p.pos].num, fmt.Sprintf(format, args...))
+}
+
+// nested parses the block below a "key:" or "-" line, or returns nil when
+// there is none.
+func (p *yamlParser) nested(parent int) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if isYAMLItem(next.text) && next.indent >= parent {
+		return p.sequence(next.indent)
+	}
+	if next.indent > parent {
+		return p.mapping(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	out := make(map[string]any)
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || isYAMLItem(l.text) {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := cutYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf("want key: value, got %q", l.text)
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		var (
+			v   any
+			err error
+		)
+		if rest == "" {
+			v, err = p.nested(indent)
+		} else {
+			v, err = parseYAMLValue(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	var out []any
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || !isYAMLItem(l.text) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		var (
+			v   any
+			err error
+		)
+		switch _, _, isKey := cutYAMLKey(item); {
+		case item == "":
+			p.pos++
+			v, err = p.nested(indent + 1)
+		case isKey:
+			// "- key: value" starts a mapping indented past the dash.
+			p.lines[p.pos] = yamlLine{num: l.num, indent: indent + len(l.text) - len(item), text: item}
+			v, err = p.mapping(p.lines[p.pos].indent)
+		default:
+			p.pos++
+			v, err = parseYAMLValue(item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// cutYAMLKey splits "key: value". Keys are plain words (letters, digits,
+// "_", "-", ".") or quoted.
+func cutYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, rest = text[1:end+1], text[end+2:]
+	} else {
+		i := strings.IndexByte(text, ':')
+		if i <= 0 {
+			return "", "", false
+		}
+		key, rest = text[:i], text[i:]
+		for _, c := range key {
+			if !(c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return "", "", false
+			}
+		}
+	}
+	if rest != ":" && !strings.HasPrefix(rest, ": ") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest[1:]), true
+}
+
+func parseYAMLValue(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", s)
+		}
+		parts, err := splitYAMLFlow(s[1 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%v in %q", err, s)
+		}
+		var out []any
+		for _, part := range parts {
+			v, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case strings.HasPrefix(s, "{"):
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("unterminated flow mapping %q", s)
+		}
+		parts, err := splitYAMLFlow(s[1 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%v in %q", err, s)
+		}
+		out := make(map[string]any)
+		for _, part := range parts {
+			key, rest, ok := cutYAMLKey(part)
+			if !ok {
+				return nil, fmt.Errorf("want key: value in %q", s)
+			}
+			v, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+		return out, nil
+	}
+	return parseYAMLScalar(s)
+}
+
+// splitYAMLFlow splits the inside of a flow collection at commas outside
+// quotes. One trailing comma is allowed; empty entries are not. Nested
+// collections are not supported.
+func splitYAMLFlow(s string) ([]string, error) {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++ // skip the escaped character
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (strings.TrimSpace(s[start:i]) == "" || strings.HasSuffix(s[start:i], ": ")):
+			quote = c
+		case c == ',':
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("empty entry")
+		}
+	}
+	return parts, nil
+}
+
+func parseYAMLScalar(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s == "" || s == "~" || s == "null":
+		return nil, nil
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes a "#" comment that starts the line or follows a
+// space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++ // skip the escaped character
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" :[{,-", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "empty",
+			in:   "# only a comment\n---\n",
+			want: map[string]any{},
+		},
+		{
+			name: "block mappings",
+			in: `
+rate_limit:
+  store: redis
+  redis:
+    host: cache.internal
+    port: 6380
+  enabled: true
+  ratio: 0.5
+  missing:
+`,
+			want: map[string]any{"rate_limit": map[string]any{
+				"store":   "redis",
+				"redis":   map[string]any{"host": "cache.internal", "port": int64(6380)},
+				"enabled": true,
+				"ratio":   0.5,
+				"missing": nil,
+			}},
+		},
+		{
+			name: "block sequences",
+			in: `
+proxies:
+  - 10.0.0.0/8
+  - "192.168.0.0/16"
+policies:
+  - name: login
+    limit: 5
+  - name: api
+    limit: 100
+unindented:
+- a
+- b
+`,
+			want: map[string]any{
+				"proxies": []any{"10.0.0.0/8", "192.168.0.0/16"},
+				"policies": []any{
+					map[string]any{"name": "login", "limit": int64(5)},
+					map[string]any{"name": "api", "limit": int64(100)},
+				},
+				"unindented": []any{"a", "b"},
+			},
+		},
+		{
+			name: "flow collections",
+			in: `
+list: [a, 2, "c, d", 'e']
+trailing: [a, b,]
+empty: []
+map: {limit: 5, window: 60s, name: "x, y"}
+map_trailing: {a: 1,}
+`,
+			want: map[string]any{
+				"list":         []any{"a", int64(2), "c, d", "e"},
+				"trailing":     []any{"a", "b"},
+				"empty":        []any(nil),
+				"map":          map[string]any{"limit": int64(5), "window": "60s", "name": "x, y"},
+				"map_trailing": map[string]any{"a": int64(1)},
+			},
+		},
+		{
+			name: "quoting",
+			in: `
+double: "a \"quoted\" # value"
+single: 'it''s'
+"quoted key": 1
+plain: true story
+null_a: ~
+null_b: null
+`,
+			want: map[string]any{
+				"double":     `a "quoted" # value`,
+				"single":     "it's",
+				"quoted key": int64(1),
+				"plain":      "true story",
+				"null_a":     nil,
+				"null_b":     nil,
+			},
+		},
+		{
+			name: "comments",
+			in: `
+# heading
+a: 1 # trailing
+b: x#not-a-comment
+c: "#kept"
+`,
+			want: map[string]any{"a": int64(1), "b": "x#not-a-comment", "c": "#kept"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAML_Malformed(t *testing.T) {
+	tests := []struct {
+		name, in, wantErr string
+	}{
+		{"tab indentation", "a:\n\tb: 1\n", "tabs"},
+		{"not a mapping", "just a scalar\n", "want key: value"},
+		{"duplicate key", "a: 1\na: 2\n", "duplicate key"},
+		{"over-indented", "a: 1\n  b: 2\n", "unexpected indentation"},
+		{"unterminated sequence", "a: [1, 2\n", "unterminated flow sequence"},
+		{"unterminated mapping", "a: {b: 1\n", "unterminated flow mapping"},
+		{"empty flow entry", "a: [1,, 2]\n", "empty entry"},
+		{"lone comma", "a: {,}\n", "empty entry"},
+		{"flow entry without key", "a: {1}\n", "want key: value"},
+		{"bad quoted string", `a: "x\q"` + "\n", "invalid quoted string"},
+		{"unclosed single quote", "a: 'x\n", "invalid quoted string"},
+		{"item in mapping", "a: 1\n- b\n", "unexpected indentation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
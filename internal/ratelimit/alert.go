@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Alert throttling
+// ──────────────────────────────────────────────
+
+// DefaultAlertInterval is how often one alert may fire when
+// NewAlertThrottle is given no interval.
+const DefaultAlertInterval = 10 * time.Minute
+
+// AlertThrottle deduplicates the limiter's own notifications: each alert
+// key ("scope X under attack") is delivered at most once per interval, so
+// an attack or a flapping store pages the on-call once instead of on every
+// request. Alerts are charged like requests, to "alert:<key>" buckets in a
+// Store; with a shared store the interval holds across instances.
+//
+// Alert keys should be low-cardinality, such as a scope name: the counts
+// of suppressed alerts are kept per key, per instance.
+type AlertThrottle struct {
+	store  Store
+	policy Policy
+
+	mu         sync.Mutex
+	suppressed map[string]int
+}
+
+// NewAlertThrottle creates a throttle allowing one alert per key per every
+// (DefaultAlertInterval when every <= 0). store may be nil for a
+// per-instance memory store.
+func NewAlertThrottle(store Store, every time.Duration) *AlertThrottle {
+	if every <= 0 {
+		every = DefaultAlertInterval
+	}
+	if store == nil {
+		store = NewMemoryStore(every)
+	}
+	return &AlertThrottle{
+		store:      store,
+		policy:     Policy{Limit: 1, Window: every, Scope: "alert", Enabled: true, Cost: 1},
+		suppressed: make(map[string]int),
+	}
+}
+
+// Notify calls send unless an alert for key was delivered within the
+// interval, passing how many alerts for key were suppressed since the last
+// delivery. It reports whether send was called. Store errors deliver the
+// alert: a duplicate page is better than a missed one.
+func (a *AlertThrottle) Notify(ctx context.Context, key string, send func(suppressed int)) bool {
+	res := a.store.Allow(ctx, "alert:"+key, a.policy, 1)
+	a.mu.Lock()
+	if res.Err == nil && !res.Allowed {
+		a.suppressed[key]++
+		a.mu.Unlock()
+		return false
+	}
+	n := a.suppressed[key]
+	delete(a.suppressed, key)
+	a.mu.Unlock()
+
+	if res.Err != nil {
+		log.Printf("[ratelimit] alert throttle store error key=%s, delivering: %v", key, res.Err)
+	}
+	send(n)
+	return true
+}
+
+// BudgetEvents wraps a BudgetStore event handler (nil for the default log
+// line). Trips and recoveries of each scope are throttled separately, so a
+// recovery is not swallowed by the trip before it.
+func (a *AlertThrottle) BudgetEvents(fn func(BudgetEvent)) func(BudgetEvent) {
+	if fn == nil {
+		fn = logBudgetEvent
+	}
+	return func(e BudgetEvent) {
+		key := "budget:" + e.Scope + ":" + strconv.FormatBool(e.Tripped)
+		a.Notify(context.Background(), key, func(suppressed int) {
+			logSuppressed(key, suppressed, a.policy.Window)
+			fn(e)
+		})
+	}
+}
+
+// SpoofEvents wraps a spoofed-header handler (see WithSpoofDetection) so it
+// fires at most once per interval per policy scope, however many forged
+// requests arrive. A nil fn logs the event.
+func (a *AlertThrottle) SpoofEvents(fn SpoofHandler) SpoofHandler {
+	if fn == nil {
+		fn = logSpoofEvent
+	}
+	return func(r *http.Request, ev SpoofEvent) {
+		key := "spoof:" + ev.Scope
+		a.Notify(r.Context(), key, func(suppressed int) {
+			logSuppressed(key, suppressed, a.policy.Window)
+			fn(r, ev)
+		})
+	}
+}
+
+func logSuppressed(key string, n int, window time.Duration) {
+	if n > 0 {
+		log.Printf("[ratelimit] alert %s: %d similar alerts suppressed within %s", key, n, window)
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlertThrottle_OncePerInterval(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	a := NewAlertThrottle(store, 0)
+
+	var sent []int
+	send := func(n int) { sent = append(sent, n) }
+	for i := 0; i < 5; i++ {
+		a.Notify(ctx, "scope:api", send)
+	}
+	if !a.Notify(ctx, "scope:other", send) {
+		t.Fatal("a different key should not be throttled")
+	}
+	if len(sent) != 2 || sent[0] != 0 {
+		t.Fatalf("expected one delivery per key, got %v", sent)
+	}
+
+	// Once the interval passes, the next delivery reports what was dropped.
+	if err := store.Reset("alert:scope:api"); err != nil {
+		t.Fatal(err)
+	}
+	a.Notify(ctx, "scope:api", send)
+	if len(sent) != 3 || sent[2] != 4 {
+		t.Fatalf("expected 4 suppressed alerts to be reported, got %v", sent)
+	}
+}
+
+func TestAlertThrottle_DeliversOnStoreError(t *testing.T) {
+	store := NewMockStore()
+	store.FailWith(errors.New("redis down"))
+	a := NewAlertThrottle(store, time.Minute)
+
+	n := 0
+	for i := 0; i < 3; i++ {
+		a.Notify(context.Background(), "k", func(int) { n++ })
+	}
+	if n != 3 {
+		t.Fatalf("expected every alert delivered while the store fails, got %d", n)
+	}
+}
+
+func TestAlertThrottle_Adapters(t *testing.T) {
+	a := NewAlertThrottle(nil, time.Minute)
+
+	var budget []BudgetEvent
+	onBudget := a.BudgetEvents(func(e BudgetEvent) { budget = append(budget, e) })
+	onBudget(BudgetEvent{Scope: "api", Tripped: true})
+	onBudget(BudgetEvent{Scope: "api", Tripped: true})
+	onBudget(BudgetEvent{Scope: "api", Tripped: false})
+	if len(budget) != 2 || !budget[0].Tripped || budget[1].Tripped {
+		t.Fatalf("expected one trip and one recovery, got %+v", budget)
+	}
+
+	spoofs := 0
+	onSpoof := a.SpoofEvents(func(*http.Request, SpoofEvent) { spoofs++ })
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 100; i++ {
+		onSpoof(r, SpoofEvent{Scope: "browse", PeerIP: "198.51.100.1"})
+	}
+	if spoofs != 1 {
+		t.Fatalf("expected one spoof alert, got %d", spoofs)
+	}
+}
@@ -1,9 +1,14 @@
 package ratelimit
 
 import (
-	"net"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gohst/internal/config"
 )
 
 // ──────────────────────────────────────────────
@@ -15,13 +20,77 @@ type AllowRule interface {
 	Matches(r *http.Request) bool
 }
 
+// AllowlistFromConfig returns the bypass rules of RATE_LIMIT_ALLOWLIST_IPS
+// and RATE_LIMIT_ALLOWLIST_PATHS (or the allowlist block of the config
+// file). Every limiter applies them already, like RATE_LIMIT_BYPASS_LOCAL;
+// use them to exempt the same clients elsewhere.
+func AllowlistFromConfig() ([]AllowRule, error) {
+	cfg := config.RateLimit
+	var rules []AllowRule
+	if len(cfg.AllowlistIPs) > 0 {
+		ips, err := NewBypassIPs(cfg.AllowlistIPs...)
+		if err != nil {
+			return nil, fmt.Errorf("allowlist: %w", err)
+		}
+		rules = append(rules, ips)
+	}
+	if len(cfg.AllowlistPaths) > 0 {
+		rules = append(rules, BypassPaths{Prefixes: cfg.AllowlistPaths})
+	}
+	return rules, nil
+}
+
+// allowlistCache is the allowlist compiled from one config.
+type allowlistCache struct {
+	cfg   *config.RateLimitConfig
+	rules []AllowRule
+}
+
+var (
+	allowlistMu       sync.Mutex
+	allowlistCompiled atomic.Pointer[allowlistCache]
+)
+
+// configAllowlist returns the rules of AllowlistFromConfig, compiled once
+// per config and then read without locking. Replace config.RateLimit,
+// rather than editing its lists, to change the allowlist at runtime.
+func configAllowlist() []AllowRule {
+	cfg := config.RateLimit
+	if cfg == nil {
+		return nil
+	}
+	if c := allowlistCompiled.Load(); c != nil && c.cfg == cfg {
+		return c.rules
+	}
+
+	allowlistMu.Lock()
+	defer allowlistMu.Unlock()
+	if c := allowlistCompiled.Load(); c != nil && c.cfg == cfg {
+		return c.rules
+	}
+	rules, err := AllowlistFromConfig()
+	if err != nil {
+		log.Printf("[ratelimit] ignoring the configured allowlist: %v", err)
+	}
+	allowlistCompiled.Store(&allowlistCache{cfg: cfg, rules: rules})
+	return rules
+}
+
+// configAllowed reports whether r matches the configured allowlist.
+func configAllowed(r *http.Request) bool {
+	for _, rule := range configAllowlist() {
+		if rule.Matches(r) {
+			return true
+		}
+	}
+	return false
+}
+
 // BypassLocalDev bypasses all requests from loopback addresses (127.0.0.1, ::1).
 type BypassLocalDev struct{}
 
-func (BypassLocalDev) Matches(r *http.Request) bool {
-	ip := ClientIP(r)
-	parsed := net.ParseIP(ip)
-	return parsed != nil && parsed.IsLoopback()
+func (b BypassLocalDev) Matches(r *http.Request) bool {
+	return b.MatchesIP(ClientIP(r))
 }
 
 // BypassPaths bypasses requests whose path has a given prefix (e.g. /healthz).
@@ -38,14 +107,26 @@ func (b BypassPaths) Matches(r *http.Request) bool {
 	return false
 }
 
-// BypassIPs bypasses requests from specific IPs or CIDRs.
+// BypassIPs bypasses requests from specific IPs or CIDRs. Prefer
+// NewBypassIPs, which validates and precompiles the list once; a struct
+// literal works too but parses Allowed on every request.
 type BypassIPs struct {
 	Allowed []string
+	set     *IPSet
+}
+
+// NewBypassIPs creates a BypassIPs rule with a precompiled IPSet, returning an
+// error for any invalid IP or CIDR.
+func NewBypassIPs(allowed ...string) (BypassIPs, error) {
+	set, err := ParseIPSet(allowed)
+	if err != nil {
+		return BypassIPs{}, err
+	}
+	return BypassIPs{Allowed: allowed, set: set}, nil
 }
 
 func (b BypassIPs) Matches(r *http.Request) bool {
-	ip := ClientIP(r)
-	return isTrusted(ip, b.Allowed)
+	return b.MatchesIP(ClientIP(r))
 }
 
 // BypassHeader bypasses requests that carry a specific header value,
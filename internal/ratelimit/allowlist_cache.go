@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Allowlist decision cache
+// ──────────────────────────────────────────────
+
+// IPRule is implemented by allow rules whose outcome depends only on the
+// client IP. Their decisions can be cached per IP; other rules (paths,
+// headers) are always evaluated per request.
+type IPRule interface {
+	AllowRule
+	MatchesIP(ip string) bool
+}
+
+// allowCacheMaxEntries bounds the cache; when full it is cleared wholesale,
+// which is cheap and keeps a spoofed-IP flood from growing it.
+const allowCacheMaxEntries = 10000
+
+// allowCache remembers, per client IP, whether any IPRule matched. Both
+// positive and negative outcomes are cached.
+type allowCache struct {
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]allowCacheEntry
+}
+
+type allowCacheEntry struct {
+	matched bool
+	expires time.Time
+}
+
+func newAllowCache(ttl time.Duration) *allowCache {
+	return &allowCache{ttl: ttl, entries: make(map[string]allowCacheEntry)}
+}
+
+// matchIP evaluates rules for ip, consulting the cache first.
+func (c *allowCache) matchIP(ip string, rules []IPRule) bool {
+	now := time.Now()
+	c.mu.RLock()
+	e, ok := c.entries[ip]
+	c.mu.RUnlock()
+	if ok && now.Before(e.expires) {
+		return e.matched
+	}
+
+	matched := false
+	for _, rule := range rules {
+		if rule.MatchesIP(ip) {
+			matched = true
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= allowCacheMaxEntries {
+		c.entries = make(map[string]allowCacheEntry)
+	}
+	c.entries[ip] = allowCacheEntry{matched: matched, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+	return matched
+}
+
+// WithAllowlistCache caches the outcome of IP-based allow rules (BypassIPs,
+// BypassLocalDev, …) per client IP for ttl, so large CIDR lists are not
+// re-evaluated on every request. Path and header rules are unaffected.
+func WithAllowlistCache(ttl time.Duration) Option {
+	return func(l *Limiter) { l.allowCache = newAllowCache(ttl) }
+}
+
+// bypassed reports whether r matches the configured allowlist, the
+// limiter's allowlist or one of its skip functions, or has a method the
+// limiter does not limit.
+func (l *Limiter) bypassed(r *http.Request) bool {
+	if !l.engages(r.Method) {
+		return true
+	}
+	if config.RateLimit.BypassLocal && (BypassLocalDev{}).Matches(r) {
+		return true
+	}
+	if configAllowed(r) {
+		return true
+	}
+	for _, skip := range l.skips {
+		if skip(r) {
+			return true
+		}
+	}
+	if l.allowCache == nil {
+		for _, rule := range l.allowlist {
+			if rule.Matches(r) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ipRules []IPRule
+	for _, rule := range l.allowlist {
+		if ir, ok := rule.(IPRule); ok {
+			ipRules = append(ipRules, ir)
+			continue
+		}
+		if rule.Matches(r) {
+			return true
+		}
+	}
+	if len(ipRules) == 0 {
+		return false
+	}
+	return l.allowCache.matchIP(ClientIP(r), ipRules)
+}
+
+// MatchesIP implements IPRule.
+func (BypassLocalDev) MatchesIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
+// MatchesIP implements IPRule.
+func (b BypassIPs) MatchesIP(ip string) bool {
+	if b.set != nil {
+		return b.set.Contains(ip)
+	}
+	return isTrusted(ip, b.Allowed)
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ──────────────────────────────────────────────
+// ASN keys
+// ──────────────────────────────────────────────
+
+// KeyTypeASN is the key type of per-ASN keys.
+const KeyTypeASN = "asn"
+
+// ASNInfo is the autonomous system an IP address belongs to.
+type ASNInfo struct {
+	Number uint32 // e.g. 16509
+	Org    string // e.g. "AMAZON-02"; informational only
+}
+
+// ASNResolver maps an IP address to its autonomous system. It is shaped
+// after the MaxMind GeoLite2-ASN reader. Lookups run on every request and
+// must be fast and safe for concurrent use.
+type ASNResolver interface {
+	LookupASN(ip net.IP) (ASNInfo, error)
+}
+
+// ASNResolverFunc adapts a function to ASNResolver.
+type ASNResolverFunc func(ip net.IP) (ASNInfo, error)
+
+// LookupASN implements ASNResolver.
+func (f ASNResolverFunc) LookupASN(ip net.IP) (ASNInfo, error) { return f(ip) }
+
+// errASNNotListed is returned by OnlyASNs for ASNs outside the list.
+var errASNNotListed = errors.New("ratelimit: ASN not listed")
+
+// OnlyASNs restricts resolver to the given ASNs: other addresses are
+// reported as unknown, so KeyByASN keys them with its fallback. Use it to
+// coarsen only cloud and hosting providers, not consumer ISPs.
+func OnlyASNs(resolver ASNResolver, numbers ...uint32) ASNResolver {
+	listed := make(map[uint32]struct{}, len(numbers))
+	for _, n := range numbers {
+		listed[n] = struct{}{}
+	}
+	return ASNResolverFunc(func(ip net.IP) (ASNInfo, error) {
+		info, err := resolver.LookupASN(ip)
+		if err != nil {
+			return ASNInfo{}, err
+		}
+		if _, ok := listed[info.Number]; !ok {
+			return ASNInfo{}, errASNNotListed
+		}
+		return info, nil
+	})
+}
+
+// ClientASN resolves the autonomous system of r's client IP (see
+// ClientIP). It returns ok=false when the IP is unknown to resolver.
+func ClientASN(r *http.Request, resolver ASNResolver) (ASNInfo, bool) {
+	ip := net.ParseIP(ClientIP(r))
+	if ip == nil {
+		return ASNInfo{}, false
+	}
+	info, err := resolver.LookupASN(ip)
+	if err != nil || info.Number == 0 {
+		return ASNInfo{}, false
+	}
+	return info, true
+}
+
+// KeyByASN keys every client in an autonomous system into one
+// "asn:<number>" bucket, so traffic from a cloud provider or botnet
+// operator is limited as a unit however many IPs it rotates through.
+// Unresolved clients use fallback, or KeyByIP when fallback is nil.
+func KeyByASN(resolver ASNResolver, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if info, ok := ClientASN(r, resolver); ok {
+			return "asn:" + strconv.FormatUint(uint64(info.Number), 10), KeyTypeASN
+		}
+		return fallback(r)
+	}
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// testASN puts 5.x.x.x in AS16509 and 6.x.x.x in AS7922.
+var testASN = ASNResolverFunc(func(ip net.IP) (ASNInfo, error) {
+	switch ip.To4()[0] {
+	case 5:
+		return ASNInfo{Number: 16509, Org: "AMAZON-02"}, nil
+	case 6:
+		return ASNInfo{Number: 7922, Org: "COMCAST-7922"}, nil
+	}
+	return ASNInfo{}, errors.New("not found")
+})
+
+func TestKeyByASN(t *testing.T) {
+	tests := []struct {
+		fn      KeyFunc
+		remote  string
+		key     string
+		keyType string
+	}{
+		{KeyByASN(testASN, nil), "5.1.1.1", "asn:16509", KeyTypeASN},
+		{KeyByASN(testASN, nil), "5.9.9.9", "asn:16509", KeyTypeASN},
+		{KeyByASN(testASN, nil), "9.1.1.1", "ip:9.1.1.1", KeyTypeIP},
+		{KeyByASN(OnlyASNs(testASN, 16509), nil), "5.1.1.1", "asn:16509", KeyTypeASN},
+		{KeyByASN(OnlyASNs(testASN, 16509), nil), "6.1.1.1", "ip:6.1.1.1", KeyTypeIP},
+	}
+	for _, tt := range tests {
+		if key, keyType := tt.fn(geoRequest(tt.remote)); key != tt.key || keyType != tt.keyType {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.remote, key, keyType, tt.key, tt.keyType)
+		}
+	}
+}
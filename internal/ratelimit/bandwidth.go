@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Response bandwidth
+// ──────────────────────────────────────────────
+
+// bandwidthChunk is the most bytes written per token check.
+const bandwidthChunk = 32 << 10
+
+// BandwidthLimiter throttles response bodies per key, for download and
+// large-file routes where fairness is about bytes rather than requests.
+// The policy counts bytes: Limit bytes per Window, plus Burst. Buckets are
+// "bw:<key>" in the same stores as request limits, so every response of a
+// key, on any instance, shares one allowance.
+//
+// Writes block until the bucket can pay for them, and fail once the
+// client goes away. Store errors fail open.
+type BandwidthLimiter struct {
+	store   Store
+	policy  Policy
+	keyFunc KeyFunc
+}
+
+// NewBandwidthLimiter creates a BandwidthLimiter, e.g. 1 MiB/s per user:
+//
+//	ratelimit.NewBandwidthLimiter(store, ratelimit.Policy{
+//		Limit: 1 << 20, Window: time.Second, Scope: "downloads", Enabled: true,
+//	}, ratelimit.KeyByUserElseIP())
+//
+// It panics if policy fails Policy.Validate.
+func NewBandwidthLimiter(store Store, policy Policy, keyFunc KeyFunc) *BandwidthLimiter {
+	if err := policy.Validate(); err != nil {
+		panic("ratelimit: " + err.Error())
+	}
+	return &BandwidthLimiter{store: store, policy: policy, keyFunc: keyFunc}
+}
+
+// Middleware returns an http middleware throttling response bodies.
+func (b *BandwidthLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.RateLimit.Enabled || !b.policy.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, _ := b.keyFunc(r)
+		next.ServeHTTP(&throttledWriter{ResponseWriter: w, ctx: r.Context(), limiter: b, key: "bw:" + key}, r)
+	})
+}
+
+// throttledWriter is a ResponseWriter whose body is paid for in tokens.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *BandwidthLimiter
+	key     string
+}
+
+// Write writes p in chunks the bucket can pay for, waiting between them.
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	chunk := min(bandwidthChunk, t.limiter.policy.Limit+t.limiter.policy.Burst)
+	written := 0
+	for written < len(p) {
+		n := min(chunk, len(p)-written)
+		if err := t.wait(n); err != nil {
+			return written, err
+		}
+		m, err := t.ResponseWriter.Write(p[written : written+n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// wait blocks until n bytes are paid for, or the request ends.
+func (t *throttledWriter) wait(n int) error {
+	p := t.limiter.policy
+	// Time to refill n bytes; Retry-After only has whole seconds.
+	refill := time.Duration(int64(n) * int64(p.Window) / int64(p.Limit))
+	refill = max(refill, time.Millisecond)
+	for {
+		res := t.limiter.store.Allow(t.ctx, t.key, p, n)
+		if res.Err != nil {
+			if t.ctx.Err() != nil {
+				return t.ctx.Err()
+			}
+			failedOpen.Add(1)
+			log.Printf("[ratelimit] bandwidth store error key=%s, failing open: %v", truncateKey(t.key), res.Err)
+			return nil
+		}
+		if res.Allowed {
+			return nil
+		}
+		timer := time.NewTimer(refill)
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			timer.Stop()
+			return t.ctx.Err()
+		}
+	}
+}
+
+// Flush implements http.Flusher when the wrapped writer does.
+func (t *throttledWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (t *throttledWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter_Throttles(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	bw := NewBandwidthLimiter(store, Policy{Limit: 10_000, Window: 100 * time.Millisecond, Enabled: true, Scope: "downloads"}, KeyByIP())
+	body := bytes.Repeat([]byte("x"), 30_000)
+	handler := bw.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n, err := w.Write(body); n != len(body) || err != nil {
+			t.Errorf("write: %d, %v", n, err)
+		}
+	}))
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/file", nil))
+	elapsed := time.Since(start)
+	if rr.Body.Len() != len(body) {
+		t.Fatalf("expected the whole body, got %d bytes", rr.Body.Len())
+	}
+	// A full bucket pays for the first 10 kB; the other 20 kB take 200ms.
+	if elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected about 200ms for 30 kB at 100 kB/s, took %s", elapsed)
+	}
+}
+
+func TestBandwidthLimiter_StopsWhenClientLeaves(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	bw := NewBandwidthLimiter(store, Policy{Limit: 1000, Window: time.Hour, Enabled: true, Scope: "downloads"}, KeyByIP())
+	var werr error
+	handler := bw.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, werr = w.Write(make([]byte, 5000))
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/file", nil).WithContext(ctx))
+	if !errors.Is(werr, context.DeadlineExceeded) {
+		t.Errorf("expected the write to fail with the request context, got %v", werr)
+	}
+}
@@ -0,0 +1,328 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ──────────────────────────────────────────────
+// Ban lists and automatic bans
+// ──────────────────────────────────────────────
+
+// Ban is one entry of a BanList.
+type Ban struct {
+	Key    string    `json:"key"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+// BanList is the store of a PenaltyBox: temporarily banned keys, with the
+// strike counts that lead to a ban. Share one list between boxes, or
+// between instances with RedisBanList, so a key banned by one is banned by
+// all.
+type BanList interface {
+	// Strike counts one strike of key, and returns the strikes counted
+	// within window of the first.
+	Strike(ctx context.Context, key string, window time.Duration) (int, error)
+	// Ban bans b.Key until b.Until, replacing any earlier ban.
+	Ban(ctx context.Context, b Ban) error
+	// Banned returns the ban of key, if it is banned.
+	Banned(ctx context.Context, key string) (Ban, bool, error)
+	// Lift removes the ban and the strike count of key.
+	Lift(ctx context.Context, key string) error
+	// Bans returns the bans in force, soonest to end first.
+	Bans(ctx context.Context) ([]Ban, error)
+}
+
+// WithAutoBan rejects keys banned in box before their bucket is checked,
+// like WithPenaltyBox, and strikes box for every denial, so keys that keep
+// getting denied are banned. Bans are denied with the policy's BanStatus
+// and reason=penalty, and cost no tokens.
+func WithAutoBan(box *PenaltyBox) Option {
+	return func(l *Limiter) {
+		l.penaltyBox = box
+		l.strikeDenials = true
+	}
+}
+
+// strike counts a denial of key for reason in the limiter's penalty box.
+// Denials that are already penalties, or that say nothing about the
+// client, are not counted.
+func (l *Limiter) strike(ctx context.Context, key, reason string) {
+	if !l.strikeDenials || l.penaltyBox == nil || l.shadow {
+		return
+	}
+	switch reason {
+	case "penalty", "escalation", "greylist", "store_error", "concurrency":
+		return
+	}
+	l.penaltyBox.strike(ctx, key, "denied by scope="+l.policy.Scope)
+}
+
+// BansHandler serves the bans of list:
+//
+//	GET    /           the bans in force
+//	DELETE /?key=<key> lift the ban of key
+//
+// Mount it behind admin authentication.
+func BansHandler(list BanList) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			bans, err := list.Bans(r.Context())
+			if err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, bans)
+		case http.MethodDelete:
+			key := r.URL.Query().Get("key")
+			if key == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key is required"})
+				return
+			}
+			if err := list.Lift(r.Context(), key); err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	})
+}
+
+// ──────────────────────────────────────────────
+// Memory ban list
+// ──────────────────────────────────────────────
+
+// MemoryBanList is a per-instance BanList.
+type MemoryBanList struct {
+	mu        sync.Mutex
+	strikes   map[string]*banStrikes
+	bans      map[string]Ban
+	lastSweep time.Time
+}
+
+type banStrikes struct {
+	n       int
+	firstAt time.Time
+	window  time.Duration
+}
+
+// NewMemoryBanList creates an empty MemoryBanList.
+func NewMemoryBanList() *MemoryBanList {
+	return &MemoryBanList{
+		strikes:   make(map[string]*banStrikes),
+		bans:      make(map[string]Ban),
+		lastSweep: time.Now(),
+	}
+}
+
+// Strike implements BanList.
+func (m *MemoryBanList) Strike(_ context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	s, ok := m.strikes[key]
+	if !ok || now.Sub(s.firstAt) > s.window {
+		s = &banStrikes{firstAt: now, window: window}
+		m.strikes[key] = s
+	}
+	s.n++
+	return s.n, nil
+}
+
+// Ban implements BanList. The strike count of the key starts over.
+func (m *MemoryBanList) Ban(_ context.Context, b Ban) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bans[b.Key] = b
+	delete(m.strikes, b.Key)
+	return nil
+}
+
+// Banned implements BanList.
+func (m *MemoryBanList) Banned(_ context.Context, key string) (Ban, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.bans[key]
+	if !ok || !time.Now().Before(b.Until) {
+		return Ban{}, false, nil
+	}
+	return b, true, nil
+}
+
+// Lift implements BanList.
+func (m *MemoryBanList) Lift(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.bans, key)
+	delete(m.strikes, key)
+	return nil
+}
+
+// Bans implements BanList.
+func (m *MemoryBanList) Bans(context.Context) ([]Ban, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	bans := []Ban{}
+	for _, b := range m.bans {
+		if now.Before(b.Until) {
+			bans = append(bans, b)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.Before(bans[j].Until) })
+	return bans, nil
+}
+
+// sweep drops ended bans and elapsed strike counts. It runs at most once a
+// minute so Strike stays cheap.
+func (m *MemoryBanList) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for k, b := range m.bans {
+		if !now.Before(b.Until) {
+			delete(m.bans, k)
+		}
+	}
+	for k, s := range m.strikes {
+		if now.Sub(s.firstAt) > s.window {
+			delete(m.strikes, k)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// Redis ban list
+// ──────────────────────────────────────────────
+
+// RedisBanList is a BanList shared by every instance using the same Redis.
+// Each ban is a key that expires with it, under <prefix>ban:, indexed in
+// the <prefix>bans sorted set by end time for listing.
+type RedisBanList struct {
+	s *RedisStore
+}
+
+// NewRedisBanList creates a ban list in the Redis of s, under its prefix.
+func NewRedisBanList(s *RedisStore) *RedisBanList {
+	return &RedisBanList{s: s}
+}
+
+var luaBanStrike = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+    redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (b *RedisBanList) strikeKey(key string) string { return b.s.prefix + "banstrike:" + key }
+func (b *RedisBanList) banKey(key string) string    { return b.s.prefix + "ban:" + key }
+func (b *RedisBanList) indexKey() string            { return b.s.prefix + "bans" }
+
+// Strike implements BanList.
+func (b *RedisBanList) Strike(ctx context.Context, key string, window time.Duration) (int, error) {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	return luaBanStrike.Run(ctx, b.s.client, []string{b.strikeKey(key)}, window.Milliseconds()).Int()
+}
+
+// Ban implements BanList. The strike count of the key starts over.
+func (b *RedisBanList) Ban(ctx context.Context, ban Ban) error {
+	ttl := time.Until(ban.Until)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(ban)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	_, err = b.s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, b.banKey(ban.Key), data, ttl)
+		p.ZAdd(ctx, b.indexKey(), redis.Z{Score: float64(ban.Until.UnixMilli()), Member: ban.Key})
+		p.Del(ctx, b.strikeKey(ban.Key))
+		return nil
+	})
+	return err
+}
+
+// Banned implements BanList.
+func (b *RedisBanList) Banned(ctx context.Context, key string) (Ban, bool, error) {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	data, err := b.s.client.Get(ctx, b.banKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Ban{}, false, nil
+	}
+	if err != nil {
+		return Ban{}, false, err
+	}
+	var ban Ban
+	if err := json.Unmarshal(data, &ban); err != nil {
+		return Ban{}, false, fmt.Errorf("ban %s: %w", truncateKey(key), err)
+	}
+	return ban, true, nil
+}
+
+// Lift implements BanList.
+func (b *RedisBanList) Lift(ctx context.Context, key string) error {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	_, err := b.s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, b.banKey(key), b.strikeKey(key))
+		p.ZRem(ctx, b.indexKey(), key)
+		return nil
+	})
+	return err
+}
+
+// Bans implements BanList. Ended bans are dropped from the index.
+func (b *RedisBanList) Bans(ctx context.Context) ([]Ban, error) {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := b.s.client.ZRemRangeByScore(ctx, b.indexKey(), "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	keys, err := b.s.client.ZRange(ctx, b.indexKey(), 0, -1).Result()
+	if err != nil || len(keys) == 0 {
+		return []Ban{}, err
+	}
+	banKeys := make([]string, len(keys))
+	for i, k := range keys {
+		banKeys[i] = b.banKey(k)
+	}
+	values, err := b.s.client.MGet(ctx, banKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	bans := make([]Ban, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue // lifted or expired since the index was read
+		}
+		var ban Ban
+		if json.Unmarshal([]byte(data), &ban) == nil {
+			bans = append(bans, ban)
+		}
+	}
+	return bans, nil
+}
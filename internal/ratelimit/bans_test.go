@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMiddleware_AutoBan(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	store.DenyAll(5)
+	list := NewMemoryBanList()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login", BanStatus: http.StatusForbidden}
+	handler := NewLimiter(store, p, KeyByIP(), WithAutoBan(NewPenaltyBoxWithList(list, 3, time.Minute, time.Hour))).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	codes := []int{}
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rr.Code)
+	}
+	want := []int{429, 429, 429, 403, 403}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, codes)
+		}
+	}
+	if got := store.CallCount("allow"); got != 3 {
+		t.Errorf("expected banned requests to skip the bucket, got %d store calls", got)
+	}
+
+	bans, _ := list.Bans(context.Background())
+	if len(bans) != 1 || bans[0].Key != "ip:192.0.2.1" || time.Until(bans[0].Until) < 59*time.Minute {
+		t.Fatalf("expected one hour-long ban of ip:192.0.2.1, got %+v", bans)
+	}
+	if err := list.Lift(context.Background(), "ip:192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a lifted ban to go back to the bucket, got %d", rr.Code)
+	}
+}
+
+func TestMiddleware_AutoBanSkipsEscalation(t *testing.T) {
+	initTestConfig()
+	escalations.mu.Lock()
+	clear(escalations.entries)
+	escalations.mu.Unlock()
+	store := NewMockStore()
+	store.DenyAll(1)
+	box := NewPenaltyBoxWithList(NewMemoryBanList(), 2, time.Minute, time.Hour)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "autoban_escalation", Escalation: 3}
+	handler := NewLimiter(store, p, KeyByIP(), WithAutoBan(box)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 4; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if _, banned := box.Banned("ip:192.0.2.1"); banned {
+		t.Error("expected denials during an escalated backoff not to count toward a ban")
+	}
+}
+
+func TestMemoryBanList_StrikesExpire(t *testing.T) {
+	list := NewMemoryBanList()
+	ctx := context.Background()
+	list.Strike(ctx, "k", 30*time.Millisecond)
+	if n, _ := list.Strike(ctx, "k", 30*time.Millisecond); n != 2 {
+		t.Fatalf("expected 2 strikes, got %d", n)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n, _ := list.Strike(ctx, "k", 30*time.Millisecond); n != 1 {
+		t.Errorf("expected the count to start over after the window, got %d", n)
+	}
+
+	list.Ban(ctx, Ban{Key: "k", Until: time.Now().Add(20 * time.Millisecond)})
+	if _, banned, _ := list.Banned(ctx, "k"); !banned {
+		t.Fatal("expected k to be banned")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, banned, _ := list.Banned(ctx, "k"); banned {
+		t.Error("expected the ban to end")
+	}
+}
+
+func TestBansHandler(t *testing.T) {
+	list := NewMemoryBanList()
+	ctx := context.Background()
+	list.Ban(ctx, Ban{Key: "ip:203.0.113.9", Reason: "test", Until: time.Now().Add(time.Hour)})
+	h := BansHandler(list)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	var bans []Ban
+	if err := json.NewDecoder(rr.Body).Decode(&bans); err != nil || len(bans) != 1 || bans[0].Key != "ip:203.0.113.9" {
+		t.Fatalf("expected the ban to be listed, got %v (%v)", bans, err)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/?key=ip:203.0.113.9", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if _, banned, _ := list.Banned(ctx, "ip:203.0.113.9"); banned {
+		t.Error("expected DELETE to lift the ban")
+	}
+}
+
+func TestRedisBanList_TimeoutBansNoOne(t *testing.T) {
+	initTestConfig()
+	addr := hangingListener(t)
+	rs := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true}),
+		prefix:  "test:",
+		timeout: 50 * time.Millisecond,
+	}
+	defer rs.Close()
+
+	box := NewPenaltyBoxWithList(NewRedisBanList(rs), 1, time.Minute, time.Hour)
+	start := time.Now()
+	if box.Strike("ip:192.0.2.1") {
+		t.Error("expected a failing ban list to ban no one")
+	}
+	if _, banned := box.banned(context.Background(), "ip:192.0.2.1"); banned {
+		t.Error("expected a failing ban list to ban no one")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the ban check to give up after the timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,411 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Blocklist
+// ──────────────────────────────────────────────
+
+// BlocklistStore holds the entries of a Blocklist: IPs, CIDRs and key
+// hashes from BlocklistKey.
+type BlocklistStore interface {
+	Add(ctx context.Context, entry string) error
+	Remove(ctx context.Context, entry string) error
+	Entries(ctx context.Context) ([]string, error)
+}
+
+// BlocklistKey returns the blocklist entry of a limiter key, e.g. of
+// "user:42": "key:" and the SHA-256 of the key in hex. Blocked keys are
+// stored hashed, so API keys and session IDs never reach the store.
+func BlocklistKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:])
+}
+
+// normalizeBlockEntry validates entry and returns it in stored form: key
+// hashes in lower case, single IPs (including /32 and /128 CIDRs) as the
+// canonical address and other CIDRs masked, so every spelling of an entry
+// is stored once and can be unblocked by any other spelling.
+func normalizeBlockEntry(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	if hash, ok := strings.CutPrefix(entry, "key:"); ok {
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha256.Size {
+			return "", fmt.Errorf("blocklist entry %q: want key:<sha256 hex>, see BlocklistKey", entry)
+		}
+		return strings.ToLower(entry), nil
+	}
+	if strings.Contains(entry, "/") {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix = prefix.Masked(); prefix.IsSingleIP() {
+				return prefix.Addr().Unmap().String(), nil
+			}
+			return prefix.String(), nil
+		}
+	} else if addr, err := netip.ParseAddr(entry); err == nil && addr.Zone() == "" {
+		return addr.Unmap().String(), nil
+	}
+	return "", fmt.Errorf("blocklist entry %q: want an IP, a CIDR or key:<sha256 hex>", entry)
+}
+
+// blockSet is a compiled snapshot of a blocklist.
+type blockSet struct {
+	ips  *IPSet
+	keys map[string]struct{}
+}
+
+// Blocklist rejects requests from blocked IPs, CIDRs and keys with 403,
+// before any limiter runs. Entries live in a BlocklistStore, so they can be
+// changed at runtime and, with RedisBlocklistStore, shared by every
+// instance. Each instance matches requests against a snapshot that is
+// reloaded by Refresh, every refresh interval after Start, and after each
+// Block and Unblock.
+type Blocklist struct {
+	store    BlocklistStore
+	keyFunc  KeyFunc
+	logStore LogStore
+	interval time.Duration
+	closer   func() error
+
+	set     atomic.Pointer[blockSet]
+	blocked atomic.Uint64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewBlocklist reads the entries of store once. keyFunc keys requests for
+// key entries; nil matches IPs only. Blocked requests are logged to the
+// process log and, when logStore is not nil, to logStore. interval
+// defaults to ten seconds.
+func NewBlocklist(store BlocklistStore, keyFunc KeyFunc, logStore LogStore, interval time.Duration) *Blocklist {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	b := &Blocklist{store: store, keyFunc: keyFunc, logStore: logStore, interval: interval, stop: make(chan struct{})}
+	b.set.Store(&blockSet{ips: &IPSet{}, keys: map[string]struct{}{}})
+	ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+	b.Refresh(ctx)
+	cancel()
+	return b
+}
+
+// NewBlocklistFromConfig creates a blocklist in Redis when RATE_LIMIT_STORE
+// is redis, and in memory otherwise, refreshed every
+// RATE_LIMIT_BLOCKLIST_REFRESH seconds. Call Start to follow changes made
+// by other instances.
+func NewBlocklistFromConfig(keyFunc KeyFunc, logStore LogStore) *Blocklist {
+	cfg := config.RateLimit
+	interval := time.Duration(cfg.BlocklistRefresh) * time.Second
+	if cfg.Store != "redis" {
+		return NewBlocklist(NewMemoryBlocklistStore(), keyFunc, logStore, interval)
+	}
+	rs := NewRedisStore()
+	b := NewBlocklist(NewRedisBlocklistStore(rs), keyFunc, logStore, interval)
+	b.closer = rs.Close
+	return b
+}
+
+// Start reloads the entries in the background until Close.
+func (b *Blocklist) Start() {
+	b.done = make(chan struct{})
+	go b.loop()
+}
+
+// Close stops reloading the entries.
+func (b *Blocklist) Close() error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	if b.done != nil {
+		<-b.done
+	}
+	if b.closer != nil {
+		return b.closer()
+	}
+	return nil
+}
+
+func (b *Blocklist) loop() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+			b.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Refresh reads the entries now. A failed read keeps the current snapshot;
+// invalid entries are logged and skipped.
+func (b *Blocklist) Refresh(ctx context.Context) error {
+	entries, err := b.store.Entries(ctx)
+	if err != nil {
+		log.Printf("[ratelimit] blocklist read failed: %v (keeping current entries)", err)
+		return err
+	}
+	var ips []string
+	keys := map[string]struct{}{}
+	for _, e := range entries {
+		if strings.HasPrefix(e, "key:") {
+			keys[e] = struct{}{}
+		} else {
+			ips = append(ips, e)
+		}
+	}
+	set, errs := parseIPSetLenient(ips)
+	for _, err := range errs {
+		log.Printf("[ratelimit] skipping blocklist entry: %v", err)
+	}
+	b.set.Store(&blockSet{ips: set, keys: keys})
+	return nil
+}
+
+// Block adds entry, an IP, a CIDR or a BlocklistKey, and applies it on
+// this instance at once.
+func (b *Blocklist) Block(ctx context.Context, entry string) error {
+	entry, err := normalizeBlockEntry(entry)
+	if err != nil {
+		return err
+	}
+	if err := b.store.Add(ctx, entry); err != nil {
+		return err
+	}
+	log.Printf("[ratelimit] blocklist: blocked %s", entry)
+	return b.Refresh(ctx)
+}
+
+// Unblock removes entry, in any spelling Block accepts, and applies it on
+// this instance at once. Entries stored verbatim by another writer are
+// removed as given too.
+func (b *Blocklist) Unblock(ctx context.Context, entry string) error {
+	entry = strings.TrimSpace(entry)
+	if stored, err := normalizeBlockEntry(entry); err == nil && stored != entry {
+		if err := b.store.Remove(ctx, stored); err != nil {
+			return err
+		}
+	}
+	if err := b.store.Remove(ctx, entry); err != nil {
+		return err
+	}
+	log.Printf("[ratelimit] blocklist: unblocked %s", entry)
+	return b.Refresh(ctx)
+}
+
+// Entries returns the entries in the store, sorted.
+func (b *Blocklist) Entries(ctx context.Context) ([]string, error) {
+	entries, err := b.store.Entries(ctx)
+	sort.Strings(entries)
+	return entries, err
+}
+
+// Blocked returns how many requests the blocklist rejected since start.
+func (b *Blocklist) Blocked() uint64 { return b.blocked.Load() }
+
+// match returns what r is blocked by, "ip" or "key", and the key hash of r
+// when it was keyed.
+func (b *Blocklist) match(r *http.Request) (by, keyHash, keyType string) {
+	set := b.set.Load()
+	if set.ips.Contains(ClientIP(r)) {
+		return "ip", "", ""
+	}
+	if b.keyFunc == nil || len(set.keys) == 0 {
+		return "", "", ""
+	}
+	key, keyType := b.keyFunc(r)
+	keyHash = BlocklistKey(key)
+	if _, ok := set.keys[keyHash]; ok {
+		return "key", keyHash, keyType
+	}
+	return "", "", ""
+}
+
+// Middleware rejects blocked requests with 403.
+func (b *Blocklist) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		by, keyHash, keyType := b.match(r)
+		if by == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		b.blocked.Add(1)
+		b.logBlocked(r, by, keyHash, keyType)
+		w.Header().Set("Cache-Control", "no-store")
+		writeErrorResponse(w, r, Policy{}, http.StatusForbidden,
+			"Access denied.",
+			"Access has been blocked. Contact support if you think this is a mistake.",
+			0)
+	})
+}
+
+// logBlocked records a blocked request to the process log and the log
+// store. With anonymization on, neither log carries the raw IP.
+func (b *Blocklist) logBlocked(r *http.Request, by, keyHash, keyType string) {
+	clientIP := ClientIP(r)
+	if anon := configAnonymizer(); anon != nil {
+		clientIP = anon.Hash(clientIP)[:40]
+	}
+	if config.RateLimit.LogLevel != "quiet" {
+		log.Printf("[ratelimit] BLOCKED %s %s | by=%s type=%s key=%s ip=%s via=%s",
+			r.Method, r.URL.Path, by, keyType, keyHash, clientIP, Boundary(r))
+	}
+	if b.logStore != nil {
+		entry := LogEntry{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			KeyType:  keyType,
+			KeyHash:  keyHash,
+			Scope:    "blocklist",
+			ClientIP: clientIP,
+		}
+		if err := b.logStore.Log(entry); err != nil {
+			log.Printf("[ratelimit] failed to write log entry: %v", err)
+		}
+	}
+}
+
+// BlocklistHandler serves the entries of b:
+//
+//	GET    /             the entries
+//	POST   /?entry=<e>   block an IP, a CIDR or a BlocklistKey
+//	DELETE /?entry=<e>   unblock it
+//
+// Mount it behind admin authentication.
+func BlocklistHandler(b *Blocklist) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := r.URL.Query().Get("entry")
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			entries, err := b.Entries(r.Context())
+			if err != nil {
+				writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, entries)
+			return
+		case http.MethodPost, http.MethodDelete:
+			if entry == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "entry is required"})
+				return
+			}
+			if r.Method == http.MethodPost {
+				if _, verr := normalizeBlockEntry(entry); verr != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": verr.Error()})
+					return
+				}
+				err = b.Block(r.Context(), entry)
+			} else {
+				err = b.Unblock(r.Context(), entry)
+			}
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ──────────────────────────────────────────────
+// Blocklist stores
+// ──────────────────────────────────────────────
+
+// MemoryBlocklistStore is a per-instance BlocklistStore.
+type MemoryBlocklistStore struct {
+	mu      sync.Mutex
+	entries map[string]struct{}
+}
+
+// NewMemoryBlocklistStore creates a MemoryBlocklistStore holding entries.
+func NewMemoryBlocklistStore(entries ...string) *MemoryBlocklistStore {
+	m := &MemoryBlocklistStore{entries: make(map[string]struct{}, len(entries))}
+	for _, e := range entries {
+		m.entries[e] = struct{}{}
+	}
+	return m
+}
+
+// Add implements BlocklistStore.
+func (m *MemoryBlocklistStore) Add(_ context.Context, entry string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[entry] = struct{}{}
+	return nil
+}
+
+// Remove implements BlocklistStore.
+func (m *MemoryBlocklistStore) Remove(_ context.Context, entry string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, entry)
+	return nil
+}
+
+// Entries implements BlocklistStore.
+func (m *MemoryBlocklistStore) Entries(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.entries))
+	for e := range m.entries {
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// RedisBlocklistStore keeps blocklist entries in the <prefix>blocklist set
+// of the Redis of a RedisStore.
+type RedisBlocklistStore struct {
+	s *RedisStore
+}
+
+// NewRedisBlocklistStore creates a blocklist store in the Redis of s,
+// under its prefix.
+func NewRedisBlocklistStore(s *RedisStore) *RedisBlocklistStore {
+	return &RedisBlocklistStore{s: s}
+}
+
+func (b *RedisBlocklistStore) key() string { return b.s.prefix + "blocklist" }
+
+// Add implements BlocklistStore.
+func (b *RedisBlocklistStore) Add(ctx context.Context, entry string) error {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	return b.s.client.SAdd(ctx, b.key(), entry).Err()
+}
+
+// Remove implements BlocklistStore.
+func (b *RedisBlocklistStore) Remove(ctx context.Context, entry string) error {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	return b.s.client.SRem(ctx, b.key(), entry).Err()
+}
+
+// Entries implements BlocklistStore.
+func (b *RedisBlocklistStore) Entries(ctx context.Context) ([]string, error) {
+	ctx, cancel := b.s.withTimeout(ctx)
+	defer cancel()
+	return b.s.client.SMembers(ctx, b.key()).Result()
+}
@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBlocklist_Middleware(t *testing.T) {
+	initTestConfig()
+	keyFunc := KeyByHeader("X-API-Key", nil)
+	b := NewBlocklist(NewMemoryBlocklistStore(), keyFunc, nil, 0)
+	handler := b.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ctx := context.Background()
+
+	status := func(remoteAddr, apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if got := status("192.0.2.1:1234", ""); got != http.StatusOK {
+		t.Fatalf("expected an empty blocklist to let requests through, got %d", got)
+	}
+
+	for _, entry := range []string{"192.0.2.1", "198.51.100.0/24"} {
+		if err := b.Block(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyed := httptest.NewRequest(http.MethodGet, "/", nil)
+	keyed.Header.Set("X-API-Key", "secret")
+	key, _ := keyFunc(keyed)
+	if err := b.Block(ctx, BlocklistKey(key)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		remoteAddr, apiKey string
+		want               int
+	}{
+		{"192.0.2.1:1234", "", http.StatusForbidden},
+		{"198.51.100.77:1234", "", http.StatusForbidden},
+		{"203.0.113.9:1234", "secret", http.StatusForbidden},
+		{"203.0.113.9:1234", "other", http.StatusOK},
+		{"192.0.2.2:1234", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		if got := status(c.remoteAddr, c.apiKey); got != c.want {
+			t.Errorf("%s key=%q: expected %d, got %d", c.remoteAddr, c.apiKey, c.want, got)
+		}
+	}
+	if got := b.Blocked(); got != 3 {
+		t.Errorf("expected 3 blocked requests, got %d", got)
+	}
+
+	if err := b.Unblock(ctx, "198.51.100.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status("198.51.100.77:1234", ""); got != http.StatusOK {
+		t.Errorf("expected an unblocked CIDR to let requests through, got %d", got)
+	}
+}
+
+func TestBlocklist_InvalidEntries(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryBlocklistStore("not-an-ip", "192.0.2.1")
+	b := NewBlocklist(store, nil, nil, 0)
+
+	for _, entry := range []string{"", "not-an-ip", "key:abc", "10.0.0.0/33"} {
+		if err := b.Block(context.Background(), entry); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	b.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected the valid stored entry to stay in force, got %d", rr.Code)
+	}
+}
+
+func TestBlocklistHandler(t *testing.T) {
+	initTestConfig()
+	b := NewBlocklist(NewMemoryBlocklistStore(), nil, nil, 0)
+	h := BlocklistHandler(b)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/?entry=203.0.113.0/24", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/?entry=bogus", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid entry to be rejected with 400, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	var entries []string
+	if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil || len(entries) != 1 || entries[0] != "203.0.113.0/24" {
+		t.Fatalf("expected the entry to be listed, got %v (%v)", entries, err)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/?entry=203.0.113.0/24", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if entries, _ := b.Entries(context.Background()); len(entries) != 0 {
+		t.Errorf("expected DELETE to unblock the entry, got %v", entries)
+	}
+}
+
+func TestRedisBlocklistStore_TimeoutKeepsEntries(t *testing.T) {
+	initTestConfig()
+	addr := hangingListener(t)
+	rs := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true}),
+		prefix:  "test:",
+		timeout: 50 * time.Millisecond,
+	}
+	defer rs.Close()
+
+	b := NewBlocklist(NewMemoryBlocklistStore("192.0.2.1"), nil, nil, 0)
+	b.store = NewRedisBlocklistStore(rs)
+	start := time.Now()
+	if err := b.Refresh(context.Background()); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the refresh to give up after the timeout, took %s", elapsed)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	b.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a failed refresh to keep the entries in force, got %d", rr.Code)
+	}
+}
+
+func TestBlocklist_CanonicalEntries(t *testing.T) {
+	initTestConfig()
+	b := NewBlocklist(NewMemoryBlocklistStore(), nil, nil, 0)
+	ctx := context.Background()
+
+	for _, entry := range []string{"2001:DB8::1", "2001:db8::1/128", "10.0.0.1", "10.0.0.1/32", "::ffff:10.0.0.1", "10.1.2.3/8"} {
+		if err := b.Block(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := b.Entries(ctx)
+	want := []string{"10.0.0.0/8", "10.0.0.1", "2001:db8::1"}
+	if len(entries) != len(want) {
+		t.Fatalf("expected each entry stored once in canonical form %v, got %v", want, entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: expected %q, got %q", i, want[i], entries[i])
+		}
+	}
+
+	for _, entry := range []string{"2001:0db8:0:0::1", "10.0.0.1/32", "10.0.0.0/8"} {
+		if err := b.Unblock(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries, _ := b.Entries(ctx); len(entries) != 0 {
+		t.Errorf("expected other spellings to unblock the entries, got %v", entries)
+	}
+}
+
+func TestBlocklist_BlocksLoggedKey(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	store.DenyAll(1)
+	logs := &recordingLogStore{}
+	keyFunc := KeyByHeader("X-API-Key", nil)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	limited := NewLimiter(store, p, keyFunc, WithLogStore(logs)).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	req := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", "a-very-long-api-key-that-the-log-would-truncate")
+		return r
+	}
+	limited.ServeHTTP(httptest.NewRecorder(), req())
+	if len(logs.entries) != 1 {
+		t.Fatalf("expected one denial logged, got %d", len(logs.entries))
+	}
+
+	b := NewBlocklist(NewMemoryBlocklistStore(), keyFunc, nil, 0)
+	if err := b.Block(context.Background(), logs.entries[0].KeyHash); err != nil {
+		t.Fatalf("expected the logged key to be a valid entry: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	b.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rr, req())
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected the logged key to block the client, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// ──────────────────────────────────────────────
+// Trust boundary classification
+// ──────────────────────────────────────────────
+
+// TrustBoundary describes how a request reached the server.
+type TrustBoundary string
+
+const (
+	// BoundaryProxy: the peer is a trusted proxy (edge traffic). In
+	// hop-count mode: X-Forwarded-For has an entry from every declared hop.
+	BoundaryProxy TrustBoundary = "proxy"
+	// BoundaryDirect: an untrusted peer without forwarding headers
+	// (direct-to-origin traffic).
+	BoundaryDirect TrustBoundary = "direct"
+	// BoundarySpoofed: an untrusted peer that sent forwarding headers, which
+	// are ignored. Usually a header-spoofing attempt.
+	BoundarySpoofed TrustBoundary = "spoofed"
+)
+
+var boundaries = [...]TrustBoundary{BoundaryProxy, BoundaryDirect, BoundarySpoofed}
+
+// Boundary classifies r by its immediate peer and forwarding headers.
+func Boundary(r *http.Request) TrustBoundary {
+	if trustedPeer(r) {
+		return BoundaryProxy
+	}
+	if hasForwardingHeaders(r) {
+		return BoundarySpoofed
+	}
+	return BoundaryDirect
+}
+
+func hasForwardingHeaders(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" ||
+		r.Header.Get("X-Real-IP") != "" ||
+		r.Header.Get("Forwarded") != "" {
+		return true
+	}
+	for _, name := range clientIPHeaders() {
+		if r.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// BoundaryCounts are request totals for one trust boundary.
+type BoundaryCounts struct {
+	Requests uint64 // requests checked by a limiter
+	Denied   uint64 // requests rejected (rate, concurrency, size, penalty, ...)
+}
+
+var boundaryRequests, boundaryDenied [len(boundaries)]atomic.Uint64
+
+func boundaryIndex(b TrustBoundary) int {
+	for i, v := range boundaries {
+		if v == b {
+			return i
+		}
+	}
+	return 0
+}
+
+// BoundaryStats returns process-wide request and denial counts per trust
+// boundary, for all limiters.
+func BoundaryStats() map[TrustBoundary]BoundaryCounts {
+	out := make(map[TrustBoundary]BoundaryCounts, len(boundaries))
+	for i, b := range boundaries {
+		out[b] = BoundaryCounts{Requests: boundaryRequests[i].Load(), Denied: boundaryDenied[i].Load()}
+	}
+	return out
+}
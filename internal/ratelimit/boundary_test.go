@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestBoundary(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   TrustBoundary
+	}{
+		{"trusted proxy", "10.0.0.1:1234", "5.6.7.8", BoundaryProxy},
+		{"direct", "1.2.3.4:1234", "", BoundaryDirect},
+		{"untrusted with XFF", "1.2.3.4:1234", "5.6.7.8", BoundarySpoofed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := Boundary(req); got != tt.want {
+				t.Fatalf("Boundary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_CountsBoundaries(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	store.QueueResult("ip:1.2.3.4", Result{Allowed: true}, Result{Allowed: false, RetryAfter: 1})
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	before := BoundaryStats()[BoundarySpoofed]
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		req.Header.Set("X-Forwarded-For", "9.9.9.9")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	after := BoundaryStats()[BoundarySpoofed]
+	if after.Requests-before.Requests != 2 || after.Denied-before.Denied != 1 {
+		t.Fatalf("spoofed counts moved by %d/%d, want 2/1",
+			after.Requests-before.Requests, after.Denied-before.Denied)
+	}
+}
@@ -1,6 +1,7 @@
 package ratelimit
 
 import (
+	"context"
 	"math"
 	"sync"
 	"time"
@@ -20,15 +21,29 @@ type Bucket struct {
 
 // NewBucket creates a bucket from a policy.
 func NewBucket(p Policy) *Bucket {
-	max := float64(p.Limit + p.Burst)
 	return &Bucket{
-		Tokens:     max, // starts full
-		MaxTokens:  max,
+		Tokens:     float64(p.Limit + p.Burst), // starts full, without carry-over
+		MaxTokens:  p.capacity(),
 		RefillRate: float64(p.Limit) / p.Window.Seconds(),
 		LastRefill: time.Now(),
 	}
 }
 
+// Retune applies a changed policy to an existing bucket, e.g. after a
+// policy reload. Tokens earned at the old rate are kept, up to the new
+// capacity.
+func (b *Bucket) Retune(p Policy, now time.Time) {
+	max := p.capacity()
+	rate := float64(p.Limit) / p.Window.Seconds()
+	if max == b.MaxTokens && rate == b.RefillRate {
+		return
+	}
+	b.refill(now)
+	b.MaxTokens = max
+	b.RefillRate = rate
+	b.Tokens = math.Min(b.Tokens, max)
+}
+
 // refill adds tokens based on elapsed time (idempotent).
 func (b *Bucket) refill(now time.Time) {
 	elapsed := now.Sub(b.LastRefill).Seconds()
@@ -84,6 +99,10 @@ type Result struct {
 	Remaining int
 	RetryAfter int   // seconds (0 when allowed)
 	ResetAt   int64  // unix timestamp
+
+	// Err is set when the store could not consult its backend. The other
+	// fields then describe the fallback decision (fail-open by default).
+	Err error
 }
 
 // ──────────────────────────────────────────────
@@ -93,7 +112,8 @@ type Result struct {
 // Store is the persistence backend for rate-limit buckets.
 type Store interface {
 	// Allow checks the rate limit for a key given a policy and cost.
-	Allow(key string, policy Policy, cost int) Result
+	// Implementations must honour ctx cancellation and deadlines.
+	Allow(ctx context.Context, key string, policy Policy, cost int) Result
 
 	// Reset removes a key from the store (e.g. after successful auth).
 	Reset(key string) error
@@ -109,7 +129,8 @@ type Store interface {
 // ConcurrencyStore manages per-key in-flight request counts.
 type ConcurrencyStore interface {
 	// Acquire increments the in-flight counter for key.
-	// Returns false if concurrency limit is reached.
+	// Returns false if concurrency limit is reached. On backend errors
+	// implementations return (true, err) and leave the decision to the caller.
 	Acquire(key string, limit int) (bool, error)
 
 	// Release decrements the in-flight counter for key.
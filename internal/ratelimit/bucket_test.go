@@ -112,3 +112,19 @@ func TestBucket_RetryAfter(t *testing.T) {
 		t.Fatalf("retryAfter should be about 1 second, got %.2f", retry)
 	}
 }
+
+func TestBucket_CarryOver(t *testing.T) {
+	p := Policy{Limit: 100, Window: time.Hour, Burst: 0, Enabled: true, Cost: 1, CarryOver: 0.25}
+	b := NewBucket(p)
+	if b.Tokens != 100 || b.MaxTokens != 125 {
+		t.Fatalf("expected a new bucket at 100 of 125 tokens, got %v of %v", b.Tokens, b.MaxTokens)
+	}
+
+	// A quiet window saves a quarter of the limit, no more.
+	now := b.LastRefill
+	b.Allow(60, now)
+	remaining, _ := b.Allow(1, now.Add(2*time.Hour))
+	if remaining != 124 {
+		t.Errorf("expected the carry-over to cap the bucket at 125, got %d remaining", remaining)
+	}
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync/atomic"
+)
+
+// ──────────────────────────────────────────────
+// Canary rollout of policy changes
+// ──────────────────────────────────────────────
+
+// canaryBuckets is the resolution of a canary's percentage (0.01%).
+const canaryBuckets = 10000
+
+// PolicyCanary applies a candidate policy to a fixed share of keys while
+// the others keep the current one, so a tighter limit can be tried on a
+// slice of traffic before a full rollout. The candidate replaces the
+// limiter policy with the same Scope: the limiter's own, or that of a
+// PolicySet or method rule.
+//
+// Keys are assigned by hash, so a key stays on the same side for as long
+// as the percentage is unchanged, and raising it only moves keys from the
+// current policy to the candidate. Both sides use the same buckets.
+type PolicyCanary struct {
+	policy  Policy
+	percent atomic.Uint32 // in canaryBuckets
+
+	control, canary canaryCounters
+}
+
+type canaryCounters struct {
+	requests, denied atomic.Uint64
+}
+
+// CanaryCounts are request totals for one side of a canary.
+type CanaryCounts struct {
+	Requests uint64 // requests checked
+	Denied   uint64 // requests rejected (rate, concurrency, size, penalty, ...)
+}
+
+// CanaryStats compares the keys on the current policy with those on the
+// candidate.
+type CanaryStats struct {
+	Control CanaryCounts
+	Canary  CanaryCounts
+	Percent float64
+}
+
+// NewPolicyCanary rolls candidate out to percent (0-100) of keys.
+func NewPolicyCanary(candidate Policy, percent float64) *PolicyCanary {
+	c := &PolicyCanary{policy: candidate}
+	c.SetPercent(percent)
+	return c
+}
+
+// SetPercent changes the share of keys on the candidate, e.g. to ramp a
+// rollout up or to abort it with 0. The change applies from the next
+// request. Values are clamped to 0-100.
+func (c *PolicyCanary) SetPercent(percent float64) {
+	c.percent.Store(uint32(math.Round(math.Max(0, math.Min(100, percent)) * canaryBuckets / 100)))
+}
+
+// Policy returns the candidate policy.
+func (c *PolicyCanary) Policy() Policy { return c.policy }
+
+// Stats returns the request and denial counts of each side since the
+// canary was created.
+func (c *PolicyCanary) Stats() CanaryStats {
+	return CanaryStats{
+		Control: c.control.counts(),
+		Canary:  c.canary.counts(),
+		Percent: float64(c.percent.Load()) * 100 / canaryBuckets,
+	}
+}
+
+func (cc *canaryCounters) counts() CanaryCounts {
+	return CanaryCounts{Requests: cc.requests.Load(), Denied: cc.denied.Load()}
+}
+
+// side returns the counters of key's side, or nil when the canary does not
+// cover scope.
+func (c *PolicyCanary) side(scope, key string) (*canaryCounters, bool) {
+	if c == nil || scope != c.policy.Scope {
+		return nil, false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	if h.Sum32()%canaryBuckets < c.percent.Load() {
+		return &c.canary, true
+	}
+	return &c.control, false
+}
+
+// pick counts a request for key and reports whether it gets the candidate.
+func (c *PolicyCanary) pick(scope, key string) bool {
+	counters, canary := c.side(scope, key)
+	if counters != nil {
+		counters.requests.Add(1)
+	}
+	return canary
+}
+
+// deny counts a rejected request for key.
+func (c *PolicyCanary) deny(scope, key string) {
+	if counters, _ := c.side(scope, key); counters != nil {
+		counters.denied.Add(1)
+	}
+}
+
+// WithCanary enforces c's candidate policy for its share of keys. The
+// candidate must have the Scope of one of the limiter's policies. Policy
+// providers and SetPolicy do not change the candidate.
+func WithCanary(c *PolicyCanary) Option {
+	return func(l *Limiter) { l.canary = c }
+}
+
+// validateCanary checks that the canary replaces a policy the limiter has.
+func (l *Limiter) validateCanary() error {
+	if l.canary == nil {
+		return nil
+	}
+	if _, ok := l.scopes()[l.canary.policy.Scope]; !ok {
+		return fmt.Errorf("canary: limiter has no policy with scope %q", l.canary.policy.Scope)
+	}
+	return l.validatePolicy(l.canary.policy)
+}
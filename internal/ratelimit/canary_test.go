@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Canary(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	current := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	candidate := current
+	candidate.Limit = 60
+	canary := NewPolicyCanary(candidate, 25)
+	keyFunc := func(r *http.Request) (string, string) { return "user:" + r.Header.Get("X-User"), KeyTypeUser }
+	store.SetAllowFunc(func(key string, p Policy, cost int) Result {
+		// Deny every canary request, so denials can be told apart per side.
+		return Result{Allowed: p.Limit != 60, Limit: p.Limit, RetryAfter: 1}
+	})
+	h := NewLimiter(store, current, keyFunc, WithCanary(canary)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(user int) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", fmt.Sprint(user))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	onCanary := func() map[string]bool {
+		out := make(map[string]bool)
+		for _, c := range store.Calls() {
+			if c.Policy.Limit == 60 {
+				out[c.Key] = true
+			}
+		}
+		store.ClearCalls()
+		return out
+	}
+
+	for user := 0; user < 1000; user++ {
+		serve(user)
+	}
+	first := onCanary()
+	if n := len(first); n < 200 || n > 300 {
+		t.Errorf("expected about 250 of 1000 keys on the canary, got %d", n)
+	}
+	stats := canary.Stats()
+	if stats.Canary.Requests != uint64(len(first)) || stats.Control.Requests != uint64(1000-len(first)) {
+		t.Errorf("unexpected request counts %+v", stats)
+	}
+	if stats.Canary.Denied != stats.Canary.Requests || stats.Control.Denied != 0 {
+		t.Errorf("unexpected denial counts %+v", stats)
+	}
+
+	// Keys keep their side, and ramping up only adds keys.
+	canary.SetPercent(50)
+	for user := 0; user < 1000; user++ {
+		serve(user)
+	}
+	second := onCanary()
+	for key := range first {
+		if !second[key] {
+			t.Errorf("%s left the canary when the rollout grew", key)
+		}
+	}
+	if len(second) <= len(first) {
+		t.Errorf("expected more keys at 50%%, got %d then %d", len(first), len(second))
+	}
+	if got := canary.Stats().Percent; got != 50 {
+		t.Errorf("expected 50%%, got %v", got)
+	}
+
+	canary.SetPercent(0)
+	for user := 0; user < 100; user++ {
+		serve(user)
+	}
+	if n := len(onCanary()); n != 0 {
+		t.Errorf("expected no canary keys at 0%%, got %d", n)
+	}
+}
+
+func TestMiddleware_CanaryOtherScope(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	policy := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	search := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "search"}
+	candidate := search
+	candidate.Limit = 5
+	set := NewPolicySet()
+	set.Add("/search", search)
+	canary := NewPolicyCanary(candidate, 100)
+	h := NewLimiter(store, policy, func(*http.Request) (string, string) { return "k", KeyTypeIP },
+		WithPolicySet(set), WithCanary(canary)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, path := range []string{"/search", "/other"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	calls := store.Calls()
+	if len(calls) != 2 || calls[0].Policy.Limit != 5 || calls[0].Key != "search:k" || calls[1].Policy.Limit != 100 {
+		t.Fatalf("got %+v", calls)
+	}
+	if stats := canary.Stats(); stats.Canary.Requests != 1 || stats.Control.Requests != 0 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+}
+
+func TestNewLimiter_RejectsUnknownCanaryScope(t *testing.T) {
+	initTestConfig()
+	defer func() {
+		if msg, _ := recover().(string); !strings.Contains(msg, `no policy with scope "exports"`) {
+			t.Errorf("expected a panic for the unknown scope, got %q", msg)
+		}
+	}()
+	policy := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	candidate := policy
+	candidate.Scope = "exports"
+	NewLimiter(NewMockStore(), policy, nil, WithCanary(NewPolicyCanary(candidate, 10)))
+}
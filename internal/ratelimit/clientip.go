@@ -1,9 +1,13 @@
 package ratelimit
 
 import (
+	"context"
+	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
 
 	"gohst/internal/config"
 )
@@ -16,50 +20,228 @@ import (
 // proxies from config.RateLimit.TrustedProxies. The rules:
 //
 //  1. If the immediate peer (RemoteAddr) is NOT in TrustedProxies, return it.
-//  2. If the peer IS trusted, inspect X-Real-IP first, then X-Forwarded-For
-//     (rightmost untrusted entry).
+//  2. If the peer IS trusted, inspect the headers of ClientIPHeaders in
+//     order, X-Real-IP then X-Forwarded-For by default. X-Forwarded-For
+//     yields its rightmost untrusted entry; any other header must hold a
+//     single IP and is skipped if it does not.
 //  3. Strip port, normalise IPv6.
+//
+// Forwarded addresses in a RATE_LIMIT_FORWARDED_SKIP class (private,
+// loopback, link-local, bogon) are never returned: in X-Forwarded-For they
+// are passed over like trusted hops, and a single-value header holding one
+// is skipped.
+//
+// In hop-count mode (RATE_LIMIT_TRUSTED_HOPS > 0) TrustedProxies and the
+// other headers are ignored: the client is the X-Forwarded-For entry that
+// many places from the right, or the peer when XFF has fewer entries.
+//
+// Inside Compose the IP is resolved once per request and reused.
 func ClientIP(r *http.Request) string {
-	peerIP := extractIP(r.RemoteAddr)
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r)
+}
 
-	// Guard: config may not be initialised (e.g. in tests).
-	var trusted []string
-	if config.RateLimit != nil {
-		trusted = config.RateLimit.TrustedProxies
+type clientIPKey struct{}
+
+// withClientIP returns r carrying its client IP, so later ClientIP calls
+// skip the header parsing.
+func withClientIP(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return r
 	}
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, resolveClientIP(r)))
+}
 
-	// If no trusted proxies configured, or peer is not trusted, return peer IP.
-	if len(trusted) == 0 || !isTrusted(peerIP, trusted) {
+func resolveClientIP(r *http.Request) string {
+	peerIP := extractIP(r.RemoteAddr)
+
+	if hops := trustedHops(); hops > 0 {
+		if ip := hopClientIP(forwardedFor(r), hops); ip != "" {
+			return ip
+		}
 		return normalizeIP(peerIP)
 	}
 
-	// Try X-Real-IP first (single value set by Nginx, etc.)
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return normalizeIP(strings.TrimSpace(realIP))
+	// Nil when config is not initialised (e.g. in tests) or no proxies are set.
+	trusted := trustedProxySet()
+
+	// If no trusted proxies configured, or peer is not trusted, return peer IP.
+	if trusted.Len() == 0 || !trusted.Contains(peerIP) {
+		return normalizeIP(peerIP)
 	}
 
-	// Walk X-Forwarded-For from right to left; return the first untrusted IP.
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		parts := strings.Split(xff, ",")
-		for i := len(parts) - 1; i >= 0; i-- {
-			ip := strings.TrimSpace(parts[i])
-			if ip == "" {
-				continue
-			}
-			if !isTrusted(ip, trusted) {
-				return normalizeIP(ip)
+	for _, name := range clientIPHeaders() {
+		v := strings.TrimSpace(r.Header.Get(name))
+		if v == "" {
+			continue
+		}
+		if strings.EqualFold(name, "X-Forwarded-For") {
+			if ip := forwardedClientIP(v, trusted); ip != "" {
+				return ip
 			}
+			continue
 		}
-		// All entries are trusted? Fall back to leftmost.
-		if first := strings.TrimSpace(parts[0]); first != "" {
-			return normalizeIP(first)
+		// Single-value headers (X-Real-IP, CF-Connecting-IP, True-Client-IP, ...)
+		if ip := net.ParseIP(v); ip != nil && !skipForwarded(ip.String()) {
+			return ip.String()
 		}
 	}
 
 	return normalizeIP(peerIP)
 }
 
+// trustedHops returns the number of proxies declared to sit in front of
+// the server, or 0 when hop-count mode is off.
+func trustedHops() int {
+	if cfg := config.RateLimit; cfg != nil && cfg.TrustedHops > 0 {
+		return cfg.TrustedHops
+	}
+	return 0
+}
+
+// hopClientIP returns the X-Forwarded-For entry hops places from the right:
+// each trusted proxy appends the address it received the request from, so
+// that entry was written by the outermost one. Entries further left are
+// client-supplied. Skipped addresses (see skipForwarded) count as further
+// internal hops. It returns "" when xff has fewer entries or the entry is
+// not an IP.
+func hopClientIP(xff string, hops int) string {
+	entries := xffEntries(xff)
+	for i := len(entries) - hops; i >= 0; i-- {
+		ip := net.ParseIP(entries[i])
+		if ip == nil {
+			return ""
+		}
+		if !skipForwarded(ip.String()) {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// xffEntries splits an X-Forwarded-For list, dropping empty entries.
+func xffEntries(xff string) []string {
+	var entries []string
+	for _, part := range strings.Split(xff, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			entries = append(entries, part)
+		}
+	}
+	return entries
+}
+
+// forwardedFor returns every X-Forwarded-For line of r joined into one list.
+func forwardedFor(r *http.Request) string {
+	return strings.Join(r.Header.Values("X-Forwarded-For"), ",")
+}
+
+// trustedPeer reports whether r came through the trusted proxies: its peer
+// is in TrustedProxies or, in hop-count mode, X-Forwarded-For has an entry
+// from every declared hop.
+func trustedPeer(r *http.Request) bool {
+	if hops := trustedHops(); hops > 0 {
+		return len(xffEntries(forwardedFor(r))) >= hops
+	}
+	return trustedProxySet().Contains(extractIP(r.RemoteAddr))
+}
+
+// defaultClientIPHeaders is the header order used when
+// RATE_LIMIT_CLIENT_IP_HEADERS is unset.
+var defaultClientIPHeaders = []string{"X-Real-IP", "X-Forwarded-For"}
+
+// clientIPHeaders returns the headers ClientIP reads from trusted peers,
+// highest priority first. Behind Cloudflare, for example, set
+// RATE_LIMIT_CLIENT_IP_HEADERS=CF-Connecting-IP,X-Forwarded-For: the CDN
+// sets the first header itself, while XFF collects every hop in between.
+func clientIPHeaders() []string {
+	if cfg := config.RateLimit; cfg != nil && len(cfg.ClientIPHeaders) > 0 {
+		return cfg.ClientIPHeaders
+	}
+	return defaultClientIPHeaders
+}
+
+// forwardedClientIP walks X-Forwarded-For from right to left and returns the
+// first untrusted IP, or the leftmost entry if all are trusted. It returns
+// "" for an empty header.
+func forwardedClientIP(xff string, trusted *IPSet) string {
+	if xff == "" {
+		return ""
+	}
+	parts := strings.Split(xff, ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(parts[i])
+		if ip == "" {
+			continue
+		}
+		if !trusted.Contains(ip) && !skipForwarded(normalizeIP(ip)) {
+			return normalizeIP(ip)
+		}
+	}
+	// All entries are trusted? Fall back to leftmost.
+	if first := strings.TrimSpace(parts[0]); first != "" && !skipForwarded(normalizeIP(first)) {
+		return normalizeIP(first)
+	}
+	return ""
+}
+
+// ──────────────────────────────────────────────
+// Forwarded-address skip policy
+// ──────────────────────────────────────────────
+
+// forwardedSkipClasses are the RATE_LIMIT_FORWARDED_SKIP classes.
+var forwardedSkipClasses = map[string][]string{
+	"private":   {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"},
+	"loopback":  {"127.0.0.0/8", "::1/128"},
+	"linklocal": {"169.254.0.0/16", "fe80::/10"},
+	"bogon": {
+		"0.0.0.0/8", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15", "198.51.100.0/24",
+		"203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "64:ff9b:1::/48", "100::/64", "2001:db8::/32", "ff00::/8",
+	},
+}
+
+var (
+	skipMu     sync.Mutex
+	skipSrc    *config.RateLimitConfig
+	skipSrcLen int
+	skipSet    *IPSet
+)
+
+// forwardedSkipSet returns the addresses of the RATE_LIMIT_FORWARDED_SKIP
+// classes, compiled once per config; nil when the list is empty. Unknown
+// class names are logged and ignored.
+func forwardedSkipSet() *IPSet {
+	cfg := config.RateLimit
+	if cfg == nil || len(cfg.ForwardedSkip) == 0 {
+		return nil
+	}
+
+	skipMu.Lock()
+	defer skipMu.Unlock()
+	if skipSrc == cfg && skipSrcLen == len(cfg.ForwardedSkip) {
+		return skipSet
+	}
+	var entries []string
+	for _, class := range cfg.ForwardedSkip {
+		cidrs, ok := forwardedSkipClasses[strings.ToLower(class)]
+		if !ok {
+			log.Printf("[ratelimit] ignoring unknown forwarded skip class %q", class)
+		}
+		entries = append(entries, cidrs...)
+	}
+	skipSrc, skipSrcLen, skipSet = cfg, len(cfg.ForwardedSkip), MustParseIPSet(entries...)
+	return skipSet
+}
+
+// skipForwarded reports whether a forwarded address must not be taken as
+// the client, so a client cannot claim to be 10.0.0.1 and land in an
+// internal bucket or a bypass rule.
+func skipForwarded(ip string) bool {
+	return forwardedSkipSet().Contains(ip)
+}
+
 // extractIP strips the port from host:port strings.
 func extractIP(addr string) string {
 	host, _, err := net.SplitHostPort(addr)
@@ -82,6 +264,7 @@ func normalizeIP(raw string) string {
 
 // isTrusted returns true if `ip` matches any entry in the trusted list.
 // Entries can be plain IPs ("10.0.0.1") or CIDRs ("10.0.0.0/8").
+// It parses the list on every call; hot paths should use a precompiled IPSet.
 func isTrusted(ip string, trusted []string) bool {
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
@@ -110,16 +293,30 @@ func isTrusted(ip string, trusted []string) bool {
 // CoarsenIPv6 maps an IPv6 address to its /64 prefix for fairness (optional).
 // IPv4 addresses are returned unchanged.
 func CoarsenIPv6(ip string) string {
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
+	return CoarsenIP(ip, 0, 64)
+}
+
+// CoarsenIP maps ip to its network prefix: v4Bits for IPv4 (e.g. 24 so a
+// CGNAT pool shares one key) and v6Bits for IPv6 (e.g. 64, 56 or 48, the
+// usual sizes of one customer's allocation). A prefix of 0, or of the
+// full address length, leaves that family unchanged, as do unparseable
+// values. Coarsened addresses are returned in CIDR form, e.g. "2001:db8::/48".
+func CoarsenIP(ip string, v4Bits, v6Bits int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
 		return ip
 	}
-	// IPv4 – no coarsening
-	if parsed.To4() != nil {
+	addr = addr.Unmap()
+	bits := v6Bits
+	if addr.Is4() {
+		bits = v4Bits
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return ip
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
 		return ip
 	}
-	// Zero-out the last 8 bytes to get a /64.
-	mask := net.CIDRMask(64, 128)
-	masked := parsed.Mask(mask)
-	return masked.String() + "/64"
+	return prefix.String()
 }
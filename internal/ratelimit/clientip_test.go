@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"gohst/internal/config"
 )
 
 func TestClientIP_RemoteAddrDirect(t *testing.T) {
@@ -26,6 +28,103 @@ func TestClientIP_IPv6(t *testing.T) {
 	}
 }
 
+func TestClientIP_CDNHeaders(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	config.RateLimit.ClientIPHeaders = []string{"CF-Connecting-IP", "True-Client-IP", "X-Forwarded-For"}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9, 10.0.0.9")
+	r.Header.Set("X-Real-IP", "198.51.100.8")
+	r.Header.Set("True-Client-IP", "203.0.113.5")
+	r.Header.Set("CF-Connecting-IP", "203.0.113.7")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected CF-Connecting-IP, got %s", ip)
+	}
+
+	// Invalid values fall through to the next header.
+	r.Header.Set("CF-Connecting-IP", "not-an-ip")
+	if ip := ClientIP(r); ip != "203.0.113.5" {
+		t.Fatalf("expected True-Client-IP, got %s", ip)
+	}
+	r.Header.Del("True-Client-IP")
+	if ip := ClientIP(r); ip != "198.51.100.9" {
+		t.Fatalf("expected XFF, and X-Real-IP to be ignored, got %s", ip)
+	}
+
+	// Untrusted peers cannot set them.
+	r.RemoteAddr = "198.51.100.1:443"
+	r.Header.Set("CF-Connecting-IP", "203.0.113.7")
+	if ip := ClientIP(r); ip != "198.51.100.1" {
+		t.Fatalf("untrusted peer should be returned as-is, got %s", ip)
+	}
+	if b := Boundary(r); b != BoundarySpoofed {
+		t.Fatalf("expected spoofed boundary, got %s", b)
+	}
+}
+
+func TestClientIP_TrustedHops(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	config.RateLimit.TrustedHops = 2
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "172.31.5.6:443"
+	r.Header.Set("X-Real-IP", "198.51.100.8")
+	r.Header.Add("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+	r.Header.Add("X-Forwarded-For", "172.31.0.10")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the entry 2 from the right, got %s", ip)
+	}
+	if b := Boundary(r); b != BoundaryProxy {
+		t.Fatalf("expected proxy boundary, got %s", b)
+	}
+
+	// Too few entries: the request skipped a hop, so use the peer.
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if ip := ClientIP(r); ip != "172.31.5.6" {
+		t.Fatalf("expected the peer, got %s", ip)
+	}
+	if b := Boundary(r); b != BoundarySpoofed {
+		t.Fatalf("expected spoofed boundary, got %s", b)
+	}
+}
+
+func TestClientIP_ForwardedSkip(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.2/32"}
+	config.RateLimit.ForwardedSkip = []string{"private", "loopback"}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:443"
+
+	// An internal hop that is not listed as trusted is passed over.
+	r.Header.Set("X-Forwarded-For", "198.51.100.9, 192.168.1.20")
+	if ip := ClientIP(r); ip != "198.51.100.9" {
+		t.Fatalf("expected the public client, got %s", ip)
+	}
+
+	// A client-supplied private address is never the client.
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if ip := ClientIP(r); ip != "10.0.0.2" {
+		t.Fatalf("expected the peer, got %s", ip)
+	}
+	r.Header.Set("X-Real-IP", "127.0.0.1")
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	if ip := ClientIP(r); ip != "198.51.100.9" {
+		t.Fatalf("expected X-Real-IP to be skipped, got %s", ip)
+	}
+
+	// Off by default.
+	config.RateLimit.ForwardedSkip = nil
+	if ip := ClientIP(r); ip != "127.0.0.1" {
+		t.Fatalf("expected X-Real-IP without a skip policy, got %s", ip)
+	}
+}
+
 func TestNormalizeIP(t *testing.T) {
 	cases := []struct {
 		input    string
@@ -79,3 +178,25 @@ func TestCoarsenIPv6(t *testing.T) {
 		t.Fatalf("expected 2001:db8:85a3::/64, got %s", result)
 	}
 }
+
+func TestCoarsenIP(t *testing.T) {
+	cases := []struct {
+		ip             string
+		v4Bits, v6Bits int
+		expected       string
+	}{
+		{"2001:db8:85a3:1234:5678::1", 0, 56, "2001:db8:85a3:1200::/56"},
+		{"2001:db8:85a3:1234:5678::1", 0, 48, "2001:db8:85a3::/48"},
+		{"2001:db8::1", 0, 0, "2001:db8::1"},
+		{"100.64.12.34", 24, 64, "100.64.12.0/24"},
+		{"::ffff:100.64.12.34", 24, 64, "100.64.12.0/24"},
+		{"100.64.12.34", 0, 64, "100.64.12.34"},
+		{"100.64.12.34", 32, 64, "100.64.12.34"},
+		{"not-an-ip", 24, 64, "not-an-ip"},
+	}
+	for _, tc := range cases {
+		if got := CoarsenIP(tc.ip, tc.v4Bits, tc.v6Bits); got != tc.expected {
+			t.Errorf("CoarsenIP(%q, %d, %d) = %q, want %q", tc.ip, tc.v4Bits, tc.v6Bits, got, tc.expected)
+		}
+	}
+}
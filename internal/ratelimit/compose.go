@@ -0,0 +1,199 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Composed limiters
+// ──────────────────────────────────────────────
+
+// Compose returns one middleware enforcing every limiter, for routes that
+// would otherwise chain several. The client IP is resolved once, each
+// limiter's key is computed once, and the rate checks of limiters sharing a
+// store run as one AllowMulti batch: with the built-in stores and
+// decorators, tokens are taken from every bucket or from none. A custom
+// store that does not implement MultiStore is checked bucket by bucket. Rate-limit headers come from the strictest result, and a
+// denial is answered by the limiter that denied with the longest wait.
+//
+// Limiters that pick their policy or key per request beyond plans and
+// tiers, or that run checks of their own (policy sets, penalty box,
+// concurrency, spoof, geo, user-agent, crawler, reputation and Tor
+// policies, state cookies, canaries, shadow mode), cannot be batched. They
+// run afterwards as ordinary middleware, in order, still sharing the
+// resolved client IP.
+func Compose(limiters ...*Limiter) func(http.Handler) http.Handler {
+	var batched []*limiterVariants
+	var chained []*Limiter
+	for _, l := range limiters {
+		if l.batchable() {
+			batched = append(batched, &limiterVariants{base: l})
+		} else {
+			chained = append(chained, l)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		for i := len(chained) - 1; i >= 0; i-- {
+			next = chained[i].Middleware(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = withClientIP(r)
+			if !config.RateLimit.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			checks, ok := composeChecks(w, r, batched)
+			if !ok {
+				return
+			}
+			results := allowComposed(r.Context(), checks)
+			for i, res := range results {
+				c := checks[i]
+				if res.Err != nil && !c.l.allowOnStoreError("allow", c.key, res.Err) {
+					c.l.denyResponse(w, r, c.l.failClosedResult(), c.key, c.keyType, "store_error")
+					return
+				}
+			}
+			if len(checks) > 0 {
+				i := mostRestrictive(results)
+				c := checks[i]
+				setRateLimitHeaders(w, c.req.Policy, results[i], c.keyType)
+				if !results[i].Allowed {
+					c.l.denyResponse(w, r, results[i], c.key, c.keyType, "rate")
+					return
+				}
+			}
+			for i, c := range checks {
+				if config.RateLimit.LogLevel == "debug" {
+					c.l.logAllowed(r, results[i], c.key, c.keyType)
+				}
+				if c.l.onAllow != nil {
+					c.l.onAllow(r, results[i])
+				}
+				r = withResult(r, c.l.policy.Scope, results[i])
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// batchable reports whether Compose can check l in a batch.
+func (l *Limiter) batchable() bool {
+	return l.policySet == nil && len(l.methodRules) == 0 && l.penaltyBox == nil &&
+		l.greylist == nil && l.concurrencyStore == nil && l.policy.ConcurrencyLimit == 0 &&
+		l.spoof == nil && l.geo == nil && len(l.uaPolicies) == 0 && l.crawler == nil &&
+		l.reputation == nil && l.tor == nil && l.cookie == nil && l.canary == nil &&
+		l.uploadUnit == 0 && l.policy.Escalation == 0 && !l.shadowed()
+}
+
+// composedCheck is the rate check of one limiter in a Compose batch.
+type composedCheck struct {
+	l       *Limiter
+	key     string
+	keyType string
+	req     AllowRequest
+}
+
+// composeChecks prepares the rate check of every enabled limiter that does
+// not bypass r. It reports false when a limiter already rejected r.
+func composeChecks(w http.ResponseWriter, r *http.Request, batched []*limiterVariants) ([]composedCheck, bool) {
+	lockdown, locked := CurrentLockdown()
+	checks := make([]composedCheck, 0, len(batched))
+	for _, v := range batched {
+		l := v.get(v.base.resolvePolicy())
+		if !l.policy.Enabled || l.bypassed(r) {
+			continue
+		}
+		boundaryRequests[boundaryIndex(Boundary(r))].Add(1)
+		key, keyType := l.keyFunc(r)
+		if locked && lockdown.BlockAnonymous && anonymousKeyType(keyType) {
+			l.lockdownResponse(w, r, key, keyType)
+			return nil, false
+		}
+		cost := l.policy.Cost
+		if cost < 1 {
+			cost = 1
+		}
+		if status, reason := checkRequestSize(r, l.policy); status != 0 {
+			charge := l.policy.OversizeCost
+			if charge < 1 {
+				charge = cost
+			}
+			result := l.store.Allow(r.Context(), l.bucketPrefix+key, l.policy, charge)
+			setRateLimitHeaders(w, l.policy, result, keyType)
+			l.rejectResponse(w, r, status, result, key, keyType, reason)
+			return nil, false
+		}
+		if l.policy.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, l.policy.MaxBodyBytes)
+		}
+		if l.costFunc != nil {
+			if c := l.costFunc(r); c > 0 {
+				cost = c
+			}
+		}
+		if l.policy.MaxCost > 0 && cost > l.policy.MaxCost {
+			l.costResponse(w, r, cost, key, keyType, "max_cost")
+			return nil, false
+		}
+		p := l.keyPolicy(r, l.policy, key, keyType)
+		if float64(cost) > p.capacity() {
+			l.costResponse(w, r, cost, key, keyType, "cost_capacity")
+			return nil, false
+		}
+		if locked {
+			window := p.Window
+			if p = lockdown.apply(p); float64(cost) > p.capacity() {
+				l.lockdownCostResponse(w, r, window, key, keyType)
+				return nil, false
+			}
+		}
+		checks = append(checks, composedCheck{
+			l: l, key: key, keyType: keyType,
+			req: AllowRequest{Key: l.bucketPrefix + key, Policy: p, Cost: cost},
+		})
+	}
+	return checks, true
+}
+
+// allowComposed runs checks with one AllowMulti per store. A store whose
+// checks share a bucket key is checked one request at a time instead, as
+// batches need distinct keys.
+func allowComposed(ctx context.Context, checks []composedCheck) []Result {
+	results := make([]Result, len(checks))
+	var stores []Store
+	groups := map[Store][]int{}
+	for i, c := range checks {
+		if _, ok := groups[c.l.store]; !ok {
+			stores = append(stores, c.l.store)
+		}
+		groups[c.l.store] = append(groups[c.l.store], i)
+	}
+	for _, store := range stores {
+		idx := groups[store]
+		reqs := make([]AllowRequest, len(idx))
+		seen := make(map[string]bool, len(idx))
+		distinct := true
+		for j, i := range idx {
+			reqs[j] = checks[i].req
+			distinct = distinct && !seen[reqs[j].Key]
+			seen[reqs[j].Key] = true
+		}
+		var res []Result
+		if distinct {
+			res = AllowMulti(ctx, store, reqs)
+		} else {
+			res = make([]Result, len(reqs))
+			for j, req := range reqs {
+				res[j] = store.Allow(ctx, req.Key, req.Policy, req.Cost)
+			}
+		}
+		for j, i := range idx {
+			results[i] = res[j]
+		}
+	}
+	return results
+}
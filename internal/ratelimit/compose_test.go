@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingMultiStore counts the calls reaching a memory store.
+type countingMultiStore struct {
+	*MemoryStore
+	allows, batches int
+}
+
+func (s *countingMultiStore) Allow(ctx context.Context, key string, p Policy, cost int) Result {
+	s.allows++
+	return s.MemoryStore.Allow(ctx, key, p, cost)
+}
+
+func (s *countingMultiStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	s.batches++
+	return s.MemoryStore.AllowMulti(ctx, reqs)
+}
+
+func TestCompose_BatchesAndUsesStrictestHeaders(t *testing.T) {
+	initTestConfig()
+	store := &countingMultiStore{MemoryStore: NewMemoryStore(time.Minute)}
+	defer store.Close()
+	ipCalls := 0
+	keyByIP := func(r *http.Request) (string, string) {
+		ipCalls++
+		return "ip:" + ClientIP(r), KeyTypeIP
+	}
+	site := NewLimiter(store, Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "site"}, keyByIP)
+	exports := NewLimiter(store, Policy{Limit: 2, Window: time.Hour, Enabled: true, Cost: 1, Scope: "exports"},
+		func(r *http.Request) (string, string) { return "exports:" + ClientIP(r), KeyTypeIP })
+	served := 0
+	handler := Compose(site, exports)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }))
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+	rr := serve()
+	if store.batches != 1 || store.allows != 0 || ipCalls != 1 {
+		t.Errorf("expected one batch and one key per limiter, got %d batches, %d allows, %d key calls", store.batches, store.allows, ipCalls)
+	}
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "2" {
+		t.Errorf("expected headers from the strictest limiter, got limit %q", got)
+	}
+
+	serve()
+	rr = serve()
+	if rr.Code != http.StatusTooManyRequests || served != 2 {
+		t.Fatalf("expected the third request denied by exports, got %d after %d served", rr.Code, served)
+	}
+	// All-or-nothing: the denied request took no token from the site bucket.
+	if res := store.MemoryStore.Allow(context.Background(), "ip:192.0.2.1", site.policy, 1); res.Remaining != 97 {
+		t.Errorf("expected the site bucket charged twice, got %d remaining", res.Remaining)
+	}
+}
+
+func TestCompose_ChainsUnbatchableLimiters(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	box.Strike("ip:192.0.2.1")
+	site := NewLimiter(store, Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "site"}, KeyByIP())
+	banned := NewLimiter(store, Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "bans"},
+		func(r *http.Request) (string, string) { return "ip:" + ClientIP(r), KeyTypeIP }, WithPenaltyBox(box))
+
+	rr := httptest.NewRecorder()
+	Compose(site, banned)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("expected the penalty box limiter to run")
+	})).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the banned key denied, got %d", rr.Code)
+	}
+}
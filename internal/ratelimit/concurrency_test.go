@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testConcurrencyStore is a conformance suite every ConcurrencyStore must
+// pass. ttl is the store's safety TTL; 0 skips the expiry cases.
+func testConcurrencyStore(t *testing.T, newStore func(t *testing.T) ConcurrencyStore, ttl time.Duration) {
+	t.Run("LimitAndRelease", func(t *testing.T) {
+		cs := newStore(t)
+		for i := 0; i < 2; i++ {
+			if ok, err := cs.Acquire("k", 2); !ok || err != nil {
+				t.Fatalf("acquire %d = %v, %v", i+1, ok, err)
+			}
+		}
+		if ok, _ := cs.Acquire("k", 2); ok {
+			t.Fatal("3rd acquire should be denied")
+		}
+		if err := cs.Release("k"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		if ok, _ := cs.Acquire("k", 2); !ok {
+			t.Fatal("acquire after release should succeed")
+		}
+	})
+
+	t.Run("OverRelease", func(t *testing.T) {
+		cs := newStore(t)
+		cs.Acquire("k", 2)
+		for i := 0; i < 3; i++ {
+			if err := cs.Release("k"); err != nil {
+				t.Fatalf("release %d: %v", i+1, err)
+			}
+		}
+		// Extra releases must not leave spare capacity behind.
+		assertCapacity(t, cs, "k", 2)
+	})
+
+	t.Run("ReleaseUnknownKey", func(t *testing.T) {
+		cs := newStore(t)
+		if err := cs.Release("never-acquired"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		assertCapacity(t, cs, "never-acquired", 1)
+	})
+
+	t.Run("Races", func(t *testing.T) {
+		cs := newStore(t)
+		const limit, workers, rounds = 3, 16, 25
+		var held, peak atomic.Int32
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					ok, err := cs.Acquire("race", limit)
+					if err != nil {
+						t.Errorf("acquire: %v", err)
+						return
+					}
+					if !ok {
+						continue
+					}
+					n := held.Add(1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					held.Add(-1)
+					if err := cs.Release("race"); err != nil {
+						t.Errorf("release: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if p := peak.Load(); p > limit {
+			t.Fatalf("peak in-flight = %d, limit %d", p, limit)
+		}
+		assertCapacity(t, cs, "race", limit)
+	})
+
+	if ttl <= 0 {
+		return
+	}
+
+	t.Run("ExpiryMidFlight", func(t *testing.T) {
+		cs := newStore(t)
+		cs.Acquire("k", 1)
+		time.Sleep(ttl + 500*time.Millisecond)
+
+		// The slot auto-released. The request's late Release must not
+		// drive the counter negative and grant extra capacity.
+		if err := cs.Release("k"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		assertCapacity(t, cs, "k", 1)
+	})
+}
+
+// assertCapacity checks that exactly limit slots can be acquired for key,
+// then releases them.
+func assertCapacity(t *testing.T, cs ConcurrencyStore, key string, limit int) {
+	t.Helper()
+	for i := 0; i < limit; i++ {
+		if ok, _ := cs.Acquire(key, limit); !ok {
+			t.Fatalf("acquire %d of %d should succeed", i+1, limit)
+		}
+	}
+	if ok, _ := cs.Acquire(key, limit); ok {
+		t.Fatalf("acquire %d should exceed the limit of %d", limit+1, limit)
+	}
+	for i := 0; i < limit; i++ {
+		cs.Release(key)
+	}
+}
+
+func TestMemoryConcurrencyStore_Conformance(t *testing.T) {
+	testConcurrencyStore(t, func(*testing.T) ConcurrencyStore { return NewMemoryConcurrencyStore() }, 0)
+}
+
+func TestMockStore_Conformance(t *testing.T) {
+	testConcurrencyStore(t, func(*testing.T) ConcurrencyStore { return NewMockStore() }, 0)
+}
+
+// TestRedisConcurrencyStore_Conformance runs against a real Redis when
+// RATE_LIMIT_TEST_REDIS_ADDR is set (e.g. localhost:6379).
+func TestRedisConcurrencyStore_Conformance(t *testing.T) {
+	addr := os.Getenv("RATE_LIMIT_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("RATE_LIMIT_TEST_REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	testConcurrencyStore(t, func(t *testing.T) ConcurrencyStore {
+		return NewRedisConcurrencyStore(client, "test:"+run+":"+t.Name()+":", time.Second)
+	}, time.Second)
+}
+
+func TestRedisConcurrencyStore_FailsOpen(t *testing.T) {
+	// Grab a free port, then close it so connections are refused.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	defer client.Close()
+	cs := NewRedisConcurrencyStore(client, "test:", time.Minute)
+
+	if ok, err := cs.Acquire("k", 1); !ok || err == nil {
+		t.Fatalf("Acquire = %v, %v, want fail-open with error", ok, err)
+	}
+	if err := cs.Release("k"); err == nil {
+		t.Fatal("Release should report the backend error")
+	}
+}
+
+func TestRedisConcurrencyStore_Timeout(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.RedisTimeoutMs = 50
+	addr := hangingListener(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true})
+	defer client.Close()
+	cs := NewRedisConcurrencyStore(client, "test:", time.Minute)
+
+	start := time.Now()
+	if ok, err := cs.Acquire("k", 1); !ok || err == nil {
+		t.Fatalf("Acquire = %v, %v, want fail-open with error", ok, err)
+	}
+	if err := cs.Release("k"); err == nil {
+		t.Fatal("Release should report the timeout")
+	}
+	lease, ok, err := cs.AcquireLease("k", 1)
+	if !ok || err == nil {
+		t.Fatalf("AcquireLease = %v, %v, want fail-open with error", ok, err)
+	}
+	if err := cs.RenewLease("k", lease); err == nil {
+		t.Fatal("RenewLease should report the timeout")
+	}
+	if err := cs.ReleaseLease("k", lease); err == nil {
+		t.Fatal("ReleaseLease should report the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected each command to give up after the timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Connection-level protections
+// ──────────────────────────────────────────────
+
+// ErrHandshakeLimited is returned from the TLS handshake when a peer has
+// exceeded its handshake rate. The connection is closed without a response.
+var ErrHandshakeLimited = errors.New("ratelimit: tls handshake rate exceeded")
+
+// HandshakeLimiter rate-limits TLS handshakes per peer IP. Handshakes are
+// expensive (asymmetric crypto) and happen before any HTTP middleware runs,
+// so floods must be stopped at the tls.Config level.
+//
+// Proxy headers are never consulted: at handshake time the only identity
+// available is the TCP peer address.
+type HandshakeLimiter struct {
+	store  Store
+	policy Policy
+}
+
+// NewHandshakeLimiter creates a handshake limiter backed by store.
+func NewHandshakeLimiter(store Store, policy Policy) *HandshakeLimiter {
+	return &HandshakeLimiter{store: store, policy: policy}
+}
+
+// Wrap returns a clone of cfg whose GetConfigForClient rejects peers that
+// exceed the handshake policy. An existing GetConfigForClient is preserved
+// and called after the check passes.
+func (h *HandshakeLimiter) Wrap(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	wrapped := cfg.Clone()
+	next := cfg.GetConfigForClient
+	wrapped.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if err := h.check(hello); err != nil {
+			return nil, err
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	return wrapped
+}
+
+// check consumes one handshake token for the hello's peer.
+func (h *HandshakeLimiter) check(hello *tls.ClientHelloInfo) error {
+	if !config.RateLimit.Enabled || !h.policy.Enabled || hello.Conn == nil {
+		return nil
+	}
+	ip := normalizeIP(extractIP(hello.Conn.RemoteAddr().String()))
+	key := "tlshs:" + ip
+
+	ctx := hello.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cost := h.policy.Cost
+	if cost < 1 {
+		cost = 1
+	}
+	result := h.store.Allow(ctx, key, h.policy, cost)
+	if result.Allowed {
+		return nil
+	}
+	log.Printf("[ratelimit] DENIED tls handshake | type=%s scope=%s key=%s retryAfter=%ds reason=handshake",
+		KeyTypeIP, h.policy.Scope, truncateKey(key), result.RetryAfter)
+	return ErrHandshakeLimited
+}
+
+// ConfigureServer applies connection-level protections from config to srv:
+//
+//   - a per-IP TLS handshake limit (when RATE_LIMIT_TLS_HANDSHAKE_LIMIT > 0)
+//   - a per-connection HTTP/2 concurrent-stream cap (RATE_LIMIT_HTTP2_MAX_STREAMS)
+//
+// Call it before ListenAndServeTLS. Capping streams per connection bounds the
+// work a single client can queue, which blunts rapid-reset style attacks.
+func ConfigureServer(srv *http.Server, store Store) {
+	cfg := config.RateLimit
+
+	if cfg.TLSHandshakeLimit > 0 {
+		hl := NewHandshakeLimiter(store, HandshakePolicy())
+		srv.TLSConfig = hl.Wrap(srv.TLSConfig)
+	}
+
+	if cfg.HTTP2MaxConcurrentStreams > 0 {
+		if srv.HTTP2 == nil {
+			srv.HTTP2 = &http.HTTP2Config{}
+		}
+		srv.HTTP2.MaxConcurrentStreams = cfg.HTTP2MaxConcurrentStreams
+	}
+}
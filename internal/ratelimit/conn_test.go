@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// addrConn is a net.Conn stub that only reports a remote address.
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func helloFrom(ip string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		Conn: addrConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 443}},
+	}
+}
+
+func TestHandshakeLimiter_DeniesAfterLimit(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 2, Window: time.Minute, Enabled: true, Cost: 1, Scope: "tls_handshake"}
+	cfg := NewHandshakeLimiter(store, p).Wrap(&tls.Config{})
+
+	for i := 0; i < 2; i++ {
+		if _, err := cfg.GetConfigForClient(helloFrom("9.9.9.9")); err != nil {
+			t.Fatalf("handshake %d should be allowed, got %v", i+1, err)
+		}
+	}
+	if _, err := cfg.GetConfigForClient(helloFrom("9.9.9.9")); err != ErrHandshakeLimited {
+		t.Fatalf("expected ErrHandshakeLimited, got %v", err)
+	}
+
+	// Other peers are unaffected.
+	if _, err := cfg.GetConfigForClient(helloFrom("8.8.8.8")); err != nil {
+		t.Fatalf("different peer should be allowed, got %v", err)
+	}
+}
+
+func TestHandshakeLimiter_ChainsExistingHook(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	called := false
+	base := &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		called = true
+		return nil, nil
+	}}
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1}
+	cfg := NewHandshakeLimiter(store, p).Wrap(base)
+
+	if _, err := cfg.GetConfigForClient(helloFrom("9.9.9.9")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !called {
+		t.Fatal("existing GetConfigForClient should be called")
+	}
+}
+
+func TestConfigureServer_HTTP2Streams(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.HTTP2MaxConcurrentStreams = 16
+
+	srv := &http.Server{}
+	ConfigureServer(srv, nil)
+	if srv.HTTP2 == nil || srv.HTTP2.MaxConcurrentStreams != 16 {
+		t.Fatal("expected HTTP/2 stream cap of 16")
+	}
+	if srv.TLSConfig != nil {
+		t.Fatal("handshake limiter should not be installed when disabled")
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+)
+
+// ──────────────────────────────────────────────
+// Results in the request context
+// ──────────────────────────────────────────────
+
+type resultKey struct{}
+
+// contextResult is one limiter's Result in a request context, linked to the
+// Results of the limiters that ran before it.
+type contextResult struct {
+	scope  string
+	result Result
+	parent *contextResult
+}
+
+// ResultFromContext returns the Result of the innermost limiter a request
+// passed, so handlers and templates can show the remaining quota:
+//
+//	if res, ok := ratelimit.ResultFromContext(r.Context()); ok {
+//		data["ExportsLeft"] = res.Remaining
+//	}
+func ResultFromContext(ctx context.Context) (Result, bool) {
+	if c, _ := ctx.Value(resultKey{}).(*contextResult); c != nil {
+		return c.result, true
+	}
+	return Result{}, false
+}
+
+// ScopeResultFromContext returns the Result of the limiter with policy
+// scope a request passed, for routes behind several limiters.
+func ScopeResultFromContext(ctx context.Context, scope string) (Result, bool) {
+	for c, _ := ctx.Value(resultKey{}).(*contextResult); c != nil; c = c.parent {
+		if c.scope == scope {
+			return c.result, true
+		}
+	}
+	return Result{}, false
+}
+
+// withResult returns r carrying the Result of the limiter with scope.
+func withResult(r *http.Request, scope string, result Result) *http.Request {
+	parent, _ := r.Context().Value(resultKey{}).(*contextResult)
+	c := &contextResult{scope: scope, result: result, parent: parent}
+	return r.WithContext(context.WithValue(r.Context(), resultKey{}, c))
+}
@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultFromContext(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	var got, outer Result
+	var ok, outerOK bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok = ResultFromContext(r.Context())
+		outer, outerOK = ScopeResultFromContext(r.Context(), "site")
+	})
+	site := NewLimiter(store, Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "site"}, KeyByIP())
+	exports := NewLimiter(store, Policy{Limit: 3, Window: time.Hour, Enabled: true, Cost: 1, Scope: "exports"}, KeyByIP())
+	handler := site.Middleware(exports.Middleware(next))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok || got.Limit != 3 || got.Remaining != 2 {
+		t.Errorf("expected the innermost Result, got %+v (%t)", got, ok)
+	}
+	if !outerOK || outer.Limit != 100 || outer.Remaining != 99 {
+		t.Errorf("expected the site Result by scope, got %+v (%t)", outer, outerOK)
+	}
+	if _, ok := ScopeResultFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "site"); ok {
+		t.Error("expected no Result outside the middleware")
+	}
+}
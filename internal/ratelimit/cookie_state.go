@@ -0,0 +1,305 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Client-side state cookie (anonymous traffic)
+// ──────────────────────────────────────────────
+
+// StateCookieConfig configures WithStateCookie.
+type StateCookieConfig struct {
+	// Secret signs the cookie (HMAC-SHA256). Use at least 32 random bytes
+	// and share it between instances.
+	Secret []byte
+
+	// Name is the cookie name; the policy scope is appended. Default "rl_state".
+	Name string
+
+	// ReconcileEvery is how long a cookie is trusted before its consumption
+	// is charged to the store. Default 5 minutes.
+	ReconcileEvery time.Duration
+
+	// IssuePolicy limits how many fresh cookies one /24 (IPv4) or /48
+	// (IPv6) network can obtain, so dropping the cookie does not reset the
+	// limit. Default 60 per minute with a burst of 60.
+	IssuePolicy Policy
+
+	// Secure sets the cookie's Secure attribute.
+	Secure bool
+
+	ledger *cookieLedger
+}
+
+// cookieState is the bucket carried by the cookie.
+type cookieState struct {
+	gen        string // generation: minted at issuance and at each reconcile
+	keyHash    string
+	bucket     Bucket
+	reconciled time.Time // last time consumption was charged to the store
+	used       int       // tokens consumed since reconciled
+}
+
+// WithStateCookie keeps the token bucket of IP-keyed (anonymous) requests in
+// a signed cookie instead of the store. The long tail of one-visit
+// visitors then never creates a store key: only cookie issuance is charged,
+// against a per-network bucket, and clients that stay longer than
+// ReconcileEvery have their consumption charged to their real key.
+//
+// Each instance keeps the bucket of every cookie generation it has seen,
+// and uses it instead of the cookie's copy, so replaying an old cookie to
+// the same instance gains nothing, and a generation that was reconciled is
+// not accepted again. A client replaying one cookie to every instance gets
+// at most one extra bucket per instance per ReconcileEvery.
+func WithStateCookie(cfg StateCookieConfig) Option {
+	if len(cfg.Secret) == 0 {
+		log.Println("[ratelimit] WithStateCookie: empty secret, state cookie disabled")
+		return func(*Limiter) {}
+	}
+	if cfg.Name == "" {
+		cfg.Name = "rl_state"
+	}
+	if cfg.ReconcileEvery <= 0 {
+		cfg.ReconcileEvery = 5 * time.Minute
+	}
+	if cfg.IssuePolicy.Limit == 0 {
+		cfg.IssuePolicy = Policy{Limit: 60, Window: time.Minute, Burst: 60, Scope: "state_cookie", Enabled: true, Cost: 1}
+	}
+	cfg.ledger = &cookieLedger{entries: map[string]*ledgerEntry{}, lastSweep: time.Now(), keep: 2 * cfg.ReconcileEvery}
+	return func(l *Limiter) { l.cookie = &cfg }
+}
+
+// cookieLedgerMaxKeys caps the generations a ledger holds. When full, new
+// generations are charged to the store directly.
+const cookieLedgerMaxKeys = 100000
+
+// cookieLedger is the per-instance record of cookie generations: the
+// bucket each one has left, and whether it was reconciled.
+type cookieLedger struct {
+	mu        sync.Mutex
+	entries   map[string]*ledgerEntry
+	lastSweep time.Time
+	keep      time.Duration // how long a generation outlives its last use: the cookie MaxAge
+}
+
+type ledgerEntry struct {
+	state    cookieState
+	spent    bool // reconciled: cookies carrying the generation are refused
+	lastUsed time.Time
+}
+
+// load returns the recorded state of the generation of st, adopting st
+// when the generation is new here. ok is false when the generation was
+// already reconciled, or is new and the ledger is full.
+func (c *cookieLedger) load(st cookieState, now time.Time) (cookieState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep(now)
+	e, seen := c.entries[st.gen]
+	switch {
+	case seen && e.spent:
+		return cookieState{}, false
+	case seen:
+		e.lastUsed = now
+		return e.state, true
+	case len(c.entries) >= cookieLedgerMaxKeys:
+		return cookieState{}, false
+	}
+	c.entries[st.gen] = &ledgerEntry{state: st, lastUsed: now}
+	return st, true
+}
+
+// save records st as the state of its generation. It returns false when
+// the generation is new and the ledger is full.
+func (c *cookieLedger) save(st cookieState, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, seen := c.entries[st.gen]
+	if !seen {
+		if len(c.entries) >= cookieLedgerMaxKeys {
+			return false
+		}
+		e = &ledgerEntry{}
+		c.entries[st.gen] = e
+	}
+	e.state, e.lastUsed = st, now
+	return true
+}
+
+// spend marks gen as reconciled.
+func (c *cookieLedger) spend(gen string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[gen]; ok {
+		e.spent, e.lastUsed = true, now
+	}
+}
+
+// sweep drops generations whose cookie has expired. It runs at most once a
+// minute so load stays cheap.
+func (c *cookieLedger) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	for gen, e := range c.entries {
+		if now.Sub(e.lastUsed) > c.keep {
+			delete(c.entries, gen)
+		}
+	}
+}
+
+// newCookieGen returns a random cookie generation.
+func newCookieGen() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// cookieAllow charges cost against the cookie bucket for key, falling back
+// to the store for issuance and reconciliation, and sets the new cookie.
+func (l *Limiter) cookieAllow(w http.ResponseWriter, r *http.Request, key string, policy Policy, cost int) Result {
+	cfg := l.cookie
+	name := cfg.Name
+	if policy.Scope != "" {
+		name += "_" + policy.Scope
+	}
+	now := time.Now()
+	max := policy.Limit + policy.Burst
+	fresh := Bucket{
+		Tokens:     float64(max),
+		MaxTokens:  policy.capacity(),
+		RefillRate: float64(policy.Limit) / policy.Window.Seconds(),
+		LastRefill: now,
+	}
+
+	st, ok := l.readStateCookie(r, name, key)
+	if ok {
+		// The ledger's copy wins over the cookie's, so replays gain nothing.
+		st, ok = cfg.ledger.load(st, now)
+	}
+	switch {
+	case !ok:
+		// New (or tampered, re-keyed or replayed) cookie: charge the issuance.
+		res := l.store.Allow(r.Context(), "cookie:"+networkOf(ClientIP(r)), cfg.IssuePolicy, 1)
+		if res.Err != nil || !res.Allowed {
+			return res
+		}
+		st = cookieState{gen: newCookieGen(), keyHash: hashValue(key), bucket: fresh, reconciled: now}
+
+	case now.Sub(st.reconciled) >= cfg.ReconcileEvery:
+		// Charge what the cookie consumed, plus this request, to the real key.
+		charge := min(st.used+cost, max)
+		res := l.store.Allow(r.Context(), key, policy, charge)
+		if res.Err != nil {
+			return res
+		}
+		cfg.ledger.spend(st.gen, now)
+		st.gen = newCookieGen()
+		st.bucket = fresh
+		st.bucket.Tokens = float64(res.Remaining)
+		st.reconciled, st.used = now, 0
+		if !res.Allowed {
+			st.bucket.Tokens = 0
+		}
+		if cfg.ledger.save(st, now) {
+			l.writeStateCookie(w, r, name, st)
+		}
+		return res
+	}
+
+	st.bucket.MaxTokens, st.bucket.RefillRate = fresh.MaxTokens, fresh.RefillRate
+	remaining, allowed := st.bucket.Allow(cost, now)
+	res := Result{Allowed: allowed, Limit: max, Remaining: remaining, ResetAt: st.bucket.ResetUnix()}
+	if allowed {
+		st.used += cost
+	} else {
+		res.RetryAfter = int(st.bucket.RetryAfter(cost))
+	}
+	if !cfg.ledger.save(st, now) {
+		// Ledger full: the store keeps the bucket instead.
+		return l.store.Allow(r.Context(), key, policy, cost)
+	}
+	l.writeStateCookie(w, r, name, st)
+	return res
+}
+
+// readStateCookie returns the cookie's state if it is present, correctly
+// signed, and was issued for key.
+func (l *Limiter) readStateCookie(r *http.Request, name, key string) (cookieState, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return cookieState{}, false
+	}
+	payloadB64, sigB64, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return cookieState{}, false
+	}
+	payload, err1 := base64.RawURLEncoding.DecodeString(payloadB64)
+	sig, err2 := base64.RawURLEncoding.DecodeString(sigB64)
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, l.signState(payload)) {
+		return cookieState{}, false
+	}
+
+	var st cookieState
+	var milliTokens, lastMs, reconciled int64
+	if _, err := fmt.Sscanf(string(payload), "%s %s %d %d %d %d",
+		&st.gen, &st.keyHash, &milliTokens, &lastMs, &reconciled, &st.used); err != nil {
+		return cookieState{}, false
+	}
+	if st.keyHash != hashValue(key) {
+		return cookieState{}, false
+	}
+	st.bucket.Tokens = float64(milliTokens) / 1000
+	st.bucket.LastRefill = time.UnixMilli(lastMs)
+	st.reconciled = time.Unix(reconciled, 0)
+	return st, true
+}
+
+func (l *Limiter) writeStateCookie(w http.ResponseWriter, r *http.Request, name string, st cookieState) {
+	payload := []byte(fmt.Sprintf("%s %s %d %d %d %d",
+		st.gen, st.keyHash, int64(math.Round(st.bucket.Tokens*1000)), st.bucket.LastRefill.UnixMilli(), st.reconciled.Unix(), st.used))
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(l.signState(payload)),
+		Path:     "/",
+		MaxAge:   int((2 * l.cookie.ReconcileEvery).Seconds()),
+		HttpOnly: true,
+		Secure:   l.cookie.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (l *Limiter) signState(payload []byte) []byte {
+	mac := hmac.New(sha256.New, l.cookie.Secret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:16]
+}
+
+// networkOf returns the /24 (IPv4) or /48 (IPv6) network containing ip, or
+// ip itself if it does not parse.
+func networkOf(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
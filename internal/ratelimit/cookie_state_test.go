@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cookieClient sends requests from one IP, replaying the cookies it was set.
+type cookieClient struct {
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (c *cookieClient) do() int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	for _, ck := range c.cookies {
+		req.AddCookie(ck)
+	}
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, req)
+	for _, ck := range rr.Result().Cookies() {
+		c.cookies[ck.Name] = ck
+	}
+	return rr.Code
+}
+
+func newCookieClient(store Store, p Policy, cfg StateCookieConfig) *cookieClient {
+	cfg.Secret = []byte("0123456789abcdef0123456789abcdef")
+	limiter := NewLimiter(store, p, KeyByIP(), WithStateCookie(cfg))
+	return &cookieClient{
+		handler: limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+		cookies: make(map[string]*http.Cookie),
+	}
+}
+
+func TestStateCookie_LimitsWithoutStoreKeys(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 2, Window: time.Hour, Enabled: true, Cost: 1, Scope: "browse"}
+	c := newCookieClient(store, p, StateCookieConfig{})
+
+	if c.do() != http.StatusOK || c.do() != http.StatusOK {
+		t.Fatal("first two requests should be allowed")
+	}
+	if code := c.do(); code != http.StatusTooManyRequests {
+		t.Fatalf("3rd request: expected 429 from the cookie bucket, got %d", code)
+	}
+	calls := store.Calls()
+	if len(calls) != 1 || calls[0].Key != "cookie:1.2.3.0/24" {
+		t.Fatalf("only the cookie issuance should reach the store, got %+v", calls)
+	}
+	if _, ok := c.cookies["rl_state_browse"]; !ok {
+		t.Fatal("cookie name should include the scope")
+	}
+}
+
+func TestStateCookie_DroppedOrTamperedCookieChargesIssuance(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 5, Window: time.Hour, Enabled: true, Cost: 1, Scope: "browse"}
+	issue := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "issue"}
+	c := newCookieClient(store, p, StateCookieConfig{IssuePolicy: issue})
+
+	if code := c.do(); code != http.StatusOK {
+		t.Fatalf("1st request: expected 200, got %d", code)
+	}
+	c.cookies["rl_state_browse"].Value = "forged." + c.cookies["rl_state_browse"].Value[7:]
+	if code := c.do(); code != http.StatusTooManyRequests {
+		t.Fatalf("tampered cookie: expected 429 from issuance limit, got %d", code)
+	}
+	c.cookies = make(map[string]*http.Cookie)
+	if code := c.do(); code != http.StatusTooManyRequests {
+		t.Fatalf("dropped cookie: expected 429 from issuance limit, got %d", code)
+	}
+}
+
+func TestStateCookie_ReconcilesToStore(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1, Scope: "browse"}
+	c := newCookieClient(store, p, StateCookieConfig{ReconcileEvery: time.Nanosecond})
+
+	c.do() // issuance
+	c.do() // reconcile: charges the first request and this one
+	calls := store.Calls()
+	if len(calls) != 2 || calls[1].Key != "ip:1.2.3.4" || calls[1].Cost != 2 {
+		t.Fatalf("expected reconcile of cost 2 on ip:1.2.3.4, got %+v", calls)
+	}
+}
+
+func TestStateCookie_ReplayGainsNothing(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 3, Window: time.Hour, Enabled: true, Cost: 1, Scope: "browse"}
+	issue := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "issue"}
+	c := newCookieClient(store, p, StateCookieConfig{IssuePolicy: issue})
+
+	c.do()
+	fresh := *c.cookies["rl_state_browse"]
+	codes := []int{}
+	for i := 0; i < 4; i++ {
+		c.cookies["rl_state_browse"] = &fresh
+		codes = append(codes, c.do())
+	}
+	want := []int{200, 200, 429, 429}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("replaying one cookie: expected %v, got %v", want, codes)
+		}
+	}
+}
+
+func TestStateCookie_ReconciledGenerationRefused(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1, Scope: "browse"}
+	issue := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "issue"}
+	c := newCookieClient(store, p, StateCookieConfig{IssuePolicy: issue, ReconcileEvery: 10 * time.Millisecond})
+
+	c.do()
+	old := *c.cookies["rl_state_browse"]
+	time.Sleep(15 * time.Millisecond)
+	if code := c.do(); code != http.StatusOK {
+		t.Fatalf("reconcile: expected 200, got %d", code)
+	}
+	c.cookies["rl_state_browse"] = &old
+	if code := c.do(); code != http.StatusTooManyRequests {
+		t.Fatalf("reconciled generation: expected it to be treated as new and hit the issuance limit, got %d", code)
+	}
+}
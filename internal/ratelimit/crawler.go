@@ -0,0 +1,265 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Verified search-engine crawlers
+// ──────────────────────────────────────────────
+
+// Crawler describes a search-engine crawler and how to verify it. A
+// request claims to be the crawler when its User-Agent contains one of
+// UserAgents; the claim holds when the client IP is in Ranges, or, when
+// Ranges is nil, when its reverse DNS name ends in one of Domains and that
+// name resolves back to the IP.
+type Crawler struct {
+	Name       string
+	UserAgents []string
+	Domains    []string
+	Ranges     *IPSet
+}
+
+// Googlebot is Google's crawler, verified by reverse DNS. Set Ranges from
+// GooglebotRangesURL to verify by range instead.
+var Googlebot = Crawler{
+	Name:       "googlebot",
+	UserAgents: []string{"Googlebot", "Google-InspectionTool", "GoogleOther"},
+	Domains:    []string{".googlebot.com", ".google.com"},
+}
+
+// Bingbot is Microsoft's crawler, verified by reverse DNS. Set Ranges from
+// BingbotRangesURL to verify by range instead.
+var Bingbot = Crawler{
+	Name:       "bingbot",
+	UserAgents: []string{"bingbot", "BingPreview", "msnbot"},
+	Domains:    []string{".search.msn.com"},
+}
+
+// Published crawler ranges, in the format ParseCrawlerRanges reads.
+const (
+	GooglebotRangesURL = "https://developers.google.com/search/apis/ipranges/googlebot.json"
+	BingbotRangesURL   = "https://www.bing.com/toolbox/bingbot.json"
+)
+
+// ParseCrawlerRanges reads the range list format Google and Bing publish:
+// {"prefixes":[{"ipv4Prefix":"..."},{"ipv6Prefix":"..."}]}.
+func ParseCrawlerRanges(body []byte) ([]string, error) {
+	var doc struct {
+		Prefixes []struct {
+			IPv4 string `json:"ipv4Prefix"`
+			IPv6 string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, p := range doc.Prefixes {
+		for _, prefix := range []string{p.IPv4, p.IPv6} {
+			if prefix != "" {
+				out = append(out, prefix)
+			}
+		}
+	}
+	return out, nil
+}
+
+// LoadCrawlerRanges downloads and parses a published crawler range list,
+// e.g. GooglebotRangesURL.
+func LoadCrawlerRanges(ctx context.Context, url string) (*IPSet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := ParseCrawlerRanges(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no ranges in %s", url)
+	}
+	return ParseIPSet(ranges)
+}
+
+// DNSResolver is the subset of *net.Resolver crawler verification uses.
+type DNSResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+const (
+	crawlerLookupTimeout = 2 * time.Second
+	crawlerCacheTTL      = 6 * time.Hour
+	crawlerCacheMax      = 10_000
+)
+
+// CrawlerVerifier verifies crawler claims. DNS verdicts, positive and
+// negative, are cached per IP for six hours, so each crawler IP costs one
+// lookup; a lookup that takes over two seconds fails the claim.
+type CrawlerVerifier struct {
+	crawlers []Crawler
+	resolver DNSResolver
+
+	mu    sync.Mutex
+	cache map[string]crawlerVerdict
+}
+
+type crawlerVerdict struct {
+	ok      bool
+	expires time.Time
+}
+
+// NewCrawlerVerifier creates a verifier for crawlers, or for Googlebot and
+// Bingbot when none are given.
+func NewCrawlerVerifier(crawlers ...Crawler) *CrawlerVerifier {
+	if len(crawlers) == 0 {
+		crawlers = []Crawler{Googlebot, Bingbot}
+	}
+	return &CrawlerVerifier{
+		crawlers: crawlers,
+		resolver: net.DefaultResolver,
+		cache:    make(map[string]crawlerVerdict),
+	}
+}
+
+// WithResolver replaces the DNS resolver, e.g. for tests.
+func (v *CrawlerVerifier) WithResolver(resolver DNSResolver) *CrawlerVerifier {
+	v.resolver = resolver
+	return v
+}
+
+// Verify returns the name of the crawler r verifiably comes from. Requests
+// merely claiming to be a crawler in their User-Agent return false.
+func (v *CrawlerVerifier) Verify(r *http.Request) (string, bool) {
+	ua := r.UserAgent()
+	if ua == "" {
+		return "", false
+	}
+	for _, c := range v.crawlers {
+		if !claimsCrawler(ua, c) {
+			continue
+		}
+		ip := ClientIP(r)
+		if c.Ranges != nil {
+			return c.Name, c.Ranges.Contains(ip)
+		}
+		return c.Name, v.verifyDNS(r.Context(), c, ip)
+	}
+	return "", false
+}
+
+func claimsCrawler(ua string, c Crawler) bool {
+	for _, token := range c.UserAgents {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *CrawlerVerifier) verifyDNS(ctx context.Context, c Crawler, ip string) bool {
+	cacheKey := c.Name + "|" + ip
+	now := time.Now()
+	v.mu.Lock()
+	if verdict, ok := v.cache[cacheKey]; ok && now.Before(verdict.expires) {
+		v.mu.Unlock()
+		return verdict.ok
+	}
+	v.mu.Unlock()
+
+	ok := v.lookup(ctx, c, ip)
+
+	v.mu.Lock()
+	if len(v.cache) >= crawlerCacheMax {
+		clear(v.cache)
+	}
+	v.cache[cacheKey] = crawlerVerdict{ok: ok, expires: now.Add(crawlerCacheTTL)}
+	v.mu.Unlock()
+	return ok
+}
+
+// lookup does the reverse-then-forward DNS check.
+func (v *CrawlerVerifier) lookup(ctx context.Context, c Crawler, ip string) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), crawlerLookupTimeout)
+	defer cancel()
+	names, err := v.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !hasCrawlerDomain(name, c.Domains) {
+			continue
+		}
+		addrs, err := v.resolver.LookupHost(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if normalizeIP(addr) == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasCrawlerDomain(name string, domains []string) bool {
+	for _, d := range domains {
+		if strings.HasSuffix(name, strings.ToLower(d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ──────────────────────────────────────────────
+// Limiter integration
+// ──────────────────────────────────────────────
+
+type crawlerConfig struct {
+	verifier *CrawlerVerifier
+	policy   Policy
+}
+
+// WithCrawlerPolicy charges verified crawlers against policy instead of
+// the limiter's, in one "crawler:<name>" bucket per crawler however many
+// IPs it crawls from. Requests that only claim a crawler User-Agent keep
+// the normal policy and key.
+func WithCrawlerPolicy(verifier *CrawlerVerifier, policy Policy) Option {
+	return func(l *Limiter) { l.crawler = &crawlerConfig{verifier: verifier, policy: policy} }
+}
+
+// crawlerPolicy returns the crawler bucket and policy for a verified
+// crawler.
+func (l *Limiter) crawlerPolicy(r *http.Request) (string, Policy, bool) {
+	if l.crawler == nil {
+		return "", Policy{}, false
+	}
+	name, ok := l.crawler.verifier.Verify(r)
+	if !ok {
+		return "", Policy{}, false
+	}
+	return "crawler:" + name, l.crawler.policy, true
+}
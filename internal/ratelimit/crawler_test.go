@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDNS resolves from fixed tables and counts reverse lookups.
+type fakeDNS struct {
+	ptr     map[string][]string
+	host    map[string][]string
+	lookups atomic.Int32
+}
+
+func (d *fakeDNS) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	d.lookups.Add(1)
+	if names, ok := d.ptr[addr]; ok {
+		return names, nil
+	}
+	return nil, errors.New("no PTR")
+}
+
+func (d *fakeDNS) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addrs, ok := d.host[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func crawlerRequest(remote, ua string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote + ":1234"
+	r.Header.Set("User-Agent", ua)
+	return r
+}
+
+const googlebotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+func TestCrawlerVerifier_DNS(t *testing.T) {
+	dns := &fakeDNS{
+		ptr: map[string][]string{
+			"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."},
+			"6.6.6.6":     {"crawl-6-6-6-6.googlebot.com.evil.test."},
+			"7.7.7.7":     {"fake.googlebot.com."},
+		},
+		host: map[string][]string{
+			"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"},
+			"fake.googlebot.com":              {"66.249.66.99"},
+		},
+	}
+	v := NewCrawlerVerifier().WithResolver(dns)
+
+	if name, ok := v.Verify(crawlerRequest("66.249.66.1", googlebotUA)); !ok || name != "googlebot" {
+		t.Fatalf("real Googlebot: got %q, %v", name, ok)
+	}
+	for _, ip := range []string{"6.6.6.6", "7.7.7.7", "8.8.8.8"} {
+		if _, ok := v.Verify(crawlerRequest(ip, googlebotUA)); ok {
+			t.Errorf("%s should not verify", ip)
+		}
+	}
+	if _, ok := v.Verify(crawlerRequest("66.249.66.1", "curl/8.0")); ok {
+		t.Error("a request not claiming a crawler should not verify")
+	}
+
+	// Verdicts are cached.
+	before := dns.lookups.Load()
+	v.Verify(crawlerRequest("66.249.66.1", googlebotUA))
+	v.Verify(crawlerRequest("8.8.8.8", googlebotUA))
+	if dns.lookups.Load() != before {
+		t.Fatal("cached verdicts should not query DNS")
+	}
+}
+
+func TestCrawlerVerifier_Ranges(t *testing.T) {
+	ranges, err := ParseCrawlerRanges([]byte(`{"prefixes":[{"ipv4Prefix":"157.55.39.0/24"},{"ipv6Prefix":"2a01:111:f403::/48"}]}`))
+	if err != nil || len(ranges) != 2 {
+		t.Fatalf("got %v, %v", ranges, err)
+	}
+	bing := Bingbot
+	bing.Ranges = MustParseIPSet(ranges...)
+	v := NewCrawlerVerifier(bing).WithResolver(&fakeDNS{})
+
+	ua := "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)"
+	if _, ok := v.Verify(crawlerRequest("157.55.39.10", ua)); !ok {
+		t.Fatal("IP in published range should verify")
+	}
+	if _, ok := v.Verify(crawlerRequest("157.55.40.10", ua)); ok {
+		t.Fatal("IP outside the ranges should not verify")
+	}
+}
+
+func TestMiddleware_CrawlerPolicy(t *testing.T) {
+	initTestConfig()
+	dns := &fakeDNS{
+		ptr:  map[string][]string{"66.249.66.1": {"crawl.googlebot.com."}},
+		host: map[string][]string{"crawl.googlebot.com": {"66.249.66.1"}},
+	}
+	store := NewMockStore()
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "browse"}
+	crawl := Policy{Limit: 1000, Window: time.Minute, Enabled: true, Cost: 1, Scope: "crawler"}
+	h := NewLimiter(store, p, KeyByIP(), WithCrawlerPolicy(NewCrawlerVerifier().WithResolver(dns), crawl)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), crawlerRequest("66.249.66.1", googlebotUA))
+	h.ServeHTTP(httptest.NewRecorder(), crawlerRequest("6.6.6.6", googlebotUA))
+
+	calls := store.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", calls)
+	}
+	if calls[0].Key != "crawler:googlebot" || calls[0].Policy.Limit != 1000 {
+		t.Fatalf("verified crawler: got %+v", calls[0])
+	}
+	if calls[1].Key != "ip:6.6.6.6" || calls[1].Policy.Limit != 10 {
+		t.Fatalf("fake crawler: got %+v", calls[1])
+	}
+}
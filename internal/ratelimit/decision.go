@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Decision API (used by cmd/ratelimitd)
+// ──────────────────────────────────────────────
+
+// DecisionServer exposes a store and a set of named policies over HTTP, so
+// services not written in Go can share the same limits and Redis state.
+//
+//	POST /v1/check   {"key": "ip:1.2.3.4", "policy": "auth_sensitive", "cost": 1}
+//	POST /v1/reset   {"key": "ip:1.2.3.4"}
+//	GET  /v1/policies
+//	GET  /v1/timeline?key=ip:1.2.3.4   (when store wraps a *TimelineStore)
+//	GET  /v1/tuner, POST /v1/tuner?scope=x&action=apply|revert   (when store wraps a *TunerStore)
+//	GET  /healthz
+//
+// Checks always answer 200 with the decision in the body, plus the usual
+// rate-limit headers; callers enforce the result themselves.
+type DecisionServer struct {
+	store    Store
+	policies map[string]Policy
+	token    string
+	mux      *http.ServeMux
+}
+
+// DecisionRequest is the body of POST /v1/check and /v1/reset.
+type DecisionRequest struct {
+	Key    string `json:"key"`
+	Policy string `json:"policy"`
+	Cost   int    `json:"cost"`
+}
+
+// DecisionResponse is the body returned by POST /v1/check.
+type DecisionResponse struct {
+	Allowed    bool   `json:"allowed"`
+	Limit      int    `json:"limit"`
+	Remaining  int    `json:"remaining"`
+	RetryAfter int    `json:"retry_after"`
+	ResetAt    int64  `json:"reset_at"`
+	Error      string `json:"error,omitempty"` // store error, when the decision is a fallback
+}
+
+// NewDecisionServer creates a DecisionServer. When token is non-empty,
+// every endpoint except /healthz requires "Authorization: Bearer <token>".
+func NewDecisionServer(store Store, policies map[string]Policy, token string) *DecisionServer {
+	s := &DecisionServer{store: store, policies: policies, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /v1/check", s.auth(s.handleCheck))
+	s.mux.HandleFunc("POST /v1/reset", s.auth(s.handleReset))
+	s.mux.HandleFunc("GET /v1/policies", s.auth(s.handlePolicies))
+	if ts, ok := findStore[*TimelineStore](store); ok {
+		s.mux.HandleFunc("GET /v1/timeline", s.auth(TimelineHandler(ts).ServeHTTP))
+	}
+	if ts, ok := findStore[*TunerStore](store); ok {
+		s.mux.HandleFunc("/v1/tuner", s.auth(TunerHandler(ts.Tuner()).ServeHTTP))
+	}
+	s.mux.Handle("GET /healthz", HealthHandler(store))
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *DecisionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *DecisionServer) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got := extractBearerToken(r)
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (s *DecisionServer) handleCheck(w http.ResponseWriter, r *http.Request) {
+	var req DecisionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if req.Key == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key is required"})
+		return
+	}
+	policy, ok := s.policies[req.Policy]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown policy " + strconv.Quote(req.Policy)})
+		return
+	}
+	cost := req.Cost
+	if cost < 1 {
+		cost = policy.Cost
+	}
+	if cost < 1 {
+		cost = 1
+	}
+
+	result := s.store.Allow(r.Context(), req.Key, policy, cost)
+	resp := DecisionResponse{
+		Allowed:    result.Allowed,
+		Limit:      result.Limit,
+		Remaining:  result.Remaining,
+		RetryAfter: result.RetryAfter,
+		ResetAt:    result.ResetAt,
+	}
+	if result.Err != nil {
+		resp.Error = result.Err.Error()
+		if policy.failClosed() {
+			failedClosed.Add(1)
+			resp.Allowed, resp.Remaining, resp.RetryAfter = false, 0, 1
+		} else {
+			failedOpen.Add(1)
+		}
+	}
+	setRateLimitHeaders(w, policy, result, "")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *DecisionServer) handleReset(w http.ResponseWriter, r *http.Request) {
+	var req DecisionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Key == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key is required"})
+		return
+	}
+	if err := s.store.Reset(req.Key); err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *DecisionServer) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	type policyInfo struct {
+		Name   string `json:"name"`
+		Limit  int    `json:"limit"`
+		Window int    `json:"window"` // seconds
+		Burst  int    `json:"burst"`
+	}
+	out := make([]policyInfo, 0, len(s.policies))
+	for name, p := range s.policies {
+		out = append(out, policyInfo{Name: name, Limit: p.Limit, Window: int(p.Window.Seconds()), Burst: p.Burst})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// findStore returns the first store of type T in store's chain of
+// decorators, following Inner().
+func findStore[T Store](store Store) (T, bool) {
+	for store != nil {
+		if t, ok := store.(T); ok {
+			return t, true
+		}
+		w, ok := store.(interface{ Inner() Store })
+		if !ok {
+			break
+		}
+		store = w.Inner()
+	}
+	var zero T
+	return zero, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ──────────────────────────────────────────────
+// Named policies
+// ──────────────────────────────────────────────
+
+// PresetPolicies returns the built-in policies keyed by scope.
+func PresetPolicies() map[string]Policy {
+	out := make(map[string]Policy)
+	for _, p := range []Policy{DefaultPolicy(), PublicBrowsePolicy(), APIDefaultPolicy(), AuthSensitivePolicy(), ExportsPolicy()} {
+		out[p.Scope] = p
+	}
+	return out
+}
+
+// ConfiguredPolicies returns the built-in policies with the named policies
+// of the config file (RATE_LIMIT_CONFIG_FILE) applied on top. A file policy
+// overrides the preset of the same scope, or the default policy under a
+// new scope.
+func ConfiguredPolicies() (map[string]Policy, error) {
+	out := PresetPolicies()
+	if len(config.RateLimit.Policies) == 0 {
+		return out, nil
+	}
+	overrides, err := ParsePolicyOverrides(config.RateLimit.Policies)
+	if err != nil {
+		return nil, err
+	}
+	for name, o := range overrides {
+		base, ok := out[name]
+		if !ok {
+			base = DefaultPolicy()
+			base.Scope = name
+		}
+		p := o.Apply(base)
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("policy %q: %v", name, err)
+		}
+		out[name] = p
+	}
+	return out, nil
+}
+
+// ParsePolicies parses a comma-separated list of "name=limit/window[/burst]"
+// entries (window in seconds), e.g. "search=50/30/10,upload=5/60".
+func ParsePolicies(spec string) (map[string]Policy, error) {
+	out := make(map[string]Policy)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("policy %q: want name=limit/window[/burst]", entry)
+		}
+		fields := strings.Split(values, "/")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("policy %q: want name=limit/window[/burst]", entry)
+		}
+		nums := make([]int, 3)
+		for i, f := range fields {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("policy %q: invalid number %q", entry, f)
+			}
+			nums[i] = n
+		}
+		if nums[0] == 0 || nums[1] == 0 {
+			return nil, fmt.Errorf("policy %q: limit and window must be positive", entry)
+		}
+		out[name] = Policy{
+			Limit:   nums[0],
+			Window:  time.Duration(nums[1]) * time.Second,
+			Burst:   nums[2],
+			Scope:   name,
+			Enabled: true,
+			Cost:    1,
+		}
+	}
+	return out, nil
+}
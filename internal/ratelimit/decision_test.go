@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestDecisionServer_CheckAndReset(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	policies := map[string]Policy{"tight": {Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "tight"}}
+	srv := NewDecisionServer(store, policies, "secret")
+
+	call := func(path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+	decide := func() DecisionResponse {
+		rr := call("/v1/check", `{"key":"ip:1.2.3.4","policy":"tight"}`, "secret")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("check: expected 200, got %d: %s", rr.Code, rr.Body)
+		}
+		var resp DecisionResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return resp
+	}
+
+	if rr := call("/v1/check", `{"key":"k","policy":"tight"}`, "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("bad token: expected 401, got %d", rr.Code)
+	}
+	if rr := call("/v1/check", `{"key":"k","policy":"nope"}`, "secret"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown policy: expected 400, got %d", rr.Code)
+	}
+
+	if resp := decide(); !resp.Allowed {
+		t.Fatal("1st check should be allowed")
+	}
+	if resp := decide(); resp.Allowed || resp.RetryAfter < 1 {
+		t.Fatalf("2nd check = %+v, want denial", resp)
+	}
+	if rr := call("/v1/reset", `{"key":"ip:1.2.3.4"}`, "secret"); rr.Code != http.StatusNoContent {
+		t.Fatalf("reset: expected 204, got %d", rr.Code)
+	}
+	if resp := decide(); !resp.Allowed {
+		t.Fatal("check after reset should be allowed")
+	}
+}
+
+func TestDecisionServer_MountsWrappedDebugEndpoints(t *testing.T) {
+	initTestConfig()
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	store := NewTunerStore(NewTimelineStore(NewMockStore(), 10, time.Minute), tuner)
+	srv := NewDecisionServer(store, PresetPolicies(), "")
+
+	for _, path := range []string{"/v1/timeline?key=k", "/v1/tuner"} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, rr.Code)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	NewDecisionServer(NewMockStore(), nil, "").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/tuner", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("plain store: expected 404 for /v1/tuner, got %d", rr.Code)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	got, err := ParsePolicies("search=50/30/10, upload=5/60")
+	if err != nil {
+		t.Fatalf("ParsePolicies: %v", err)
+	}
+	if p := got["search"]; p.Limit != 50 || p.Window != 30*time.Second || p.Burst != 10 || p.Scope != "search" {
+		t.Fatalf("search = %+v", p)
+	}
+	if p := got["upload"]; p.Limit != 5 || p.Burst != 0 {
+		t.Fatalf("upload = %+v", p)
+	}
+	for _, bad := range []string{"search", "search=50", "search=x/30", "search=0/30"} {
+		if _, err := ParsePolicies(bad); err == nil {
+			t.Fatalf("ParsePolicies(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConfiguredPolicies(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.Policies = []byte(`{"api_default": {"limit": 200}, "search": {"limit": 50, "window": "30s"}}`)
+	got, err := ConfiguredPolicies()
+	if err != nil {
+		t.Fatalf("ConfiguredPolicies: %v", err)
+	}
+	if p, preset := got["api_default"], APIDefaultPolicy(); p.Limit != 200 || p.Window != preset.Window || p.Burst != preset.Burst {
+		t.Errorf("api_default = %+v, want the preset with limit 200", p)
+	}
+	if p := got["search"]; p.Limit != 50 || p.Window != 30*time.Second || p.Scope != "search" || !p.Enabled {
+		t.Errorf("search = %+v", p)
+	}
+	if _, ok := got["exports"]; !ok {
+		t.Error("expected the presets to be kept")
+	}
+
+	config.RateLimit.Policies = []byte(`{"search": {"limit": 0}}`)
+	if _, err := ConfiguredPolicies(); err == nil {
+		t.Error("expected an invalid file policy to fail")
+	}
+}
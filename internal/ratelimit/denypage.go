@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+
+	"gohst/internal/config"
+	"gohst/internal/render"
+)
+
+// ──────────────────────────────────────────────
+// Templated deny pages
+// ──────────────────────────────────────────────
+
+// DenyPage is the data of a templated deny page, available to the template
+// as .Data.
+type DenyPage struct {
+	Status     int    // response status, 429 unless the policy sets DenyStatus
+	Scope      string // policy scope
+	KeyType    string // what the client was limited by, e.g. "user" or "ip"
+	Message    string // from the limiter's DenyMessageFunc
+	RetryAfter int    // seconds until the client may retry, as in Retry-After
+	Limit      int
+	Remaining  int
+	ResetAt    int64 // unix timestamp
+}
+
+// WithDenyTemplate renders HTML rate-limit denials with the named view of
+// the render package, e.g. "errors/429" for templates/views/errors/429.tmpl,
+// inside the site layout. It overrides RATE_LIMIT_DENY_TEMPLATE.
+func WithDenyTemplate(name string) Option {
+	return func(l *Limiter) { l.denyTemplate = name }
+}
+
+var (
+	denyViewOnce sync.Once
+	denyView     *render.View
+)
+
+// denyPageView returns the view deny pages are rendered with. Templates are
+// parsed on the first templated denial, not on every one.
+func denyPageView() *render.View {
+	denyViewOnce.Do(func() { denyView = render.NewView() })
+	return denyView
+}
+
+// renderDenyPage renders the deny template of l, and reports whether it did.
+// retryAfter is the delay advertised in Retry-After. JSON and minimal
+// responses never use the template.
+func (l *Limiter) renderDenyPage(w http.ResponseWriter, r *http.Request, status int, result Result, keyType string, retryAfter int) bool {
+	name := l.denyTemplate
+	if name == "" {
+		name = config.RateLimit.DenyTemplate
+	}
+	if name == "" || l.policy.DenyBody == DenyBodyMinimal || responseFormat(r, l.policy) != "html" {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	denyPageView().Render(w, r, name, DenyPage{
+		Status:     status,
+		Scope:      l.policy.Scope,
+		KeyType:    keyType,
+		Message:    l.denyMessage(keyType),
+		RetryAfter: retryAfter,
+		Limit:      result.Limit,
+		Remaining:  result.Remaining,
+		ResetAt:    result.ResetAt,
+	})
+	return true
+}
+
+// ──────────────────────────────────────────────
+// Deny messages
+// ──────────────────────────────────────────────
+
+// DenyMessageFunc returns the sentence rate-limit denials open with, for
+// the policy scope and the key type the client was limited by.
+type DenyMessageFunc func(scope, keyType string) string
+
+// WithDenyMessage words rate-limit denials with fn instead of DenyMessage,
+// in JSON and HTML bodies and as .Data.Message in deny templates.
+func WithDenyMessage(fn DenyMessageFunc) Option {
+	return func(l *Limiter) { l.denyMessageFunc = fn }
+}
+
+// DenyMessage is the default DenyMessageFunc. It tells clients what they
+// were limited by, their account or their network, so a user behind a
+// shared IP knows the limit is not theirs alone. Denials in the
+// auth_sensitive scope speak of login attempts.
+func DenyMessage(scope, keyType string) string {
+	what := "requests"
+	if scope == "auth_sensitive" {
+		what = "login attempts"
+	}
+	switch {
+	case accountKeyType(keyType):
+		return "Too many " + what + " for this account."
+	case networkKeyType(keyType):
+		return "Too many " + what + " from your network."
+	}
+	return "Rate limit exceeded."
+}
+
+// denyMessage returns the opening sentence of l's denials for keyType.
+func (l *Limiter) denyMessage(keyType string) string {
+	if l.denyMessageFunc != nil {
+		return l.denyMessageFunc(l.policy.Scope, keyType)
+	}
+	return DenyMessage(l.policy.Scope, keyType)
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+	"gohst/internal/render"
+)
+
+func TestMiddleware_DenyTemplate(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.DefaultResponseFormat = "html"
+	denyViewOnce.Do(func() {})
+	denyView = &render.View{
+		Template: template.Must(template.New("").Parse(
+			`{{define "views/errors/429"}}wait {{.Data.RetryAfter}}s ({{.Data.Scope}}){{end}}` +
+				`{{define "layout"}}<main>{{.Content}}</main>{{end}}`)),
+		Layout: "layout",
+		Dirs:   render.ViewDirs{Views: "views"},
+	}
+	t.Cleanup(func() { denyView = nil })
+
+	store := NewMockStore()
+	store.DenyAll(30)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "browse"}
+	handler := NewLimiter(store, p, KeyByIP(), WithDenyTemplate("errors/429")).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if body := rr.Body.String(); body != "<main>wait 30s (browse)</main>" {
+		t.Errorf("expected the rendered template, got %q", body)
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(rr, req)
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected JSON clients to skip the template, got %q", rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestDenyMessage(t *testing.T) {
+	for _, tc := range []struct {
+		scope, keyType, want string
+	}{
+		{"auth_sensitive", KeyTypeIPIdent, "Too many login attempts for this account."},
+		{"auth_sensitive", KeyTypeIP, "Too many login attempts from your network."},
+		{"api_default", KeyTypeToken, "Too many requests for this account."},
+		{"public_browse", KeyTypeIP, "Too many requests from your network."},
+		{"public_browse", KeyTypeHeader, "Rate limit exceeded."},
+	} {
+		if got := DenyMessage(tc.scope, tc.keyType); got != tc.want {
+			t.Errorf("DenyMessage(%q, %q) = %q, want %q", tc.scope, tc.keyType, got, tc.want)
+		}
+	}
+}
+
+func TestMiddleware_DenyMessage(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.DefaultResponseFormat = "json"
+	store := NewMockStore()
+	store.DenyAll(30)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "exports"}
+	handler := NewLimiter(store, p, KeyByIP(), WithDenyMessage(func(scope, keyType string) string {
+		return "No more " + scope + " for " + keyType + "."
+	})).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rr.Body.String(), `"message":"No more exports for ip. Please slow down and try again later."`) {
+		t.Errorf("expected the custom deny message, got %s", rr.Body.String())
+	}
+}
@@ -7,9 +7,11 @@
 // (IP, user ID, bearer token, or composite keys) and enforcing configurable
 // limits with optional burst capacity.
 //
-// Two store backends are provided:
+// Four store backends are provided:
 //   - In-memory (single instance / development)
 //   - Redis with atomic Lua scripts (production / multi-instance)
+//   - Tiered: local buckets synced to Redis in the background (low latency)
+//   - Gossip: memory buckets replicated between a few peers over UDP
 //
 // # Quick Start
 //
@@ -59,10 +61,31 @@
 //
 //   - [KeyByIP]: by client IP address
 //   - [KeyByUserElseIP]: by authenticated user ID, falling back to IP
+//   - [KeyBySession]: by session ID hash, falling back to IP
 //   - [KeyByTokenElseUserElseIP]: by bearer token, then user, then IP
 //   - [KeyByIPAndIdentifier]: by IP + form field (e.g. email) — for brute-force protection
 //   - [KeyByIPAndRoute]: by IP + request path — for per-endpoint limits
+//   - [KeyByRoutePattern]: by IP + matched ServeMux pattern (e.g. "GET /users/{id}")
+//   - [KeyByGraphQLOperation]: by IP + GraphQL operation name, with [GraphQLCost] for complexity-based cost
 //   - [KeyByIPAndUA]: by IP + user-agent hash
+//   - [KeyByAPIKey]: by the client ID behind a validated API key
+//   - [KeyByJWTClaim]: by a claim (e.g. sub, tenant_id) of the bearer JWT
+//   - [KeyByHeader]: by a hash of any request header, with a fallback key function
+//   - [KeyByCookie]: by a hash of a named cookie, with a fallback key function
+//   - [KeyByOrigin]: by the Origin/Referer host of an embedding site, limited to listed hosts
+//   - [KeyByClientCert]: by the SPIFFE ID or common name of a verified mTLS client certificate
+//   - [KeyByGatewayHeader]: by a key a trusted API gateway computed and forwarded in a header
+//   - [KeyByCountry], [KeyByRegion]: one bucket per location from a [GeoResolver]
+//   - [KeyByASN]: one bucket per autonomous system from an [ASNResolver]
+//   - [KeyByTLSFingerprint]: by JA3/JA4 TLS fingerprint, from a trusted proxy header or a [TLSFingerprinter]
+//   - [KeyByTenant], [KeyByTenantAndUser]: per tenant, or per user within a tenant, from a [TenantResolver]
+//   - [KeyBuilder]: any combination of IP, route, headers and identifiers, composed fluently
+//
+// IP-based key functions accept [WithIPv6Prefix] and [WithIPv4Prefix] to key
+// clients by network instead of by address.
+//
+// [WithTierMultipliers] scales the policy by key type, so a fallback chain
+// such as [KeyByTokenElseUserElseIP] can give bare IPs a smaller budget.
 //
 // # Configuration
 //
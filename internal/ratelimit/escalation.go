@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Penalty escalation
+// ──────────────────────────────────────────────
+
+// maxEscalation bounds Policy.Escalation: 2^10 windows is far longer than
+// any backoff worth waiting for.
+const maxEscalation = 10
+
+var escalations = &escalationTracker{entries: map[string]*escalationEntry{}}
+
+// escalationTracker keeps the backoff level of keys that are denied window
+// after window. It lives in process memory, so each instance escalates the
+// denials it sees: behind a load balancer a key backs off per instance, and
+// a restart forgets every level.
+type escalationTracker struct {
+	mu        sync.Mutex
+	entries   map[string]*escalationEntry
+	lastSweep time.Time
+}
+
+type escalationEntry struct {
+	level        int       // backoff exponent: denials wait Retry-After × 2^level
+	windowStart  time.Time // start of the last window the key was denied in
+	blockedUntil time.Time
+	keep         time.Duration // how long the entry is worth keeping once unblocked
+}
+
+// violate records a denial of bucket under p that would wait retryAfter
+// seconds, and returns the escalated wait. The level rises by one for each
+// new window the key is denied in, and falls by one for each window it
+// was not, so a one-off burst waits the plain Retry-After. The escalated
+// wait is capped by escalationMax, but never below retryAfter. When extend
+// is false the denial only counts toward the level, and the wait is
+// returned unchanged.
+func (t *escalationTracker) violate(bucket string, p Policy, retryAfter int, extend bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	e, ok := t.entries[bucket]
+	switch {
+	case !ok:
+		e = &escalationEntry{windowStart: now}
+		t.entries[bucket] = e
+	case now.Sub(e.windowStart) >= p.Window:
+		gap := int(now.Sub(e.windowStart) / p.Window)
+		e.level = min(max(e.level+2-gap, 0), p.Escalation)
+		e.windowStart = now
+	}
+	e.keep = time.Duration(p.Escalation+1) * p.Window
+	if !extend {
+		return retryAfter
+	}
+	if limit := escalationMax(); limit > 0 && retryAfter > limit>>e.level {
+		retryAfter = max(retryAfter, limit)
+	} else {
+		retryAfter <<= e.level
+	}
+	if until := now.Add(time.Duration(retryAfter) * time.Second); until.After(e.blockedUntil) {
+		e.blockedUntil = until
+	}
+	return retryAfter
+}
+
+// escalationMax is the longest escalated wait in seconds: the smaller of
+// RATE_LIMIT_ESCALATION_MAX and RATE_LIMIT_RETRY_AFTER_MAX, so a key is
+// never held back longer than its Retry-After says. 0 means no cap.
+func escalationMax() int {
+	if config.RateLimit == nil {
+		return 0
+	}
+	limit := config.RateLimit.EscalationMax
+	if m := config.RateLimit.RetryAfterMax; m > 0 && (limit <= 0 || m < limit) {
+		limit = m
+	}
+	return limit
+}
+
+// blocked reports whether bucket is still backing off and, if so, the
+// number of seconds left.
+func (t *escalationTracker) blocked(bucket string) (retryAfter int, blocked bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[bucket]
+	if !ok {
+		return 0, false
+	}
+	remaining := time.Until(e.blockedUntil)
+	if remaining <= 0 {
+		return 0, false
+	}
+	return int(math.Ceil(remaining.Seconds())), true
+}
+
+// sweep drops entries that are unblocked and whose level has decayed. It
+// runs at most once a minute so violate stays cheap.
+func (t *escalationTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for k, e := range t.entries {
+		if now.After(e.blockedUntil) && now.Sub(e.windowStart) > e.keep {
+			delete(t.entries, k)
+		}
+	}
+}
+
+// escalationBucket is the key escalation state is kept under for key.
+func (l *Limiter) escalationBucket(key string) string {
+	return l.policy.Scope + "|" + l.bucketPrefix + key
+}
+
+// escalate returns result with the Retry-After of a denial for reason
+// escalated by the policy. Store errors, concurrency denials, penalty box
+// bans and greylisting are not escalated; denials during a backoff raise
+// the level without extending the backoff.
+func (l *Limiter) escalate(result Result, key, reason string) Result {
+	if l.policy.Escalation <= 0 {
+		return result
+	}
+	switch reason {
+	case "store_error", "concurrency", "penalty", "greylist":
+		return result
+	}
+	retryAfter := escalations.violate(l.escalationBucket(key), l.policy, result.RetryAfter, reason != "escalation")
+	if retryAfter != result.RetryAfter {
+		result.RetryAfter = retryAfter
+		result.ResetAt = time.Now().Unix() + int64(retryAfter)
+	}
+	return result
+}
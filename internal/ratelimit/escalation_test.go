@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestEscalation_BacksOffAndDecays(t *testing.T) {
+	tracker := &escalationTracker{entries: map[string]*escalationEntry{}}
+	p := Policy{Limit: 1, Window: 50 * time.Millisecond, Escalation: 3}
+
+	waits := []int{tracker.violate("k", p, 2, true), tracker.violate("k", p, 2, true)}
+	for i := 0; i < 4; i++ {
+		time.Sleep(60 * time.Millisecond)
+		waits = append(waits, tracker.violate("k", p, 2, true))
+	}
+	// One window at the plain wait, then doubling per window up to 2^3.
+	want := []int{2, 2, 4, 8, 16, 16}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("expected waits %v, got %v", want, waits)
+		}
+	}
+
+	// Two quiet windows bring the level down from 3 to 1, plus one for this window.
+	time.Sleep(160 * time.Millisecond)
+	if got := tracker.violate("k", p, 2, true); got != 8 {
+		t.Errorf("expected the backoff to decay to 8s, got %ds", got)
+	}
+	if got := tracker.violate("other", p, 2, true); got != 2 {
+		t.Errorf("expected a fresh key to wait the plain 2s, got %ds", got)
+	}
+}
+
+func TestMiddleware_EscalationSkipsBucket(t *testing.T) {
+	initTestConfig()
+	escalations.mu.Lock()
+	clear(escalations.entries)
+	escalations.mu.Unlock()
+	store := NewMockStore()
+	store.DenyAll(2)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "escalation_test", Escalation: 3}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d: expected 429, got %d", i+1, rr.Code)
+		}
+		if ra := rr.Header().Get("Retry-After"); ra != "2" {
+			t.Errorf("request %d: expected Retry-After 2, got %s", i+1, ra)
+		}
+	}
+	if got := store.CallCount("allow"); got != 1 {
+		t.Errorf("expected the bucket to be checked once while backing off, got %d", got)
+	}
+}
+
+func TestEscalation_CappedAtMax(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.EscalationMax = 3600
+	tracker := &escalationTracker{entries: map[string]*escalationEntry{}}
+	p := Policy{Limit: 1, Window: 10 * time.Millisecond, Escalation: maxEscalation}
+
+	var wait int
+	for i := 0; i <= maxEscalation; i++ {
+		wait = tracker.violate("k", p, 600, true)
+		time.Sleep(15 * time.Millisecond)
+	}
+	if wait != 3600 {
+		t.Errorf("expected the top level to wait the 3600s cap instead of 600×2^%d, got %ds", maxEscalation, wait)
+	}
+	if got, _ := tracker.blocked("k"); got > 3600 {
+		t.Errorf("expected the backoff to end within the cap, got %ds", got)
+	}
+
+	config.RateLimit.RetryAfterMax = 60
+	if got := tracker.violate("k", p, 600, true); got != 600 {
+		t.Errorf("expected a cap below the plain wait to leave it unescalated, got %ds", got)
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Fail-open / fail-closed on store errors
+// ──────────────────────────────────────────────
+
+// FailMode selects what the middleware does when its store is unavailable.
+type FailMode string
+
+const (
+	// FailModeDefault follows RATE_LIMIT_FAIL_MODE.
+	FailModeDefault FailMode = ""
+	// FailOpen lets the request through unlimited.
+	FailOpen FailMode = "open"
+	// FailClosed rejects the request with a 429.
+	FailClosed FailMode = "closed"
+)
+
+var (
+	failedOpen   atomic.Uint64
+	failedClosed atomic.Uint64
+)
+
+// FailureStats counts requests decided without a working store since start.
+type FailureStats struct {
+	FailedOpen   uint64 // store errors that let the request through
+	FailedClosed uint64 // store errors that rejected the request
+}
+
+// Failures returns the process-wide store failure counters.
+func Failures() FailureStats {
+	return FailureStats{FailedOpen: failedOpen.Load(), FailedClosed: failedClosed.Load()}
+}
+
+// failClosed reports whether p rejects requests on store errors.
+func (p Policy) failClosed() bool {
+	switch p.FailMode {
+	case FailClosed:
+		return true
+	case FailOpen:
+		return false
+	}
+	return config.RateLimit != nil && FailMode(config.RateLimit.FailMode) == FailClosed
+}
+
+// allowOnStoreError records a store error for op and reports whether the
+// request may proceed under the policy's fail mode.
+func (l *Limiter) allowOnStoreError(op, key string, err error) bool {
+	if l.policy.failClosed() {
+		failedClosed.Add(1)
+		log.Printf("[ratelimit] store %s error scope=%s key=%s, failing closed: %v", op, l.policy.Scope, truncateKey(key), err)
+		return false
+	}
+	failedOpen.Add(1)
+	log.Printf("[ratelimit] store %s error scope=%s key=%s, failing open: %v", op, l.policy.Scope, truncateKey(key), err)
+	return true
+}
+
+// failClosedResult is the denial returned when a fail-closed policy cannot
+// reach its store. Clients are asked to retry shortly.
+func (l *Limiter) failClosedResult() Result {
+	return Result{
+		Allowed:    false,
+		Limit:      l.policy.Limit + l.policy.Burst,
+		Remaining:  0,
+		RetryAfter: 1,
+		ResetAt:    time.Now().Unix() + 1,
+	}
+}
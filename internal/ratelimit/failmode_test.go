@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func serveOnce(h http.Handler) int {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	h.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestMiddleware_FailMode(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	base := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+
+	tests := []struct {
+		name   string
+		global string
+		mode   FailMode
+		want   int
+	}{
+		{"default open", "open", FailModeDefault, http.StatusOK},
+		{"global closed", "closed", FailModeDefault, http.StatusTooManyRequests},
+		{"policy closed", "open", FailClosed, http.StatusTooManyRequests},
+		{"policy open overrides global", "closed", FailOpen, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestConfig()
+			config.RateLimit.FailMode = tt.global
+			store := NewMockStore()
+			store.FailWith(errors.New("redis down"))
+
+			p := base
+			p.FailMode = tt.mode
+			before := Failures()
+			if got := serveOnce(NewLimiter(store, p, KeyByIP()).Middleware(ok)); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+			after := Failures()
+			if after.FailedOpen+after.FailedClosed != before.FailedOpen+before.FailedClosed+1 {
+				t.Fatalf("failure counters did not move: %+v -> %+v", before, after)
+			}
+		})
+	}
+}
+
+func TestMiddleware_FailClosedConcurrency(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	conc := NewMockStore()
+	conc.FailWith(errors.New("redis down"))
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test", ConcurrencyLimit: 1, FailMode: FailClosed}
+	h := NewLimiter(store, p, KeyByIP(), WithConcurrency(conc)).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	if got := serveOnce(h); got != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", got)
+	}
+
+	// Failing open must not release a slot that was never acquired.
+	p.FailMode = FailOpen
+	h = NewLimiter(store, p, KeyByIP(), WithConcurrency(conc)).Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	conc.ClearCalls()
+	if got := serveOnce(h); got != http.StatusOK {
+		t.Fatalf("status = %d, want 200", got)
+	}
+	if n := conc.CallCount("release"); n != 0 {
+		t.Fatalf("release calls = %d, want 0", n)
+	}
+}
+
+func TestAuthSensitivePolicy_FailsClosed(t *testing.T) {
+	initTestConfig()
+	if !AuthSensitivePolicy().failClosed() {
+		t.Fatal("auth_sensitive should fail closed")
+	}
+	if DefaultPolicy().failClosed() {
+		t.Fatal("default policy should follow the global fail-open mode")
+	}
+}
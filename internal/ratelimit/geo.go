@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// GeoIP keys and per-country policies
+// ──────────────────────────────────────────────
+
+// KeyTypeGeo is the key type of country- and region-wide keys.
+const KeyTypeGeo = "geo"
+
+// GeoInfo is the location of an IP address.
+type GeoInfo struct {
+	Country string // ISO 3166-1 alpha-2, e.g. "US"
+	Region  string // ISO 3166-2 subdivision without the country, e.g. "CA"; may be empty
+}
+
+// GeoResolver maps an IP address to its location. It is shaped after the
+// MaxMind GeoIP2 readers, so an adapter over geoip2.Reader is a few lines
+// (see the README). Lookups run on every request and must be fast and safe
+// for concurrent use.
+type GeoResolver interface {
+	LookupGeo(ip net.IP) (GeoInfo, error)
+}
+
+// GeoResolverFunc adapts a function to GeoResolver.
+type GeoResolverFunc func(ip net.IP) (GeoInfo, error)
+
+// LookupGeo implements GeoResolver.
+func (f GeoResolverFunc) LookupGeo(ip net.IP) (GeoInfo, error) { return f(ip) }
+
+// ClientGeo resolves the location of r's client IP (see ClientIP). It
+// returns ok=false when the IP is unknown to resolver.
+func ClientGeo(r *http.Request, resolver GeoResolver) (GeoInfo, bool) {
+	ip := net.ParseIP(ClientIP(r))
+	if ip == nil {
+		return GeoInfo{}, false
+	}
+	info, err := resolver.LookupGeo(ip)
+	if err != nil || info.Country == "" {
+		return GeoInfo{}, false
+	}
+	info.Country = strings.ToUpper(info.Country)
+	info.Region = strings.ToUpper(info.Region)
+	return info, true
+}
+
+// KeyByCountry keys every client of a country into one "geo:<CC>" bucket,
+// for an aggregate cap on a region's traffic. Unresolved clients use
+// fallback, or KeyByIP when fallback is nil.
+func KeyByCountry(resolver GeoResolver, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if info, ok := ClientGeo(r, resolver); ok {
+			return "geo:" + info.Country, KeyTypeGeo
+		}
+		return fallback(r)
+	}
+}
+
+// KeyByRegion is like KeyByCountry but keys on "geo:<CC>-<region>",
+// falling back to the country when the region is unknown.
+func KeyByRegion(resolver GeoResolver, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if info, ok := ClientGeo(r, resolver); ok {
+			return "geo:" + geoCode(info), KeyTypeGeo
+		}
+		return fallback(r)
+	}
+}
+
+// geoConfig is the limiter's per-country policy setup.
+type geoConfig struct {
+	resolver GeoResolver
+	policies map[string]Policy
+}
+
+// WithGeoPolicies charges clients from the listed locations against their
+// own policy instead of the limiter's. Keys are country codes ("RU") or
+// country-region codes ("US-CA"); a region entry wins over its country.
+// The limiter's key function still decides who is limited, so KeyByIP
+// with a stricter "XX" policy gives each IP from XX a smaller bucket,
+// kept separately under "geo:XX:<key>".
+func WithGeoPolicies(resolver GeoResolver, policies map[string]Policy) Option {
+	normalized := make(map[string]Policy, len(policies))
+	for code, p := range policies {
+		normalized[strings.ToUpper(code)] = p
+	}
+	return func(l *Limiter) { l.geo = &geoConfig{resolver: resolver, policies: normalized} }
+}
+
+// geoPolicy returns the key and policy the rate check should use for r.
+func (l *Limiter) geoPolicy(r *http.Request, key string) (string, Policy) {
+	if l.geo == nil || len(l.geo.policies) == 0 {
+		return key, l.policy
+	}
+	info, ok := ClientGeo(r, l.geo.resolver)
+	if !ok {
+		return key, l.policy
+	}
+	for _, code := range []string{geoCode(info), info.Country} {
+		if p, ok := l.geo.policies[code]; ok {
+			return "geo:" + code + ":" + key, p
+		}
+	}
+	return key, l.policy
+}
+
+// geoCode returns "CC-REGION", or "CC" when the region is unknown.
+func geoCode(info GeoInfo) string {
+	if info.Region == "" {
+		return info.Country
+	}
+	return info.Country + "-" + info.Region
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testGeo resolves 5.x.x.x to RU, 6.x.x.x to US-CA and 7.x.x.x to US.
+var testGeo = GeoResolverFunc(func(ip net.IP) (GeoInfo, error) {
+	switch ip.To4()[0] {
+	case 5:
+		return GeoInfo{Country: "ru"}, nil
+	case 6:
+		return GeoInfo{Country: "US", Region: "CA"}, nil
+	case 7:
+		return GeoInfo{Country: "US"}, nil
+	}
+	return GeoInfo{}, errors.New("not found")
+})
+
+func geoRequest(remote string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote + ":1234"
+	return r
+}
+
+func TestKeyByCountryAndRegion(t *testing.T) {
+	tests := []struct {
+		fn      KeyFunc
+		remote  string
+		key     string
+		keyType string
+	}{
+		{KeyByCountry(testGeo, nil), "5.1.1.1", "geo:RU", KeyTypeGeo},
+		{KeyByCountry(testGeo, nil), "6.1.1.1", "geo:US", KeyTypeGeo},
+		{KeyByCountry(testGeo, nil), "9.1.1.1", "ip:9.1.1.1", KeyTypeIP},
+		{KeyByRegion(testGeo, nil), "6.1.1.1", "geo:US-CA", KeyTypeGeo},
+		{KeyByRegion(testGeo, nil), "7.1.1.1", "geo:US", KeyTypeGeo},
+	}
+	for _, tt := range tests {
+		if key, keyType := tt.fn(geoRequest(tt.remote)); key != tt.key || keyType != tt.keyType {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.remote, key, keyType, tt.key, tt.keyType)
+		}
+	}
+}
+
+func TestMiddleware_GeoPolicies(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"}
+	strict := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "login_strict"}
+	limiter := NewLimiter(store, p, KeyByIP(), WithGeoPolicies(testGeo, map[string]Policy{"ru": strict, "US-CA": strict}))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(remote string) int {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, geoRequest(remote))
+		return rr.Code
+	}
+
+	for _, remote := range []string{"5.1.1.1", "6.1.1.1"} {
+		if code := serve(remote); code != http.StatusOK {
+			t.Fatalf("%s 1st request: expected 200, got %d", remote, code)
+		}
+		if code := serve(remote); code != http.StatusTooManyRequests {
+			t.Fatalf("%s 2nd request: expected 429, got %d", remote, code)
+		}
+	}
+	// Other locations, and unresolved IPs, keep the normal policy.
+	for _, remote := range []string{"7.1.1.1", "9.1.1.1"} {
+		for i := 0; i < 3; i++ {
+			if code := serve(remote); code != http.StatusOK {
+				t.Fatalf("%s request %d: expected 200, got %d", remote, i+1, code)
+			}
+		}
+	}
+}
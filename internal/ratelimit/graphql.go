@@ -0,0 +1,577 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// GraphQL operation keys + complexity cost
+// ──────────────────────────────────────────────
+
+// KeyTypeGraphQL is the key type of per-operation GraphQL keys.
+const KeyTypeGraphQL = "graphql"
+
+const (
+	// graphQLMaxBody is the largest request body parsed as GraphQL.
+	graphQLMaxBody = 1 << 20
+	// graphQLMaxFields and graphQLMaxDepth cap analysis: bigger queries
+	// are reported at the cap instead of being walked to the end.
+	graphQLMaxFields = 10_000
+	graphQLMaxDepth  = 128
+	// graphQLUnreadCost is charged for bodies too large to analyze: more
+	// than any bucket holds, so the limiter rejects them outright.
+	graphQLUnreadCost = math.MaxInt32
+)
+
+var (
+	errGraphQLSyntax  = errors.New("ratelimit: invalid GraphQL query")
+	errGraphQLTooDeep = errors.New("ratelimit: GraphQL query too deep")
+)
+
+// GraphQLRequest is one operation of a GraphQL HTTP request.
+type GraphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+}
+
+// ParseGraphQLRequest reads the GraphQL operations of r: the query and
+// operationName parameters of a GET, or the body of a POST, either JSON
+// (one object, or an array for a batch) or application/graphql. Bodies
+// over 1 MiB are not parsed. The body is put back, so the GraphQL handler
+// still reads all of it.
+func ParseGraphQLRequest(r *http.Request) ([]GraphQLRequest, bool) {
+	reqs, ok, _ := parseGraphQLRequest(r)
+	return reqs, ok
+}
+
+// parseGraphQLRequest is ParseGraphQLRequest, also reporting whether r is
+// a JSON or application/graphql POST whose body was too large, or failed,
+// to be read in full.
+func parseGraphQLRequest(r *http.Request) (reqs []GraphQLRequest, ok, unread bool) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		reqs = []GraphQLRequest{{Query: q.Get("query"), OperationName: q.Get("operationName")}}
+	case http.MethodPost:
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		body, ok := peekBody(r, graphQLMaxBody)
+		if !ok {
+			hasBody := r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+			graphQLBody := mediaType == "" || mediaType == "application/json" || mediaType == "application/graphql"
+			return nil, false, hasBody && graphQLBody
+		}
+		body = bytes.TrimSpace(body)
+		switch {
+		case mediaType == "application/graphql":
+			reqs = []GraphQLRequest{{Query: string(body), OperationName: r.URL.Query().Get("operationName")}}
+		case len(body) > 0 && body[0] == '[':
+			if json.Unmarshal(body, &reqs) != nil || len(reqs) == 0 {
+				return nil, false, false
+			}
+			return reqs, true, false
+		default:
+			var req GraphQLRequest
+			if json.Unmarshal(body, &req) != nil {
+				return nil, false, false
+			}
+			reqs = []GraphQLRequest{req}
+		}
+	default:
+		return nil, false, false
+	}
+	if reqs[0].Query == "" && reqs[0].OperationName == "" {
+		return nil, false, false
+	}
+	return reqs, true, false
+}
+
+// peekBody reads up to max bytes of r's body and puts them back in front
+// of the rest. It reports false when there is no body, or it cannot be
+// read, or it is longer than max.
+func peekBody(r *http.Request, max int64) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	r.Body = replayBody{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || int64(len(buf)) > max {
+		return nil, false
+	}
+	return buf, true
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// GraphQLOperationName returns the name of r's GraphQL operation: its
+// operationName, or the name of the query's only operation. It returns
+// "-" for anonymous operations and requests that are not GraphQL,
+// "~batch" for batches and "~other" for names that are not valid GraphQL
+// names.
+func GraphQLOperationName(r *http.Request) string {
+	reqs, ok := ParseGraphQLRequest(r)
+	if !ok {
+		return "-"
+	}
+	if len(reqs) > 1 {
+		return "~batch"
+	}
+	name := reqs[0].OperationName
+	if name == "" {
+		if doc, err := parseGraphQL(reqs[0].Query); err == nil && len(doc.operations) == 1 {
+			name = doc.operations[0].name
+		}
+	}
+	switch {
+	case name == "":
+		return "-"
+	case !validGraphQLName(name):
+		return "~other"
+	}
+	return name
+}
+
+// KeyByGraphQLOperation keys by IP + GraphQL operation name
+// ("graphql:<ip>:GetUser"), so each operation behind a single /graphql
+// endpoint gets its own budget per client. See GraphQLOperationName for
+// anonymous, batched and non-GraphQL requests.
+//
+// Clients choose operation names freely, so list the operations the schema
+// serves in known: any other name is keyed as "~other" and cannot mint
+// fresh buckets. An empty list accepts every name.
+func KeyByGraphQLOperation(known []string, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	allowed := make(map[string]bool, len(known))
+	for _, name := range known {
+		allowed[name] = true
+	}
+	return func(r *http.Request) (string, string) {
+		op := GraphQLOperationName(r)
+		if len(allowed) > 0 && !allowed[op] && op != "-" && op != "~batch" {
+			op = "~other"
+		}
+		return "graphql:" + clientIP(r) + ":" + op, KeyTypeGraphQL
+	}
+}
+
+// ──────────────────────────────────────────────
+// Cost analysis
+// ──────────────────────────────────────────────
+
+// GraphQLAnalyzer computes the token cost of a GraphQL operation. Plug in
+// the server's own complexity calculation (e.g. gqlgen's) to charge what
+// the server actually computes, or use ComplexityAnalyzer.
+type GraphQLAnalyzer interface {
+	Cost(req GraphQLRequest) (int, error)
+}
+
+// GraphQLAnalyzerFunc adapts a function to GraphQLAnalyzer.
+type GraphQLAnalyzerFunc func(req GraphQLRequest) (int, error)
+
+// Cost implements GraphQLAnalyzer.
+func (f GraphQLAnalyzerFunc) Cost(req GraphQLRequest) (int, error) { return f(req) }
+
+// ComplexityAnalyzer charges FieldCost tokens per selected field plus
+// DepthCost tokens per level of the deepest selection (see AnalyzeGraphQL).
+// The zero value charges one token per field.
+type ComplexityAnalyzer struct {
+	FieldCost int
+	DepthCost int
+}
+
+// Cost implements GraphQLAnalyzer.
+func (a ComplexityAnalyzer) Cost(req GraphQLRequest) (int, error) {
+	c, err := AnalyzeGraphQL(req.Query, req.OperationName)
+	if err != nil {
+		return 0, err
+	}
+	if a.FieldCost == 0 && a.DepthCost == 0 {
+		a.FieldCost = 1
+	}
+	return a.FieldCost*c.Fields + a.DepthCost*c.Depth, nil
+}
+
+// GraphQLCost returns a CostFunc charging each GraphQL request what
+// analyzer computes (ComplexityAnalyzer{} when nil), summed over a batch.
+// Requests that are not GraphQL, persisted queries sent without their
+// text, and queries the analyzer rejects are charged the policy's Cost.
+// A JSON or application/graphql body over 1 MiB, or one that cannot be
+// read, cannot be analyzed, so it is charged more than any bucket holds
+// and rejected with 400.
+func GraphQLCost(analyzer GraphQLAnalyzer) CostFunc {
+	if analyzer == nil {
+		analyzer = ComplexityAnalyzer{}
+	}
+	return func(r *http.Request) int {
+		reqs, ok, unread := parseGraphQLRequest(r)
+		if unread {
+			return graphQLUnreadCost
+		}
+		if !ok {
+			return 0
+		}
+		total := 0
+		for _, req := range reqs {
+			if req.Query == "" {
+				continue
+			}
+			if cost, err := analyzer.Cost(req); err == nil && cost > 0 {
+				total += cost
+			}
+		}
+		return total
+	}
+}
+
+// GraphQLComplexity is the size of a GraphQL operation.
+type GraphQLComplexity struct {
+	Depth  int // nesting of the deepest field; top-level fields are depth 1
+	Fields int // fields selected, counting fragments once per spread
+}
+
+// AnalyzeGraphQL measures the operation named operationName in query, or
+// its only operation, or all of them when operationName is empty and the
+// document has several. Fragments are expanded where they are spread.
+// Queries beyond 10,000 fields or 128 levels are reported at that size
+// rather than walked to the end, so fragment bombs stay cheap to analyze.
+func AnalyzeGraphQL(query, operationName string) (GraphQLComplexity, error) {
+	doc, err := parseGraphQL(query)
+	if errors.Is(err, errGraphQLTooDeep) {
+		return GraphQLComplexity{Depth: graphQLMaxDepth, Fields: graphQLMaxFields}, nil
+	}
+	if err != nil {
+		return GraphQLComplexity{}, err
+	}
+	w := gqlWalker{fragments: doc.fragments, visiting: make(map[string]bool)}
+	found := false
+	for _, op := range doc.operations {
+		if operationName == "" || op.name == operationName {
+			w.walk(op.selections, 1)
+			found = true
+		}
+	}
+	if !found {
+		return GraphQLComplexity{}, errGraphQLSyntax
+	}
+	return w.c, nil
+}
+
+type gqlWalker struct {
+	fragments map[string][]*gqlSelection
+	visiting  map[string]bool
+	c         GraphQLComplexity
+}
+
+func (w *gqlWalker) walk(sels []*gqlSelection, depth int) {
+	for _, s := range sels {
+		if w.c.Fields >= graphQLMaxFields {
+			return
+		}
+		switch {
+		case s.field:
+			w.c.Fields++
+			w.c.Depth = max(w.c.Depth, depth)
+			w.walk(s.children, depth+1)
+		case s.spread != "":
+			// Unknown and cyclic spreads are invalid; the server rejects them.
+			frag, ok := w.fragments[s.spread]
+			if !ok || w.visiting[s.spread] {
+				continue
+			}
+			w.visiting[s.spread] = true
+			w.walk(frag, depth)
+			delete(w.visiting, s.spread)
+		default:
+			w.walk(s.children, depth)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// Minimal GraphQL document parser
+// ──────────────────────────────────────────────
+
+// gqlSelection is a field, a fragment spread or an inline fragment. Only
+// the shape is kept: arguments, aliases and directives are skipped.
+type gqlSelection struct {
+	field    bool
+	spread   string
+	children []*gqlSelection
+}
+
+type gqlOperation struct {
+	name       string
+	selections []*gqlSelection
+}
+
+type gqlDocument struct {
+	operations []gqlOperation
+	fragments  map[string][]*gqlSelection
+}
+
+func parseGraphQL(query string) (*gqlDocument, error) {
+	toks, err := lexGraphQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{toks: toks}
+	doc := &gqlDocument{fragments: make(map[string][]*gqlSelection)}
+	for p.err == nil && p.peek().kind != 0 {
+		t := p.peek()
+		switch {
+		case t.kind == '{':
+			doc.operations = append(doc.operations, gqlOperation{selections: p.selectionSet(0)})
+		case t.kind == 'n' && (t.val == "query" || t.val == "mutation" || t.val == "subscription"):
+			p.next()
+			var op gqlOperation
+			if p.peek().kind == 'n' {
+				op.name = p.next().val
+			}
+			if p.peek().kind == '(' {
+				p.skipBalanced()
+			}
+			p.directives()
+			op.selections = p.selectionSet(0)
+			doc.operations = append(doc.operations, op)
+		case t.kind == 'n' && t.val == "fragment":
+			p.next()
+			name := p.expect('n').val
+			if p.expect('n').val != "on" {
+				p.fail(errGraphQLSyntax)
+			}
+			p.expect('n')
+			p.directives()
+			doc.fragments[name] = p.selectionSet(0)
+		default:
+			p.fail(errGraphQLSyntax)
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(doc.operations) == 0 {
+		return nil, errGraphQLSyntax
+	}
+	return doc, nil
+}
+
+type gqlParser struct {
+	toks []gqlToken
+	pos  int
+	err  error
+}
+
+func (p *gqlParser) peek() gqlToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return gqlToken{}
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) expect(kind byte) gqlToken {
+	t := p.next()
+	if t.kind != kind {
+		p.fail(errGraphQLSyntax)
+	}
+	return t
+}
+
+func (p *gqlParser) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *gqlParser) selectionSet(depth int) []*gqlSelection {
+	if depth >= graphQLMaxDepth {
+		p.fail(errGraphQLTooDeep)
+		return nil
+	}
+	p.expect('{')
+	var sels []*gqlSelection
+	for p.err == nil {
+		switch p.peek().kind {
+		case '}':
+			p.next()
+			return sels
+		case '.':
+			p.next()
+			if t := p.peek(); t.kind == 'n' && t.val != "on" {
+				p.next()
+				p.directives()
+				sels = append(sels, &gqlSelection{spread: t.val})
+				continue
+			}
+			if p.peek().kind == 'n' {
+				p.next()
+				p.expect('n')
+			}
+			p.directives()
+			sels = append(sels, &gqlSelection{children: p.selectionSet(depth + 1)})
+		case 'n':
+			p.next()
+			if p.peek().kind == ':' {
+				p.next()
+				p.expect('n')
+			}
+			if p.peek().kind == '(' {
+				p.skipBalanced()
+			}
+			p.directives()
+			f := &gqlSelection{field: true}
+			if p.peek().kind == '{' {
+				f.children = p.selectionSet(depth + 1)
+			}
+			sels = append(sels, f)
+		default:
+			p.fail(errGraphQLSyntax)
+		}
+	}
+	return sels
+}
+
+func (p *gqlParser) directives() {
+	for p.err == nil && p.peek().kind == '@' {
+		p.next()
+		p.expect('n')
+		if p.peek().kind == '(' {
+			p.skipBalanced()
+		}
+	}
+}
+
+// skipBalanced skips a parenthesised argument or variable list, including
+// any list and object values nested in it.
+func (p *gqlParser) skipBalanced() {
+	depth := 0
+	for p.err == nil {
+		switch p.next().kind {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return
+			}
+		case 0:
+			p.fail(errGraphQLSyntax)
+		}
+	}
+}
+
+// gqlToken is a punctuator (its own byte as kind, '.' for "..."), a name
+// ('n') or a string or number value ('v').
+type gqlToken struct {
+	kind byte
+	val  string
+}
+
+func lexGraphQL(src string) ([]gqlToken, error) {
+	src = strings.TrimPrefix(src, "\ufeff")
+	var toks []gqlToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			end, ok := gqlStringEnd(src, i)
+			if !ok {
+				return nil, errGraphQLSyntax
+			}
+			toks = append(toks, gqlToken{kind: 'v'})
+			i = end
+		case c == '.':
+			if !strings.HasPrefix(src[i:], "...") {
+				return nil, errGraphQLSyntax
+			}
+			toks = append(toks, gqlToken{kind: '.'})
+			i += 3
+		case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+			toks = append(toks, gqlToken{kind: c})
+			i++
+		case isGraphQLNameStart(c):
+			j := i + 1
+			for j < len(src) && (isGraphQLNameStart(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, gqlToken{kind: 'n', val: src[i:j]})
+			i = j
+		case c == '-' || isDigit(c):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				j++
+			}
+			toks = append(toks, gqlToken{kind: 'v'})
+			i = j
+		default:
+			return nil, errGraphQLSyntax
+		}
+	}
+	return toks, nil
+}
+
+// gqlStringEnd returns the offset just past the string or block string
+// starting at src[i].
+func gqlStringEnd(src string, i int) (int, bool) {
+	if strings.HasPrefix(src[i:], `"""`) {
+		for j := i + 3; j < len(src); j++ {
+			if strings.HasPrefix(src[j:], `\"""`) {
+				j += 3
+			} else if strings.HasPrefix(src[j:], `"""`) {
+				return j + 3, true
+			}
+		}
+		return 0, false
+	}
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, true
+		case '\n', '\r':
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+func validGraphQLName(s string) bool {
+	if s == "" || !isGraphQLNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isGraphQLNameStart(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
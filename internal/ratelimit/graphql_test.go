@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func graphQLRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = "1.2.3.4:9999"
+	return r
+}
+
+func TestAnalyzeGraphQL(t *testing.T) {
+	tests := []struct {
+		name, query, op string
+		want            GraphQLComplexity
+	}{
+		{"shorthand", `{ me { id name } }`, "", GraphQLComplexity{Depth: 2, Fields: 3}},
+		{"arguments and aliases", `query Q($n: Int = 5) { a: users(first: $n, filter: {tags: ["x", "}"]}) @include(if: true) { id } }`, "", GraphQLComplexity{Depth: 2, Fields: 2}},
+		{"fragments", `query { me { ...F friends { ...F } } } fragment F on User { id name }`, "", GraphQLComplexity{Depth: 3, Fields: 6}},
+		{"inline fragment", `{ node(id: 1) { ... on User { id } ... @skip(if: false) { name } } }`, "", GraphQLComplexity{Depth: 2, Fields: 3}},
+		{"cyclic fragment", `{ me { ...A } } fragment A on User { id ...A }`, "", GraphQLComplexity{Depth: 2, Fields: 2}},
+		{"selected operation", `query A { a } query B { b { c d } }`, "B", GraphQLComplexity{Depth: 2, Fields: 3}},
+		{"strings and comments", "{ a(s: \"{\\\"\", b: \"\"\"{ x\"\"\") # { y }\n }", "", GraphQLComplexity{Depth: 1, Fields: 1}},
+		{"too deep", strings.Repeat("{ a ", 200) + strings.Repeat("}", 200), "", GraphQLComplexity{Depth: graphQLMaxDepth, Fields: graphQLMaxFields}},
+	}
+	for _, tc := range tests {
+		got, err := AnalyzeGraphQL(tc.query, tc.op)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %+v, %v; want %+v", tc.name, got, err, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "{ a", "query { a(b: }", "nonsense"} {
+		if _, err := AnalyzeGraphQL(bad, ""); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestAnalyzeGraphQL_FragmentBomb(t *testing.T) {
+	// Each fragment spreads the previous one twice: 2^30 fields expanded.
+	var b strings.Builder
+	b.WriteString("{ ...F30 } fragment F0 on Q { a }")
+	for i := 1; i <= 30; i++ {
+		prev := "F" + strconv.Itoa(i-1)
+		fmt.Fprintf(&b, " fragment F%d on Q { ...%s ...%s }", i, prev, prev)
+	}
+	query := b.String()
+
+	got, err := AnalyzeGraphQL(query, "")
+	if err != nil || got.Fields != graphQLMaxFields {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
+
+func TestKeyByGraphQLOperation(t *testing.T) {
+	fn := KeyByGraphQLOperation([]string{"GetUser"})
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		key  string
+	}{
+		{"operationName", graphQLRequest(`{"query":"query GetUser { me { id } }","operationName":"GetUser"}`), "graphql:1.2.3.4:GetUser"},
+		{"name from query", graphQLRequest(`{"query":"query GetUser { me { id } }"}`), "graphql:1.2.3.4:GetUser"},
+		{"unknown name", graphQLRequest(`{"query":"query Random123 { me { id } }"}`), "graphql:1.2.3.4:~other"},
+		{"anonymous", graphQLRequest(`{"query":"{ me { id } }"}`), "graphql:1.2.3.4:-"},
+		{"batch", graphQLRequest(`[{"query":"{ a }"},{"query":"{ b }"}]`), "graphql:1.2.3.4:~batch"},
+		{"not graphql", graphQLRequest(`not json`), "graphql:1.2.3.4:-"},
+	}
+	for _, tc := range tests {
+		if key, keyType := fn(tc.req); key != tc.key || keyType != KeyTypeGraphQL {
+			t.Errorf("%s: got %q (%s), want %q", tc.name, key, keyType, tc.key)
+		}
+	}
+
+	get := httptest.NewRequest(http.MethodGet, "/graphql?"+url.Values{"query": {"query GetUser { me { id } }"}}.Encode(), nil)
+	get.RemoteAddr = "1.2.3.4:9999"
+	if key, _ := fn(get); key != "graphql:1.2.3.4:GetUser" {
+		t.Errorf("GET: got %q", key)
+	}
+}
+
+func TestParseGraphQLRequest_BodyStillReadable(t *testing.T) {
+	body := `{"query":"{ me { id } }"}`
+	r := graphQLRequest(body)
+	if _, ok := ParseGraphQLRequest(r); !ok {
+		t.Fatal("expected a GraphQL request")
+	}
+	got, _ := io.ReadAll(r.Body)
+	if string(got) != body {
+		t.Fatalf("handler would read %q", got)
+	}
+}
+
+func TestMiddleware_GraphQLCost(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "graphql"}
+	limiter := NewLimiter(store, p, KeyByGraphQLOperation(nil), WithCostFunc(GraphQLCost(ComplexityAnalyzer{FieldCost: 1, DepthCost: 2})))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), graphQLRequest(`{"query":"query Feed { posts { id author { name } } }"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), graphQLRequest(`{"query":"{ a } query { b"}`))
+
+	calls := store.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", calls)
+	}
+	// 4 fields + 2 * depth 3.
+	if calls[0].Cost != 10 || calls[0].Key != "graphql:1.2.3.4:Feed" {
+		t.Fatalf("got %+v", calls[0])
+	}
+	// Unparseable queries are charged the policy cost.
+	if calls[1].Cost != 1 {
+		t.Fatalf("got %+v", calls[1])
+	}
+}
+
+func TestMiddleware_GraphQLOversizedBody(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "graphql"}
+	handler := NewLimiter(store, p, KeyByIP(), WithCostFunc(GraphQLCost(nil))).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	padding := strings.Repeat(" ", graphQLMaxBody)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, graphQLRequest(`{"query":"{ a`+padding+` }"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a body too large to analyze to be rejected with 400, got %d", rr.Code)
+	}
+	if n := store.CallCount("allow"); n != 0 {
+		t.Errorf("expected the rejection to charge no bucket, got %d calls", n)
+	}
+
+	upload := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(padding+"x"))
+	upload.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, upload)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a large multipart upload to be charged the policy cost, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Greylisting
+// ──────────────────────────────────────────────
+
+// GreylistStore remembers when keys were first seen.
+type GreylistStore interface {
+	// FirstSeen records key as seen now, unless it was already seen, and
+	// returns when it was first seen. The record expires ttl after the
+	// last time key was seen.
+	FirstSeen(ctx context.Context, key string, ttl time.Duration) (time.Time, error)
+}
+
+// Greylist turns away the first request of keys it has not seen, and lets
+// them in once they come back at least Delay later. Naive bots fire once
+// and move on; real clients retry. Browsers do not retry on their own: a
+// greylisted form POST shows the denial, and the user must submit the
+// form again after the delay.
+type Greylist struct {
+	Store    GreylistStore
+	Delay    time.Duration // how long a new key must wait before retrying
+	Remember time.Duration // how long a key stays known after its last request; 0 means a day
+}
+
+// GreylistFromConfig returns a Greylist on store with the
+// RATE_LIMIT_GREYLIST_* settings.
+func GreylistFromConfig(store GreylistStore) Greylist {
+	cfg := config.RateLimit
+	return Greylist{
+		Store:    store,
+		Delay:    time.Duration(cfg.GreylistDelay) * time.Second,
+		Remember: time.Duration(cfg.GreylistRemember) * time.Second,
+	}
+}
+
+// WithGreylist greylists the keys of the limiter, e.g. on login and signup
+// routes. Greylisted requests are denied with reason=greylist and a
+// Retry-After of the remaining delay, and cost no tokens.
+func WithGreylist(g Greylist) Option {
+	if g.Delay <= 0 {
+		g.Delay = 5 * time.Second
+	}
+	if g.Remember <= 0 {
+		g.Remember = 24 * time.Hour
+	}
+	return func(l *Limiter) { l.greylist = &g }
+}
+
+// wait returns the seconds key must still wait, or 0 once it may proceed.
+// A failing store greylists no one.
+func (g *Greylist) wait(ctx context.Context, key string) int {
+	first, err := g.Store.FirstSeen(ctx, key, g.Remember)
+	if err != nil {
+		log.Printf("[ratelimit] greylist store error key=%s: %v", truncateKey(key), err)
+		return 0
+	}
+	left := g.Delay - time.Since(first)
+	if left <= 0 {
+		return 0
+	}
+	return int(math.Ceil(left.Seconds()))
+}
+
+// ──────────────────────────────────────────────
+// Memory greylist store
+// ──────────────────────────────────────────────
+
+// MemoryGreylistStore is a per-instance GreylistStore.
+type MemoryGreylistStore struct {
+	mu        sync.Mutex
+	seen      map[string]*list.Element // of *greylistEntry
+	lru       *list.List               // front is the most recently seen
+	maxKeys   int
+	lastSweep time.Time
+}
+
+type greylistEntry struct {
+	key     string
+	first   time.Time
+	expires time.Time
+}
+
+// NewMemoryGreylistStore creates an empty MemoryGreylistStore holding at
+// most maxKeys keys. When full, the least recently seen key is forgotten,
+// as in MemoryStore's WithMaxKeys, so a flood of new keys cannot grow the
+// store without bound; a forgotten key is greylisted again on its next
+// visit. 0 means unbounded.
+func NewMemoryGreylistStore(maxKeys int) *MemoryGreylistStore {
+	return &MemoryGreylistStore{
+		seen:      make(map[string]*list.Element),
+		lru:       list.New(),
+		maxKeys:   maxKeys,
+		lastSweep: time.Now(),
+	}
+}
+
+// FirstSeen implements GreylistStore.
+func (m *MemoryGreylistStore) FirstSeen(_ context.Context, key string, ttl time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	elem, ok := m.seen[key]
+	if !ok {
+		elem = m.lru.PushFront(&greylistEntry{key: key, first: now})
+		m.seen[key] = elem
+		if m.maxKeys > 0 && m.lru.Len() > m.maxKeys {
+			oldest := m.lru.Back()
+			m.lru.Remove(oldest)
+			delete(m.seen, oldest.Value.(*greylistEntry).key)
+		}
+	} else {
+		m.lru.MoveToFront(elem)
+	}
+	e := elem.Value.(*greylistEntry)
+	if ok && !now.Before(e.expires) {
+		e.first = now
+	}
+	e.expires = now.Add(ttl)
+	return e.first, nil
+}
+
+// sweep drops expired keys. It runs at most once a minute so FirstSeen
+// stays cheap.
+func (m *MemoryGreylistStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for k, elem := range m.seen {
+		if !now.Before(elem.Value.(*greylistEntry).expires) {
+			m.lru.Remove(elem)
+			delete(m.seen, k)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// Redis greylist store
+// ──────────────────────────────────────────────
+
+// RedisGreylistStore is a GreylistStore shared by every instance using the
+// same Redis, under <prefix>grey:.
+type RedisGreylistStore struct {
+	s *RedisStore
+}
+
+// NewRedisGreylistStore creates a greylist store in the Redis of s, under
+// its prefix.
+func NewRedisGreylistStore(s *RedisStore) *RedisGreylistStore {
+	return &RedisGreylistStore{s: s}
+}
+
+var luaGreylistSeen = redis.NewScript(`
+local first = redis.call("GET", KEYS[1])
+if not first then
+    first = ARGV[1]
+    redis.call("SET", KEYS[1], first, "PX", ARGV[2])
+else
+    redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return first
+`)
+
+// FirstSeen implements GreylistStore.
+func (g *RedisGreylistStore) FirstSeen(ctx context.Context, key string, ttl time.Duration) (time.Time, error) {
+	ctx, cancel := g.s.withTimeout(ctx)
+	defer cancel()
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	first, err := luaGreylistSeen.Run(ctx, g.s.client, []string{g.s.prefix + "grey:" + key}, now, ttl.Milliseconds()).Text()
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
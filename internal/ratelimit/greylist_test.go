@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMiddleware_Greylist(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "signup"}
+	grey := Greylist{Store: NewMemoryGreylistStore(0), Delay: 50 * time.Millisecond, Remember: time.Minute}
+	handler := NewLimiter(store, p, KeyByIP(), WithGreylist(grey)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/signup", nil)
+		req.RemoteAddr = addr
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	rr := serve("192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected a new key to be greylisted with Retry-After 1, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := serve("192.0.2.1:1234"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected an early retry to stay greylisted, got %d", rr.Code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if rr := serve("192.0.2.1:1234"); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("expected a key that came back to pass, charged once, got %d remaining=%s", rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+	}
+	if rr := serve("198.51.100.7:1234"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected another new key to be greylisted, got %d", rr.Code)
+	}
+}
+
+func TestMemoryGreylistStore_Forgets(t *testing.T) {
+	s := NewMemoryGreylistStore(0)
+	ctx := context.Background()
+	first, _ := s.FirstSeen(ctx, "k", 30*time.Millisecond)
+	if again, _ := s.FirstSeen(ctx, "k", 30*time.Millisecond); !again.Equal(first) {
+		t.Fatalf("expected the first sighting to be kept, got %s then %s", first, again)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if later, _ := s.FirstSeen(ctx, "k", 30*time.Millisecond); !later.After(first) {
+		t.Errorf("expected an expired key to be seen anew")
+	}
+}
+
+func TestMemoryGreylistStore_MaxKeys(t *testing.T) {
+	s := NewMemoryGreylistStore(2)
+	ctx := context.Background()
+	a, _ := s.FirstSeen(ctx, "a", time.Minute)
+	s.FirstSeen(ctx, "b", time.Minute)
+	s.FirstSeen(ctx, "a", time.Minute) // a is now the most recently seen
+	s.FirstSeen(ctx, "c", time.Minute) // evicts b
+	if n := len(s.seen); n != 2 {
+		t.Fatalf("expected the store capped at 2 keys, got %d", n)
+	}
+	if again, _ := s.FirstSeen(ctx, "a", time.Minute); !again.Equal(a) {
+		t.Error("expected the recently seen key to be kept")
+	}
+	if _, ok := s.seen["b"]; ok {
+		t.Error("expected the least recently seen key to be forgotten")
+	}
+}
+
+func TestRedisGreylistStore_TimeoutGreylistsNoOne(t *testing.T) {
+	initTestConfig()
+	addr := hangingListener(t)
+	rs := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true}),
+		prefix:  "test:",
+		timeout: 50 * time.Millisecond,
+	}
+	defer rs.Close()
+
+	g := Greylist{Store: NewRedisGreylistStore(rs), Delay: time.Minute, Remember: time.Hour}
+	if wait := g.wait(context.Background(), "ip:192.0.2.1"); wait != 0 {
+		t.Errorf("expected a failing store to greylist no one, got wait %d", wait)
+	}
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Rate-limit response headers
+// ──────────────────────────────────────────────
+
+// setRateLimitHeaders writes the rate-limit response headers selected by
+// RATE_LIMIT_HEADERS: X-RateLimit-*, the IETF draft fields, or both. Names
+// follow RATE_LIMIT_HEADER_PREFIX and RATE_LIMIT_HEADER_CASE, values listed
+// in RATE_LIMIT_HEADER_OMIT are left out, and with
+// RATE_LIMIT_HEADER_HIDE_ANONYMOUS clients keyed by IP only get none.
+func setRateLimitHeaders(w http.ResponseWriter, p Policy, r Result, keyType string) {
+	cfg := config.RateLimit
+	if cfg == nil {
+		cfg = &config.RateLimitConfig{}
+	}
+	if cfg.HeaderHideAnonymous && anonymousKeyType(keyType) {
+		return
+	}
+	mode := cfg.Headers
+	if mode == "" {
+		mode = "x-ratelimit"
+	}
+	if mode != "ietf" {
+		prefix := cfg.HeaderPrefix
+		if prefix == "" {
+			prefix = "X-RateLimit-"
+		}
+		if !headerOmitted("limit") {
+			setHeader(w, prefix+"Limit", strconv.Itoa(r.Limit))
+		}
+		if !headerOmitted("remaining") {
+			setHeader(w, prefix+"Remaining", strconv.Itoa(r.Remaining))
+		}
+		if !headerOmitted("reset") {
+			setHeader(w, prefix+"Reset", strconv.FormatInt(r.ResetAt, 10))
+		}
+	}
+	if mode != "x-ratelimit" {
+		setIETFRateLimitHeaders(w, p, r)
+	}
+}
+
+// setIETFRateLimitHeaders writes the fields of the IETF RateLimit header
+// draft (draft-ietf-httpapi-ratelimit-headers): RateLimit-Policy with the
+// quota and window, RateLimit with the remaining quota and the seconds until
+// it resets, and the RateLimit-Limit/-Remaining/-Reset fields of earlier
+// drafts. Unlike X-RateLimit-Reset, reset times are relative.
+//
+// An omitted limit drops RateLimit-Policy, and an omitted remaining or reset
+// value drops its parameter from RateLimit.
+func setIETFRateLimitHeaders(w http.ResponseWriter, p Policy, r Result) {
+	name := p.Scope
+	if name == "" {
+		name = "default"
+	}
+	name = strconv.Quote(name)
+	reset := r.ResetAt - time.Now().Unix()
+	if reset < 0 {
+		reset = 0
+	}
+	omitLimit, omitRemaining, omitReset := headerOmitted("limit"), headerOmitted("remaining"), headerOmitted("reset")
+	if !omitLimit {
+		setHeader(w, "RateLimit-Policy", fmt.Sprintf("%s;q=%d;w=%d", name, r.Limit, int64(p.Window/time.Second)))
+	}
+	if !omitRemaining || !omitReset {
+		field := name
+		if !omitRemaining {
+			field += ";r=" + strconv.Itoa(r.Remaining)
+		}
+		if !omitReset {
+			field += ";t=" + strconv.FormatInt(reset, 10)
+		}
+		setHeader(w, "RateLimit", field)
+	}
+	if !omitLimit {
+		setHeader(w, "RateLimit-Limit", strconv.Itoa(r.Limit))
+	}
+	if !omitRemaining {
+		setHeader(w, "RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	}
+	if !omitReset {
+		setHeader(w, "RateLimit-Reset", strconv.FormatInt(reset, 10))
+	}
+}
+
+// setRetryAfter writes the Retry-After header of a denial that clears in
+// seconds, and returns the delay it advertises: seconds capped at
+// RATE_LIMIT_RETRY_AFTER_MAX, so a long quota or fixed-window denial does
+// not tell a browser to wait for days. With RATE_LIMIT_RETRY_AFTER_FORMAT
+// set to "http-date" the header is the time to retry at instead.
+func setRetryAfter(w http.ResponseWriter, seconds int) int {
+	format, limit := "", 0
+	if config.RateLimit != nil {
+		format, limit = config.RateLimit.RetryAfterFormat, config.RateLimit.RetryAfterMax
+	}
+	if limit > 0 && seconds > limit {
+		seconds = limit
+	}
+	if format == "http-date" {
+		w.Header().Set("Retry-After", time.Now().Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+	} else {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	return seconds
+}
+
+// setHeader sets a rate-limit header, writing its name as
+// RATE_LIMIT_HEADER_CASE says. Non-canonical names bypass Header.Set, so
+// they must be read back from the header map directly.
+func setHeader(w http.ResponseWriter, name, value string) {
+	headerCase := ""
+	if config.RateLimit != nil {
+		headerCase = config.RateLimit.HeaderCase
+	}
+	switch headerCase {
+	case "lower":
+		w.Header()[strings.ToLower(name)] = []string{value}
+	case "preserve":
+		w.Header()[name] = []string{value}
+	default:
+		w.Header().Set(name, value)
+	}
+}
+
+// headerOmitted reports whether RATE_LIMIT_HEADER_OMIT lists field.
+func headerOmitted(field string) bool {
+	return config.RateLimit != nil && slices.Contains(config.RateLimit.HeaderOmit, field)
+}
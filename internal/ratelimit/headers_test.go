@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func serveHeaders(t *testing.T, keyFunc KeyFunc) http.Header {
+	t.Helper()
+	store := NewMemoryStore(time.Minute)
+	t.Cleanup(func() { store.Close() })
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	handler := NewLimiter(store, p, keyFunc).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rr.Header()
+}
+
+func TestHeaders_PrefixAndCase(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.HeaderPrefix = "X-Rate-Limit-"
+	if h := serveHeaders(t, KeyByIP()); h.Get("X-Rate-Limit-Remaining") != "9" || h.Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("expected the configured prefix, got %v", h)
+	}
+
+	config.RateLimit.HeaderCase = "lower"
+	if h := serveHeaders(t, KeyByIP()); len(h["x-rate-limit-limit"]) != 1 {
+		t.Errorf("expected lower-case names, got %v", h)
+	}
+
+	config.RateLimit.HeaderPrefix = "X-RateLimit-"
+	config.RateLimit.HeaderCase = "preserve"
+	if h := serveHeaders(t, KeyByIP()); len(h["X-RateLimit-Reset"]) != 1 {
+		t.Errorf("expected names as configured, got %v", h)
+	}
+}
+
+func TestHeaders_Omit(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.Headers = "both"
+	config.RateLimit.HeaderOmit = []string{"limit", "reset"}
+	h := serveHeaders(t, KeyByIP())
+	for _, name := range []string{"X-RateLimit-Limit", "X-RateLimit-Reset", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Reset"} {
+		if h.Get(name) != "" {
+			t.Errorf("expected %s to be omitted, got %q", name, h.Get(name))
+		}
+	}
+	if h.Get("X-RateLimit-Remaining") != "9" {
+		t.Errorf("expected X-RateLimit-Remaining, got %v", h)
+	}
+	if got := h.Get("RateLimit"); got != `"api";r=9` {
+		t.Errorf("RateLimit = %q", got)
+	}
+}
+
+func TestHeaders_HideAnonymous(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.HeaderHideAnonymous = true
+	if h := serveHeaders(t, KeyByIP()); h.Get("X-RateLimit-Limit") != "" {
+		t.Errorf("expected no limit values for IP-keyed clients, got %v", h)
+	}
+	byUser := func(*http.Request) (string, string) { return "user:1", KeyTypeUser }
+	if h := serveHeaders(t, byUser); h.Get("X-RateLimit-Limit") != "10" {
+		t.Errorf("expected limit values for signed-in clients, got %v", h)
+	}
+}
+
+func TestHeaders_HideAnonymousKeepsRetryAfter(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.HeaderHideAnonymous = true
+	store := NewMockStore()
+	store.DenyAll(30)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("expected Retry-After on denials, got %v", rr.Header())
+	}
+	for name := range rr.Header() {
+		if strings.Contains(strings.ToLower(name), "ratelimit") {
+			t.Errorf("expected no rate-limit headers, got %s", name)
+		}
+	}
+}
+
+func TestHeaders_RetryAfterCapAndDate(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.RetryAfterMax = 3600
+	store := NewMockStore()
+	store.DenyAll(29 * 86400)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "quota"}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	rr := serve()
+	if got := rr.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("expected Retry-After capped at 3600, got %q", got)
+	}
+	var body struct {
+		RetryAfter int `json:"retry_after"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.RetryAfter != 29*86400 {
+		t.Errorf("expected the uncapped delay in the body, got %d (%v)", body.RetryAfter, err)
+	}
+
+	config.RateLimit.RetryAfterFormat = "http-date"
+	at, err := http.ParseTime(serve().Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("expected an HTTP-date: %v", err)
+	}
+	if d := time.Until(at); d < 3590*time.Second || d > 3601*time.Second {
+		t.Errorf("expected a date about an hour ahead, got %s", d)
+	}
+}
@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Store health
+// ──────────────────────────────────────────────
+
+// HealthStatus describes whether a store can currently reach its backend.
+type HealthStatus struct {
+	Backend string        // "memory", "redis", "tiered", "gossip", ...
+	Healthy bool          // false when the backend is unreachable
+	Message string        // human-readable summary, e.g. for a health endpoint
+	Latency time.Duration // round trip of the check
+}
+
+// Healther is implemented by stores that can check their backend.
+type Healther interface {
+	// Ping returns an error if the backend is unreachable.
+	Ping(ctx context.Context) error
+
+	// Status reports the backend's health in a form suitable for display.
+	Status(ctx context.Context) HealthStatus
+}
+
+// CheckHealth returns the status of store. Stores that do not implement
+// Healther are reported healthy with an "unknown" backend.
+func CheckHealth(ctx context.Context, store Store) HealthStatus {
+	if h, ok := store.(Healther); ok {
+		return h.Status(ctx)
+	}
+	return HealthStatus{Backend: "unknown", Healthy: true, Message: "ok (no health check)"}
+}
+
+// HealthHandler serves the store's health as JSON: 200 when healthy, 503
+// when degraded. Mount it next to the app's own health endpoint.
+func HealthHandler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		st := CheckHealth(ctx, store)
+
+		status, state := http.StatusOK, "ok"
+		if !st.Healthy {
+			status, state = http.StatusServiceUnavailable, "degraded"
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     state,
+			"backend":    st.Backend,
+			"message":    st.Message,
+			"latency_ms": st.Latency.Milliseconds(),
+		})
+	})
+}
+
+// pingStatus runs ping and builds a HealthStatus for backend. fallback
+// describes what the store does while the backend is down.
+func pingStatus(ctx context.Context, backend, fallback string, ping func(context.Context) error) HealthStatus {
+	start := time.Now()
+	err := ping(ctx)
+	st := HealthStatus{Backend: backend, Healthy: err == nil, Message: "ok", Latency: time.Since(start)}
+	if err != nil {
+		st.Message = fmt.Sprintf("rate limiter degraded: %s unreachable, %s (%v)", backend, fallback, err)
+	}
+	return st
+}
+
+// globalFailMode describes the configured store-error behaviour.
+func globalFailMode() string {
+	if config.RateLimit != nil && FailMode(config.RateLimit.FailMode) == FailClosed {
+		return "failing closed"
+	}
+	return "failing open"
+}
+
+// ──────────────────────────────────────────────
+// Implementations
+// ──────────────────────────────────────────────
+
+// Ping implements Healther. The memory store has no backend to lose.
+func (s *MemoryStore) Ping(context.Context) error { return nil }
+
+// Status implements Healther.
+func (s *MemoryStore) Status(context.Context) HealthStatus {
+	st := s.Stats()
+	return HealthStatus{Backend: "memory", Healthy: true, Message: fmt.Sprintf("ok (%d keys)", st.Keys)}
+}
+
+// Ping implements Healther with a Redis PING bounded by the store timeout.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.client.Ping(ctx).Err()
+}
+
+// Status implements Healther.
+func (s *RedisStore) Status(ctx context.Context) HealthStatus {
+	return pingStatus(ctx, "redis", globalFailMode(), s.Ping)
+}
+
+// Ping implements Healther by pinging the remote store, if it can be pinged.
+func (t *TieredStore) Ping(ctx context.Context) error {
+	if h, ok := t.remote.(Healther); ok {
+		return h.Ping(ctx)
+	}
+	return nil
+}
+
+// Status implements Healther. Local buckets keep limiting while the remote
+// is down, but only per instance.
+func (t *TieredStore) Status(ctx context.Context) HealthStatus {
+	return pingStatus(ctx, "tiered", "limiting per instance", t.Ping)
+}
+
+// Ping implements Healther. Gossip is best-effort, so lost peers never make
+// the store unhealthy.
+func (g *GossipStore) Ping(context.Context) error { return nil }
+
+// Status implements Healther.
+func (g *GossipStore) Status(context.Context) HealthStatus {
+	g.mu.Lock()
+	peers := len(g.peers)
+	g.mu.Unlock()
+	return HealthStatus{Backend: "gossip", Healthy: true, Message: fmt.Sprintf("ok (%d peers)", peers)}
+}
+
+// Ping implements Healther by delegating to the wrapped store.
+func (d *DenyCacheStore) Ping(ctx context.Context) error { return pingInner(ctx, d.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (d *DenyCacheStore) Status(ctx context.Context) HealthStatus { return CheckHealth(ctx, d.inner) }
+
+// Ping implements Healther by delegating to the wrapped store.
+func (s *InstrumentedStore) Ping(ctx context.Context) error { return pingInner(ctx, s.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (s *InstrumentedStore) Status(ctx context.Context) HealthStatus {
+	return CheckHealth(ctx, s.inner)
+}
+
+// Ping implements Healther by delegating to the wrapped store.
+func (t *TimelineStore) Ping(ctx context.Context) error { return pingInner(ctx, t.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (t *TimelineStore) Status(ctx context.Context) HealthStatus { return CheckHealth(ctx, t.inner) }
+
+// Ping implements Healther by delegating to the wrapped store.
+func (s *AnonymizingStore) Ping(ctx context.Context) error { return pingInner(ctx, s.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (s *AnonymizingStore) Status(ctx context.Context) HealthStatus { return CheckHealth(ctx, s.inner) }
+
+func pingInner(ctx context.Context, inner Store) error {
+	if h, ok := inner.(Healther); ok {
+		return h.Ping(ctx)
+	}
+	return nil
+}
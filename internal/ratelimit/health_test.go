@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisStore_StatusUnreachable(t *testing.T) {
+	initTestConfig()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	store := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1}),
+		prefix:  "test:",
+		timeout: 100 * time.Millisecond,
+	}
+	defer store.Close()
+
+	st := CheckHealth(context.Background(), NewDenyCacheStore(store, 5, time.Minute))
+	if st.Healthy {
+		t.Fatal("unreachable Redis should be unhealthy")
+	}
+	if st.Backend != "redis" || !strings.Contains(st.Message, "redis unreachable, failing open") {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestCheckHealth_Memory(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	if st := CheckHealth(context.Background(), store); !st.Healthy || st.Backend != "memory" {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	h := HealthHandler(NewInstrumentedStore(store, StoreHooks{}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz/ratelimit", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	store.FailWith(errors.New("connection refused"))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz/ratelimit", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rr.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body["status"] != "degraded" {
+		t.Fatalf("status = %v, want degraded", body["status"])
+	}
+}
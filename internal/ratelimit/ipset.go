@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// IPSet – precompiled IP / CIDR membership
+// ──────────────────────────────────────────────
+
+// IPSet is an immutable set of IPs and CIDR ranges, parsed once and stored as
+// sorted, merged address ranges so lookups are a binary search (O(log n))
+// with no string parsing on the request path. IPv4 and IPv6 are kept apart;
+// IPv4-mapped IPv6 addresses are matched as IPv4.
+type IPSet struct {
+	v4 []ipRange
+	v6 []ipRange
+}
+
+// ipRange is an inclusive range of addresses as 128-bit integers.
+type ipRange struct {
+	lo, hi u128
+}
+
+type u128 struct{ hi, lo uint64 }
+
+func (a u128) less(b u128) bool {
+	return a.hi < b.hi || (a.hi == b.hi && a.lo < b.lo)
+}
+
+// ParseIPSet builds an IPSet from plain IPs ("10.0.0.1") and CIDRs
+// ("10.0.0.0/8"). Empty entries are ignored; any invalid entry is an error.
+func ParseIPSet(entries []string) (*IPSet, error) {
+	set, errs := parseIPSetLenient(entries)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return set, nil
+}
+
+// MustParseIPSet is like ParseIPSet but panics on invalid input. Intended for
+// package-level vars and literals known to be valid.
+func MustParseIPSet(entries ...string) *IPSet {
+	set, err := ParseIPSet(entries)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// parseIPSetLenient builds a set from the valid entries and returns an error
+// for each invalid one.
+func parseIPSetLenient(entries []string) (*IPSet, []error) {
+	set := &IPSet{}
+	var errs []error
+	for _, raw := range entries {
+		entry := strings.TrimSpace(raw)
+		if entry == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		var err error
+		if strings.Contains(entry, "/") {
+			prefix, err = netip.ParsePrefix(entry)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(entry)
+			if err == nil {
+				addr = addr.Unmap()
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid IP or CIDR %q: %w", entry, err))
+			continue
+		}
+		set.add(prefix)
+	}
+	set.v4 = mergeRanges(set.v4)
+	set.v6 = mergeRanges(set.v6)
+	return set, errs
+}
+
+func (s *IPSet) add(p netip.Prefix) {
+	p = p.Masked()
+	addr := p.Addr()
+	if addr.Is4In6() {
+		// "::ffff:10.0.0.0/104" style prefixes are IPv4 ranges.
+		bits := p.Bits() - 96
+		if bits < 0 {
+			bits = 0
+		}
+		p = netip.PrefixFrom(addr.Unmap(), bits).Masked()
+		addr = p.Addr()
+	}
+	lo := toU128(addr)
+	hostBits := addr.BitLen() - p.Bits()
+	hi := lo
+	switch {
+	case hostBits >= 128:
+		hi = u128{^uint64(0), ^uint64(0)}
+	case hostBits >= 64:
+		hi.lo = ^uint64(0)
+		hi.hi |= (uint64(1) << (hostBits - 64)) - 1
+	case hostBits > 0:
+		hi.lo |= (uint64(1) << hostBits) - 1
+	}
+	r := ipRange{lo: lo, hi: hi}
+	if addr.Is4() {
+		s.v4 = append(s.v4, r)
+	} else {
+		s.v6 = append(s.v6, r)
+	}
+}
+
+func toU128(a netip.Addr) u128 {
+	if a.Is4() {
+		b := a.As4()
+		return u128{lo: uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3])}
+	}
+	b := a.As16()
+	var v u128
+	for i := 0; i < 8; i++ {
+		v.hi = v.hi<<8 | uint64(b[i])
+		v.lo = v.lo<<8 | uint64(b[i+8])
+	}
+	return v
+}
+
+// mergeRanges sorts ranges and coalesces overlapping or adjacent ones.
+func mergeRanges(rs []ipRange) []ipRange {
+	if len(rs) < 2 {
+		return rs
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].lo.less(rs[j].lo) })
+	out := rs[:1]
+	for _, r := range rs[1:] {
+		last := &out[len(out)-1]
+		if !last.hi.less(r.lo) || adjacent(last.hi, r.lo) {
+			if last.hi.less(r.hi) {
+				last.hi = r.hi
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// adjacent reports whether b == a+1.
+func adjacent(a, b u128) bool {
+	next := u128{hi: a.hi, lo: a.lo + 1}
+	if next.lo == 0 {
+		next.hi++
+	}
+	return next == b
+}
+
+// Contains reports whether ip (a string IP) is in the set. Unparseable input
+// is never contained.
+func (s *IPSet) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	return s.ContainsAddr(addr)
+}
+
+// ContainsAddr reports whether addr is in the set.
+func (s *IPSet) ContainsAddr(addr netip.Addr) bool {
+	if s == nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	ranges := s.v6
+	if addr.Is4() {
+		ranges = s.v4
+	}
+	x := toU128(addr)
+	// First range whose lo is greater than x; the candidate is the one before.
+	i := sort.Search(len(ranges), func(i int) bool { return x.less(ranges[i].lo) })
+	return i > 0 && !ranges[i-1].hi.less(x)
+}
+
+// Len returns the number of merged ranges in the set.
+func (s *IPSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.v4) + len(s.v6)
+}
+
+// ──────────────────────────────────────────────
+// Trusted proxies (compiled from config)
+// ──────────────────────────────────────────────
+
+var (
+	// trustedMu serialises changes to the ranges below and rebuilds of
+	// the compiled set; requests read the set through trustedCompiled.
+	trustedMu sync.Mutex
+	// trustedCompiled is the set last compiled, with the config and
+	// generation it was compiled for.
+	trustedCompiled atomic.Pointer[trustedCache]
+
+	// fetchedProxies are the ranges published by a ProxyRangeUpdater.
+	fetchedProxies []string
+	// runtimeProxies replaces config.RateLimit.TrustedProxies once set by
+	// SetTrustedProxies.
+	runtimeProxies *[]string
+	// proxiesGen is bumped, under trustedMu, whenever the fetched or
+	// runtime ranges change.
+	proxiesGen atomic.Uint64
+)
+
+// trustedCache is a compiled trusted proxy set. set is nil when no ranges
+// are trusted.
+type trustedCache struct {
+	cfg *config.RateLimitConfig
+	gen uint64
+	set *IPSet
+}
+
+// trustedProxySet returns the configured trusted proxies (see
+// TrustedProxies), plus any ranges fetched by a ProxyRangeUpdater,
+// compiled into an IPSet. The set is compiled once per config and per
+// change made through SetTrustedProxies or a ProxyRangeUpdater, then read
+// without locking; invalid entries are logged once per compile and
+// skipped. Change the list at runtime with SetTrustedProxies rather than
+// by editing config.RateLimit.TrustedProxies.
+func trustedProxySet() *IPSet {
+	cfg := config.RateLimit
+	if cfg == nil {
+		return nil
+	}
+	if c := trustedCompiled.Load(); c != nil && c.cfg == cfg && c.gen == proxiesGen.Load() {
+		return c.set
+	}
+
+	trustedMu.Lock()
+	defer trustedMu.Unlock()
+	gen := proxiesGen.Load()
+	if c := trustedCompiled.Load(); c != nil && c.cfg == cfg && c.gen == gen {
+		return c.set
+	}
+	base := cfg.TrustedProxies
+	if runtimeProxies != nil {
+		base = *runtimeProxies
+	}
+	var set *IPSet
+	if len(base) > 0 || len(fetchedProxies) > 0 {
+		entries := append(append([]string(nil), base...), fetchedProxies...)
+		var errs []error
+		set, errs = parseIPSetLenient(entries)
+		for _, err := range errs {
+			log.Printf("[ratelimit] ignoring trusted proxy entry: %v", err)
+		}
+	}
+	trustedCompiled.Store(&trustedCache{cfg: cfg, gen: gen, set: set})
+	return set
+}
+
+// setFetchedProxies replaces the fetched ranges trusted next to
+// TrustedProxies.
+func setFetchedProxies(entries []string) {
+	trustedMu.Lock()
+	defer trustedMu.Unlock()
+	fetchedProxies = entries
+	proxiesGen.Add(1)
+}
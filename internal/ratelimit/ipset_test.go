@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gohst/internal/config"
+)
+
+func TestIPSet_Contains(t *testing.T) {
+	set := MustParseIPSet("10.0.0.0/8", "172.16.0.1", "192.168.1.0/24", "2001:db8::/32", "::1")
+
+	cases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"11.0.0.0", false},
+		{"172.16.0.1", true},
+		{"172.16.0.2", false},
+		{"192.168.1.200", true},
+		{"192.168.2.1", false},
+		{"::ffff:10.1.2.3", true}, // IPv4-mapped matches IPv4 ranges
+		{"2001:db8:ffff::1", true},
+		{"2001:db9::1", false},
+		{"::1", true},
+		{"not-an-ip", false},
+	}
+	for _, tc := range cases {
+		if got := set.Contains(tc.ip); got != tc.expected {
+			t.Errorf("Contains(%q) = %v, want %v", tc.ip, got, tc.expected)
+		}
+	}
+}
+
+func TestIPSet_MergesRanges(t *testing.T) {
+	set := MustParseIPSet("10.0.0.0/25", "10.0.0.128/25", "10.0.0.5", "10.0.1.0/24")
+	if set.Len() != 1 {
+		t.Fatalf("adjacent and overlapping ranges should merge into 1, got %d", set.Len())
+	}
+	if !set.Contains("10.0.1.255") || set.Contains("10.0.2.0") {
+		t.Fatal("merged range has wrong bounds")
+	}
+}
+
+func TestParseIPSet_InvalidEntry(t *testing.T) {
+	if _, err := ParseIPSet([]string{"10.0.0.0/8", "10.0.0.0/33"}); err == nil {
+		t.Fatal("expected error for invalid CIDR")
+	}
+	if _, err := ParseIPSet([]string{"300.1.1.1"}); err == nil {
+		t.Fatal("expected error for invalid IP")
+	}
+	if _, err := NewBypassIPs("bogus"); err == nil {
+		t.Fatal("NewBypassIPs should validate entries")
+	}
+}
+
+func TestClientIP_TrustedProxyXFF(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	defer initTestConfig()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:443"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.9")
+
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected rightmost untrusted XFF entry, got %s", ip)
+	}
+
+	// Untrusted peer: headers are ignored.
+	r.RemoteAddr = "198.51.100.1:443"
+	if ip := ClientIP(r); ip != "198.51.100.1" {
+		t.Fatalf("untrusted peer should be returned as-is, got %s", ip)
+	}
+
+	// A list set at runtime is compiled once and then served as is.
+	if err := SetTrustedProxies([]string{"198.51.100.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(resetTrustedProxies)
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the new proxy list to be trusted, got %s", ip)
+	}
+	if a, b := trustedProxySet(), trustedProxySet(); a != b {
+		t.Error("expected the compiled set to be reused")
+	}
+}
+
+func TestTrustedProxySet_FetchedOnlyIsCached(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	setFetchedProxies([]string{"192.0.2.0/24"})
+	t.Cleanup(func() { setFetchedProxies(nil) })
+
+	a := trustedProxySet()
+	if a == nil || !a.Contains("192.0.2.10") {
+		t.Fatalf("expected the fetched ranges to be trusted, got %v", a)
+	}
+	if b := trustedProxySet(); b != a {
+		t.Error("expected fetched ranges without configured ones to be compiled once")
+	}
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Budgets for background jobs
+// ──────────────────────────────────────────────
+
+// ErrNoJobBudget is returned for a job/resource pair that was never declared.
+var ErrNoJobBudget = errors.New("ratelimit: no budget declared for job")
+
+// JobStats counts one job budget's decisions.
+type JobStats struct {
+	Job       string
+	Resource  string
+	Allowed   uint64        // calls admitted
+	Throttled uint64        // calls that had to wait (Wait) or were denied (Allow)
+	Waited    time.Duration // total time spent waiting in Wait
+}
+
+// JobLimiter enforces rate budgets for scheduled and background jobs
+// ("the CRM sync may call the CRM API at most 60/min") through the same
+// Store as the HTTP limiters, so a budget holds across every instance
+// running the job. Keys are "job:<job>:<resource>".
+//
+// It has no scheduler of its own: jobs call Wait (or Allow) before each
+// call to the limited resource, or are wrapped with Wrap.
+type JobLimiter struct {
+	store Store
+
+	mu      sync.Mutex
+	budgets map[string]Policy
+	stats   map[string]*JobStats
+}
+
+// NewJobLimiter creates a JobLimiter backed by store.
+func NewJobLimiter(store Store) *JobLimiter {
+	return &JobLimiter{
+		store:   store,
+		budgets: make(map[string]Policy),
+		stats:   make(map[string]*JobStats),
+	}
+}
+
+// Declare sets the budget job may spend on resource. The policy's scope
+// defaults to "job:<job>".
+func (j *JobLimiter) Declare(job, resource string, p Policy) {
+	if p.Scope == "" {
+		p.Scope = "job:" + job
+	}
+	if p.Cost < 1 {
+		p.Cost = 1
+	}
+	p.Enabled = true
+
+	key := jobKey(job, resource)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.budgets[key] = p
+	if j.stats[key] == nil {
+		j.stats[key] = &JobStats{Job: job, Resource: resource}
+	}
+}
+
+// Allow spends cost from job's budget for resource without blocking.
+func (j *JobLimiter) Allow(ctx context.Context, job, resource string, cost int) (Result, error) {
+	key := jobKey(job, resource)
+	p, st, ok := j.budget(key)
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s/%s", ErrNoJobBudget, job, resource)
+	}
+	if cost < 1 {
+		cost = p.Cost
+	}
+
+	res := j.store.Allow(ctx, key, p, cost)
+	if res.Err != nil {
+		if p.failClosed() {
+			failedClosed.Add(1)
+			log.Printf("[ratelimit] store allow error job=%s resource=%s, failing closed: %v", job, resource, res.Err)
+			res.Allowed, res.Remaining, res.RetryAfter = false, 0, 1
+		} else {
+			failedOpen.Add(1)
+			log.Printf("[ratelimit] store allow error job=%s resource=%s, failing open: %v", job, resource, res.Err)
+			res.Allowed = true
+		}
+	}
+
+	j.mu.Lock()
+	if res.Allowed {
+		st.Allowed++
+	} else {
+		st.Throttled++
+	}
+	j.mu.Unlock()
+	return res, nil
+}
+
+// Wait blocks until job's budget for resource admits cost, or ctx ends.
+func (j *JobLimiter) Wait(ctx context.Context, job, resource string, cost int) error {
+	start := time.Now()
+	waited := false
+	defer func() {
+		if waited {
+			j.addWait(jobKey(job, resource), time.Since(start))
+		}
+	}()
+
+	for {
+		res, err := j.Allow(ctx, job, resource, cost)
+		if err != nil {
+			return err
+		}
+		if res.Allowed {
+			return nil
+		}
+		waited = true
+		delay := time.Duration(max(res.RetryAfter, 1)) * time.Second
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Wrap returns fn guarded by Wait, in the func(ctx) error shape job
+// runners expect.
+func (j *JobLimiter) Wrap(job, resource string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := j.Wait(ctx, job, resource, 0); err != nil {
+			return err
+		}
+		return fn(ctx)
+	}
+}
+
+// Stats returns every declared budget's counters, sorted by job and resource.
+func (j *JobLimiter) Stats() []JobStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]JobStats, 0, len(j.stats))
+	for _, st := range j.stats {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Job != out[b].Job {
+			return out[a].Job < out[b].Job
+		}
+		return out[a].Resource < out[b].Resource
+	})
+	return out
+}
+
+func (j *JobLimiter) budget(key string) (Policy, *JobStats, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p, ok := j.budgets[key]
+	return p, j.stats[key], ok
+}
+
+func (j *JobLimiter) addWait(key string, d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if st := j.stats[key]; st != nil {
+		st.Waited += d
+	}
+}
+
+func jobKey(job, resource string) string { return "job:" + job + ":" + resource }
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobLimiter_BudgetAndStats(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	jobs := NewJobLimiter(store)
+	jobs.Declare("crm-sync", "crm-api", Policy{Limit: 2, Window: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := jobs.Wait(ctx, "crm-sync", "crm-api", 1); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if res, _ := jobs.Allow(ctx, "crm-sync", "crm-api", 1); res.Allowed {
+		t.Fatal("3rd call should exceed the budget")
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := jobs.Wait(short, "crm-sync", "crm-api", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait over budget: want deadline exceeded, got %v", err)
+	}
+
+	st := jobs.Stats()
+	if len(st) != 1 || st[0].Allowed != 2 || st[0].Throttled != 2 || st[0].Waited <= 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
+
+func TestJobLimiter_UndeclaredAndWrap(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	jobs := NewJobLimiter(store)
+
+	if _, err := jobs.Allow(context.Background(), "nightly", "mailer", 1); !errors.Is(err, ErrNoJobBudget) {
+		t.Fatalf("want ErrNoJobBudget, got %v", err)
+	}
+
+	jobs.Declare("nightly", "mailer", Policy{Limit: 60, Window: time.Minute})
+	ran := false
+	run := jobs.Wrap("nightly", "mailer", func(context.Context) error { ran = true; return nil })
+	if err := run(context.Background()); err != nil || !ran {
+		t.Fatalf("wrapped job: ran=%v err=%v", ran, err)
+	}
+	if calls := store.Calls(); len(calls) != 1 || calls[0].Key != "job:nightly:mailer" || calls[0].Policy.Scope != "job:nightly" {
+		t.Fatalf("unexpected store calls: %+v", calls)
+	}
+}
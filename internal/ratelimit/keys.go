@@ -1,6 +1,8 @@
 package ratelimit
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -8,6 +10,7 @@ import (
 	"strings"
 
 	"gohst/internal/auth"
+	"gohst/internal/config"
 	"gohst/internal/session"
 )
 
@@ -23,25 +26,133 @@ const (
 	KeyTypeIPUA    = "ipua"
 	KeyTypeIPRoute = "iproute"
 	KeyTypeIPIdent = "ipident"
+	KeyTypeAPIKey  = "apikey"
+	KeyTypeHeader  = "header"
+	KeyTypeCookie  = "cookie"
 )
 
+// The built-in key types fall into three classes, used by lockdown,
+// header hiding and deny messages. Custom key types, and KeyTypeTenant,
+// fall into none.
+
+// accountKeyType reports whether keyType identifies an account or a
+// credential. KeyTypeIPIdent counts, as it keys login attempts by the
+// account they target.
+func accountKeyType(keyType string) bool {
+	switch keyType {
+	case KeyTypeIPIdent, KeyTypeUser, KeyTypeSession, KeyTypeToken, KeyTypeAPIKey,
+		KeyTypeJWT, KeyTypeTenantUser, KeyTypeService, KeyTypeGateway:
+		return true
+	}
+	return false
+}
+
+// networkKeyType reports whether keyType is derived from the client IP
+// alone.
+func networkKeyType(keyType string) bool {
+	switch keyType {
+	case KeyTypeIP, KeyTypeIPUA, KeyTypeIPRoute, KeyTypeGeo, KeyTypeASN, KeyTypeGraphQL:
+		return true
+	}
+	return false
+}
+
+// anonymousKeyType reports whether keyType identifies no account: it is
+// derived from the client IP, the client software (KeyTypeTLS), a value
+// the client picks (KeyTypeHeader, KeyTypeCookie) or the embedding site
+// (KeyTypeOrigin).
+func anonymousKeyType(keyType string) bool {
+	switch keyType {
+	case KeyTypeTLS, KeyTypeHeader, KeyTypeCookie, KeyTypeOrigin:
+		return true
+	}
+	return networkKeyType(keyType)
+}
+
 // KeyFunc computes a (key, keyType) pair from a request.
 type KeyFunc func(r *http.Request) (key string, keyType string)
 
+// KeyOption configures how a key function renders the client IP or
+// identifier. Options that do not apply to a function are ignored.
+type KeyOption func(*keyConfig)
+
+type keyConfig struct {
+	v4Bits, v6Bits int
+	normalize      func(string) string
+}
+
+func newKeyConfig(opts []KeyOption) keyConfig {
+	var c keyConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithIPv6Prefix keys IPv6 clients by their /bits network (typically 64,
+// 56 or 48) instead of the full address, since one customer usually holds
+// a whole block and can rotate through it.
+func WithIPv6Prefix(bits int) KeyOption {
+	return func(c *keyConfig) { c.v6Bits = bits }
+}
+
+// WithIPv4Prefix keys IPv4 clients by their /bits network, e.g. 24, so
+// the addresses of one CGNAT pool share a bucket. Leave it unset unless
+// the pool's users should share a limit.
+func WithIPv4Prefix(bits int) KeyOption {
+	return func(c *keyConfig) { c.v4Bits = bits }
+}
+
+// WithIdentifierNormalizer maps identifiers through fn, after trimming and
+// lowercasing, before they are hashed into the key. Use it to fold aliases
+// of one account into one bucket, e.g. with NormalizeEmail.
+func WithIdentifierNormalizer(fn func(string) string) KeyOption {
+	return func(c *keyConfig) { c.normalize = fn }
+}
+
+// keyIdentifier returns the identifier resolver for a key function,
+// normalised as opts say.
+func keyIdentifier(field string, opts []KeyOption) func(*http.Request) string {
+	normalize := newKeyConfig(opts).normalize
+	return func(r *http.Request) string {
+		v := extractIdentifier(r, field)
+		if normalize != nil && v != "" {
+			v = normalize(v)
+		}
+		return v
+	}
+}
+
+// keyIP returns the client IP resolver for a key function, coarsened as
+// opts say (see CoarsenIP).
+func keyIP(opts []KeyOption) func(*http.Request) string {
+	c := newKeyConfig(opts)
+	if c.v4Bits == 0 && c.v6Bits == 0 {
+		return ClientIP
+	}
+	return func(r *http.Request) string {
+		return CoarsenIP(ClientIP(r), c.v4Bits, c.v6Bits)
+	}
+}
+
 // ──────────────────────────────────────────────
 // Pre-built key functions
 // ──────────────────────────────────────────────
 
-// KeyByIP keys solely by the client IP address.
-func KeyByIP() KeyFunc {
+// KeyByIP keys solely by the client IP address, optionally coarsened to
+// its network (see WithIPv6Prefix and WithIPv4Prefix); the other IP-based
+// key functions take the same options.
+func KeyByIP(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
 	return func(r *http.Request) (string, string) {
-		ip := ClientIP(r)
+		ip := clientIP(r)
 		return "ip:" + ip, KeyTypeIP
 	}
 }
 
 // KeyByUserElseIP keys by authenticated user ID, falling back to IP.
-func KeyByUserElseIP() KeyFunc {
+func KeyByUserElseIP(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
 	return func(r *http.Request) (string, string) {
 		sess := session.FromContext(r.Context())
 		if sess != nil && auth.IsAuthenticated(sess) {
@@ -49,13 +160,14 @@ func KeyByUserElseIP() KeyFunc {
 				return fmt.Sprintf("user:%v", uid), KeyTypeUser
 			}
 		}
-		ip := ClientIP(r)
+		ip := clientIP(r)
 		return "ip:" + ip, KeyTypeIP
 	}
 }
 
 // KeyByTokenElseUserElseIP keys by bearer token hash, then user ID, then IP.
-func KeyByTokenElseUserElseIP() KeyFunc {
+func KeyByTokenElseUserElseIP(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
 	return func(r *http.Request) (string, string) {
 		// Check for bearer token
 		if token := extractBearerToken(r); token != "" {
@@ -69,39 +181,141 @@ func KeyByTokenElseUserElseIP() KeyFunc {
 			}
 		}
 		// Fallback to IP
-		ip := ClientIP(r)
+		ip := clientIP(r)
 		return "ip:" + ip, KeyTypeIP
 	}
 }
 
+// KeyBySession keys by a hash of the session ID, falling back to IP. It
+// separates anonymous visitors who share one NAT address. Only sessions the
+// client presented a cookie for count: a session created for this request
+// is keyed by IP, so dropping cookies does not mint fresh buckets.
+func KeyBySession(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	return func(r *http.Request) (string, string) {
+		if sess := session.FromContext(r.Context()); sess != nil && sess.ID() != "" {
+			if c, err := r.Cookie(session.SESSION_NAME); err == nil && c.Value == sess.ID() {
+				return "session:" + hashValue(sess.ID()), KeyTypeSession
+			}
+		}
+		return "ip:" + clientIP(r), KeyTypeIP
+	}
+}
+
+// APIKeyLookup validates an API key and resolves it to a stable client ID
+// (e.g. a customer or application ID). It returns ok=false for unknown or
+// revoked keys. It runs on every request, so it should be cached.
+type APIKeyLookup func(ctx context.Context, apiKey string) (clientID string, ok bool)
+
+// KeyByAPIKey keys by the client ID behind an API key. The key is read from
+// header (e.g. "X-API-Key"), then from queryParam; either may be empty to
+// disable that source. Requests without a key, or with a key lookup
+// rejects, are keyed by IP, so random garbage keys cannot mint fresh
+// buckets.
+func KeyByAPIKey(header, queryParam string, lookup APIKeyLookup, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	return func(r *http.Request) (string, string) {
+		var apiKey string
+		if header != "" {
+			apiKey = strings.TrimSpace(r.Header.Get(header))
+		}
+		if apiKey == "" && queryParam != "" {
+			apiKey = strings.TrimSpace(r.URL.Query().Get(queryParam))
+		}
+		if apiKey != "" {
+			if clientID, ok := lookup(r.Context(), apiKey); ok && clientID != "" {
+				return "apikey:" + clientID, KeyTypeAPIKey
+			}
+		}
+		return "ip:" + clientIP(r), KeyTypeIP
+	}
+}
+
+// KeyByHeader keys by a hash of an arbitrary request header, e.g.
+// "X-Device-ID" sent by the mobile apps. Requests without the header use
+// fallback, or KeyByIP when fallback is nil. The header is client-supplied,
+// so a client can rotate it to get fresh buckets: pair it with an IP-keyed
+// limiter when the limit must hold against abuse.
+func KeyByHeader(name string, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	prefix := "header:" + strings.ToLower(name) + ":"
+	return func(r *http.Request) (string, string) {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return prefix + hashValue(v), KeyTypeHeader
+		}
+		return fallback(r)
+	}
+}
+
+// KeyByCookie keys by a hash of a named cookie, e.g. a long-lived visitor ID
+// set for anonymous traffic, so visitors behind one carrier-grade NAT get
+// their own buckets without logging in. Requests without the cookie use
+// fallback, or KeyByIP when fallback is nil. Clients can drop or forge the
+// cookie, so as with KeyByHeader, pair it with an IP-keyed limiter where
+// the limit must hold against abuse.
+func KeyByCookie(name string, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	prefix := "cookie:" + strings.ToLower(name) + ":"
+	return func(r *http.Request) (string, string) {
+		if c, err := r.Cookie(name); err == nil {
+			if v := strings.TrimSpace(c.Value); v != "" {
+				return prefix + hashValue(v), KeyTypeCookie
+			}
+		}
+		return fallback(r)
+	}
+}
+
 // KeyByIPAndIdentifier creates a composite key from IP + a form/query value,
 // ideal for login/reset endpoints where you want to limit attempts on a
 // specific account from a specific IP.
 //
 // The identifier (e.g. email) is normalised and hashed so it is safe to log
-// and store.
-func KeyByIPAndIdentifier(field string) KeyFunc {
+// and store. Trimming and lowercasing are always applied; pass
+// WithIdentifierNormalizer(NormalizeEmail) to also fold address aliases.
+func KeyByIPAndIdentifier(field string, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	identifierOf := keyIdentifier(field, opts)
 	return func(r *http.Request) (string, string) {
-		ip := ClientIP(r)
-		identifier := extractIdentifier(r, field)
+		ip := clientIP(r)
+		identifier := identifierOf(r)
 		return fmt.Sprintf("ipident:%s:%s", ip, hashValue(identifier)), KeyTypeIPIdent
 	}
 }
 
 // KeyByIPAndRoute creates a composite key from IP + request path,
 // useful for limiting expensive endpoints without penalising the whole site.
-func KeyByIPAndRoute() KeyFunc {
+func KeyByIPAndRoute(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
 	return func(r *http.Request) (string, string) {
-		ip := ClientIP(r)
+		ip := clientIP(r)
 		route := r.URL.Path
 		return fmt.Sprintf("iproute:%s:%s", ip, route), KeyTypeIPRoute
 	}
 }
 
+// KeyByRoutePattern is KeyByIPAndRoute keyed on the matched route pattern
+// (e.g. "GET /users/{id}") instead of the raw path, so /users/1 and
+// /users/2 share one bucket and dynamic paths cannot explode key
+// cardinality. The pattern is taken from r.Pattern when the limiter runs
+// inside the mux's handler, otherwise looked up in mux, which may be nil
+// for the former. Unmatched requests share one "-" pattern per IP.
+func KeyByRoutePattern(mux *http.ServeMux, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	return func(r *http.Request) (string, string) {
+		return fmt.Sprintf("iproute:%s:%s", clientIP(r), routePattern(r, mux)), KeyTypeIPRoute
+	}
+}
+
 // KeyByIPAndUA creates a composite key from IP + user-agent hash.
-func KeyByIPAndUA() KeyFunc {
+func KeyByIPAndUA(opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
 	return func(r *http.Request) (string, string) {
-		ip := ClientIP(r)
+		ip := clientIP(r)
 		ua := r.Header.Get("User-Agent")
 		return fmt.Sprintf("ipua:%s:%s", ip, hashValue(ua)), KeyTypeIPUA
 	}
@@ -141,9 +355,55 @@ func extractIdentifier(r *http.Request, field string) string {
 	return ""
 }
 
-// hashValue returns the first 16 chars of the SHA-256 hex digest.
-// This is safe to log and store; the original value cannot be recovered.
+// routePattern returns the ServeMux pattern matching r, or "-".
+func routePattern(r *http.Request, mux *http.ServeMux) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	if mux != nil {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+	}
+	return "-"
+}
+
+// NormalizeEmail folds the aliases of an email address into one form, so
+// "F.O.O+spam@googlemail.com" and "foo@gmail.com" share a key: it strips
+// any "+tag" from the local part and, for Gmail, the dots as well. Values
+// without an "@" are returned lowercased and trimmed. The result is for
+// keys only; it is not necessarily a deliverable address.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if i := strings.IndexByte(local, '+'); i > 0 {
+		local = local[:i]
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// hashValue hashes an identifier, token or header value for use in keys.
+// With RATE_LIMIT_HASH_SECRET set it returns the full HMAC-SHA256 hex
+// digest, so logged hashes cannot be matched offline against known values
+// (e.g. a list of emails) and collisions are negligible. Without a secret,
+// or with RATE_LIMIT_HASH_MODE=legacy, it returns the first 16 chars of
+// the plain SHA-256 hex digest, as earlier versions did.
 func hashValue(v string) string {
+	if cfg := config.RateLimit; cfg != nil && cfg.HashSecret != "" && cfg.HashMode != "legacy" {
+		mac := hmac.New(sha256.New, []byte(cfg.HashSecret))
+		mac.Write([]byte(v))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
 	h := sha256.Sum256([]byte(v))
 	return hex.EncodeToString(h[:])[:16]
 }
@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// Composite key builder
+// ──────────────────────────────────────────────
+
+// keyDim is one dimension of a composite key.
+type keyDim struct {
+	rank  int    // canonical position; dimensions are emitted in rank, then name order
+	kind  string // contributes to the keyType, e.g. "ip"
+	name  string // contributes to the key prefix, e.g. "header.x-device"
+	hash  bool   // hash the value so it is safe to log and store
+	value func(r *http.Request) string
+}
+
+const (
+	rankTenant = iota
+	rankIP
+	rankRoute
+	rankHeader
+	rankCookie
+	rankIdentifier
+	rankCustom
+)
+
+// KeyBuilder composes request dimensions into one KeyFunc:
+//
+//	NewKeyBuilder().IP().Header("X-Device").Build()
+//
+// Dimensions are emitted in a fixed order whatever order they were added
+// in, so equal builders always produce equal keys. The key is
+// "<dims>:<value>:<value>..." and the keyType joins the dimension kinds,
+// e.g. key "ip+header.x-device:203.0.113.7:9f86d081884c7d65" with keyType
+// "ip+header". Client-supplied values (headers, identifiers, custom
+// values) are hashed; the IP and route are kept readable.
+//
+// Builders are immutable: each method returns a new builder, so a partial
+// builder can be shared as a base.
+type KeyBuilder struct {
+	dims []keyDim
+}
+
+// NewKeyBuilder returns an empty builder.
+func NewKeyBuilder() KeyBuilder { return KeyBuilder{} }
+
+// Tenant adds the tenant ID (see KeyByTenant); requests without a tenant
+// get "-".
+func (b KeyBuilder) Tenant(resolve TenantResolver) KeyBuilder {
+	return b.with(keyDim{rank: rankTenant, kind: "tenant", name: "tenant", value: func(r *http.Request) string {
+		if id, ok := resolve(r); ok {
+			return id
+		}
+		return "-"
+	}})
+}
+
+// IP adds the client IP (see ClientIP), optionally coarsened to its
+// network (see WithIPv6Prefix).
+func (b KeyBuilder) IP(opts ...KeyOption) KeyBuilder {
+	return b.with(keyDim{rank: rankIP, kind: "ip", name: "ip", value: keyIP(opts)})
+}
+
+// Route adds the request path.
+func (b KeyBuilder) Route() KeyBuilder {
+	return b.with(keyDim{rank: rankRoute, kind: "route", name: "route", value: func(r *http.Request) string {
+		return r.URL.Path
+	}})
+}
+
+// RoutePattern adds the matched route pattern instead of the raw path (see
+// KeyByRoutePattern). Route and RoutePattern are one dimension: only the
+// first added is used.
+func (b KeyBuilder) RoutePattern(mux *http.ServeMux) KeyBuilder {
+	return b.with(keyDim{rank: rankRoute, kind: "route", name: "route", value: func(r *http.Request) string {
+		return routePattern(r, mux)
+	}})
+}
+
+// Header adds a hash of the named request header.
+func (b KeyBuilder) Header(name string) KeyBuilder {
+	return b.with(keyDim{rank: rankHeader, kind: "header", name: "header." + strings.ToLower(name), hash: true,
+		value: func(r *http.Request) string {
+			return strings.TrimSpace(r.Header.Get(name))
+		}})
+}
+
+// Cookie adds a hash of the named cookie's value.
+func (b KeyBuilder) Cookie(name string) KeyBuilder {
+	return b.with(keyDim{rank: rankCookie, kind: "cookie", name: "cookie." + strings.ToLower(name), hash: true,
+		value: func(r *http.Request) string {
+			if c, err := r.Cookie(name); err == nil {
+				return strings.TrimSpace(c.Value)
+			}
+			return ""
+		}})
+}
+
+// Identifier adds a hash of a normalised form or query value, e.g. "email"
+// (see KeyByIPAndIdentifier and WithIdentifierNormalizer).
+func (b KeyBuilder) Identifier(field string, opts ...KeyOption) KeyBuilder {
+	return b.with(keyDim{rank: rankIdentifier, kind: "ident", name: "ident." + strings.ToLower(field), hash: true,
+		value: keyIdentifier(field, opts)})
+}
+
+// Value adds a custom dimension; fn's result is hashed. name should be a
+// short lowercase label such as "tenant".
+func (b KeyBuilder) Value(name string, fn func(r *http.Request) string) KeyBuilder {
+	name = strings.ToLower(name)
+	return b.with(keyDim{rank: rankCustom, kind: name, name: name, hash: true, value: fn})
+}
+
+// with returns a copy of b with d added; adding the same dimension twice
+// is a no-op.
+func (b KeyBuilder) with(d keyDim) KeyBuilder {
+	for _, existing := range b.dims {
+		if existing.name == d.name {
+			return b
+		}
+	}
+	dims := make([]keyDim, len(b.dims), len(b.dims)+1)
+	copy(dims, b.dims)
+	dims = append(dims, d)
+	sort.SliceStable(dims, func(i, j int) bool {
+		if dims[i].rank != dims[j].rank {
+			return dims[i].rank < dims[j].rank
+		}
+		return dims[i].name < dims[j].name
+	})
+	return KeyBuilder{dims: dims}
+}
+
+// Build returns the KeyFunc. An empty builder keys by IP.
+func (b KeyBuilder) Build() KeyFunc {
+	if len(b.dims) == 0 {
+		return KeyByIP()
+	}
+	dims := b.dims
+
+	names := make([]string, len(dims))
+	var kinds []string
+	for i, d := range dims {
+		names[i] = d.name
+		if len(kinds) == 0 || kinds[len(kinds)-1] != d.kind {
+			kinds = append(kinds, d.kind)
+		}
+	}
+	prefix := strings.Join(names, "+")
+	keyType := strings.Join(kinds, "+")
+
+	return func(r *http.Request) (string, string) {
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		for _, d := range dims {
+			v := d.value(r)
+			if d.hash {
+				v = hashValue(v)
+			}
+			sb.WriteByte(':')
+			sb.WriteString(v)
+		}
+		return sb.String(), keyType
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyBuilder_ComposesDimensions(t *testing.T) {
+	fn := NewKeyBuilder().IP().Route().Header("X-Device").Build()
+	r := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Device", "phone-1")
+
+	key, keyType := fn(r)
+	if keyType != "ip+route+header" {
+		t.Fatalf("expected keyType ip+route+header, got %q", keyType)
+	}
+	expected := "ip+route+header.x-device:10.0.0.1:/api/export:" + hashValue("phone-1")
+	if key != expected {
+		t.Fatalf("expected key %q, got %q", expected, key)
+	}
+}
+
+func TestKeyBuilder_OrderIndependent(t *testing.T) {
+	a := NewKeyBuilder().Identifier("email").Header("X-B").IP().Header("X-A").Build()
+	b := NewKeyBuilder().IP().Header("X-A").Header("X-B").Identifier("email").Identifier("email").Build()
+	r := httptest.NewRequest(http.MethodGet, "/login?email=Alice@Example.com", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-A", "1")
+	r.Header.Set("X-B", "2")
+
+	ka, ta := a(r)
+	kb, tb := b(r)
+	if ka != kb || ta != tb {
+		t.Fatalf("builders differ: %q/%q vs %q/%q", ka, ta, kb, tb)
+	}
+	if ta != "ip+header+ident" {
+		t.Fatalf("expected keyType ip+header+ident, got %q", ta)
+	}
+	expected := "ip+header.x-a+header.x-b+ident.email:10.0.0.1:" +
+		hashValue("1") + ":" + hashValue("2") + ":" + hashValue("alice@example.com")
+	if ka != expected {
+		t.Fatalf("expected key %q, got %q", expected, ka)
+	}
+}
+
+func TestKeyBuilder_Immutable(t *testing.T) {
+	base := NewKeyBuilder().IP()
+	withRoute := base.Route().Build()
+	onlyIP := base.Build()
+
+	r := httptest.NewRequest(http.MethodGet, "/x", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+	if key, keyType := onlyIP(r); key != "ip:1.2.3.4" || keyType != KeyTypeIP {
+		t.Fatalf("base builder changed: %q/%q", key, keyType)
+	}
+	if key, _ := withRoute(r); key != "ip+route:1.2.3.4:/x" {
+		t.Fatalf("unexpected key %q", key)
+	}
+}
+
+func TestKeyBuilder_EmptyKeysByIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+	if key, keyType := NewKeyBuilder().Build()(r); key != "ip:1.2.3.4" || keyType != KeyTypeIP {
+		t.Fatalf("expected IP key, got %q/%q", key, keyType)
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// ──────────────────────────────────────────────
+// Client-certificate (mTLS / SPIFFE) keys
+// ──────────────────────────────────────────────
+
+// KeyTypeService is the key type of client-certificate identity keys.
+const KeyTypeService = "service"
+
+// ClientCertIdentity returns the identity of r's verified client
+// certificate: its SPIFFE ID (a "spiffe://" URI SAN) if it has one,
+// otherwise its subject common name. Certificates the server did not
+// verify are ignored, so serve with tls.RequireAndVerifyClientCert (or
+// VerifyClientCertIfGiven) and the internal CA in ClientCAs.
+func ClientCertIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	id := certIdentity(r.TLS.VerifiedChains[0][0])
+	return id, id != ""
+}
+
+func certIdentity(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return u.String()
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+// KeyByClientCert keys mTLS service-to-service calls by the calling
+// service ("service:spiffe://prod/ns/billing/sa/worker" or
+// "service:<CN>"), so each internal caller gets its own budget. Requests
+// without a verified client certificate use fallback, or KeyByIP when
+// fallback is nil.
+func KeyByClientCert(fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if id, ok := ClientCertIdentity(r); ok {
+			return "service:" + id, KeyTypeService
+		}
+		return fallback(r)
+	}
+}
+
+// BypassIdentities bypasses requests whose verified client certificate has
+// one of the given identities (SPIFFE IDs or common names, see
+// ClientCertIdentity), e.g. a health checker or the deploy pipeline.
+type BypassIdentities struct {
+	Identities []string
+}
+
+func (b BypassIdentities) Matches(r *http.Request) bool {
+	id, ok := ClientCertIdentity(r)
+	if !ok {
+		return false
+	}
+	for _, allowed := range b.Identities {
+		if id == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func certRequest(cert *x509.Certificate, verified bool) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/internal", nil)
+	r.RemoteAddr = "10.1.2.3:4444"
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return r
+}
+
+func TestKeyByClientCert(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://prod/ns/billing/sa/worker")
+	withSPIFFE := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, URIs: []*url.URL{spiffe}}
+	withCN := &x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}
+	fn := KeyByClientCert(nil)
+
+	if key, keyType := fn(certRequest(withSPIFFE, true)); key != "service:spiffe://prod/ns/billing/sa/worker" || keyType != KeyTypeService {
+		t.Fatalf("SPIFFE: got %s (%s)", key, keyType)
+	}
+	if key, _ := fn(certRequest(withCN, true)); key != "service:reports" {
+		t.Fatalf("CN: got %s", key)
+	}
+	// An unverified certificate is not trusted.
+	if key, keyType := fn(certRequest(withCN, false)); key != "ip:10.1.2.3" || keyType != KeyTypeIP {
+		t.Fatalf("unverified: got %s (%s)", key, keyType)
+	}
+}
+
+func TestBypassIdentities(t *testing.T) {
+	rule := BypassIdentities{Identities: []string{"deployer"}}
+	if !rule.Matches(certRequest(&x509.Certificate{Subject: pkix.Name{CommonName: "deployer"}}, true)) {
+		t.Fatal("listed identity should bypass")
+	}
+	if rule.Matches(certRequest(&x509.Certificate{Subject: pkix.Name{CommonName: "deployer"}}, false)) {
+		t.Fatal("unverified certificate should not bypass")
+	}
+	if rule.Matches(certRequest(&x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, true)) {
+		t.Fatal("unlisted identity should not bypass")
+	}
+}
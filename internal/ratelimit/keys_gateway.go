@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// Gateway-supplied keys
+// ──────────────────────────────────────────────
+
+// KeyTypeGateway is the key type of keys supplied by a trusted gateway.
+const KeyTypeGateway = "gateway"
+
+// gatewayKeyMaxLen bounds gateway keys kept verbatim; longer values are
+// hashed so a misbehaving gateway cannot bloat the store.
+const gatewayKeyMaxLen = 128
+
+// KeyByGatewayHeader uses a key the API gateway has already computed, e.g.
+// from "X-RateLimit-Key" set after it authenticated the request, so the
+// limiter does not re-parse tokens the gateway validated. The header is
+// only honoured when RemoteAddr is in RATE_LIMIT_TRUSTED_PROXIES; in
+// hop-count mode (RATE_LIMIT_TRUSTED_HOPS) the peer is not checked, so the
+// header is never trusted. Otherwise, or when it is empty, fallback
+// computes the key, or KeyByIP when fallback is nil. The gateway must
+// strip the header from incoming requests.
+func KeyByGatewayHeader(header string, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if gatewayPeer(r) {
+			if v := strings.TrimSpace(r.Header.Get(header)); v != "" {
+				if len(v) > gatewayKeyMaxLen || strings.ContainsFunc(v, isControl) {
+					v = hashValue(v)
+				}
+				return "gateway:" + v, KeyTypeGateway
+			}
+		}
+		return fallback(r)
+	}
+}
+
+// gatewayPeer reports whether r's immediate peer is a configured trusted
+// proxy. Unlike trustedPeer it ignores hop-count mode, where any client can
+// satisfy the check with a forged X-Forwarded-For.
+func gatewayPeer(r *http.Request) bool {
+	if trustedHops() > 0 {
+		return false
+	}
+	return trustedProxySet().Contains(extractIP(r.RemoteAddr))
+}
+
+func isControl(c rune) bool { return c < 0x20 || c == 0x7f }
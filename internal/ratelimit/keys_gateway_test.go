@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gohst/internal/config"
+)
+
+func TestKeyByGatewayHeader(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	fn := KeyByGatewayHeader("X-RateLimit-Key", KeyByIPAndRoute())
+
+	r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-RateLimit-Key", "tenant-7:user-42")
+	if key, keyType := fn(r); key != "gateway:tenant-7:user-42" || keyType != KeyTypeGateway {
+		t.Fatalf("trusted gateway: got %s (%s)", key, keyType)
+	}
+
+	long := strings.Repeat("x", gatewayKeyMaxLen+1)
+	r.Header.Set("X-RateLimit-Key", long)
+	if key, _ := fn(r); key != "gateway:"+hashValue(long) {
+		t.Fatalf("long key should be hashed, got %s", key)
+	}
+
+	// Untrusted peers cannot choose their own key.
+	r.RemoteAddr = "9.9.9.9:1234"
+	if key, keyType := fn(r); key != "iproute:9.9.9.9:/api/orders" || keyType != KeyTypeIPRoute {
+		t.Fatalf("untrusted peer: got %s (%s)", key, keyType)
+	}
+
+	// A trusted proxy without the header falls back too.
+	r = httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if _, keyType := fn(r); keyType != KeyTypeIPRoute {
+		t.Fatalf("no header: got key type %s", keyType)
+	}
+}
+
+func TestKeyByGatewayHeader_ForgedForwardedFor(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedHops = 1
+	fn := KeyByGatewayHeader("X-RateLimit-Key", nil)
+
+	// In hop-count mode a direct client can make the request look proxied
+	// by adding X-Forwarded-For; it must not pick its own key.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "9.9.9.9:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	r.Header.Set("X-RateLimit-Key", "victim")
+	if key, keyType := fn(r); keyType == KeyTypeGateway {
+		t.Fatalf("forged XFF was trusted: got %s", key)
+	}
+
+	// Hop mode ignores TRUSTED_PROXIES for client IPs, so even a listed
+	// peer is refused.
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	r.RemoteAddr = "10.0.0.1:1234"
+	if key, keyType := fn(r); keyType == KeyTypeGateway {
+		t.Fatalf("hop mode should refuse the header: got %s", key)
+	}
+}
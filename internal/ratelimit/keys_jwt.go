@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// JWT claim keys
+// ──────────────────────────────────────────────
+
+// KeyTypeJWT is the key type reported by KeyByJWTClaim.
+const KeyTypeJWT = "jwt"
+
+// JWTVerifier checks a token signature. alg is the header's "alg" value,
+// signingInput is "<header>.<payload>" as sent, and signature is decoded.
+type JWTVerifier func(alg string, signingInput, signature []byte) error
+
+// HS256Verifier verifies HMAC-SHA256 signed tokens with secret.
+func HS256Verifier(secret []byte) JWTVerifier {
+	return func(alg string, signingInput, signature []byte) error {
+		if alg != "HS256" {
+			return fmt.Errorf("unexpected alg %q", alg)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+}
+
+// KeyByJWTClaim keys by one claim (e.g. "sub" or "tenant_id") of the bearer
+// JWT, so clients keep their budget across token refreshes. Only string
+// and number claims up to jwtClaimMaxLen bytes are used, and the value is
+// hashed so subjects and e-mail addresses never reach the store or logs.
+// Requests without a usable token, with an expired token, or without such
+// a claim are keyed by IP.
+//
+// verify may be nil to skip signature checks when an upstream gateway has
+// already verified the token. Without verification anyone can mint claims,
+// so an attacker could spread requests over invented subjects.
+func KeyByJWTClaim(claim string, verify JWTVerifier, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	return func(r *http.Request) (string, string) {
+		if token := extractBearerToken(r); token != "" {
+			if claims, err := parseJWT(token, verify); err == nil {
+				if s, ok := claimValue(claims[claim]); ok {
+					return "jwt:" + claim + ":" + hashValue(s), KeyTypeJWT
+				}
+			}
+		}
+		return "ip:" + clientIP(r), KeyTypeIP
+	}
+}
+
+// jwtClaimMaxLen bounds the claim values KeyByJWTClaim accepts.
+const jwtClaimMaxLen = 256
+
+// claimValue returns v as a key part when it is a non-empty string or a
+// number of at most jwtClaimMaxLen bytes. Arrays, objects and booleans
+// are refused rather than stringified.
+func claimValue(v interface{}) (string, bool) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return "", false
+	}
+	return s, s != "" && len(s) <= jwtClaimMaxLen
+}
+
+// parseJWT decodes a compact JWS, verifies it when verify is non-nil, and
+// rejects expired tokens.
+func parseJWT(token string, verify JWTVerifier) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	enc := base64.RawURLEncoding
+
+	if verify != nil {
+		headerJSON, err := enc.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("header: %w", err)
+		}
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		if err := json.Unmarshal(headerJSON, &header); err != nil {
+			return nil, fmt.Errorf("header: %w", err)
+		}
+		sig, err := enc.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("signature: %w", err)
+		}
+		if err := verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	dec := json.NewDecoder(strings.NewReader(string(payload)))
+	dec.UseNumber() // keep numeric IDs exact
+	var claims map[string]interface{}
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	if exp, ok := claims["exp"].(json.Number); ok {
+		if secs, err := exp.Int64(); err == nil && time.Now().Unix() >= secs {
+			return nil, errors.New("token expired")
+		}
+	}
+	return claims, nil
+}
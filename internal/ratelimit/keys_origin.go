@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// Origin keys (embeddable widgets)
+// ──────────────────────────────────────────────
+
+// KeyTypeOrigin is the key type of per-embedding-site keys.
+const KeyTypeOrigin = "origin"
+
+// KeyByOrigin keys widget API calls by the site embedding the widget, so
+// each embedding site gets its own budget instead of each visitor. The
+// site is the host of the Origin header, or of the Referer when Origin is
+// absent or "null".
+//
+// Both headers are set by browsers but can be forged by any other client,
+// so:
+//
+//   - Only hosts in allowed (exact, or "*.example.com" for any subdomain)
+//     are keyed by origin; others use fallback, so inventing origins
+//     cannot mint fresh buckets. An empty list accepts no host, so every
+//     request uses fallback.
+//   - A request whose Origin and Referer name different hosts is treated
+//     as forged and uses fallback.
+//   - Requests with neither header use fallback, or KeyByIP when fallback
+//     is nil.
+//
+// A forged Origin can still spend a listed site's budget, so keep a
+// per-IP limiter next to this one.
+func KeyByOrigin(allowed []string, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	exact := make(map[string]struct{})
+	var suffixes []string
+	for _, h := range allowed {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if rest, ok := strings.CutPrefix(h, "*."); ok {
+			if rest != "" {
+				suffixes = append(suffixes, "."+rest)
+			}
+		} else if h != "" {
+			exact[h] = struct{}{}
+		}
+	}
+	if len(exact) == 0 && len(suffixes) == 0 {
+		log.Println("[ratelimit] warning: KeyByOrigin has no allowed hosts; every request uses the fallback key")
+	}
+	listed := func(host string) bool {
+		if _, ok := exact[host]; ok {
+			return true
+		}
+		for _, s := range suffixes {
+			if strings.HasSuffix(host, s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) (string, string) {
+		origin := headerHost(r.Header.Get("Origin"))
+		referer := headerHost(r.Header.Get("Referer"))
+		host := origin
+		switch {
+		case origin == "":
+			host = referer
+		case referer != "" && referer != origin:
+			host = "" // disagreeing headers: forged
+		}
+		if host != "" && listed(host) {
+			return "origin:" + host, KeyTypeOrigin
+		}
+		return fallback(r)
+	}
+}
+
+// headerHost returns the lowercased host (without port) of an Origin or
+// Referer value, or "" when it has none.
+func headerHost(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "null" {
+		return ""
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyByOrigin(t *testing.T) {
+	fn := KeyByOrigin([]string{"shop.example.com", "*.partner.io"}, nil)
+
+	tests := []struct {
+		name            string
+		origin, referer string
+		key             string
+	}{
+		{"origin", "https://shop.example.com", "", "origin:shop.example.com"},
+		{"origin with port", "https://Shop.Example.com:8443", "", "origin:shop.example.com"},
+		{"referer only", "", "https://a.partner.io/page?x=1", "origin:a.partner.io"},
+		{"null origin uses referer", "null", "https://shop.example.com/", "origin:shop.example.com"},
+		{"matching headers", "https://shop.example.com", "https://shop.example.com/cart", "origin:shop.example.com"},
+		{"conflicting headers", "https://shop.example.com", "https://evil.test/", "ip:1.2.3.4"},
+		{"unlisted host", "https://random.test", "", "ip:1.2.3.4"},
+		{"bare suffix not matched", "https://partner.io", "", "ip:1.2.3.4"},
+		{"non-http scheme", "chrome-extension://abc", "", "ip:1.2.3.4"},
+		{"no headers", "", "", "ip:1.2.3.4"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/widget", nil)
+		r.RemoteAddr = "1.2.3.4:9999"
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if tc.referer != "" {
+			r.Header.Set("Referer", tc.referer)
+		}
+		key, keyType := fn(r)
+		if key != tc.key {
+			t.Errorf("%s: got key %q, want %q", tc.name, key, tc.key)
+		}
+		if tc.key != "ip:1.2.3.4" && keyType != KeyTypeOrigin {
+			t.Errorf("%s: got key type %q", tc.name, keyType)
+		}
+	}
+}
+
+func TestKeyByOrigin_EmptyListUsesFallback(t *testing.T) {
+	for _, allowed := range [][]string{nil, {""}, {"*."}} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "1.2.3.4:9999"
+		r.Header.Set("Origin", "https://anyone.test")
+		if key, _ := KeyByOrigin(allowed, nil)(r); key != "ip:1.2.3.4" {
+			t.Errorf("allowed=%q: expected the fallback key, got %q", allowed, key)
+		}
+	}
+}
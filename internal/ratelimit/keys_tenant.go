@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"gohst/internal/auth"
+	"gohst/internal/session"
+)
+
+// ──────────────────────────────────────────────
+// Tenant keys (multi-tenant apps)
+// ──────────────────────────────────────────────
+
+const (
+	KeyTypeTenant     = "tenant"
+	KeyTypeTenantUser = "tenantuser"
+)
+
+// TenantResolver returns the tenant a request belongs to. It returns
+// ok=false when the request carries no tenant. Resolvers that read client
+// input (subdomains, headers) should be wrapped to reject unknown tenants,
+// or a client can mint fresh buckets by inventing tenant IDs.
+type TenantResolver func(r *http.Request) (tenantID string, ok bool)
+
+// TenantFromSubdomain resolves the tenant from the label directly below
+// baseDomain, e.g. "acme" for acme.example.com with baseDomain
+// "example.com". "www" and the bare base domain have no tenant.
+func TenantFromSubdomain(baseDomain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(r *http.Request) (string, bool) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		prefix, ok := strings.CutSuffix(host, suffix)
+		if !ok || prefix == "" {
+			return "", false
+		}
+		if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+			prefix = prefix[i+1:]
+		}
+		if prefix == "" || prefix == "www" {
+			return "", false
+		}
+		return prefix, true
+	}
+}
+
+// TenantFromHeader resolves the tenant from a request header, e.g.
+// "X-Tenant-ID" set by an API gateway. The header is honoured only from
+// trusted proxies, since clients could otherwise set it themselves.
+func TenantFromHeader(name string) TenantResolver {
+	return func(r *http.Request) (string, bool) {
+		if Boundary(r) != BoundaryProxy {
+			return "", false
+		}
+		v := strings.TrimSpace(r.Header.Get(name))
+		return v, v != ""
+	}
+}
+
+// TenantFromSession resolves the tenant from a session value, e.g.
+// "tenant_id" stored at login.
+func TenantFromSession(key string) TenantResolver {
+	return func(r *http.Request) (string, bool) {
+		sess := session.FromContext(r.Context())
+		if sess == nil {
+			return "", false
+		}
+		v, ok := sess.Get(key)
+		if !ok || v == nil {
+			return "", false
+		}
+		id := fmt.Sprint(v)
+		return id, id != ""
+	}
+}
+
+// FirstTenant tries each resolver in order and returns the first tenant
+// found.
+func FirstTenant(resolvers ...TenantResolver) TenantResolver {
+	return func(r *http.Request) (string, bool) {
+		for _, resolve := range resolvers {
+			if id, ok := resolve(r); ok {
+				return id, true
+			}
+		}
+		return "", false
+	}
+}
+
+// KeyByTenant keys every request of a tenant into one "tenant:<id>"
+// bucket, so one noisy customer cannot exhaust capacity shared with the
+// others. Requests without a tenant use fallback, or KeyByIP when fallback
+// is nil.
+func KeyByTenant(resolve TenantResolver, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if id, ok := resolve(r); ok {
+			return "tenant:" + id, KeyTypeTenant
+		}
+		return fallback(r)
+	}
+}
+
+// KeyByTenantAndUser keys by tenant + authenticated user
+// ("tenant:<id>:user:<uid>"), falling back to tenant + IP for anonymous
+// requests, so fairness holds between users inside one tenant as well.
+// Requests without a tenant are keyed like KeyByUserElseIP.
+func KeyByTenantAndUser(resolve TenantResolver, opts ...KeyOption) KeyFunc {
+	clientIP := keyIP(opts)
+	noTenant := KeyByUserElseIP(opts...)
+	return func(r *http.Request) (string, string) {
+		id, ok := resolve(r)
+		if !ok {
+			return noTenant(r)
+		}
+		sess := session.FromContext(r.Context())
+		if sess != nil && auth.IsAuthenticated(sess) {
+			if uid, ok := sess.Get("user_id"); ok && uid != nil {
+				return fmt.Sprintf("tenant:%s:user:%v", id, uid), KeyTypeTenantUser
+			}
+		}
+		return "tenant:" + id + ":ip:" + clientIP(r), KeyTypeTenantUser
+	}
+}
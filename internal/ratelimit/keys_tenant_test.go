@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gohst/internal/config"
+)
+
+func TestTenantFromSubdomain(t *testing.T) {
+	resolve := TenantFromSubdomain("example.com")
+	cases := map[string]string{
+		"acme.example.com":          "acme",
+		"ACME.example.com:8443":     "acme",
+		"eu.acme.example.com":       "acme",
+		"www.example.com":           "",
+		"example.com":               "",
+		"acme.example.com.evil.net": "",
+	}
+	for host, expected := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		id, ok := resolve(r)
+		if id != expected || ok != (expected != "") {
+			t.Errorf("%s: got %q/%v, want %q", host, id, ok, expected)
+		}
+	}
+}
+
+func TestKeyByTenant(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+
+	fn := KeyByTenant(FirstTenant(TenantFromHeader("X-Tenant-ID"), TenantFromSubdomain("example.com")), nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "acme.example.com"
+	r.RemoteAddr = "1.2.3.4:1234"
+	if key, keyType := fn(r); key != "tenant:acme" || keyType != KeyTypeTenant {
+		t.Fatalf("subdomain: got %s (%s)", key, keyType)
+	}
+
+	// The header wins when a trusted proxy sets it, and is ignored otherwise.
+	r.Header.Set("X-Tenant-ID", "globex")
+	if key, _ := fn(r); key != "tenant:acme" {
+		t.Fatalf("untrusted header: got %s", key)
+	}
+	r.RemoteAddr = "10.0.0.1:1234"
+	if key, _ := fn(r); key != "tenant:globex" {
+		t.Fatalf("trusted header: got %s", key)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "example.com"
+	r.RemoteAddr = "1.2.3.4:1234"
+	if key, keyType := fn(r); key != "ip:1.2.3.4" || keyType != KeyTypeIP {
+		t.Fatalf("no tenant: got %s (%s)", key, keyType)
+	}
+}
+
+func TestKeyByTenantAndUser_Anonymous(t *testing.T) {
+	initTestConfig()
+	fn := KeyByTenantAndUser(TenantFromSubdomain("example.com"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "acme.example.com"
+	r.RemoteAddr = "1.2.3.4:1234"
+	if key, keyType := fn(r); key != "tenant:acme:ip:1.2.3.4" || keyType != KeyTypeTenantUser {
+		t.Fatalf("got %s (%s)", key, keyType)
+	}
+
+	b := NewKeyBuilder().IP().Tenant(TenantFromSubdomain("example.com")).Build()
+	if key, keyType := b(r); key != "tenant+ip:acme:1.2.3.4" || keyType != "tenant+ip" {
+		t.Fatalf("builder: got %s (%s)", key, keyType)
+	}
+}
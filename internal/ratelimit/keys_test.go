@@ -1,9 +1,17 @@
 package ratelimit
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"gohst/internal/config"
 )
 
 func TestKeyByIP(t *testing.T) {
@@ -20,6 +28,26 @@ func TestKeyByIP(t *testing.T) {
 	}
 }
 
+func TestKeyByIP_Coarsened(t *testing.T) {
+	fn := KeyByIP(WithIPv6Prefix(48), WithIPv4Prefix(24))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	r.RemoteAddr = "[2001:db8:85a3:1234::1]:9999"
+	if key, keyType := fn(r); key != "ip:2001:db8:85a3::/48" || keyType != KeyTypeIP {
+		t.Fatalf("unexpected IPv6 key %q/%q", key, keyType)
+	}
+	r.RemoteAddr = "100.64.12.34:9999"
+	if key, _ := fn(r); key != "ip:100.64.12.0/24" {
+		t.Fatalf("unexpected IPv4 key %q", key)
+	}
+
+	// Composites take the same options.
+	r.RemoteAddr = "[2001:db8:85a3:1234::1]:9999"
+	if key, _ := KeyByIPAndRoute(WithIPv6Prefix(64))(r); key != "iproute:2001:db8:85a3:1234::/64:/" {
+		t.Fatalf("unexpected composite key %q", key)
+	}
+}
+
 func TestKeyByIPAndRoute(t *testing.T) {
 	fn := KeyByIPAndRoute()
 	r := httptest.NewRequest(http.MethodGet, "/api/export", nil)
@@ -77,6 +105,25 @@ func TestHashValue_Deterministic(t *testing.T) {
 	}
 }
 
+func TestHashValue_HMAC(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	legacy := hashValue("test@example.com")
+
+	config.RateLimit.HashSecret = "s3cret"
+	config.RateLimit.HashMode = "hmac"
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("test@example.com"))
+	if got := hashValue("test@example.com"); got != hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("expected full HMAC digest, got %s", got)
+	}
+
+	config.RateLimit.HashMode = "legacy"
+	if got := hashValue("test@example.com"); got != legacy {
+		t.Fatalf("legacy mode should keep the old hash, got %s", got)
+	}
+}
+
 func TestHashValue_DifferentInputs(t *testing.T) {
 	a := hashValue("alice@example.com")
 	b := hashValue("bob@example.com")
@@ -84,3 +131,262 @@ func TestHashValue_DifferentInputs(t *testing.T) {
 		t.Fatal("different inputs should produce different hashes")
 	}
 }
+
+func TestKeyByAPIKey(t *testing.T) {
+	keys := map[string]string{"live_abc": "cust_42"}
+	fn := KeyByAPIKey("X-API-Key", "api_key", func(_ context.Context, k string) (string, bool) {
+		id, ok := keys[k]
+		return id, ok
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   string
+	}{
+		{"header", "/", "live_abc", "apikey:cust_42"},
+		{"query param", "/?api_key=live_abc", "", "apikey:cust_42"},
+		{"unknown key falls back to IP", "/", "garbage", "ip:1.2.3.4"},
+		{"no key falls back to IP", "/", "", "ip:1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.RemoteAddr = "1.2.3.4:9999"
+			if tt.header != "" {
+				r.Header.Set("X-API-Key", tt.header)
+			}
+			if key, _ := fn(r); key != tt.want {
+				t.Fatalf("expected key %q, got %q", tt.want, key)
+			}
+		})
+	}
+}
+
+// signHS256 builds a compact HS256 JWT for tests.
+func signHS256(secret []byte, payload string) string {
+	enc := base64.RawURLEncoding
+	input := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestKeyByJWTClaim(t *testing.T) {
+	secret := []byte("s3cret")
+	fn := KeyByJWTClaim("sub", HS256Verifier(secret))
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"valid", signHS256(secret, `{"sub":"user_7","exp":4102444800}`), "jwt:sub:" + hashValue("user_7")},
+		{"numeric claim", signHS256(secret, `{"sub":12345678901234}`), "jwt:sub:" + hashValue("12345678901234")},
+		{"array claim", signHS256(secret, `{"sub":["a","b"]}`), "ip:1.2.3.4"},
+		{"object claim", signHS256(secret, `{"sub":{"id":"a"}}`), "ip:1.2.3.4"},
+		{"boolean claim", signHS256(secret, `{"sub":true}`), "ip:1.2.3.4"},
+		{"empty claim", signHS256(secret, `{"sub":""}`), "ip:1.2.3.4"},
+		{"oversized claim", signHS256(secret, `{"sub":"`+strings.Repeat("x", jwtClaimMaxLen+1)+`"}`), "ip:1.2.3.4"},
+		{"bad signature", signHS256([]byte("other"), `{"sub":"user_7"}`), "ip:1.2.3.4"},
+		{"expired", signHS256(secret, `{"sub":"user_7","exp":1}`), "ip:1.2.3.4"},
+		{"missing claim", signHS256(secret, `{"tenant_id":"t1"}`), "ip:1.2.3.4"},
+		{"not a JWT", "opaque-token", "ip:1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "1.2.3.4:9999"
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			if key, _ := fn(r); key != tt.want {
+				t.Fatalf("expected key %q, got %q", tt.want, key)
+			}
+		})
+	}
+
+	// Without a verifier the claim is trusted as-is.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signHS256([]byte("any"), `{"tenant_id":"t1"}`))
+	if key, keyType := KeyByJWTClaim("tenant_id", nil)(r); key != "jwt:tenant_id:"+hashValue("t1") || keyType != KeyTypeJWT {
+		t.Fatalf("unverified key = %q (%s)", key, keyType)
+	}
+}
+
+func TestKeyBySession_FallsBackToIP(t *testing.T) {
+	fn := KeyBySession()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+
+	key, keyType := fn(r)
+	if keyType != KeyTypeIP || key != "ip:1.2.3.4" {
+		t.Fatalf("expected ip:1.2.3.4 (%s), got %s (%s)", KeyTypeIP, key, keyType)
+	}
+}
+
+func TestKeyByHeader(t *testing.T) {
+	fn := KeyByHeader("X-Device-ID", nil)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+
+	if key, keyType := fn(r); key != "ip:1.2.3.4" || keyType != KeyTypeIP {
+		t.Fatalf("without header: got %s (%s)", key, keyType)
+	}
+
+	r.Header.Set("X-Device-ID", "device-42")
+	key, keyType := fn(r)
+	if keyType != KeyTypeHeader || key != "header:x-device-id:"+hashValue("device-42") {
+		t.Fatalf("with header: got %s (%s)", key, keyType)
+	}
+
+	// A custom fallback is used when the header is missing.
+	fn = KeyByHeader("X-Device-ID", KeyByIPAndRoute())
+	r = httptest.NewRequest(http.MethodGet, "/export", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+	if _, keyType := fn(r); keyType != KeyTypeIPRoute {
+		t.Fatalf("fallback key type = %s", keyType)
+	}
+}
+
+func TestKeyByRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(http.ResponseWriter, *http.Request) {})
+	fn := KeyByRoutePattern(mux)
+
+	key := func(path string) string {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		k, keyType := fn(r)
+		if keyType != KeyTypeIPRoute {
+			t.Fatalf("expected keyType %q, got %q", KeyTypeIPRoute, keyType)
+		}
+		return k
+	}
+
+	if k := key("/users/1"); k != "iproute:10.0.0.1:GET /users/{id}" {
+		t.Fatalf("unexpected key %q", k)
+	}
+	if key("/users/1") != key("/users/2") {
+		t.Fatal("dynamic segments should share a bucket")
+	}
+	if k := key("/nope/123"); k != "iproute:10.0.0.1:-" {
+		t.Fatalf("unmatched path: got %q", k)
+	}
+
+	// Inside the mux, r.Pattern is used without a second lookup.
+	var inside string
+	inner := http.NewServeMux()
+	inner.HandleFunc("POST /orders/{id}/pay", func(_ http.ResponseWriter, r *http.Request) {
+		inside, _ = KeyByRoutePattern(nil)(r)
+	})
+	r := httptest.NewRequest(http.MethodPost, "/orders/42/pay", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	inner.ServeHTTP(httptest.NewRecorder(), r)
+	if inside != "iproute:10.0.0.1:POST /orders/{id}/pay" {
+		t.Fatalf("unexpected key inside mux %q", inside)
+	}
+}
+
+func TestKeyByCookie(t *testing.T) {
+	fn := KeyByCookie("visitor_id", nil)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "1.2.3.4:9999"
+
+	if key, keyType := fn(r); key != "ip:1.2.3.4" || keyType != KeyTypeIP {
+		t.Fatalf("without cookie: got %s (%s)", key, keyType)
+	}
+
+	r.AddCookie(&http.Cookie{Name: "visitor_id", Value: "v-123"})
+	key, keyType := fn(r)
+	if keyType != KeyTypeCookie || key != "cookie:visitor_id:"+hashValue("v-123") {
+		t.Fatalf("with cookie: got %s (%s)", key, keyType)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := map[string]string{
+		" Foo+spam@Gmail.com ":    "foo@gmail.com",
+		"f.o.o@gmail.com":         "foo@gmail.com",
+		"F.O.O+x@googlemail.com":  "foo@gmail.com",
+		"first.last+news@corp.io": "first.last@corp.io",
+		"+only@corp.io":           "+only@corp.io",
+		"username":                "username",
+	}
+	for in, expected := range cases {
+		if got := NormalizeEmail(in); got != expected {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", in, got, expected)
+		}
+	}
+}
+
+func TestKeyByIPAndIdentifier_Normalizer(t *testing.T) {
+	key := func(fn KeyFunc, email string) string {
+		r := httptest.NewRequest(http.MethodGet, "/login?email="+email, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		k, _ := fn(r)
+		return k
+	}
+
+	plain := KeyByIPAndIdentifier("email")
+	if key(plain, "foo%2Bspam@gmail.com") == key(plain, "foo@gmail.com") {
+		t.Fatal("without a normalizer, aliases should get separate keys")
+	}
+
+	folded := KeyByIPAndIdentifier("email", WithIdentifierNormalizer(NormalizeEmail))
+	want := key(folded, "foo@gmail.com")
+	for _, alias := range []string{"foo%2Bspam@gmail.com", "f.o.o@gmail.com", "FOO@googlemail.com"} {
+		if got := key(folded, alias); got != want {
+			t.Errorf("alias %q: got %q, want %q", alias, got, want)
+		}
+	}
+}
+
+func TestKeyTypeClasses(t *testing.T) {
+	tests := []struct {
+		keyType                     string
+		account, network, anonymous bool
+	}{
+		{KeyTypeToken, true, false, false},
+		{KeyTypeUser, true, false, false},
+		{KeyTypeSession, true, false, false},
+		{KeyTypeIPIdent, true, false, false},
+		{KeyTypeAPIKey, true, false, false},
+		{KeyTypeJWT, true, false, false},
+		{KeyTypeTenantUser, true, false, false},
+		{KeyTypeService, true, false, false},
+		{KeyTypeGateway, true, false, false},
+		{KeyTypeIP, false, true, true},
+		{KeyTypeIPUA, false, true, true},
+		{KeyTypeIPRoute, false, true, true},
+		{KeyTypeGeo, false, true, true},
+		{KeyTypeASN, false, true, true},
+		{KeyTypeGraphQL, false, true, true},
+		{KeyTypeTLS, false, false, true},
+		{KeyTypeHeader, false, false, true},
+		{KeyTypeCookie, false, false, true},
+		{KeyTypeOrigin, false, false, true},
+		{KeyTypeTenant, false, false, false},
+		{"custom", false, false, false},
+	}
+	for _, tt := range tests {
+		if got := accountKeyType(tt.keyType); got != tt.account {
+			t.Errorf("accountKeyType(%q) = %v, want %v", tt.keyType, got, tt.account)
+		}
+		if got := networkKeyType(tt.keyType); got != tt.network {
+			t.Errorf("networkKeyType(%q) = %v, want %v", tt.keyType, got, tt.network)
+		}
+		if got := anonymousKeyType(tt.keyType); got != tt.anonymous {
+			t.Errorf("anonymousKeyType(%q) = %v, want %v", tt.keyType, got, tt.anonymous)
+		}
+		if tt.account && tt.anonymous {
+			t.Errorf("%q is both an account and anonymous", tt.keyType)
+		}
+		msg := DenyMessage("api", tt.keyType)
+		switch {
+		case tt.account && msg != "Too many requests for this account.",
+			tt.network && msg != "Too many requests from your network.",
+			!tt.account && !tt.network && msg != "Rate limit exceeded.":
+			t.Errorf("DenyMessage for %q disagrees with its class: %q", tt.keyType, msg)
+		}
+	}
+}
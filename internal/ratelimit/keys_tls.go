@@ -0,0 +1,249 @@
+package ratelimit
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ──────────────────────────────────────────────
+// TLS fingerprint keys (JA3 / JA4)
+// ──────────────────────────────────────────────
+
+// KeyTypeTLS is the key type of TLS-fingerprint keys.
+const KeyTypeTLS = "tls"
+
+// TLSFingerprinter records the fingerprint of each connection's ClientHello
+// when this server terminates TLS, so KeyByTLSFingerprint can read it back
+// per request. Install it on the http.Server before serving.
+type TLSFingerprinter struct {
+	fingerprint func(*tls.ClientHelloInfo) string
+
+	mu    sync.Mutex
+	conns map[string]string // remote addr → fingerprint
+}
+
+// NewTLSFingerprinter creates a fingerprinter using fn, or JA4 when fn is
+// nil. JA4 sorts ciphers and extensions, so it stays stable for browsers
+// that randomise extension order; JA3 does not.
+func NewTLSFingerprinter(fn func(*tls.ClientHelloInfo) string) *TLSFingerprinter {
+	if fn == nil {
+		fn = JA4
+	}
+	return &TLSFingerprinter{fingerprint: fn, conns: make(map[string]string)}
+}
+
+// Install wraps srv.TLSConfig to record fingerprints and chains
+// srv.ConnState to forget them when connections close. Call it after
+// ConfigureServer, before ListenAndServeTLS.
+func (f *TLSFingerprinter) Install(srv *http.Server) {
+	srv.TLSConfig = f.Wrap(srv.TLSConfig)
+	next := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed || state == http.StateHijacked {
+			f.forget(c.RemoteAddr().String())
+		}
+		if next != nil {
+			next(c, state)
+		}
+	}
+}
+
+// Wrap returns a clone of cfg whose GetConfigForClient records the hello's
+// fingerprint. An existing GetConfigForClient is preserved.
+func (f *TLSFingerprinter) Wrap(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	wrapped := cfg.Clone()
+	next := cfg.GetConfigForClient
+	wrapped.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if hello.Conn != nil {
+			fp := f.fingerprint(hello)
+			f.mu.Lock()
+			f.conns[hello.Conn.RemoteAddr().String()] = fp
+			f.mu.Unlock()
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	return wrapped
+}
+
+// Fingerprint returns the recorded fingerprint of r's connection.
+func (f *TLSFingerprinter) Fingerprint(r *http.Request) (string, bool) {
+	if r.TLS == nil {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fp, ok := f.conns[r.RemoteAddr]
+	return fp, ok && fp != ""
+}
+
+func (f *TLSFingerprinter) forget(addr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, addr)
+}
+
+// KeyByTLSFingerprint keys by the client's TLS fingerprint. A fingerprint
+// identifies the client software, not a user: every visitor on the same
+// browser build shares one, while a bot framework keeps its own however
+// many IPs and user agents it rotates. Use it as an extra, generous
+// limiter next to a per-IP one.
+//
+// The fingerprint is taken from header (e.g. "X-JA4") when the request
+// comes from a trusted proxy, otherwise from fp when this server
+// terminates TLS; either may be empty/nil. Requests with neither use
+// fallback, or KeyByIP when fallback is nil.
+func KeyByTLSFingerprint(fp *TLSFingerprinter, header string, fallback KeyFunc) KeyFunc {
+	if fallback == nil {
+		fallback = KeyByIP()
+	}
+	return func(r *http.Request) (string, string) {
+		if header != "" && Boundary(r) == BoundaryProxy {
+			if v := strings.TrimSpace(r.Header.Get(header)); v != "" {
+				return "tls:" + hashValue(v), KeyTypeTLS
+			}
+		}
+		if fp != nil {
+			if v, ok := fp.Fingerprint(r); ok {
+				return "tls:" + hashValue(v), KeyTypeTLS
+			}
+		}
+		return fallback(r)
+	}
+}
+
+// ──────────────────────────────────────────────
+// Fingerprint algorithms
+// ──────────────────────────────────────────────
+
+// JA3 returns the JA3 hash of hello. crypto/tls does not expose the
+// legacy record version, so it is derived from the supported versions
+// (771 for TLS 1.2 and 1.3 clients, as on the wire).
+func JA3(hello *tls.ClientHelloInfo) string {
+	version := uint16(0)
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	version = min(version, tls.VersionTLS12)
+
+	curves := make([]uint16, 0, len(hello.SupportedCurves))
+	for _, c := range hello.SupportedCurves {
+		curves = append(curves, uint16(c))
+	}
+	points := make([]uint16, 0, len(hello.SupportedPoints))
+	for _, p := range hello.SupportedPoints {
+		points = append(points, uint16(p))
+	}
+
+	s := strings.Join([]string{
+		strconv.Itoa(int(version)),
+		joinDecimal(hello.CipherSuites),
+		joinDecimal(hello.Extensions),
+		joinDecimal(curves),
+		joinDecimal(points),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint of hello, e.g. "t13d1516h2_8daaf6152771_e5627efa2ab1".
+func JA4(hello *tls.ClientHelloInfo) string {
+	version := uint16(0)
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	versions := map[uint16]string{tls.VersionTLS13: "13", tls.VersionTLS12: "12", tls.VersionTLS11: "11", tls.VersionTLS10: "10"}
+	ver, ok := versions[version]
+	if !ok {
+		ver = "00"
+	}
+	sni := "i"
+	if hello.ServerName != "" {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(hello.SupportedProtos) > 0 && hello.SupportedProtos[0] != "" {
+		p := hello.SupportedProtos[0]
+		alpn = string(p[0]) + string(p[len(p)-1])
+	}
+
+	ciphers := withoutGREASE(hello.CipherSuites)
+	exts := withoutGREASE(hello.Extensions)
+	var hashed []uint16 // extensions without SNI and ALPN
+	for _, e := range exts {
+		if e != 0x0000 && e != 0x0010 {
+			hashed = append(hashed, e)
+		}
+	}
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
+	sort.Slice(hashed, func(i, j int) bool { return hashed[i] < hashed[j] })
+
+	sigs := make([]uint16, 0, len(hello.SignatureSchemes))
+	for _, s := range hello.SignatureSchemes {
+		sigs = append(sigs, uint16(s))
+	}
+	extPart := joinHex(hashed)
+	if len(sigs) > 0 {
+		extPart += "_" + joinHex(sigs)
+	}
+
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s",
+		ver, sni, min(len(ciphers), 99), min(len(exts), 99), alpn,
+		truncatedSHA256(joinHex(ciphers), len(ciphers) == 0),
+		truncatedSHA256(extPart, len(hashed) == 0))
+}
+
+// isGREASE reports whether v is a GREASE value (RFC 8701).
+func isGREASE(v uint16) bool { return v&0x0f0f == 0x0a0a && v>>8 == v&0xff }
+
+func withoutGREASE(vs []uint16) []uint16 {
+	out := make([]uint16, 0, len(vs))
+	for _, v := range vs {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinDecimal(vs []uint16) string {
+	parts := make([]string, 0, len(vs))
+	for _, v := range withoutGREASE(vs) {
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(vs []uint16) string {
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func truncatedSHA256(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
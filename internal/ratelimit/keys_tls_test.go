@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"gohst/internal/config"
+)
+
+func testHello() *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		CipherSuites:      []uint16{0x0a0a, tls.TLS_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		ServerName:        "example.com",
+		SupportedCurves:   []tls.CurveID{tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256},
+		SupportedProtos:   []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x1a1a, tls.VersionTLS13, tls.VersionTLS12},
+		Extensions:        []uint16{0x2a2a, 0x0000, 0x0010, 0x000a, 0x000d, 0x002b},
+	}
+}
+
+func TestJA4(t *testing.T) {
+	hello := testHello()
+	fp := JA4(hello)
+	if !regexp.MustCompile(`^t13d0205h2_[0-9a-f]{12}_[0-9a-f]{12}$`).MatchString(fp) {
+		t.Fatalf("unexpected JA4 %q", fp)
+	}
+
+	// Extension order does not change JA4, but does change JA3.
+	shuffled := testHello()
+	shuffled.Extensions = []uint16{0x002b, 0x000d, 0x0010, 0x000a, 0x0000, 0x2a2a}
+	if JA4(shuffled) != fp {
+		t.Fatal("JA4 should ignore extension order")
+	}
+	if JA3(shuffled) == JA3(hello) {
+		t.Fatal("JA3 should depend on extension order")
+	}
+	if len(JA3(hello)) != 32 {
+		t.Fatalf("JA3 should be an MD5 hex digest, got %q", JA3(hello))
+	}
+}
+
+func TestKeyByTLSFingerprint(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+
+	fp := NewTLSFingerprinter(nil)
+	remote := &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5555}
+	hello := testHello()
+	hello.Conn = addrConn{remote: remote}
+	if _, err := fp.Wrap(nil).GetConfigForClient(hello); err != nil {
+		t.Fatal(err)
+	}
+	fn := KeyByTLSFingerprint(fp, "X-JA4", nil)
+
+	// Terminated locally: the recorded hello is used.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote.String()
+	r.TLS = &tls.ConnectionState{}
+	if key, keyType := fn(r); key != "tls:"+hashValue(JA4(hello)) || keyType != KeyTypeTLS {
+		t.Fatalf("local TLS: got %s (%s)", key, keyType)
+	}
+
+	// Header from a trusted proxy.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-JA4", "t13d1516h2_8daaf6152771_e5627efa2ab1")
+	if _, keyType := fn(r); keyType != KeyTypeTLS {
+		t.Fatalf("trusted proxy header: got key type %s", keyType)
+	}
+
+	// The same header from an untrusted peer is ignored.
+	r.RemoteAddr = "9.9.9.9:1234"
+	if key, keyType := fn(r); key != "ip:9.9.9.9" || keyType != KeyTypeIP {
+		t.Fatalf("untrusted header: got %s (%s)", key, keyType)
+	}
+
+	fp.forget(remote.String())
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remote.String()
+	r.TLS = &tls.ConnectionState{}
+	if _, keyType := fn(r); keyType != KeyTypeIP {
+		t.Fatal("closed connection should no longer have a fingerprint")
+	}
+}
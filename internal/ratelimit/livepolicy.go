@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ──────────────────────────────────────────────
+// Runtime policy updates
+// ──────────────────────────────────────────────
+
+// livePolicies holds the policies set at runtime with SetPolicy, by scope.
+// It is shared by the copies a limiter makes of itself for PolicySet rules
+// and resolved policies.
+type livePolicies struct {
+	mu sync.Mutex // serializes writers
+	m  atomic.Pointer[map[string]Policy]
+}
+
+// get returns the runtime replacement for p, or p itself.
+func (lp *livePolicies) get(p Policy) Policy {
+	if lp == nil {
+		return p
+	}
+	if m := lp.m.Load(); m != nil {
+		if live, ok := (*m)[p.Scope]; ok {
+			return live
+		}
+	}
+	return p
+}
+
+func (lp *livePolicies) update(fn func(m map[string]Policy)) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	next := make(map[string]Policy)
+	if m := lp.m.Load(); m != nil {
+		for scope, p := range *m {
+			next[scope] = p
+		}
+	}
+	fn(next)
+	lp.m.Store(&next)
+}
+
+// scopes returns the policies the limiter was built with, by scope: its
+// own and those of its PolicySet and method rules.
+func (l *Limiter) scopes() map[string]Policy {
+	out := map[string]Policy{l.policy.Scope: l.policy}
+	if l.policySet != nil {
+		for _, rule := range l.policySet.rules {
+			out[rule.policy.Scope] = rule.policy
+		}
+	}
+	for _, rule := range l.methodRules {
+		out[rule.policy.Scope] = rule.policy
+	}
+	return out
+}
+
+// SetPolicy replaces, while the limiter serves requests, the policy with
+// the same Scope: the limiter's own, or that of one of its PolicySet or
+// method rules. The change applies from the next request and keeps
+// existing buckets. Policy providers still apply their overrides on top.
+// Invalid policies, and scopes the limiter does not have, are rejected.
+func (l *Limiter) SetPolicy(p Policy) error {
+	if _, ok := l.scopes()[p.Scope]; !ok {
+		return fmt.Errorf("limiter has no policy with scope %q", p.Scope)
+	}
+	if err := l.validatePolicy(p); err != nil {
+		return err
+	}
+	l.live.update(func(m map[string]Policy) { m[p.Scope] = p })
+	return nil
+}
+
+// ResetPolicy reverts scope to the policy the limiter was built with.
+func (l *Limiter) ResetPolicy(scope string) {
+	l.live.update(func(m map[string]Policy) { delete(m, scope) })
+}
+
+// Policy returns the limiter's current policy for scope, before policy
+// provider overrides.
+func (l *Limiter) Policy(scope string) (Policy, bool) {
+	p, ok := l.scopes()[scope]
+	if !ok {
+		return Policy{}, false
+	}
+	return l.live.get(p), true
+}
+
+// PolicyRegistry collects limiters so admin tooling can list and change
+// their policies by scope in one place.
+type PolicyRegistry struct {
+	mu       sync.RWMutex
+	limiters []*Limiter
+}
+
+// NewPolicyRegistry creates an empty registry.
+func NewPolicyRegistry() *PolicyRegistry {
+	return &PolicyRegistry{}
+}
+
+// Register adds limiters to the registry.
+func (r *PolicyRegistry) Register(limiters ...*Limiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiters = append(r.limiters, limiters...)
+}
+
+// SetPolicy calls SetPolicy on every registered limiter that has a policy
+// with p's Scope. It returns an error if none has, or if p is invalid.
+func (r *PolicyRegistry) SetPolicy(p Policy) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	found := false
+	for _, l := range r.limiters {
+		if _, ok := l.scopes()[p.Scope]; !ok {
+			continue
+		}
+		if err := l.SetPolicy(p); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no registered limiter has a policy with scope %q", p.Scope)
+	}
+	return nil
+}
+
+// ResetPolicy reverts scope on every registered limiter.
+func (r *PolicyRegistry) ResetPolicy(scope string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, l := range r.limiters {
+		l.ResetPolicy(scope)
+	}
+}
+
+// Policies returns the current policy of every scope of the registered
+// limiters. When limiters share a scope, the first registered one wins.
+func (r *PolicyRegistry) Policies() map[string]Policy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]Policy)
+	for _, l := range r.limiters {
+		for scope := range l.scopes() {
+			if _, ok := out[scope]; !ok {
+				out[scope], _ = l.Policy(scope)
+			}
+		}
+	}
+	return out
+}
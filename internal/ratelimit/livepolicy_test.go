@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter_SetPolicy(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	api := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	login := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"}
+	routes := NewPolicySet()
+	routes.Add("/login", login)
+	l := NewLimiter(store, api, KeyByIP(), WithPolicySet(routes))
+	h := l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(path string) int {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		calls := store.Calls()
+		return calls[len(calls)-1].Policy.Limit
+	}
+
+	if got := serve("/"); got != 100 {
+		t.Fatalf("expected 100, got %d", got)
+	}
+	api.Limit, login.Limit = 20, 2
+	if err := l.SetPolicy(api); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetPolicy(login); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve("/"); got != 20 {
+		t.Fatalf("after SetPolicy: expected 20, got %d", got)
+	}
+	if got := serve("/login"); got != 2 {
+		t.Fatalf("route rule after SetPolicy: expected 2, got %d", got)
+	}
+	if p, _ := l.Policy("login"); p.Limit != 2 {
+		t.Fatalf("Policy: got %+v", p)
+	}
+
+	l.ResetPolicy("api")
+	if got := serve("/"); got != 100 {
+		t.Fatalf("after ResetPolicy: expected 100, got %d", got)
+	}
+
+	if err := l.SetPolicy(Policy{Limit: 1, Window: time.Minute, Enabled: true, Scope: "other"}); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+	if err := l.SetPolicy(Policy{Limit: 1, Enabled: true, Scope: "api"}); err == nil {
+		t.Fatal("expected an error for an invalid policy")
+	}
+}
+
+func TestLimiter_SetPolicyConcurrent(t *testing.T) {
+	initTestConfig()
+	p := Policy{Limit: 1000, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	l := NewLimiter(NewMemoryStore(time.Minute), p, KeyByIP())
+	h := l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				q := p
+				q.Limit = 500 + i*100 + j
+				l.SetPolicy(q)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPolicyRegistry(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	a := NewLimiter(store, Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "search"}, KeyByIP())
+	b := NewLimiter(store, Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "search"}, KeyByIP())
+	c := NewLimiter(store, Policy{Limit: 30, Window: time.Minute, Enabled: true, Cost: 1, Scope: "upload"}, KeyByIP())
+	reg := NewPolicyRegistry()
+	reg.Register(a, b, c)
+
+	if err := reg.SetPolicy(Policy{Limit: 50, Window: time.Minute, Enabled: true, Cost: 1, Scope: "search"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []*Limiter{a, b} {
+		if p, _ := l.Policy("search"); p.Limit != 50 {
+			t.Fatalf("expected 50, got %+v", p)
+		}
+	}
+	all := reg.Policies()
+	if len(all) != 2 || all["search"].Limit != 50 || all["upload"].Limit != 30 {
+		t.Fatalf("got %+v", all)
+	}
+	if err := reg.SetPolicy(Policy{Limit: 1, Window: time.Minute, Enabled: true, Scope: "nope"}); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+	reg.ResetPolicy("search")
+	if p, _ := a.Policy("search"); p.Limit != 10 {
+		t.Fatalf("after reset: got %+v", p)
+	}
+}
@@ -0,0 +1,242 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Emergency lockdown
+// ──────────────────────────────────────────────
+
+// Lockdown tightens every limiter of the process at once, e.g. during a
+// scraping incident, without touching any policy.
+type Lockdown struct {
+	// Factor divides every rate limit and burst; values below 1 leave
+	// limits unchanged.
+	Factor float64 `json:"factor"`
+	// BlockAnonymous rejects requests keyed by client IP, i.e. without a
+	// token, user, session or other identity, with 403.
+	BlockAnonymous bool `json:"block_anonymous"`
+}
+
+type lockdownSetting struct {
+	on bool
+	Lockdown
+}
+
+// lockdownState is the lockdown set at runtime; nil follows the config.
+var lockdownState atomic.Pointer[lockdownSetting]
+
+// SetLockdown puts every limiter into lockdown from the next request.
+func SetLockdown(ld Lockdown) {
+	lockdownState.Store(&lockdownSetting{on: true, Lockdown: ld})
+	log.Printf("[ratelimit] lockdown on: limits divided by %g, anonymous traffic blocked: %t", ld.Factor, ld.BlockAnonymous)
+}
+
+// EndLockdown ends a lockdown, including one started by RATE_LIMIT_LOCKDOWN.
+func EndLockdown() {
+	lockdownState.Store(&lockdownSetting{})
+	log.Println("[ratelimit] lockdown off")
+}
+
+// CurrentLockdown returns the lockdown in force, if any: the last one set
+// with SetLockdown, or the one configured by RATE_LIMIT_LOCKDOWN.
+func CurrentLockdown() (Lockdown, bool) {
+	if s := lockdownState.Load(); s != nil {
+		return s.Lockdown, s.on
+	}
+	cfg := config.RateLimit
+	if cfg == nil || !cfg.Lockdown {
+		return Lockdown{}, false
+	}
+	return Lockdown{Factor: float64(cfg.LockdownFactor), BlockAnonymous: cfg.LockdownBlockAnonymous}, true
+}
+
+// apply returns p with its limit and burst divided by the factor.
+func (ld Lockdown) apply(p Policy) Policy {
+	if ld.Factor <= 1 {
+		return p
+	}
+	return scalePolicy(p, 1/ld.Factor)
+}
+
+// lockdownResponse rejects an anonymous request during a lockdown.
+func (l *Limiter) lockdownResponse(w http.ResponseWriter, r *http.Request, key, keyType string) {
+	l.logDenied(r, Result{}, key, keyType, "lockdown")
+	writeErrorResponse(w, r, l.policy, http.StatusForbidden,
+		"Request blocked.",
+		"Anonymous requests are temporarily not accepted. Sign in and try again.",
+		0)
+}
+
+// lockdownCostResponse rejects a request its bucket could pay normally but
+// not at the capacity left by a lockdown. It is the lockdown, not the
+// request, that is at fault, so this is a 503 the client may retry after a
+// window rather than a 400.
+func (l *Limiter) lockdownCostResponse(w http.ResponseWriter, r *http.Request, window time.Duration, key, keyType string) {
+	l.logDenied(r, Result{}, key, keyType, "lockdown_cost")
+	retryAfter := setRetryAfter(w, max(1, int(math.Ceil(window.Seconds()))))
+	writeErrorResponse(w, r, l.policy, http.StatusServiceUnavailable,
+		"Request too expensive to serve during the current restrictions. Please try again later.",
+		fmt.Sprintf("Requests this large are temporarily not accepted. Please try again in %d seconds.", retryAfter),
+		retryAfter)
+}
+
+// ──────────────────────────────────────────────
+// Shared lockdown flag
+// ──────────────────────────────────────────────
+
+// LockdownLoadFunc reads a lockdown flag shared by every instance. ok is
+// false when the flag is not set.
+type LockdownLoadFunc func(ctx context.Context) (ld Lockdown, ok bool, err error)
+
+// LockdownWatcher follows a shared lockdown flag, so one switch locks down
+// the whole fleet. The process enters lockdown when the flag is set or
+// changes, and leaves it when the flag is removed; in between, SetLockdown
+// and EndLockdown still apply locally. A failed read keeps the current
+// state.
+type LockdownWatcher struct {
+	load     LockdownLoadFunc
+	interval time.Duration
+	closer   func() error
+
+	mu   sync.Mutex
+	seen bool
+	last Lockdown
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewLockdownWatcher reads the flag once. interval defaults to five
+// seconds.
+func NewLockdownWatcher(load LockdownLoadFunc, interval time.Duration) *LockdownWatcher {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	w := &LockdownWatcher{load: load, interval: interval, stop: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+	w.Refresh(ctx)
+	cancel()
+	return w
+}
+
+// NewLockdownWatcherFromConfig follows the Redis lockdown flag when
+// RATE_LIMIT_LOCKDOWN_REDIS is set, or returns nil.
+func NewLockdownWatcherFromConfig() *LockdownWatcher {
+	cfg := config.RateLimit
+	if !cfg.LockdownRedis {
+		return nil
+	}
+	store := NewRedisStore()
+	w := NewLockdownWatcher(RedisLockdownFlag(store), time.Duration(cfg.LockdownRefresh)*time.Second)
+	w.closer = store.Close
+	return w
+}
+
+// Start checks the flag in the background until Close.
+func (w *LockdownWatcher) Start() {
+	w.done = make(chan struct{})
+	go w.loop()
+}
+
+// Close stops checking the flag.
+func (w *LockdownWatcher) Close() error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	if w.done != nil {
+		<-w.done
+	}
+	if w.closer != nil {
+		return w.closer()
+	}
+	return nil
+}
+
+func (w *LockdownWatcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+			w.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Refresh reads the flag now.
+func (w *LockdownWatcher) Refresh(ctx context.Context) error {
+	ld, ok, err := w.load(ctx)
+	if err != nil {
+		log.Printf("[ratelimit] lockdown flag read failed: %v (keeping current state)", err)
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case ok && (!w.seen || ld != w.last):
+		SetLockdown(ld)
+	case !ok && w.seen:
+		EndLockdown()
+	}
+	w.seen, w.last = ok, ld
+	return nil
+}
+
+// lockdownFlagKey is the Redis key of the lockdown flag, under the store
+// prefix.
+const lockdownFlagKey = "lockdown"
+
+// RedisLockdownFlag reads the lockdown flag of s: a JSON Lockdown such as
+// {"factor":4,"block_anonymous":true} under the "lockdown" key.
+func RedisLockdownFlag(s *RedisStore) LockdownLoadFunc {
+	return func(ctx context.Context) (Lockdown, bool, error) {
+		ctx, cancel := s.withTimeout(ctx)
+		defer cancel()
+		data, err := s.client.Get(ctx, s.prefix+lockdownFlagKey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return Lockdown{}, false, nil
+		}
+		if err != nil {
+			return Lockdown{}, false, err
+		}
+		var ld Lockdown
+		if err := json.Unmarshal(data, &ld); err != nil {
+			return Lockdown{}, false, fmt.Errorf("lockdown flag: %w", err)
+		}
+		return ld, true, nil
+	}
+}
+
+// PublishLockdown sets the lockdown flag of s, or removes it when ld is
+// nil. Watchers pick it up on their next check.
+func (s *RedisStore) PublishLockdown(ctx context.Context, ld *Lockdown) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if ld == nil {
+		return s.client.Del(ctx, s.prefix+lockdownFlagKey).Err()
+	}
+	data, err := json.Marshal(ld)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+lockdownFlagKey, data, 0).Err()
+}
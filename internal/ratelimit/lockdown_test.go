@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestMiddleware_Lockdown(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { lockdownState.Store(nil) })
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Burst: 20, Enabled: true, Cost: 1, Scope: "api"}
+	h := NewLimiter(store, p, KeyByTokenElseUserElseIP()).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(token string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	SetLockdown(Lockdown{Factor: 4, BlockAnonymous: true})
+	if code := serve("secret"); code != http.StatusOK {
+		t.Fatalf("expected an identified request to pass, got %d", code)
+	}
+	if c := store.Calls()[0]; c.Policy.Limit != 25 || c.Policy.Burst != 5 {
+		t.Errorf("expected limits divided by 4, got %d/%d", c.Policy.Limit, c.Policy.Burst)
+	}
+	if code := serve(""); code != http.StatusForbidden {
+		t.Errorf("expected an anonymous request to be blocked, got %d", code)
+	}
+
+	EndLockdown()
+	store.ClearCalls()
+	if code := serve(""); code != http.StatusOK {
+		t.Fatalf("expected anonymous requests after the lockdown, got %d", code)
+	}
+	if c := store.Calls()[0]; c.Policy.Limit != 100 {
+		t.Errorf("expected the normal limit after the lockdown, got %d", c.Policy.Limit)
+	}
+}
+
+func TestMiddleware_LockdownCostCapacity(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { lockdownState.Store(nil) })
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Burst: 20, Enabled: true, Cost: 1, Scope: "api"}
+	l := NewLimiter(store, p, KeyByIP(), WithCostFunc(func(*http.Request) int { return 50 }))
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	if rr := serve(l.Middleware(next)); rr.Code != http.StatusOK {
+		t.Fatalf("expected a cost within capacity to pass, got %d", rr.Code)
+	}
+	SetLockdown(Lockdown{Factor: 4})
+	store.ClearCalls()
+	for name, h := range map[string]http.Handler{"middleware": l.Middleware(next), "composed": Compose(l)(next)} {
+		rr := serve(h)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected 503 for a cost over the lockdown capacity of 30, got %d", name, rr.Code)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("%s: expected Retry-After of one window, got %q", name, got)
+		}
+	}
+	// A cost the bucket could never hold stays a 400, lockdown or not.
+	big := NewLimiter(store, p, KeyByIP(), WithCostFunc(func(*http.Request) int { return 200 }))
+	for name, h := range map[string]http.Handler{"middleware": big.Middleware(next), "composed": Compose(big)(next)} {
+		if rr := serve(h); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 for a cost over the full capacity of 120, got %d", name, rr.Code)
+		}
+	}
+	if n := store.CallCount("allow"); n != 0 {
+		t.Errorf("expected the store not to be charged, got %d calls", n)
+	}
+}
+
+func TestMiddleware_LockdownKeepsLoginOpen(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { lockdownState.Store(nil) })
+	SetLockdown(Lockdown{Factor: 4, BlockAnonymous: true})
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "auth_sensitive"}
+	h := NewLimiter(NewMockStore(), p, KeyByIPAndIdentifier("email")).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("email=a%40example.com"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected login attempts to pass a lockdown blocking anonymous requests, got %d", rr.Code)
+	}
+}
+
+func TestCurrentLockdown_Config(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { lockdownState.Store(nil) })
+	config.RateLimit.Lockdown = true
+	config.RateLimit.LockdownFactor = 2
+
+	if ld, on := CurrentLockdown(); !on || ld.Factor != 2 || ld.BlockAnonymous {
+		t.Fatalf("expected the configured lockdown, got %+v %v", ld, on)
+	}
+	EndLockdown()
+	if _, on := CurrentLockdown(); on {
+		t.Error("expected EndLockdown to end a configured lockdown")
+	}
+}
+
+func TestLockdownWatcher(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(func() { lockdownState.Store(nil) })
+	var (
+		flag *Lockdown
+		fail error
+	)
+	w := NewLockdownWatcher(func(context.Context) (Lockdown, bool, error) {
+		if fail != nil {
+			return Lockdown{}, false, fail
+		}
+		if flag == nil {
+			return Lockdown{}, false, nil
+		}
+		return *flag, true, nil
+	}, time.Hour)
+	ctx := context.Background()
+	if _, on := CurrentLockdown(); on {
+		t.Fatal("expected no lockdown without a flag")
+	}
+
+	flag = &Lockdown{Factor: 10}
+	w.Refresh(ctx)
+	if ld, on := CurrentLockdown(); !on || ld.Factor != 10 {
+		t.Fatalf("expected the flag's lockdown, got %+v %v", ld, on)
+	}
+
+	// A local EndLockdown holds until the flag changes.
+	EndLockdown()
+	w.Refresh(ctx)
+	if _, on := CurrentLockdown(); on {
+		t.Error("expected an unchanged flag to keep the local state")
+	}
+	flag = &Lockdown{Factor: 10, BlockAnonymous: true}
+	w.Refresh(ctx)
+	if ld, on := CurrentLockdown(); !on || !ld.BlockAnonymous {
+		t.Errorf("expected the changed flag to apply, got %+v %v", ld, on)
+	}
+
+	fail = errors.New("redis down")
+	if err := w.Refresh(ctx); err == nil {
+		t.Error("expected the read error")
+	}
+	if _, on := CurrentLockdown(); !on {
+		t.Error("expected a failed read to keep the lockdown")
+	}
+
+	fail, flag = nil, nil
+	w.Refresh(ctx)
+	if _, on := CurrentLockdown(); on {
+		t.Error("expected removing the flag to end the lockdown")
+	}
+}
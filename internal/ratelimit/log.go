@@ -2,8 +2,10 @@ package ratelimit
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"time"
 
 	"gohst/internal/db"
@@ -22,6 +24,8 @@ type LogEntry struct {
 	Scope      string
 	RetryAfter int
 	ClientIP   string
+	Shadow     bool        // a shadowed limiter would have rejected the request
+	Headers    http.Header // shadow denials only: the headers the denial would have sent
 }
 
 // LogStore persists denied-request log entries.
@@ -55,9 +59,16 @@ func (s *DBLogStore) Log(entry LogEntry) error {
 	}
 
 	query := `
-		INSERT INTO rate_limit_logs (method, path, key_type, key_hash, scope, retry_after, client_ip, denied_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		INSERT INTO rate_limit_logs (method, path, key_type, key_hash, scope, retry_after, client_ip, shadow, headers, denied_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
+	var headers []byte
+	if entry.Headers != nil {
+		var err error
+		if headers, err = json.Marshal(entry.Headers); err != nil {
+			return err
+		}
+	}
 	_, err := s.db.Exec(query,
 		entry.Method,
 		entry.Path,
@@ -66,6 +77,8 @@ func (s *DBLogStore) Log(entry LogEntry) error {
 		entry.Scope,
 		entry.RetryAfter,
 		entry.ClientIP,
+		entry.Shadow,
+		headers,
 		time.Now().UTC(),
 	)
 	return err
@@ -1,11 +1,19 @@
 package ratelimit
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gohst/internal/config"
 )
@@ -18,6 +26,10 @@ import (
 // Return true to indicate the response has been handled; false to use default 429.
 type OnLimitFunc func(w http.ResponseWriter, r *http.Request, result Result) bool
 
+// OnAllowFunc is an optional callback invoked when a request passes the
+// limiter, before the next handler runs, e.g. to record usage.
+type OnAllowFunc func(r *http.Request, result Result)
+
 // Limiter holds all the dependencies for a rate-limit middleware instance.
 type Limiter struct {
 	store            Store
@@ -25,8 +37,36 @@ type Limiter struct {
 	policy           Policy
 	keyFunc          KeyFunc
 	onLimit          OnLimitFunc
+	onAllow          OnAllowFunc
 	allowlist        []AllowRule
+	skips            []func(r *http.Request) bool
+	methods          []string
+	allowCache       *allowCache
 	logStore         LogStore
+	scopeLogStores   map[string]LogStore
+	denyTemplate     string
+	denyMessageFunc  DenyMessageFunc
+	penaltyBox       *PenaltyBox
+	strikeDenials    bool
+	greylist         *Greylist
+	spoof            *spoofConfig
+	geo              *geoConfig
+	cookie           *StateCookieConfig
+	tiers            map[string]float64
+	costFunc         CostFunc
+	uploadUnit       int64
+	reputation       *reputationConfig
+	crawler          *crawlerConfig
+	uaPolicies       map[UAClass]Policy
+	tor              *torConfig
+	policySet        *PolicySet
+	methodRules      []policyRule
+	policyProviders  []PolicyProvider
+	plans            *planConfig
+	canary           *PolicyCanary
+	live             *livePolicies
+	bucketPrefix     string
+	shadow           bool
 }
 
 // Option configures a Limiter.
@@ -37,6 +77,12 @@ func WithOnLimit(fn OnLimitFunc) Option {
 	return func(l *Limiter) { l.onLimit = fn }
 }
 
+// WithOnAllow calls fn for every request that passes the rate limit check,
+// with the Result it got. Requests that bypass the limiter are not reported.
+func WithOnAllow(fn OnAllowFunc) Option {
+	return func(l *Limiter) { l.onAllow = fn }
+}
+
 // WithConcurrency attaches a concurrency store.
 func WithConcurrency(cs ConcurrencyStore) Option {
 	return func(l *Limiter) { l.concurrencyStore = cs }
@@ -47,28 +93,187 @@ func WithAllowlist(rules ...AllowRule) Option {
 	return func(l *Limiter) { l.allowlist = rules }
 }
 
+// WithSkip bypasses the limiter for requests fn returns true for, e.g. staff
+// accounts or a feature flag, like an allowlist rule. Skips add up: a
+// request is bypassed if any of them matches.
+func WithSkip(fn func(r *http.Request) bool) Option {
+	return func(l *Limiter) { l.skips = append(l.skips, fn) }
+}
+
+// WithMethods limits only requests with one of methods, e.g. "POST", "PUT"
+// and "DELETE" for a write policy; other requests bypass the limiter. GET
+// also covers HEAD.
+func WithMethods(methods ...string) Option {
+	return func(l *Limiter) {
+		l.methods = nil
+		for _, m := range methods {
+			l.methods = append(l.methods, strings.ToUpper(strings.TrimSpace(m)))
+		}
+	}
+}
+
+// engages reports whether WithMethods lets l limit requests with method.
+func (l *Limiter) engages(method string) bool {
+	if len(l.methods) == 0 {
+		return true
+	}
+	return slices.Contains(l.methods, method) || method == http.MethodHead && slices.Contains(l.methods, http.MethodGet)
+}
+
 // WithLogStore attaches a log store for denied-request logging.
 func WithLogStore(ls LogStore) Option {
 	return func(l *Limiter) { l.logStore = ls }
 }
 
-// NewLimiter creates a new Limiter.
+// WithScopeLogStores sends the denials of each scope to its own log store
+// instead of the one set by WithLogStore, e.g. API denials to an audit
+// table. The scope is that of the policy that denied the request, so the
+// routes of a PolicySet can log apart. Nil stores are ignored.
+func WithScopeLogStores(stores map[string]LogStore) Option {
+	byScope := make(map[string]LogStore, len(stores))
+	for scope, ls := range stores {
+		if ls != nil {
+			byScope[scope] = ls
+		}
+	}
+	return func(l *Limiter) { l.scopeLogStores = byScope }
+}
+
+// WithPenaltyBox rejects keys that are currently banned in box.
+func WithPenaltyBox(box *PenaltyBox) Option {
+	return func(l *Limiter) { l.penaltyBox = box }
+}
+
+// CostFunc returns the token cost of a request, or 0 to charge the
+// policy's Cost.
+type CostFunc func(r *http.Request) int
+
+// WithCostFunc charges each request what fn returns instead of the fixed
+// policy Cost, e.g. GraphQLCost for query complexity. Oversize rejections
+// still charge OversizeCost or Cost.
+func WithCostFunc(fn CostFunc) Option {
+	return func(l *Limiter) { l.costFunc = fn }
+}
+
+// NewLimiter creates a new Limiter. It panics if policy, or any policy
+// set by an option, fails Policy.Validate, or sets a concurrency limit
+// without a ConcurrencyStore: such a limiter would silently misbehave.
 func NewLimiter(store Store, policy Policy, keyFunc KeyFunc, opts ...Option) *Limiter {
 	l := &Limiter{
 		store:   store,
 		policy:  policy,
 		keyFunc: keyFunc,
+		live:    &livePolicies{},
 	}
 	for _, o := range opts {
 		o(l)
 	}
+	if err := l.validate(); err != nil {
+		panic("ratelimit: " + err.Error())
+	}
 	return l
 }
 
+// validate checks every policy the limiter can enforce.
+func (l *Limiter) validate() error {
+	policies := []Policy{l.policy}
+	add := func(p *Policy) {
+		if p != nil {
+			policies = append(policies, *p)
+		}
+	}
+	if l.policySet != nil {
+		for _, rule := range l.policySet.rules {
+			policies = append(policies, rule.policy)
+		}
+	}
+	for _, rule := range l.methodRules {
+		policies = append(policies, rule.policy)
+	}
+	if l.geo != nil {
+		for _, p := range l.geo.policies {
+			policies = append(policies, p)
+		}
+	}
+	for _, p := range l.uaPolicies {
+		policies = append(policies, p)
+	}
+	if l.crawler != nil {
+		policies = append(policies, l.crawler.policy)
+	}
+	if l.spoof != nil {
+		add(l.spoof.strict)
+	}
+	if l.reputation != nil {
+		add(l.reputation.strict)
+	}
+	if l.tor != nil {
+		add(l.tor.policy)
+	}
+	if l.plans != nil {
+		for _, plan := range l.plans.plans {
+			add(plan.Policy)
+		}
+	}
+	errs := []error{l.validateCanary()}
+	for _, p := range policies {
+		if err := l.validatePolicy(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatePolicy checks p and that the limiter can enforce it.
+func (l *Limiter) validatePolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Enabled && p.ConcurrencyLimit > 0 && l.concurrencyStore == nil {
+		return fmt.Errorf("policy %q: concurrency limit %d needs a ConcurrencyStore (WithConcurrency)", p.Scope, p.ConcurrencyLimit)
+	}
+	return nil
+}
+
 // Middleware returns an http middleware function compatible with the existing
 // middleware.Chain helper.
 func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.policySet != nil || len(l.methodRules) > 0 {
+		return l.policySetMiddleware(next)
+	}
+	return l.handler(next)
+}
+
+// Handle returns h limited by l, to limit a single route where it is
+// registered:
+//
+//	mux.Handle("POST /login", loginLimiter.Handle(loginHandler))
+func (l *Limiter) Handle(h http.Handler) http.Handler {
+	return l.Middleware(h)
+}
+
+// HandleFunc is Handle for a handler function. The result can be passed to
+// mux.HandleFunc as well as mux.Handle.
+func (l *Limiter) HandleFunc(fn func(http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return l.Middleware(http.HandlerFunc(fn)).ServeHTTP
+}
+
+// handler enforces l.policy, or only observes it in shadow mode; bucket
+// keys get l.bucketPrefix.
+func (l *Limiter) handler(next http.Handler) http.Handler {
+	if l.shadowed() {
+		return l.shadowHandler(next)
+	}
+	return l.enforce(next)
+}
+
+// enforce enforces l.policy.
+func (l *Limiter) enforce(next http.Handler) http.Handler {
+	variants := &limiterVariants{base: l}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A policy resolved at request time runs on a copy of l holding it.
+		l := variants.get(l.resolvePolicy())
+
 		// Global kill-switch
 		if !config.RateLimit.Enabled || !l.policy.Enabled {
 			next.ServeHTTP(w, r)
@@ -76,24 +281,116 @@ func (l *Limiter) Middleware(next http.Handler) http.Handler {
 		}
 
 		// Allowlist bypass
-		for _, rule := range l.allowlist {
-			if rule.Matches(r) {
+		if l.bypassed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		boundaryRequests[boundaryIndex(Boundary(r))].Add(1)
+
+		key, keyType := l.keyFunc(r)
+		if l.canary.pick(l.policy.Scope, key) {
+			if l = variants.get(l.canary.policy); !l.policy.Enabled {
 				next.ServeHTTP(w, r)
 				return
 			}
 		}
-
-		key, keyType := l.keyFunc(r)
+		lockdown, locked := CurrentLockdown()
+		if locked && lockdown.BlockAnonymous && anonymousKeyType(keyType) {
+			l.lockdownResponse(w, r, key, keyType)
+			return
+		}
 		cost := l.policy.Cost
 		if cost < 1 {
 			cost = 1
 		}
 
+		// ── Reputation check ───────────────────────
+		listed := l.checkReputation(r)
+		if listed && l.reputation.strict == nil {
+			l.blockResponse(w, r, key, keyType)
+			return
+		}
+
+		// ── Tor challenge ──────────────────────────
+		tor := l.checkTor(r)
+		if tor && l.tor.challenge != nil && l.tor.challenge(w, r) {
+			return
+		}
+
+		// ── Penalty box check ──────────────────────
+		if l.penaltyBox != nil {
+			if retryAfter, banned := l.penaltyBox.banned(r.Context(), key); banned {
+				l.denyResponse(w, r, Result{
+					Allowed:    false,
+					Limit:      l.policy.Limit + l.policy.Burst,
+					Remaining:  0,
+					RetryAfter: retryAfter,
+					ResetAt:    time.Now().Unix() + int64(retryAfter),
+				}, key, keyType, "penalty")
+				return
+			}
+		}
+
+		// ── Escalated backoff check ────────────────
+		if l.policy.Escalation > 0 {
+			if retryAfter, blocked := escalations.blocked(l.escalationBucket(key)); blocked {
+				l.denyResponse(w, r, Result{
+					Allowed:    false,
+					Limit:      l.policy.Limit + l.policy.Burst,
+					Remaining:  0,
+					RetryAfter: retryAfter,
+					ResetAt:    time.Now().Unix() + int64(retryAfter),
+				}, key, keyType, "escalation")
+				return
+			}
+		}
+
+		// ── Greylist check ─────────────────────────
+		if l.greylist != nil {
+			if wait := l.greylist.wait(r.Context(), key); wait > 0 {
+				l.denyResponse(w, r, Result{
+					Allowed:    false,
+					Limit:      l.policy.Limit + l.policy.Burst,
+					Remaining:  0,
+					RetryAfter: wait,
+					ResetAt:    time.Now().Unix() + int64(wait),
+				}, key, keyType, "greylist")
+				return
+			}
+		}
+
+		// ── Request-size sanity check ──────────────
+		if status, reason := checkRequestSize(r, l.policy); status != 0 {
+			charge := l.policy.OversizeCost
+			if charge < 1 {
+				charge = cost
+			}
+			result := l.store.Allow(r.Context(), l.bucketPrefix+key, l.policy, charge)
+			setRateLimitHeaders(w, l.policy, result, keyType)
+			l.rejectResponse(w, r, status, result, key, keyType, reason)
+			return
+		}
+		if l.policy.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, l.policy.MaxBodyBytes)
+		}
+		if l.costFunc != nil {
+			if c := l.costFunc(r); c > 0 {
+				cost = c
+			}
+		}
+		if l.policy.MaxCost > 0 && cost > l.policy.MaxCost {
+			l.costResponse(w, r, cost, key, keyType, "max_cost")
+			return
+		}
+
 		// ── Concurrency limit check ────────────────
 		if l.policy.ConcurrencyLimit > 0 && l.concurrencyStore != nil {
-			ok, err := l.concurrencyStore.Acquire(key, l.policy.ConcurrencyLimit)
+			ok, err := l.concurrencyStore.Acquire(l.bucketPrefix+key, l.policy.ConcurrencyLimit)
+			reason := "concurrency"
 			if err != nil {
-				log.Printf("[ratelimit] concurrency store error key=%s: %v", truncateKey(key), err)
+				ok = l.allowOnStoreError("acquire", key, err)
+				reason = "store_error"
 			}
 			if !ok {
 				l.denyResponse(w, r, Result{
@@ -102,97 +399,354 @@ func (l *Limiter) Middleware(next http.Handler) http.Handler {
 					Remaining:  0,
 					RetryAfter: 1,
 					ResetAt:    0,
-				}, key, keyType, "concurrency")
+				}, key, keyType, reason)
 				return
 			}
-			defer func() {
-				if err := l.concurrencyStore.Release(key); err != nil {
-					log.Printf("[ratelimit] concurrency release error key=%s: %v", truncateKey(key), err)
-				}
-			}()
+			// A slot that failed open was never taken, so there is nothing to release.
+			if err == nil {
+				defer func() {
+					if err := l.concurrencyStore.Release(l.bucketPrefix + key); err != nil {
+						log.Printf("[ratelimit] concurrency release error key=%s: %v", truncateKey(key), err)
+					}
+				}()
+			}
 		}
 
 		// ── Rate limit check ───────────────────────
-		result := l.store.Allow(key, l.policy, cost)
+		rateKey, ratePolicy, strict := l.checkSpoof(r, key)
+		reason := "rate"
+		switch {
+		case strict:
+			reason = "spoof"
+		case listed:
+			rateKey, ratePolicy, strict = "reputation:"+key, *l.reputation.strict, true
+			reason = "reputation"
+		case tor && l.tor.policy != nil:
+			rateKey, ratePolicy, strict = "tor:"+key, *l.tor.policy, true
+			reason = "tor"
+		default:
+			if crawlerKey, crawlerPolicy, ok := l.crawlerPolicy(r); ok {
+				rateKey, ratePolicy, strict = crawlerKey, crawlerPolicy, true
+				reason = "crawler"
+			} else if uaKey, uaPolicy, ok := l.uaPolicy(r, key); ok {
+				rateKey, ratePolicy = uaKey, l.keyPolicy(r, uaPolicy, key, keyType)
+			} else {
+				rateKey, ratePolicy = l.geoPolicy(r, key)
+				ratePolicy = l.keyPolicy(r, ratePolicy, key, keyType)
+			}
+		}
+		// A cost beyond the bucket's capacity could never be paid: 400,
+		// not 429. One only a lockdown makes unpayable is retryable.
+		if float64(cost) > ratePolicy.capacity() {
+			l.costResponse(w, r, cost, key, keyType, "cost_capacity")
+			return
+		}
+		if locked {
+			window := ratePolicy.Window
+			if ratePolicy = lockdown.apply(ratePolicy); float64(cost) > ratePolicy.capacity() {
+				l.lockdownCostResponse(w, r, window, key, keyType)
+				return
+			}
+		}
+		rateKey = l.bucketPrefix + rateKey
+		var result Result
+		if l.cookie != nil && keyType == KeyTypeIP && !strict {
+			result = l.cookieAllow(w, r, rateKey, ratePolicy, cost)
+		} else {
+			result = l.store.Allow(r.Context(), rateKey, ratePolicy, cost)
+		}
+		if result.Err != nil && !l.allowOnStoreError("allow", key, result.Err) {
+			l.denyResponse(w, r, l.failClosedResult(), key, keyType, "store_error")
+			return
+		}
 
 		// Always set rate-limit headers, even on success.
-		setRateLimitHeaders(w, result)
+		setRateLimitHeaders(w, ratePolicy, result, keyType)
 
 		if !result.Allowed {
-			l.denyResponse(w, r, result, key, keyType, "rate")
+			l.denyResponse(w, r, result, key, keyType, reason)
 			return
 		}
+		if config.RateLimit.LogLevel == "debug" {
+			l.logAllowed(r, result, key, keyType)
+		}
+		if l.onAllow != nil {
+			l.onAllow(r, result)
+		}
+		l.meterBody(r, rateKey, ratePolicy, key, keyType)
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withResult(r, l.policy.Scope, result))
 	})
 }
 
+// resolvePolicy returns the policy to enforce now: the policy set by
+// SetPolicy, or l.policy, with the overrides of every policy provider
+// applied, in order.
+func (l *Limiter) resolvePolicy() Policy {
+	p := l.live.get(l.policy)
+	if p.Scope == "" {
+		return p
+	}
+	for _, provider := range l.policyProviders {
+		if o, ok := provider.LookupPolicy(p.Scope); ok {
+			p = o.Apply(p)
+		}
+	}
+	return p
+}
+
+// limiterVariantsMax bounds the copies a limiterVariants keeps.
+const limiterVariantsMax = 256
+
+// limiterVariants caches copies of a limiter that differ only in policy,
+// so each distinct policy resolved at request time costs one copy.
+type limiterVariants struct {
+	base *Limiter
+	m    sync.Map // Policy -> *Limiter
+	n    atomic.Int32
+}
+
+func (v *limiterVariants) get(p Policy) *Limiter {
+	if p == v.base.policy {
+		return v.base
+	}
+	if c, ok := v.m.Load(p); ok {
+		return c.(*Limiter)
+	}
+	if v.n.Add(1) > limiterVariantsMax {
+		v.m.Clear()
+		v.n.Store(1)
+	}
+	c := v.base
+	if err := v.base.validatePolicy(p); err != nil {
+		// Keep enforcing the policy from code; logged once per bad policy.
+		log.Printf("[ratelimit] ignoring policy override: %v", err)
+	} else {
+		variant := *v.base
+		variant.policy = p
+		c = &variant
+	}
+	actual, _ := v.m.LoadOrStore(p, c)
+	return actual.(*Limiter)
+}
+
 // denyResponse writes a 429 response with proper headers and logging.
 func (l *Limiter) denyResponse(w http.ResponseWriter, r *http.Request, result Result, key, keyType, reason string) {
+	if l.shadow {
+		l.shadowDeny(r, result, key, keyType, reason)
+		return
+	}
+	result = l.escalate(result, key, reason)
+	l.logDenied(r, result, key, keyType, reason)
+	l.strike(r.Context(), key, reason)
+	l.tarpit(r, key, reason)
+
+	// Custom handler?
+	if l.onLimit != nil && l.onLimit(w, r, result) {
+		return
+	}
+
+	status := l.policy.denyStatus(reason)
+	retryAfter := l.setDenyHeaders(w, status, result, keyType)
+	if l.renderDenyPage(w, r, status, result, keyType, retryAfter) {
+		return
+	}
+	msg := l.denyMessage(keyType)
+	writeErrorResponse(w, r, l.policy, status,
+		msg+" Please slow down and try again later.",
+		fmt.Sprintf("%s Please try again in %d seconds.", msg, retryAfter),
+		result.RetryAfter)
+}
+
+// setDenyHeaders writes the headers of a denial with status, and returns
+// the Retry-After it advertises.
+func (l *Limiter) setDenyHeaders(w http.ResponseWriter, status int, result Result, keyType string) int {
+	if status != http.StatusTooManyRequests {
+		// CDNs cache 403 and some 5xx responses by default; a denial
+		// applies to one client, not to the URL.
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	setRateLimitHeaders(w, l.policy, result, keyType)
+	return setRetryAfter(w, result.RetryAfter)
+}
+
+// rejectResponse writes a non-429 rejection (e.g. 413, 431) through the same
+// logging path as rate-limit denials.
+func (l *Limiter) rejectResponse(w http.ResponseWriter, r *http.Request, status int, result Result, key, keyType, reason string) {
+	l.logDenied(r, result, key, keyType, reason)
+	writeErrorResponse(w, r, l.policy, status,
+		"Request rejected: "+http.StatusText(status)+".",
+		"Your request was too large to process.",
+		result.RetryAfter)
+}
+
+// costResponse rejects a request costing more than the policy allows, or
+// than its bucket could ever hold, with 400: unlike a 429, retrying would
+// never help.
+func (l *Limiter) costResponse(w http.ResponseWriter, r *http.Request, cost int, key, keyType, reason string) {
+	l.logDenied(r, Result{}, key, keyType, reason)
+	writeErrorResponse(w, r, l.policy, http.StatusBadRequest,
+		fmt.Sprintf("Request too expensive: it costs %d tokens, more than the rate limit allows.", cost),
+		"Your request is too expensive to process. Please make a smaller request.",
+		0)
+}
+
+// logDenied records a rejected request to the process log and the log store.
+func (l *Limiter) logDenied(r *http.Request, result Result, key, keyType, reason string) {
+	l.logDenial(r, result, key, keyType, reason, nil)
+}
+
+// logDenial is logDenied with the response headers of the denial, which
+// only a shadowed limiter records, as its response is discarded.
+func (l *Limiter) logDenial(r *http.Request, result Result, key, keyType, reason string, headers http.Header) {
+	boundary := Boundary(r)
+	tag := ""
+	if l.shadow {
+		tag = " mode=shadow"
+		countShadowDenial(l.policy.Scope)
+	} else {
+		boundaryDenied[boundaryIndex(boundary)].Add(1)
+	}
+	l.canary.deny(l.policy.Scope, key)
+
+	// With anonymization on, neither log carries the raw key or IP.
+	// Otherwise both carry the key's BlocklistKey, so a denied key can be
+	// blocked from its log entry.
+	loggedKey, keyHash, block, clientIP := truncateKey(key), BlocklistKey(key), "", ClientIP(r)
+	if anon := configAnonymizer(); anon != nil {
+		loggedKey, clientIP = anon.Key(key), anon.Hash(clientIP)[:40]
+		keyHash = loggedKey
+	} else {
+		block = " block=" + keyHash
+	}
+
 	// Log at warn level (never log raw secrets)
-	log.Printf("[ratelimit] DENIED %s %s | type=%s scope=%s key=%s retryAfter=%ds reason=%s",
-		r.Method, r.URL.Path, keyType, l.policy.Scope, truncateKey(key), result.RetryAfter, reason)
+	if config.RateLimit.LogLevel != "quiet" {
+		log.Printf("[ratelimit] DENIED %s %s | type=%s scope=%s key=%s%s retryAfter=%ds reason=%s via=%s%s",
+			r.Method, r.URL.Path, keyType, l.policy.Scope, truncateKey(loggedKey), block, result.RetryAfter, reason, boundary, tag)
+	}
 
 	// Log to database if configured
-	if l.logStore != nil {
+	logStore := l.logStore
+	if ls, ok := l.scopeLogStores[l.policy.Scope]; ok {
+		logStore = ls
+	}
+	if logStore != nil {
 		entry := LogEntry{
 			Method:     r.Method,
 			Path:       r.URL.Path,
 			KeyType:    keyType,
-			KeyHash:    truncateKey(key),
+			KeyHash:    keyHash,
 			Scope:      l.policy.Scope,
 			RetryAfter: result.RetryAfter,
-			ClientIP:   ClientIP(r),
+			ClientIP:   clientIP,
+			Shadow:     l.shadow,
+			Headers:    headers,
 		}
-		if err := l.logStore.Log(entry); err != nil {
+		if err := logStore.Log(entry); err != nil {
 			log.Printf("[ratelimit] failed to write log entry: %v", err)
 		}
 	}
+}
 
-	// Custom handler?
-	if l.onLimit != nil && l.onLimit(w, r, result) {
-		return
+// logAllowed logs an allowed request at the "debug" log level.
+func (l *Limiter) logAllowed(r *http.Request, result Result, key, keyType string) {
+	loggedKey := truncateKey(key)
+	if anon := configAnonymizer(); anon != nil {
+		loggedKey = truncateKey(anon.Key(key))
 	}
+	log.Printf("[ratelimit] ALLOWED %s %s | type=%s scope=%s key=%s remaining=%d",
+		r.Method, r.URL.Path, keyType, l.policy.Scope, loggedKey, result.Remaining)
+}
 
-	// Default 429
-	setRateLimitHeaders(w, result)
+// DenyBody selects how much body a rejection response carries.
+type DenyBody string
 
-	format := config.RateLimit.DefaultResponseFormat
-	// Heuristic: if Accept header prefers JSON, use JSON regardless of config.
-	accept := r.Header.Get("Accept")
-	if containsJSON(accept) {
-		format = "json"
-	}
+const (
+	// DenyBodyFull sends the JSON or HTML error body (the default).
+	DenyBodyFull DenyBody = ""
+	// DenyBodyMinimal sends status and headers with an empty body.
+	DenyBodyMinimal DenyBody = "minimal"
+)
+
+var gzipPool = sync.Pool{New: func() interface{} {
+	zw, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+	return zw
+}}
 
-	w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+// writeErrorResponse writes a JSON or HTML error body for status, following
+// RATE_LIMIT_RESPONSE_FORMAT and the request's Accept header. The policy
+// can ask for an empty body or a gzipped HTML page instead.
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, p Policy, status int, jsonMsg, htmlMsg string, retryAfter int) {
+	if p.DenyBody == DenyBodyMinimal {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(status)
+		return
+	}
 
-	switch format {
+	text := http.StatusText(status)
+	switch responseFormat(r, p) {
 	case "json":
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusTooManyRequests)
+		w.WriteHeader(status)
 		resp := map[string]interface{}{
-			"error":       "Too Many Requests",
-			"retry_after": result.RetryAfter,
-			"message":     "Rate limit exceeded. Please slow down and try again later.",
+			"error":       text,
+			"retry_after": retryAfter,
+			"message":     jsonMsg,
 		}
 		_ = json.NewEncoder(w).Encode(resp)
 	default:
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusTooManyRequests)
-		fmt.Fprintf(w, `<!DOCTYPE html>
-<html><head><title>429 Too Many Requests</title></head>
+		page := fmt.Sprintf(`<!DOCTYPE html>
+<html><head><title>%d %s</title></head>
 <body>
-<h1>Too Many Requests</h1>
-<p>You have exceeded the rate limit. Please try again in %d seconds.</p>
-</body></html>`, result.RetryAfter)
+<h1>%s</h1>
+<p>%s</p>
+</body></html>`, status, text, text, htmlMsg)
+
+		if p.CompressDeny && contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			zw := gzipPool.Get().(*gzip.Writer)
+			zw.Reset(&buf)
+			_, _ = zw.Write([]byte(page))
+			_ = zw.Close()
+			gzipPool.Put(zw)
+
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Add("Vary", "Accept-Encoding")
+			w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+			w.WriteHeader(status)
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(page))
 	}
 }
 
-// setRateLimitHeaders writes the standard rate-limit response headers.
-func setRateLimitHeaders(w http.ResponseWriter, r Result) {
-	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(r.Limit))
-	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
-	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(r.ResetAt, 10))
+// responseFormat returns the body format of a rejection of r under p:
+// "json" or "html".
+func responseFormat(r *http.Request, p Policy) string {
+	// Heuristic: if Accept header prefers JSON, use JSON regardless of config.
+	if containsJSON(r.Header.Get("Accept")) {
+		return "json"
+	}
+	if p.ResponseFormat != "" {
+		return p.ResponseFormat
+	}
+	return config.RateLimit.DefaultResponseFormat
+}
+
+// denyStatus returns the status code of a denial of p for reason: BanStatus
+// for clients in the penalty box, then DenyStatus, then 429.
+func (p Policy) denyStatus(reason string) int {
+	if reason == "penalty" && p.BanStatus != 0 {
+		return p.BanStatus
+	}
+	if p.DenyStatus != 0 {
+		return p.DenyStatus
+	}
+	return http.StatusTooManyRequests
 }
 
 // truncateKey returns a safe-to-log version of the key.
@@ -1,8 +1,12 @@
 package ratelimit
 
 import (
+	"compress/gzip"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +20,7 @@ func initTestConfig() {
 		Store:                 "memory",
 		RedisPrefix:           "test:rl:",
 		DefaultResponseFormat: "json",
+		FailMode:              "open",
 		TrustedProxies:        nil,
 		DefaultLimit:          300,
 		DefaultWindow:         60,
@@ -165,6 +170,103 @@ func TestMiddleware_AllowlistBypass(t *testing.T) {
 	}
 }
 
+func TestMiddleware_ConfigAllowlist(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.AllowlistIPs = []string{"10.0.0.0/8"}
+	config.RateLimit.AllowlistPaths = []string{"/healthz"}
+
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	status := func(remoteAddr, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for i := 0; i < 3; i++ {
+		if got := status("10.1.2.3:1234", "/"); got != http.StatusOK {
+			t.Fatalf("allowlisted IP: expected 200, got %d", got)
+		}
+		if got := status("192.0.2.1:1234", "/healthz"); got != http.StatusOK {
+			t.Fatalf("allowlisted path: expected 200, got %d", got)
+		}
+	}
+	if status("192.0.2.1:1234", "/") != http.StatusOK || status("192.0.2.1:1234", "/") != http.StatusTooManyRequests {
+		t.Error("expected other requests to be limited")
+	}
+
+	// A new config, as on a restart or reload, recompiles the allowlist.
+	cfg := *config.RateLimit
+	cfg.AllowlistIPs = nil
+	config.RateLimit = &cfg
+	if got := status("10.1.2.3:1234", "/"); got != http.StatusOK {
+		t.Fatalf("expected a first request after the change to pass, got %d", got)
+	}
+	if got := status("10.1.2.3:1234", "/"); got != http.StatusTooManyRequests {
+		t.Errorf("expected a changed allowlist to take effect, got %d", got)
+	}
+}
+
+func TestMiddleware_Skip(t *testing.T) {
+	initTestConfig()
+
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+	staff := func(r *http.Request) bool { return r.Header.Get("X-Staff") == "1" }
+	limiter := NewLimiter(store, p, KeyByIP(), WithSkip(staff))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	composed := Compose(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, h := range []http.Handler{handler, composed} {
+		for i := 0; i < 5; i++ {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Staff", "1")
+			h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Limit") != "" {
+				t.Fatalf("skipped request should pass unlimited, got %d", rr.Code)
+			}
+		}
+	}
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected other requests to be limited (200, 429), got %v", codes)
+	}
+}
+
+func TestMiddleware_Methods(t *testing.T) {
+	initTestConfig()
+
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "writes"}
+	limiter := NewLimiter(store, p, KeyByIP(), WithMethods("post", "DELETE"))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodHead, http.MethodDelete} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, "/items", nil))
+		codes = append(codes, rr.Code)
+	}
+	want := []int{200, 200, 200, 200, 429}
+	if !slices.Equal(codes, want) {
+		t.Errorf("expected only POST and DELETE to be limited (%v), got %v", want, codes)
+	}
+}
+
 func TestMiddleware_JSONResponse(t *testing.T) {
 	initTestConfig()
 	config.RateLimit.DefaultResponseFormat = "json"
@@ -222,3 +324,267 @@ func TestMemoryConcurrencyStore(t *testing.T) {
 		t.Fatal("acquire after release should succeed")
 	}
 }
+
+// countingIPRule matches one IP and counts evaluations.
+type countingIPRule struct {
+	ip    string
+	calls *int
+}
+
+func (c countingIPRule) Matches(r *http.Request) bool { return c.MatchesIP(ClientIP(r)) }
+func (c countingIPRule) MatchesIP(ip string) bool {
+	*c.calls++
+	return ip == c.ip
+}
+
+func TestMiddleware_AllowlistCache(t *testing.T) {
+	initTestConfig()
+
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	calls := 0
+	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+	limiter := NewLimiter(store, p, KeyByIP(),
+		WithAllowlist(countingIPRule{ip: "10.0.0.1", calls: &calls}, BypassPaths{Prefixes: []string{"/healthz"}}),
+		WithAllowlistCache(time.Minute),
+	)
+
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("allowlisted IP should bypass, got %d", rr.Code)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("IP rule should be evaluated once and cached, got %d evaluations", calls)
+	}
+
+	// Path rules still apply for non-allowlisted IPs.
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.RemoteAddr = "5.5.5.5:1234"
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("bypassed path should return 200, got %d", rr.Code)
+		}
+	}
+}
+
+func TestMiddleware_MinimalDenyBody(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	store.DenyAll(30)
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test", DenyBody: DenyBodyMinimal}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Fatalf("expected empty body, got %q", rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Fatalf("Retry-After = %q, want 30", rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestMiddleware_GzipDenyPage(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.DefaultResponseFormat = "html"
+	store := NewMockStore()
+	store.DenyAll(30)
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test", CompressDeny: true}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", rr.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	page, _ := io.ReadAll(zr)
+	if !strings.Contains(string(page), "429 Too Many Requests") {
+		t.Fatalf("unexpected page: %s", page)
+	}
+
+	// Clients that do not accept gzip get plain HTML.
+	rr = httptest.NewRecorder()
+	req.Header.Del("Accept-Encoding")
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "" || !strings.Contains(rr.Body.String(), "<h1>") {
+		t.Fatal("expected uncompressed HTML without Accept-Encoding")
+	}
+}
+
+func TestMiddleware_CostCeilings(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 50, Window: time.Minute, Burst: 10, Enabled: true, Cost: 1, Scope: "search"}
+	cost := 0
+	h := NewLimiter(store, p, KeyByIP(), WithCostFunc(func(*http.Request) int { return cost })).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(c int) int {
+		cost = c
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Code
+	}
+
+	if code := serve(60); code != http.StatusOK {
+		t.Errorf("expected a request costing the whole bucket to pass, got %d", code)
+	}
+	if code := serve(61); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a cost beyond the bucket, got %d", code)
+	}
+	if n := len(store.Calls()); n != 1 {
+		t.Errorf("expected the impossible request not to reach the store, got %d calls", n)
+	}
+
+	p.MaxCost = 20
+	h = NewLimiter(store, p, KeyByIP(), WithCostFunc(func(*http.Request) int { return cost })).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	if code := serve(21); code != http.StatusBadRequest {
+		t.Errorf("expected 400 above MaxCost, got %d", code)
+	}
+	store.DenyAll(5)
+	if code := serve(20); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for an affordable cost, got %d", code)
+	}
+}
+
+func TestMiddleware_BypassLocal(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.BypassLocal = true
+	store := NewMockStore()
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	h := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if n := len(store.Calls()); n != 0 {
+		t.Errorf("expected localhost to bypass the limiter, got %d calls", n)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if n := len(store.Calls()); n != 1 {
+		t.Errorf("expected other clients to be limited, got %d calls", n)
+	}
+}
+
+func TestMiddleware_PolicyResponseOverrides(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.DefaultResponseFormat = "html"
+	store := NewMockStore()
+	store.DenyAll(10)
+	logs := &recordingLogStore{}
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api",
+		ResponseFormat: "json", DenyStatus: http.StatusServiceUnavailable}
+	handler := NewLimiter(store, p, KeyByIP(), WithLogStore(NopLogStore{}),
+		WithScopeLogStores(map[string]LogStore{"api": logs})).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the policy's deny status, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected the policy's JSON format over the global HTML, got %q", ct)
+	}
+	if len(logs.entries) != 1 || logs.entries[0].Scope != "api" {
+		t.Errorf("expected the denial in the scope's log store, got %+v", logs.entries)
+	}
+}
+
+func TestMiddleware_IETFHeaders(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func() http.Header {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr.Header()
+	}
+
+	config.RateLimit.Headers = "ietf"
+	h := serve()
+	if got := h.Get("RateLimit-Policy"); got != `"api";q=10;w=60` {
+		t.Errorf("RateLimit-Policy = %q", got)
+	}
+	if got := h.Get("RateLimit"); !strings.HasPrefix(got, `"api";r=9;t=`) {
+		t.Errorf("RateLimit = %q", got)
+	}
+	if h.Get("RateLimit-Remaining") != "9" || h.Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("expected only the IETF fields, got %v", h)
+	}
+
+	config.RateLimit.Headers = "both"
+	if h := serve(); h.Get("RateLimit") == "" || h.Get("X-RateLimit-Remaining") != "8" {
+		t.Errorf("expected both header sets, got %v", h)
+	}
+}
+
+func TestMiddleware_OnAllow(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	var seen []Result
+	p := Policy{Limit: 2, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	handler := NewLimiter(store, p, KeyByIP(), WithOnAllow(func(r *http.Request, res Result) {
+		seen = append(seen, res)
+	})).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected OnAllow for the 2 allowed requests only, got %d", len(seen))
+	}
+	if seen[0].Remaining != 1 || seen[1].Remaining != 0 || seen[1].Limit != 2 {
+		t.Errorf("expected each request's Result, got %+v", seen)
+	}
+}
+
+func TestLimiter_HandleFunc(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	limiter := NewLimiter(store, Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"}, KeyByIP())
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", limiter.HandleFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mux.Handle("GET /", limiter.Handle(http.NotFoundHandler()))
+
+	codes := []int{}
+	for _, method := range []string{http.MethodPost, http.MethodPost, http.MethodGet} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, "/login", nil))
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected 200, 429, 429 from one shared limiter, got %v", codes)
+	}
+}
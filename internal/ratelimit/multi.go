@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+)
+
+// ──────────────────────────────────────────────
+// Batched Allow across several policies
+// ──────────────────────────────────────────────
+
+// AllowRequest is one (key, policy, cost) check in a batch.
+type AllowRequest struct {
+	Key    string
+	Policy Policy
+	Cost   int
+}
+
+// MultiStore is implemented by stores that can check several buckets in one
+// operation (one Lua call for Redis). Evaluation is all-or-nothing: tokens
+// are consumed from every bucket only if every bucket can afford its cost.
+// Each Result reports its own bucket; Result.Allowed is false for the
+// buckets that could not afford the request. Keys in a batch must be distinct.
+type MultiStore interface {
+	Store
+	AllowMulti(ctx context.Context, reqs []AllowRequest) []Result
+}
+
+// AllowMulti checks reqs against store, using a single round trip when the
+// store implements MultiStore. Otherwise each request is checked in order,
+// stopping at the first denial; earlier buckets keep their consumption in
+// that case, and the unchecked ones are reported as denied with no
+// RetryAfter.
+func AllowMulti(ctx context.Context, store Store, reqs []AllowRequest) []Result {
+	if ms, ok := store.(MultiStore); ok {
+		return ms.AllowMulti(ctx, reqs)
+	}
+	results := make([]Result, len(reqs))
+	for i, req := range reqs {
+		results[i] = store.Allow(ctx, req.Key, req.Policy, req.Cost)
+		if !results[i].Allowed {
+			for j := i + 1; j < len(reqs); j++ {
+				p := reqs[j].Policy
+				results[j] = Result{Limit: p.Limit + p.Burst}
+			}
+			break
+		}
+	}
+	return results
+}
+
+// AllAllowed reports whether every result in a batch admitted the request.
+func AllAllowed(results []Result) bool {
+	for _, r := range results {
+		if !r.Allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// MostRestrictive returns the result to expose in headers for a batch: the
+// longest-waiting denial if any were denied, otherwise the result with the
+// fewest remaining tokens.
+func MostRestrictive(results []Result) Result {
+	if len(results) == 0 {
+		return Result{}
+	}
+	return results[mostRestrictive(results)]
+}
+
+// mostRestrictive returns the index of MostRestrictive(results).
+func mostRestrictive(results []Result) int {
+	best := 0
+	for i, r := range results {
+		b := results[best]
+		switch {
+		case !r.Allowed && (b.Allowed || r.RetryAfter > b.RetryAfter):
+			best = i
+		case r.Allowed && b.Allowed && r.Remaining < b.Remaining:
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestMemoryStore_AllowMultiAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	wide := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "wide"}
+	narrow := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "narrow"}
+	reqs := []AllowRequest{
+		{Key: "a", Policy: wide, Cost: 1},
+		{Key: "b", Policy: narrow, Cost: 1},
+	}
+
+	if res := store.AllowMulti(ctx, reqs); !AllAllowed(res) {
+		t.Fatal("1st batch should be allowed")
+	}
+	res := store.AllowMulti(ctx, reqs)
+	if AllAllowed(res) {
+		t.Fatal("2nd batch should be denied by the narrow policy")
+	}
+	if !res[0].Allowed || res[1].Allowed {
+		t.Fatalf("per-bucket results = %v/%v, want true/false", res[0].Allowed, res[1].Allowed)
+	}
+	if res[1].RetryAfter < 1 {
+		t.Fatalf("RetryAfter = %d, want >= 1", res[1].RetryAfter)
+	}
+	// The denied batch must not have charged the wide bucket.
+	if res[0].Remaining != 9 {
+		t.Fatalf("wide remaining = %d, want 9", res[0].Remaining)
+	}
+}
+
+func TestAllowMulti_FallbackStopsAtFirstDenial(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{Store: NewMemoryStore(time.Minute)}
+	defer inner.Close()
+
+	narrow := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "narrow"}
+	wide := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "wide"}
+	reqs := []AllowRequest{
+		{Key: "a", Policy: narrow, Cost: 1},
+		{Key: "b", Policy: wide, Cost: 1},
+	}
+
+	AllowMulti(ctx, inner, reqs)
+	inner.calls = 0
+	res := AllowMulti(ctx, inner, reqs)
+	if AllAllowed(res) {
+		t.Fatal("2nd batch should be denied")
+	}
+	if inner.calls != 1 {
+		t.Fatalf("inner calls = %d, want 1", inner.calls)
+	}
+	if res[1].Limit != 10 {
+		t.Fatalf("unchecked result limit = %d, want 10", res[1].Limit)
+	}
+}
+
+func TestMostRestrictive(t *testing.T) {
+	got := MostRestrictive([]Result{
+		{Allowed: true, Remaining: 5},
+		{Allowed: true, Remaining: 2},
+		{Allowed: true, Remaining: 7},
+	})
+	if got.Remaining != 2 {
+		t.Fatalf("Remaining = %d, want 2", got.Remaining)
+	}
+
+	got = MostRestrictive([]Result{
+		{Allowed: true, Remaining: 1},
+		{Allowed: false, RetryAfter: 3},
+		{Allowed: false, RetryAfter: 30},
+	})
+	if got.Allowed || got.RetryAfter != 30 {
+		t.Fatalf("got %+v, want denial with RetryAfter 30", got)
+	}
+}
+
+// assertAtomicBatch checks that a batch denied by one bucket takes no
+// tokens from the others.
+func assertAtomicBatch(t *testing.T, name string, store Store) {
+	t.Helper()
+	if _, ok := store.(MultiStore); !ok {
+		t.Errorf("%s: does not implement MultiStore", name)
+		return
+	}
+	ctx := context.Background()
+	wide := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "wide"}
+	narrow := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "narrow"}
+	reqs := []AllowRequest{
+		{Key: name + ":a", Policy: wide, Cost: 1},
+		{Key: name + ":b", Policy: narrow, Cost: 1},
+	}
+	if res := AllowMulti(ctx, store, reqs); !AllAllowed(res) {
+		t.Errorf("%s: 1st batch should be allowed, got %+v", name, res)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if res := AllowMulti(ctx, store, reqs); AllAllowed(res) {
+			t.Errorf("%s: batch %d should be denied by the narrow policy", name, i+2)
+		}
+	}
+	if res := store.Allow(ctx, name+":a", wide, 1); res.Remaining != 8 {
+		t.Errorf("%s: denied batches charged the wide bucket: remaining %d, want 8", name, res.Remaining)
+	}
+}
+
+func TestAllowMulti_DecoratorsStayAtomic(t *testing.T) {
+	initTestConfig()
+	mem := func() Store { return NewMemoryStore(time.Minute) }
+	overrides := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		return map[string]PolicyOverride{}, nil
+	}, time.Hour)
+	stores := map[string]Store{
+		"fallback":     NewFallbackStore(mem(), time.Hour),
+		"migration":    NewMigrationStore(mem(), mem()),
+		"budget":       NewBudgetStore(mem(), time.Second, time.Minute, BudgetLocal, nil),
+		"denycache":    NewDenyCacheStore(mem(), 1, time.Minute),
+		"overrides":    NewKeyOverrideStore(mem(), overrides),
+		"instrumented": NewInstrumentedStore(mem(), StoreHooks{}),
+		"timeline":     NewTimelineStore(mem(), 10, time.Minute),
+		"tuner":        NewTunerStore(mem(), NewPolicyTuner(TunerGuardrails{})),
+		"anonymizing":  NewAnonymizingStore(mem(), NewAnonymizer([]byte("secret"), time.Hour)),
+		"tiered":       NewTieredStore(NewMemoryStore(time.Minute), time.Hour),
+	}
+	for name, store := range stores {
+		assertAtomicBatch(t, name, store)
+		store.Close()
+	}
+}
+
+func TestAllowMulti_AtomicThroughNewStore(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.MigrateFrom = "memory"
+	config.RateLimit.MigrateRead = "new"
+	config.RateLimit.Anonymize = true
+	config.RateLimit.AnonymizeSecret = "secret"
+	config.RateLimit.AnonymizeRotate = 3600
+	store := NewStore()
+	defer store.Close()
+	assertAtomicBatch(t, "newstore", store)
+}
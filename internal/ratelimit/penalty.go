@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Penalty box
+// ──────────────────────────────────────────────
+
+// PenaltyBox tracks abuse signals ("strikes") per key and temporarily bans
+// keys that collect too many strikes within a window. Any subsystem that
+// identifies misbehaviour (slow requests, repeated denials, …) can strike a
+// key; Limiters configured WithPenaltyBox reject banned keys outright.
+//
+// Strikes and bans are kept in a BanList, so a box on a RedisBanList bans
+// a key on every instance, and BansHandler lists and lifts its bans.
+type PenaltyBox struct {
+	list      BanList
+	threshold int
+	window    time.Duration
+	banFor    time.Duration
+}
+
+// NewPenaltyBox creates a per-instance penalty box that bans a key for
+// banFor once it collects threshold strikes within window.
+func NewPenaltyBox(threshold int, window, banFor time.Duration) *PenaltyBox {
+	return NewPenaltyBoxWithList(NewMemoryBanList(), threshold, window, banFor)
+}
+
+// NewPenaltyBoxWithList is NewPenaltyBox keeping strikes and bans in list.
+// Boxes sharing a list share bans, and their strikes count together.
+func NewPenaltyBoxWithList(list BanList, threshold int, window, banFor time.Duration) *PenaltyBox {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &PenaltyBox{
+		list:      list,
+		threshold: threshold,
+		window:    window,
+		banFor:    banFor,
+	}
+}
+
+// List returns the ban list of p, e.g. to serve it with BansHandler.
+func (p *PenaltyBox) List() BanList { return p.list }
+
+// Strike records one abuse signal for key. It returns true when this strike
+// (or an earlier one) has put the key in the penalty box.
+func (p *PenaltyBox) Strike(key string) bool {
+	return p.strike(context.Background(), key, "")
+}
+
+// strike records one abuse signal for key, and bans it for banFor once it
+// has collected threshold strikes. source describes the strikes in the
+// ban's reason. A failing ban list bans no one.
+func (p *PenaltyBox) strike(ctx context.Context, key, source string) bool {
+	n, err := p.list.Strike(ctx, key, p.window)
+	if err != nil {
+		log.Printf("[ratelimit] ban list error key=%s: %v", truncateKey(key), err)
+		return false
+	}
+	if n < p.threshold {
+		_, banned := p.banned(ctx, key)
+		return banned
+	}
+	b := Ban{
+		Key:    key,
+		Reason: fmt.Sprintf("%d strikes within %s", n, p.window),
+		Until:  time.Now().Add(p.banFor),
+	}
+	if source != "" {
+		b.Reason += ", " + source
+	}
+	if err := p.list.Ban(ctx, b); err != nil {
+		log.Printf("[ratelimit] ban list error key=%s: %v", truncateKey(key), err)
+		return false
+	}
+	log.Printf("[ratelimit] BANNED key=%s for %s: %s", truncateKey(key), p.banFor, b.Reason)
+	return true
+}
+
+// Banned reports whether key is currently banned and, if so, the number of
+// seconds until the ban lifts.
+func (p *PenaltyBox) Banned(key string) (retryAfter int, banned bool) {
+	return p.banned(context.Background(), key)
+}
+
+// banned is Banned under ctx. A failing ban list bans no one.
+func (p *PenaltyBox) banned(ctx context.Context, key string) (retryAfter int, banned bool) {
+	b, ok, err := p.list.Banned(ctx, key)
+	if err != nil {
+		log.Printf("[ratelimit] ban list error key=%s: %v", truncateKey(key), err)
+		return 0, false
+	}
+	if !ok {
+		return 0, false
+	}
+	return max(int(math.Ceil(time.Until(b.Until).Seconds())), 1), true
+}
+
+// Clear removes all strikes and any ban for key.
+func (p *PenaltyBox) Clear(key string) {
+	if err := p.list.Lift(context.Background(), key); err != nil {
+		log.Printf("[ratelimit] ban list error key=%s: %v", truncateKey(key), err)
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPenaltyBox_BansAfterThreshold(t *testing.T) {
+	box := NewPenaltyBox(3, time.Minute, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if box.Strike("k") {
+			t.Fatalf("strike %d should not ban yet", i+1)
+		}
+	}
+	if !box.Strike("k") {
+		t.Fatal("3rd strike should ban")
+	}
+
+	retry, banned := box.Banned("k")
+	if !banned {
+		t.Fatal("key should be banned")
+	}
+	if retry < 1 || retry > 60 {
+		t.Fatalf("retryAfter should be within the ban, got %d", retry)
+	}
+
+	if _, banned := box.Banned("other"); banned {
+		t.Fatal("unrelated key should not be banned")
+	}
+}
+
+func TestPenaltyBox_Clear(t *testing.T) {
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	box.Strike("k")
+	box.Clear("k")
+	if _, banned := box.Banned("k"); banned {
+		t.Fatal("cleared key should not be banned")
+	}
+}
+
+func TestMiddleware_PenaltyBoxDenies(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	box.Strike("ip:1.2.3.4")
+
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	limiter := NewLimiter(store, p, KeyByIP(), WithPenaltyBox(box))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("banned key: expected 429, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "5.6.7.8:1234"
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("other key: expected 200, got %d", rr.Code)
+	}
+}
+
+func TestMiddleware_PenaltyBoxBanStatus(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	box.Strike("ip:1.2.3.4")
+
+	p := Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test",
+		DenyStatus: http.StatusServiceUnavailable, BanStatus: http.StatusForbidden}
+	handler := NewLimiter(store, p, KeyByIP(), WithPenaltyBox(box)).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(addr string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("1.2.3.4:1234")
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("banned key: expected 403, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected Retry-After and no-store on a ban, got %v", rr.Header())
+	}
+
+	serve("5.6.7.8:1234")
+	if rr := serve("5.6.7.8:1234"); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("over limit: expected the deny status 503, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Plans (free / pro / enterprise)
+// ──────────────────────────────────────────────
+
+// PlanResolver returns the plan of the client a key belongs to, e.g. by
+// looking up the user, API key or tenant in the key. It returns false when
+// the key has no plan, such as for bare IPs.
+type PlanResolver func(r *http.Request, key, keyType string) (plan string, ok bool)
+
+// Plan is the rate budget of a plan.
+type Plan struct {
+	// Multiplier scales the Limit and Burst of the policy in effect, so
+	// one plan can cover every route: 10 gives ten times the free budget.
+	// 0 means 1.
+	Multiplier float64
+
+	// Policy, when set, replaces the policy in effect before Multiplier is
+	// applied.
+	Policy *Policy
+}
+
+type planConfig struct {
+	resolve PlanResolver
+	plans   map[string]Plan
+}
+
+// WithPlans charges each key by its plan. Keys on a plan keep their
+// bucket, now checked against the plan's budget; keys without a plan,
+// or on a plan missing from plans, keep the limiter's policy. Plans apply
+// to the rate check, and to geo and User-Agent class policies, instead of
+// WithTierMultipliers; the strict spoof, reputation, Tor and crawler
+// policies are kept. The resolver runs on every request, so wrap slow
+// lookups with CachePlans.
+func WithPlans(resolve PlanResolver, plans map[string]Plan) Option {
+	return func(l *Limiter) { l.plans = &planConfig{resolve: resolve, plans: plans} }
+}
+
+// keyPolicy returns p adjusted for the key: by its plan when it has one,
+// otherwise by its tier multiplier.
+func (l *Limiter) keyPolicy(r *http.Request, p Policy, key, keyType string) Policy {
+	if l.plans != nil {
+		if name, ok := l.plans.resolve(r, key, keyType); ok {
+			if plan, ok := l.plans.plans[name]; ok {
+				if plan.Policy != nil {
+					p = *plan.Policy
+				}
+				if plan.Multiplier > 0 {
+					p = scalePolicy(p, plan.Multiplier)
+				}
+				return p
+			}
+		}
+	}
+	return l.tierPolicy(p, keyType)
+}
+
+const planCacheMax = 10_000
+
+type cachedPlan struct {
+	plan    string
+	ok      bool
+	expires time.Time
+}
+
+// CachePlans caches the answers of resolve per key for ttl, so a plan
+// stored in a database costs one lookup per key per ttl. Plan changes
+// take effect within ttl.
+func CachePlans(resolve PlanResolver, ttl time.Duration) PlanResolver {
+	var mu sync.Mutex
+	cache := make(map[string]cachedPlan)
+	return func(r *http.Request, key, keyType string) (string, bool) {
+		now := time.Now()
+		mu.Lock()
+		c, hit := cache[key]
+		mu.Unlock()
+		if hit && now.Before(c.expires) {
+			return c.plan, c.ok
+		}
+		plan, ok := resolve(r, key, keyType)
+		mu.Lock()
+		if len(cache) >= planCacheMax {
+			clear(cache)
+		}
+		cache[key] = cachedPlan{plan: plan, ok: ok, expires: now.Add(ttl)}
+		mu.Unlock()
+		return plan, ok
+	}
+}
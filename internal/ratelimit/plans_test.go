@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Plans(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	free := Policy{Limit: 30, Window: time.Minute, Burst: 5, Enabled: true, Cost: 1, Scope: "api"}
+	enterprise := Policy{Limit: 1000, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	plansByUser := map[string]string{"user:1": "pro", "user:2": "enterprise", "user:3": "legacy"}
+	resolve := func(_ *http.Request, key, _ string) (string, bool) {
+		plan, ok := plansByUser[key]
+		return plan, ok
+	}
+	keyFunc := func(r *http.Request) (string, string) { return "user:" + r.Header.Get("X-User"), KeyTypeUser }
+	h := NewLimiter(store, free, keyFunc,
+		WithPlans(resolve, map[string]Plan{"pro": {Multiplier: 10}, "enterprise": {Policy: &enterprise}}),
+		WithTierMultipliers(map[string]float64{KeyTypeUser: 0.5}),
+	).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, user := range []string{"1", "2", "3", "4"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", user)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	calls := store.Calls()
+	want := []struct {
+		key          string
+		limit, burst int
+	}{
+		{"user:1", 300, 50}, // pro: ten times free
+		{"user:2", 1000, 0}, // enterprise: own policy
+		{"user:3", 15, 3},   // unknown plan: tier multiplier
+		{"user:4", 15, 3},   // no plan: tier multiplier
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %+v", calls)
+	}
+	for i, w := range want {
+		if c := calls[i]; c.Key != w.key || c.Policy.Limit != w.limit || c.Policy.Burst != w.burst {
+			t.Errorf("got key=%q limit=%d burst=%d, want %q %d/%d", c.Key, c.Policy.Limit, c.Policy.Burst, w.key, w.limit, w.burst)
+		}
+	}
+}
+
+func TestCachePlans(t *testing.T) {
+	var lookups atomic.Int32
+	resolve := CachePlans(func(_ *http.Request, key, _ string) (string, bool) {
+		lookups.Add(1)
+		return "pro", key == "user:1"
+	}, time.Hour)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 3; i++ {
+		if plan, ok := resolve(r, "user:1", KeyTypeUser); plan != "pro" || !ok {
+			t.Fatalf("got %q, %v", plan, ok)
+		}
+		if _, ok := resolve(r, "ip:1.2.3.4", KeyTypeIP); ok {
+			t.Fatal("expected no plan for an IP key")
+		}
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Fatalf("expected 2 lookups, got %d", n)
+	}
+}
@@ -1,7 +1,11 @@
 package ratelimit
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"gohst/internal/config"
 )
 
 // Policy defines a rate-limit policy that can be attached to a route or group.
@@ -16,6 +20,12 @@ type Policy struct {
 	// Set to 0 for strict limiting (fixed-window behaviour).
 	Burst int
 
+	// CarryOver lets a key save unused budget for later windows, as a share
+	// of Limit between 0 and 1. Meant for long-window quotas: with a monthly
+	// Limit and 0.25, a quiet month leaves up to a quarter of the next
+	// one's budget on top. New keys start without carry-over.
+	CarryOver float64
+
 	// Scope is an optional human-readable name used for logging/reporting.
 	Scope string
 
@@ -26,9 +36,123 @@ type Policy struct {
 	// Use higher values for expensive endpoints.
 	Cost int
 
+	// MaxCost caps the cost of a single request, e.g. one priced by a
+	// CostFunc. Costlier requests are rejected with 400, as retrying
+	// would not help. 0 means no cap.
+	MaxCost int
+
 	// ConcurrencyLimit caps the number of in-flight requests per key.
 	// 0 means unlimited.
 	ConcurrencyLimit int
+
+	// MaxHeaderCount / MaxHeaderBytes reject requests with too many or too
+	// large headers (431). 0 means unlimited.
+	MaxHeaderCount int
+	MaxHeaderBytes int
+
+	// MaxBodyBytes rejects request bodies larger than this (413). 0 means unlimited.
+	MaxBodyBytes int64
+
+	// OversizeCost is the token cost charged when a request is rejected for
+	// size, so repeat offenders run out of budget. 0 charges Cost.
+	OversizeCost int
+
+	// FailMode decides what happens when the store is unreachable. The
+	// default follows RATE_LIMIT_FAIL_MODE.
+	FailMode FailMode
+
+	// DenyBody selects the body of rejection responses. DenyBodyMinimal
+	// sends status and headers only, to cut egress during floods.
+	DenyBody DenyBody
+
+	// CompressDeny gzips HTML rejection pages for clients that accept gzip.
+	CompressDeny bool
+
+	// ResponseFormat is the body format of rejections, "json" or "html".
+	// Empty follows RATE_LIMIT_RESPONSE_FORMAT. Clients that accept JSON
+	// always get JSON.
+	ResponseFormat string
+
+	// DenyStatus is the status code of rate-limit denials. 0 means 429.
+	// Capacity-protection scopes use 503, which CDNs retry and cache
+	// differently.
+	DenyStatus int
+
+	// BanStatus is the status code of denials while the client is in the
+	// penalty box, e.g. 403. 0 follows DenyStatus.
+	BanStatus int
+
+	// TarpitDelay holds the denials of keys far over their limit for up to
+	// this long before answering, e.g. 10s, so a scraper pays in time what
+	// it can no longer pay in tokens. Delays are jittered between a fifth
+	// of it and all of it. 0 answers every denial at once.
+	TarpitDelay time.Duration
+
+	// TarpitAfter is how many denials a key collects within Window before
+	// its denials are held. 0 means Limit.
+	TarpitAfter int
+
+	// Escalation backs off keys that are denied window after window: each
+	// window in a row doubles the wait of their denials, up to 2^Escalation
+	// times Retry-After, and each quiet window halves it again. The bucket
+	// is not checked while a key backs off, so a key denied hundreds of
+	// times a minute does not get a fresh budget every window. 0 disables.
+	Escalation int
+}
+
+// Validate reports the settings of p that cannot work, such as a zero
+// window or a cost no bucket could ever pay. Disabled policies are never
+// enforced and always valid.
+func (p Policy) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	var errs []error
+	check := func(bad bool, format string, args ...interface{}) {
+		if bad {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(p.Limit < 1, "limit must be positive, got %d", p.Limit)
+	check(p.Window <= 0, "window must be positive, got %s", p.Window)
+	check(p.Burst < 0, "burst must not be negative, got %d", p.Burst)
+	check(p.Cost < 0, "cost must not be negative, got %d", p.Cost)
+	check(p.MaxCost < 0, "max cost must not be negative, got %d", p.MaxCost)
+	check(p.MaxCost > 0 && p.Cost > p.MaxCost, "cost %d exceeds max cost %d", p.Cost, p.MaxCost)
+	check(p.Limit >= 1 && p.Burst >= 0 && p.Cost > p.Limit+p.Burst,
+		"cost %d exceeds limit+burst %d, so no request could pass", p.Cost, p.Limit+p.Burst)
+	check(p.CarryOver < 0 || p.CarryOver > 1, "carry-over must be between 0 and 1, got %g", p.CarryOver)
+	check(p.ConcurrencyLimit < 0, "concurrency limit must not be negative, got %d", p.ConcurrencyLimit)
+	check(p.MaxHeaderCount < 0 || p.MaxHeaderBytes < 0 || p.MaxBodyBytes < 0, "size limits must not be negative")
+	check(p.OversizeCost < 0, "oversize cost must not be negative, got %d", p.OversizeCost)
+	check(p.FailMode != FailModeDefault && p.FailMode != FailOpen && p.FailMode != FailClosed,
+		"unknown fail mode %q", p.FailMode)
+	check(p.DenyBody != DenyBodyFull && p.DenyBody != DenyBodyMinimal, "unknown deny body %q", p.DenyBody)
+	check(p.ResponseFormat != "" && p.ResponseFormat != "json" && p.ResponseFormat != "html",
+		"unknown response format %q", p.ResponseFormat)
+	check(p.DenyStatus != 0 && (p.DenyStatus < 400 || p.DenyStatus > 599),
+		"deny status must be a 4xx or 5xx code, got %d", p.DenyStatus)
+	check(p.BanStatus != 0 && (p.BanStatus < 400 || p.BanStatus > 599),
+		"ban status must be a 4xx or 5xx code, got %d", p.BanStatus)
+	check(p.Escalation < 0 || p.Escalation > maxEscalation,
+		"escalation must be between 0 and %d, got %d", maxEscalation, p.Escalation)
+	check(p.TarpitDelay < 0 || p.TarpitAfter < 0, "tarpit settings must not be negative")
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("policy %q: %w", p.Scope, err)
+	}
+	return nil
+}
+
+// capacity is the most tokens a bucket for p holds: the limit, the burst
+// and the carry-over.
+func (p Policy) capacity() float64 {
+	return float64(p.Limit+p.Burst) + p.CarryOver*float64(p.Limit)
+}
+
+// keepAlive is how long an idle bucket for p is kept: two windows, and
+// long enough to fill its carry-over.
+func (p Policy) keepAlive() time.Duration {
+	return time.Duration(float64(2*p.Window) * (1 + p.CarryOver))
 }
 
 // DefaultPolicy returns a sensible default (300/min, burst 60).
@@ -76,6 +200,9 @@ func AuthSensitivePolicy() Policy {
 		Scope:   "auth_sensitive",
 		Enabled: true,
 		Cost:    1,
+
+		// Brute-force protection matters more than availability here.
+		FailMode: FailClosed,
 	}
 }
 
@@ -91,3 +218,30 @@ func ExportsPolicy() Policy {
 		ConcurrencyLimit: 1,
 	}
 }
+
+// UploadPolicy limits upload bytes per key: bytesPerMinute, counted in
+// tokens of UploadTokenBytes. Use it with WithUploadCost(UploadTokenBytes).
+// A single upload larger than the budget is rejected with 400.
+func UploadPolicy(bytesPerMinute int64) Policy {
+	return Policy{
+		Limit:   int(max(bytesPerMinute/UploadTokenBytes, 1)),
+		Window:  60 * time.Second,
+		Burst:   0,
+		Scope:   "uploads",
+		Enabled: true,
+		Cost:    1,
+	}
+}
+
+// HandshakePolicy limits TLS handshakes per peer IP. Values come from
+// RATE_LIMIT_TLS_HANDSHAKE_LIMIT / _WINDOW / _BURST.
+func HandshakePolicy() Policy {
+	return Policy{
+		Limit:   config.RateLimit.TLSHandshakeLimit,
+		Window:  time.Duration(config.RateLimit.TLSHandshakeWindow) * time.Second,
+		Burst:   config.RateLimit.TLSHandshakeBurst,
+		Scope:   "tls_handshake",
+		Enabled: config.RateLimit.TLSHandshakeLimit > 0,
+		Cost:    1,
+	}
+}
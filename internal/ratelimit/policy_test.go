@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, p := range []Policy{DefaultPolicy(), PublicBrowsePolicy(), APIDefaultPolicy(), AuthSensitivePolicy(), ExportsPolicy(), {}} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: %v", p.Scope, err)
+		}
+	}
+
+	valid := Policy{Limit: 10, Window: time.Minute, Burst: 5, Enabled: true, Cost: 1, Scope: "x"}
+	cases := []struct {
+		edit func(*Policy)
+		want string
+	}{
+		{func(p *Policy) { p.Window = 0 }, "window must be positive"},
+		{func(p *Policy) { p.Limit = 0 }, "limit must be positive"},
+		{func(p *Policy) { p.Burst = -1 }, "burst must not be negative"},
+		{func(p *Policy) { p.Cost = 16 }, "cost 16 exceeds limit+burst 15"},
+		{func(p *Policy) { p.MaxBodyBytes = -1 }, "size limits"},
+		{func(p *Policy) { p.CarryOver = 1.5 }, "carry-over must be between 0 and 1"},
+		{func(p *Policy) { p.FailMode = "sometimes" }, `unknown fail mode "sometimes"`},
+		{func(p *Policy) { p.ResponseFormat = "xml" }, `unknown response format "xml"`},
+		{func(p *Policy) { p.DenyStatus = 200 }, "deny status must be a 4xx or 5xx code"},
+		{func(p *Policy) { p.BanStatus = 302 }, "ban status must be a 4xx or 5xx code"},
+	}
+	for _, c := range cases {
+		p := valid
+		c.edit(&p)
+		err := p.Validate()
+		if err == nil || !strings.Contains(err.Error(), c.want) || !strings.Contains(err.Error(), `policy "x"`) {
+			t.Errorf("expected %q, got %v", c.want, err)
+		}
+	}
+}
+
+func TestNewLimiter_RejectsInvalidPolicies(t *testing.T) {
+	initTestConfig()
+	expectPanic := func(name, want string, build func()) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			if msg, _ := r.(string); !strings.Contains(msg, want) {
+				t.Errorf("%s: expected a panic containing %q, got %v", name, want, r)
+			}
+		}()
+		build()
+	}
+	store := NewMockStore()
+	bad := Policy{Limit: 10, Enabled: true, Scope: "bad"}
+
+	expectPanic("policy", `policy "bad": window must be positive`, func() {
+		NewLimiter(store, bad, KeyByIP())
+	})
+	expectPanic("concurrency", "needs a ConcurrencyStore", func() {
+		NewLimiter(store, ExportsPolicy(), KeyByIP())
+	})
+	expectPanic("route rule", `policy "bad"`, func() {
+		routes := NewPolicySet()
+		routes.Add("/x", bad)
+		NewLimiter(store, DefaultPolicy(), KeyByIP(), WithPolicySet(routes))
+	})
+
+	// Disabled rules are never enforced, so they need no settings.
+	routes := NewPolicySet()
+	routes.Add("/healthz", Policy{})
+	NewLimiter(store, DefaultPolicy(), KeyByIP(), WithPolicySet(routes))
+	NewExportsLimiter(store, NewMemoryConcurrencyStore())
+}
+
+func TestMiddleware_InvalidOverrideKeepsPolicy(t *testing.T) {
+	initTestConfig()
+	cost := 500
+	provider := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		return map[string]PolicyOverride{"api": {Cost: &cost}}, nil
+	}, time.Hour)
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	h := NewLimiter(store, p, KeyByIP(), WithPolicyProvider(provider)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if calls := store.Calls(); len(calls) != 1 || calls[0].Cost != 1 {
+		t.Fatalf("expected the policy from code, got %+v", calls)
+	}
+}
@@ -0,0 +1,319 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Hot-reloaded policy overrides file
+// ──────────────────────────────────────────────
+
+// policyFileMaxSize caps the overrides file.
+const policyFileMaxSize = 1 << 20
+
+// PolicyOverride replaces some fields of a policy. Nil fields keep the
+// value compiled into the app.
+type PolicyOverride struct {
+	Limit            *int          `json:"limit,omitempty"`
+	Window           *PolicyWindow `json:"window,omitempty"`
+	Burst            *int          `json:"burst,omitempty"`
+	CarryOver        *float64      `json:"carry_over,omitempty"`
+	Cost             *int          `json:"cost,omitempty"`
+	MaxCost          *int          `json:"max_cost,omitempty"`
+	ConcurrencyLimit *int          `json:"concurrency,omitempty"`
+	MaxBodyBytes     *int64        `json:"max_body_bytes,omitempty"`
+	FailMode         *FailMode     `json:"fail_mode,omitempty"`
+	ResponseFormat   *string       `json:"response_format,omitempty"`
+	DenyStatus       *int          `json:"deny_status,omitempty"`
+	BanStatus        *int          `json:"ban_status,omitempty"`
+	Enabled          *bool         `json:"enabled,omitempty"`
+}
+
+// PolicyWindow is a policy window in JSON: a duration string such as "90s"
+// or "5m", or a number of seconds.
+type PolicyWindow time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *PolicyWindow) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*w = PolicyWindow(d)
+		return nil
+	}
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return fmt.Errorf("window %s: want a duration or seconds", data)
+	}
+	*w = PolicyWindow(time.Duration(n) * time.Second)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w PolicyWindow) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(w).String())
+}
+
+// Validate rejects overrides that would produce an unusable policy.
+func (o PolicyOverride) Validate() error {
+	switch {
+	case o.Limit != nil && *o.Limit < 1:
+		return fmt.Errorf("limit must be positive")
+	case o.Window != nil && *o.Window <= 0:
+		return fmt.Errorf("window must be positive")
+	case o.Burst != nil && *o.Burst < 0:
+		return fmt.Errorf("burst must not be negative")
+	case o.CarryOver != nil && (*o.CarryOver < 0 || *o.CarryOver > 1):
+		return fmt.Errorf("carry_over must be between 0 and 1")
+	case o.Cost != nil && *o.Cost < 0:
+		return fmt.Errorf("cost must not be negative")
+	case o.MaxCost != nil && *o.MaxCost < 0:
+		return fmt.Errorf("max_cost must not be negative")
+	case o.ConcurrencyLimit != nil && *o.ConcurrencyLimit < 0:
+		return fmt.Errorf("concurrency must not be negative")
+	case o.MaxBodyBytes != nil && *o.MaxBodyBytes < 0:
+		return fmt.Errorf("max_body_bytes must not be negative")
+	case o.FailMode != nil && *o.FailMode != "" && *o.FailMode != FailOpen && *o.FailMode != FailClosed:
+		return fmt.Errorf("fail_mode must be %q or %q", FailOpen, FailClosed)
+	case o.ResponseFormat != nil && *o.ResponseFormat != "" && *o.ResponseFormat != "json" && *o.ResponseFormat != "html":
+		return fmt.Errorf(`response_format must be "json" or "html"`)
+	case o.DenyStatus != nil && *o.DenyStatus != 0 && (*o.DenyStatus < 400 || *o.DenyStatus > 599):
+		return fmt.Errorf("deny_status must be a 4xx or 5xx code")
+	case o.BanStatus != nil && *o.BanStatus != 0 && (*o.BanStatus < 400 || *o.BanStatus > 599):
+		return fmt.Errorf("ban_status must be a 4xx or 5xx code")
+	}
+	return nil
+}
+
+// Apply returns p with the override's fields replaced.
+func (o PolicyOverride) Apply(p Policy) Policy {
+	if o.Limit != nil {
+		p.Limit = *o.Limit
+	}
+	if o.Window != nil {
+		p.Window = time.Duration(*o.Window)
+	}
+	if o.Burst != nil {
+		p.Burst = *o.Burst
+	}
+	if o.CarryOver != nil {
+		p.CarryOver = *o.CarryOver
+	}
+	if o.Cost != nil {
+		p.Cost = *o.Cost
+	}
+	if o.MaxCost != nil {
+		p.MaxCost = *o.MaxCost
+	}
+	if o.ConcurrencyLimit != nil {
+		p.ConcurrencyLimit = *o.ConcurrencyLimit
+	}
+	if o.MaxBodyBytes != nil {
+		p.MaxBodyBytes = *o.MaxBodyBytes
+	}
+	if o.FailMode != nil {
+		p.FailMode = *o.FailMode
+	}
+	if o.ResponseFormat != nil {
+		p.ResponseFormat = *o.ResponseFormat
+	}
+	if o.DenyStatus != nil {
+		p.DenyStatus = *o.DenyStatus
+	}
+	if o.BanStatus != nil {
+		p.BanStatus = *o.BanStatus
+	}
+	if o.Enabled != nil {
+		p.Enabled = *o.Enabled
+	}
+	return p
+}
+
+// ParsePolicyOverrides parses a JSON object of overrides keyed by policy
+// scope, e.g. {"api_default": {"limit": 200, "window": "1m"}}.
+func ParsePolicyOverrides(data []byte) (map[string]PolicyOverride, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var overrides map[string]PolicyOverride
+	if err := dec.Decode(&overrides); err != nil {
+		return nil, err
+	}
+	for scope, o := range overrides {
+		if err := o.Validate(); err != nil {
+			return nil, fmt.Errorf("policy %q: %v", scope, err)
+		}
+	}
+	return overrides, nil
+}
+
+// ParsePolicyOverridesYAML parses overrides in YAML, with the layout and
+// fields of ParsePolicyOverrides:
+//
+//	api_default:
+//	  limit: 200
+//	  window: 1m
+func ParsePolicyOverridesYAML(data []byte) (map[string]PolicyOverride, error) {
+	doc, err := config.ParseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicyOverrides(js)
+}
+
+// PolicyFile applies policy overrides from a JSON or, for a .yaml or .yml
+// path, YAML file (see ParsePolicyOverrides) and reloads it when it changes, so limits can be
+// tuned in production without a redeploy. The file is polled every
+// interval for a new modification time or size, which also catches
+// Kubernetes ConfigMap updates. A file that fails to read or parse keeps
+// the current overrides.
+type PolicyFile struct {
+	path     string
+	interval time.Duration
+
+	overrides atomic.Pointer[map[string]PolicyOverride]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewPolicyFile loads the overrides in path. interval defaults to five
+// seconds. An unreadable or invalid file is an error, so a bad deploy fails
+// at boot rather than at the first reload.
+func NewPolicyFile(path string, interval time.Duration) (*PolicyFile, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	f := &PolicyFile{path: path, interval: interval, stop: make(chan struct{})}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewPolicyFileFromConfig loads RATE_LIMIT_POLICY_FILE, or returns nil when
+// it is not set.
+func NewPolicyFileFromConfig() (*PolicyFile, error) {
+	cfg := config.RateLimit
+	if cfg.PolicyFile == "" {
+		return nil, nil
+	}
+	return NewPolicyFile(cfg.PolicyFile, time.Duration(cfg.PolicyFileRefresh)*time.Second)
+}
+
+// Start watches the file in the background until Close.
+func (f *PolicyFile) Start() {
+	f.done = make(chan struct{})
+	go f.loop()
+}
+
+// Close stops watching the file.
+func (f *PolicyFile) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	if f.done != nil {
+		<-f.done
+	}
+	return nil
+}
+
+func (f *PolicyFile) loop() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.poll()
+		}
+	}
+}
+
+// poll reloads the file if it changed since the last load.
+func (f *PolicyFile) poll() {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("[ratelimit] policy file %s: %v (keeping current policies)", f.path, err)
+		return
+	}
+	f.mu.Lock()
+	changed := !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+	f.mu.Unlock()
+	if changed {
+		f.Reload()
+	}
+}
+
+// Reload reads the file now.
+func (f *PolicyFile) Reload() error {
+	info, err := os.Stat(f.path)
+	if err == nil && info.Size() > policyFileMaxSize {
+		err = fmt.Errorf("larger than %d bytes", policyFileMaxSize)
+	}
+	var overrides map[string]PolicyOverride
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(f.path); err == nil {
+			switch strings.ToLower(filepath.Ext(f.path)) {
+			case ".yaml", ".yml":
+				overrides, err = ParsePolicyOverridesYAML(data)
+			default:
+				overrides, err = ParsePolicyOverrides(data)
+			}
+		}
+	}
+	if info != nil {
+		// A bad version is retried only once the file changes again.
+		f.mu.Lock()
+		f.modTime, f.size = info.ModTime(), info.Size()
+		f.mu.Unlock()
+	}
+	if err != nil {
+		err = fmt.Errorf("policy file %s: %w", f.path, err)
+		if f.overrides.Load() != nil {
+			log.Printf("[ratelimit] %v (keeping current policies)", err)
+		}
+		return err
+	}
+	f.overrides.Store(&overrides)
+	log.Printf("[ratelimit] loaded %d policy overrides from %s", len(overrides), f.path)
+	return nil
+}
+
+// LookupPolicy implements PolicyProvider.
+func (f *PolicyFile) LookupPolicy(scope string) (PolicyOverride, bool) {
+	if f == nil {
+		return PolicyOverride{}, false
+	}
+	o, ok := (*f.overrides.Load())[scope]
+	return o, ok
+}
+
+// WithPolicyFile applies the overrides in f; see WithPolicyProvider.
+func WithPolicyFile(f *PolicyFile) Option {
+	return WithPolicyProvider(f)
+}
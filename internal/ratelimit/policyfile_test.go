@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePolicyOverrides(t *testing.T) {
+	overrides, err := ParsePolicyOverrides([]byte(`{
+		"api_default": {"limit": 200, "window": "30s", "burst": 0},
+		"exports": {"window": 120, "enabled": false}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := overrides["api_default"].Apply(APIDefaultPolicy())
+	if p.Limit != 200 || p.Window != 30*time.Second || p.Burst != 0 || p.Cost != 1 || !p.Enabled {
+		t.Fatalf("api_default: got %+v", p)
+	}
+	p = overrides["exports"].Apply(ExportsPolicy())
+	if p.Limit != ExportsPolicy().Limit || p.Window != 2*time.Minute || p.Enabled {
+		t.Fatalf("exports: got %+v", p)
+	}
+
+	for _, bad := range []string{
+		`{"a": {"limit": 0}}`,
+		`{"a": {"window": "-1s"}}`,
+		`{"a": {"window": "soon"}}`,
+		`{"a": {"fail_mode": "maybe"}}`,
+		`{"a": {"limt": 5}}`,
+		`[]`,
+	} {
+		if _, err := ParsePolicyOverrides([]byte(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestPolicyFile_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	body := `
+# tuned for the launch
+api_default:
+  limit: 200
+  window: 30s
+exports: {window: 120, enabled: false}
+`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewPolicyFile(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, _ := f.LookupPolicy("api_default")
+	if p := o.Apply(APIDefaultPolicy()); p.Limit != 200 || p.Window != 30*time.Second {
+		t.Errorf("api_default: got %+v", p)
+	}
+	o, _ = f.LookupPolicy("exports")
+	if p := o.Apply(ExportsPolicy()); p.Window != 2*time.Minute || p.Enabled {
+		t.Errorf("exports: got %+v", p)
+	}
+
+	for _, bad := range []string{"a:\n  limt: 5\n", "a:\n  limit: 0\n", "- a\n"} {
+		if _, err := ParsePolicyOverridesYAML([]byte(bad)); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestPolicyFile_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	write := func(body string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	base := time.Now().Add(-time.Hour)
+	write(`{"search": {"limit": 50}}`, base)
+
+	f, err := NewPolicyFile(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := func() int {
+		o, ok := f.LookupPolicy("search")
+		if !ok || o.Limit == nil {
+			return 0
+		}
+		return *o.Limit
+	}
+	if got := limit(); got != 50 {
+		t.Fatalf("expected 50, got %d", got)
+	}
+	if _, ok := f.LookupPolicy("other"); ok {
+		t.Fatal("expected no override for an unlisted scope")
+	}
+
+	write(`{"search": {"limit": 75}}`, base.Add(time.Minute))
+	f.poll()
+	if got := limit(); got != 75 {
+		t.Fatalf("after change: expected 75, got %d", got)
+	}
+
+	write(`{"search": {"limit": -1}}`, base.Add(2*time.Minute))
+	f.poll()
+	if got := limit(); got != 75 {
+		t.Fatalf("invalid file: expected to keep 75, got %d", got)
+	}
+
+	os.Remove(path)
+	f.poll()
+	if got := limit(); got != 75 {
+		t.Fatalf("missing file: expected to keep 75, got %d", got)
+	}
+
+	if _, err := NewPolicyFile(path, time.Hour); err == nil {
+		t.Fatal("expected an error for a missing file at startup")
+	}
+}
+
+func TestMiddleware_PolicyFile(t *testing.T) {
+	initTestConfig()
+	path := filepath.Join(t.TempDir(), "policies.json")
+	os.WriteFile(path, []byte(`{"api": {"limit": 7}, "login": {"enabled": false}}`), 0o600)
+	f, err := NewPolicyFile(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMockStore()
+	routes := NewPolicySet()
+	routes.Add("/login", Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"})
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	h := NewLimiter(store, p, KeyByIP(), WithPolicySet(routes), WithPolicyFile(f)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, path := range []string{"/", "/login"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", path, rr.Code)
+		}
+	}
+	calls := store.Calls()
+	if len(calls) != 1 || calls[0].Policy.Limit != 7 {
+		t.Fatalf("got %+v", calls)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rr.Header().Get("X-RateLimit-Limit"); got != "7" {
+		t.Fatalf("expected limit header 7, got %q", got)
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+// ──────────────────────────────────────────────
+// Policy groups with inheritance
+// ──────────────────────────────────────────────
+
+// PolicyGroup is a named family of policies derived from one base, so
+// defaults such as the window, fail mode and deny body are set once and
+// every member changes with them:
+//
+//	api := ratelimit.NewPolicyGroup("api", ratelimit.APIDefaultPolicy())
+//	search := api.Policy("api_search", func(p *ratelimit.Policy) { p.Limit = 50 })
+//	partner := api.Group("partner", func(p *ratelimit.Policy) { p.FailMode = ratelimit.FailClosed })
+//	bulk := partner.Policy("partner_bulk", func(p *ratelimit.Policy) { p.Cost = 10 })
+//
+// Derived policies are plain values computed when they are created. Build
+// a group at startup, before serving requests.
+type PolicyGroup struct {
+	name     string
+	base     Policy
+	parent   *PolicyGroup
+	policies map[string]Policy
+}
+
+// NewPolicyGroup creates a root group. The base policy's Scope is set to
+// name.
+func NewPolicyGroup(name string, base Policy) *PolicyGroup {
+	base.Scope = name
+	return &PolicyGroup{name: name, base: base, policies: make(map[string]Policy)}
+}
+
+// Name returns the group's name.
+func (g *PolicyGroup) Name() string { return g.name }
+
+// Base returns the group's base policy.
+func (g *PolicyGroup) Base() Policy { return g.base }
+
+// Group creates a subgroup whose base is this group's base changed by
+// edit, which may be nil. Its policies are listed by every ancestor's
+// Policies too.
+func (g *PolicyGroup) Group(name string, edit func(*Policy)) *PolicyGroup {
+	sub := NewPolicyGroup(name, g.derive(name, edit))
+	sub.parent = g
+	return sub
+}
+
+// Policy returns the group's base changed by edit, which may be nil, with
+// Scope set to scope, and registers it under scope.
+func (g *PolicyGroup) Policy(scope string, edit func(*Policy)) Policy {
+	p := g.derive(scope, edit)
+	for group := g; group != nil; group = group.parent {
+		group.policies[scope] = p
+	}
+	return p
+}
+
+// Policies returns every policy derived from the group and its subgroups,
+// keyed by scope, e.g. for NewDecisionServer.
+func (g *PolicyGroup) Policies() map[string]Policy {
+	out := make(map[string]Policy, len(g.policies))
+	for scope, p := range g.policies {
+		out[scope] = p
+	}
+	return out
+}
+
+func (g *PolicyGroup) derive(scope string, edit func(*Policy)) Policy {
+	p := g.base
+	if edit != nil {
+		edit(&p)
+	}
+	p.Scope = scope
+	return p
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyGroup(t *testing.T) {
+	base := Policy{Limit: 100, Window: time.Minute, Burst: 20, Enabled: true, Cost: 1, DenyBody: DenyBodyMinimal}
+	api := NewPolicyGroup("api", base)
+	search := api.Policy("api_search", func(p *Policy) { p.Limit = 50 })
+	partner := api.Group("partner", func(p *Policy) { p.FailMode = FailClosed })
+	bulk := partner.Policy("partner_bulk", func(p *Policy) { p.Cost = 10 })
+	plain := api.Policy("api_plain", nil)
+
+	if search.Limit != 50 || search.Window != time.Minute || search.Burst != 20 || search.DenyBody != DenyBodyMinimal || search.Scope != "api_search" {
+		t.Fatalf("search: got %+v", search)
+	}
+	if bulk.Cost != 10 || bulk.FailMode != FailClosed || bulk.Limit != 100 || bulk.Scope != "partner_bulk" {
+		t.Fatalf("bulk: got %+v", bulk)
+	}
+	want := api.Base()
+	want.Scope = "api_plain"
+	if plain != want {
+		t.Fatalf("plain: got %+v", plain)
+	}
+	if api.Base().Scope != "api" || partner.Name() != "partner" {
+		t.Fatalf("base scope %q, name %q", api.Base().Scope, partner.Name())
+	}
+
+	all := api.Policies()
+	if len(all) != 3 || all["partner_bulk"] != bulk || all["api_search"] != search {
+		t.Fatalf("api policies: got %+v", all)
+	}
+	if sub := partner.Policies(); len(sub) != 1 {
+		t.Fatalf("partner policies: got %+v", sub)
+	}
+}
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gohst/internal/config"
+	"gohst/internal/db"
+)
+
+// ──────────────────────────────────────────────
+// Dynamic policy providers
+// ──────────────────────────────────────────────
+
+// PolicyProvider supplies policy overrides by scope at request time.
+// Lookups run on every request and must be fast and safe for concurrent
+// use; providers backed by slow sources cache them (see
+// CachedPolicyProvider).
+type PolicyProvider interface {
+	LookupPolicy(scope string) (PolicyOverride, bool)
+}
+
+// WithPolicyProvider applies the overrides of provider to the limiter's
+// policy, and to the policies of its PolicySet and method rules, matched
+// by Scope. Changes take effect on the next request. With several
+// providers, later ones win for the fields they set. Policies without a
+// Scope are never overridden.
+func WithPolicyProvider(provider PolicyProvider) Option {
+	return func(l *Limiter) {
+		if provider != nil {
+			l.policyProviders = append(l.policyProviders, provider)
+		}
+	}
+}
+
+// PolicyLoadFunc loads every policy override, keyed by scope.
+type PolicyLoadFunc func(ctx context.Context) (map[string]PolicyOverride, error)
+
+// policyLoadTimeout bounds one load of a CachedPolicyProvider.
+const policyLoadTimeout = 5 * time.Second
+
+// CachedPolicyProvider serves overrides from memory and reloads them at
+// most once per TTL. Reloads run in the background on the first lookup
+// after the TTL, so a slow or unreachable source never delays requests; a
+// failed reload keeps the current overrides and is retried after another
+// TTL.
+type CachedPolicyProvider struct {
+	load PolicyLoadFunc
+	ttl  time.Duration
+
+	overrides  atomic.Pointer[map[string]PolicyOverride]
+	loadedAt   atomic.Int64 // unix nanos of the last load attempt
+	refreshing atomic.Bool
+}
+
+// NewCachedPolicyProvider creates a provider and loads it once. ttl
+// defaults to ten seconds.
+func NewCachedPolicyProvider(load PolicyLoadFunc, ttl time.Duration) *CachedPolicyProvider {
+	if ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	c := &CachedPolicyProvider{load: load, ttl: ttl}
+	c.overrides.Store(&map[string]PolicyOverride{})
+	ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+	c.Refresh(ctx)
+	cancel()
+	return c
+}
+
+// LookupPolicy implements PolicyProvider.
+func (c *CachedPolicyProvider) LookupPolicy(scope string) (PolicyOverride, bool) {
+	if c == nil {
+		return PolicyOverride{}, false
+	}
+	if time.Since(time.Unix(0, c.loadedAt.Load())) > c.ttl && c.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer c.refreshing.Store(false)
+			ctx, cancel := context.WithTimeout(context.Background(), policyLoadTimeout)
+			defer cancel()
+			c.Refresh(ctx)
+		}()
+	}
+	o, ok := (*c.overrides.Load())[scope]
+	return o, ok
+}
+
+// Refresh reloads the overrides now.
+func (c *CachedPolicyProvider) Refresh(ctx context.Context) error {
+	c.loadedAt.Store(time.Now().UnixNano())
+	overrides, err := c.load(ctx)
+	if err != nil {
+		log.Printf("[ratelimit] policy reload failed: %v (keeping current policies)", err)
+		return err
+	}
+	c.overrides.Store(&overrides)
+	return nil
+}
+
+// ──────────────────────────────────────────────
+// Database policy provider (PostgreSQL)
+// ──────────────────────────────────────────────
+
+// NewDBPolicyProvider creates a provider reading the rate_limit_policies
+// table of the primary DB, cached for ttl.
+func NewDBPolicyProvider(ttl time.Duration) *CachedPolicyProvider {
+	primary := db.GetPrimaryDB()
+	if primary == nil {
+		log.Println("[ratelimit] warning: no primary DB available for policy provider")
+		return NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+			return nil, fmt.Errorf("database not available")
+		}, ttl)
+	}
+	return NewCachedPolicyProvider(DBPolicyLoader(primary.DB), ttl)
+}
+
+// NewPolicyProviderFromConfig creates the database policy provider when
+// RATE_LIMIT_POLICY_TABLE is set, or returns nil.
+func NewPolicyProviderFromConfig() *CachedPolicyProvider {
+	if !config.RateLimit.PolicyTableEnabled {
+		return nil
+	}
+	ttl := time.Duration(config.RateLimit.PolicyTableTTL) * time.Second
+	log.Printf("[ratelimit] loading policies from the database (cached %s)", ttl)
+	return NewDBPolicyProvider(ttl)
+}
+
+// DBPolicyLoader loads overrides from the rate_limit_policies table.
+// NULL columns keep the policy from code. Rows with invalid values are
+// logged and skipped, so one bad edit does not discard the others.
+func DBPolicyLoader(conn *sql.DB) PolicyLoadFunc {
+	return func(ctx context.Context) (map[string]PolicyOverride, error) {
+		query := `
+			SELECT scope, request_limit, window_seconds, burst, cost, concurrency,
+			       max_body_bytes, fail_mode, enabled
+			FROM rate_limit_policies`
+
+		rows, err := conn.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		out := make(map[string]PolicyOverride)
+		for rows.Next() {
+			var (
+				scope                                   string
+				limit, window, burst, cost, concurrency sql.NullInt64
+				maxBody                                 sql.NullInt64
+				failMode                                sql.NullString
+				enabled                                 sql.NullBool
+			)
+			if err := rows.Scan(&scope, &limit, &window, &burst, &cost, &concurrency, &maxBody, &failMode, &enabled); err != nil {
+				return nil, err
+			}
+			o := PolicyOverride{
+				Limit:            nullInt(limit),
+				Burst:            nullInt(burst),
+				Cost:             nullInt(cost),
+				ConcurrencyLimit: nullInt(concurrency),
+			}
+			if window.Valid {
+				w := PolicyWindow(time.Duration(window.Int64) * time.Second)
+				o.Window = &w
+			}
+			if maxBody.Valid {
+				o.MaxBodyBytes = &maxBody.Int64
+			}
+			if failMode.Valid {
+				m := FailMode(failMode.String)
+				o.FailMode = &m
+			}
+			if enabled.Valid {
+				o.Enabled = &enabled.Bool
+			}
+			if err := o.Validate(); err != nil {
+				log.Printf("[ratelimit] skipping policy %q from the database: %v", scope, err)
+				continue
+			}
+			out[scope] = o
+		}
+		return out, rows.Err()
+	}
+}
+
+func nullInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
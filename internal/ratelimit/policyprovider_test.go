@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedPolicyProvider(t *testing.T) {
+	var limit atomic.Int32
+	var fail atomic.Bool
+	limit.Store(50)
+	load := func(context.Context) (map[string]PolicyOverride, error) {
+		if fail.Load() {
+			return nil, errors.New("db down")
+		}
+		n := int(limit.Load())
+		return map[string]PolicyOverride{"search": {Limit: &n}}, nil
+	}
+	c := NewCachedPolicyProvider(load, time.Hour)
+	get := func() int {
+		o, ok := c.LookupPolicy("search")
+		if !ok {
+			return 0
+		}
+		return *o.Limit
+	}
+	if got := get(); got != 50 {
+		t.Fatalf("expected 50, got %d", got)
+	}
+
+	// Within the TTL the cache is served.
+	limit.Store(75)
+	if got := get(); got != 50 {
+		t.Fatalf("expected the cached 50, got %d", got)
+	}
+	if err := c.Refresh(context.Background()); err != nil || get() != 75 {
+		t.Fatalf("after refresh: got %d, %v", get(), err)
+	}
+
+	// A failed reload keeps the current overrides.
+	fail.Store(true)
+	if err := c.Refresh(context.Background()); err == nil || get() != 75 {
+		t.Fatalf("failed refresh: got %d, %v", get(), err)
+	}
+}
+
+func TestCachedPolicyProvider_ReloadsAfterTTL(t *testing.T) {
+	var loads atomic.Int32
+	c := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		loads.Add(1)
+		return nil, nil
+	}, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	c.LookupPolicy("x")
+	deadline := time.Now().Add(time.Second)
+	for loads.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if loads.Load() != 2 {
+		t.Fatalf("expected a background reload, got %d loads", loads.Load())
+	}
+}
+
+func TestMiddleware_PolicyProviders(t *testing.T) {
+	initTestConfig()
+	fileLimit, dbLimit, burst := 7, 9, 3
+	file := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		return map[string]PolicyOverride{"api": {Limit: &fileLimit, Burst: &burst}}, nil
+	}, time.Hour)
+	table := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		return map[string]PolicyOverride{"api": {Limit: &dbLimit}}, nil
+	}, time.Hour)
+
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	var none *CachedPolicyProvider
+	h := NewLimiter(store, p, KeyByIP(), WithPolicyProvider(file), WithPolicyProvider(table), WithPolicyProvider(none)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	calls := store.Calls()
+	if len(calls) != 1 || calls[0].Policy.Limit != 9 || calls[0].Policy.Burst != 3 {
+		t.Fatalf("got %+v", calls)
+	}
+}
@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// Route-pattern and per-method policies
+// ──────────────────────────────────────────────
+
+// PolicySet maps route patterns to policies, so one Limiter can serve many
+// route families instead of wiring a Limiter per route group. Rules are
+// tried in the order they were added and the first match wins, so add
+// specific patterns before broad ones. Requests no rule matches use the
+// limiter's own policy.
+//
+// A pattern is an optional method list followed by a path:
+//
+//	"/healthz"              any method, exact path
+//	"GET /api/users/*"      "*" matches exactly one path segment
+//	"POST,PUT /api/**"      a final "**" matches any remaining segments, or none
+//
+// GET also matches HEAD, as in http.ServeMux. Empty segments are ignored,
+// so "/api/users/" and "/api/users" are the same path.
+type PolicySet struct {
+	rules []policyRule
+}
+
+type policyRule struct {
+	pattern  string
+	methods  []string // nil matches any method
+	segments []string
+	policy   Policy
+}
+
+// NewPolicySet creates an empty policy set.
+func NewPolicySet() *PolicySet {
+	return &PolicySet{}
+}
+
+// Add appends a rule charging requests matching pattern against policy.
+// Each rule gets its own buckets, named after policy.Scope, or the pattern
+// when Scope is empty; rules sharing a Scope share a budget. A policy with
+// Enabled unset exempts its routes from limiting.
+func (s *PolicySet) Add(pattern string, policy Policy) error {
+	rule, err := parsePolicyPattern(pattern)
+	if err != nil {
+		return err
+	}
+	rule.policy = policy
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// Match returns the policy of the first rule matching method and path.
+func (s *PolicySet) Match(method, path string) (Policy, bool) {
+	if i := s.match(method, path); i >= 0 {
+		return s.rules[i].policy, true
+	}
+	return Policy{}, false
+}
+
+// match returns the index of the first rule matching method and path, or -1.
+func (s *PolicySet) match(method, path string) int {
+	segments := pathSegments(path)
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.matchMethod(method) && matchSegments(rule.segments, segments) {
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePolicyPattern(pattern string) (policyRule, error) {
+	rule := policyRule{pattern: pattern}
+	path := strings.TrimSpace(pattern)
+	if methods, rest, ok := strings.Cut(path, " "); ok {
+		for _, m := range strings.Split(methods, ",") {
+			m = strings.ToUpper(strings.TrimSpace(m))
+			if m == "" {
+				return policyRule{}, fmt.Errorf("policy pattern %q: empty method", pattern)
+			}
+			if m == "*" {
+				rule.methods = nil
+				break
+			}
+			rule.methods = append(rule.methods, m)
+		}
+		path = strings.TrimSpace(rest)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return policyRule{}, fmt.Errorf("policy pattern %q: path must start with /", pattern)
+	}
+	rule.segments = pathSegments(path)
+	for i, seg := range rule.segments {
+		if seg == "**" && i != len(rule.segments)-1 {
+			return policyRule{}, fmt.Errorf("policy pattern %q: ** must be the last segment", pattern)
+		}
+	}
+	return rule, nil
+}
+
+func (rule *policyRule) matchMethod(method string) bool {
+	if rule.methods == nil {
+		return true
+	}
+	for _, m := range rule.methods {
+		if m == method || (m == http.MethodGet && method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathSegments(path string) []string {
+	var out []string
+	for _, seg := range strings.Split(path, "/") {
+		if seg != "" {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+func matchSegments(pattern, path []string) bool {
+	for i, seg := range pattern {
+		if seg == "**" {
+			return true
+		}
+		if i >= len(path) || (seg != "*" && seg != path[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(path)
+}
+
+// bucketName is the prefix of a rule's bucket keys.
+func (rule *policyRule) bucketName() string {
+	if rule.policy.Scope != "" {
+		return rule.policy.Scope
+	}
+	return rule.pattern
+}
+
+// ──────────────────────────────────────────────
+// Limiter integration
+// ──────────────────────────────────────────────
+
+// WithPolicySet selects each request's policy from set. Every rule is
+// enforced with the limiter's key function and options; requests matching
+// no rule use the limiter's policy and buckets. Add all rules before
+// calling Middleware.
+func WithPolicySet(set *PolicySet) Option {
+	return func(l *Limiter) { l.policySet = set }
+}
+
+// WithMethodPolicies charges requests by HTTP method, e.g. reads 300/min
+// and writes 30/min on the same routes. Keys are comma-separated method
+// lists ("GET", "POST,PUT,DELETE"); GET also covers HEAD. Each entry has
+// its own buckets, named after its Scope or the method list, so a client's
+// reads never spend its write budget; each request is charged once.
+// Methods not listed use the limiter's policy, and WithPolicySet rules
+// take precedence. Invalid method lists are logged and ignored.
+func WithMethodPolicies(policies map[string]Policy) Option {
+	return func(l *Limiter) {
+		methods := make([]string, 0, len(policies))
+		for m := range policies {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		l.methodRules = nil
+		for _, m := range methods {
+			list := strings.ReplaceAll(m, " ", "")
+			rule, err := parsePolicyPattern(list + " /**")
+			if err != nil || list == "" {
+				log.Printf("[ratelimit] ignoring method policy %q: invalid method list", m)
+				continue
+			}
+			rule.pattern = list
+			rule.policy = policies[m]
+			l.methodRules = append(l.methodRules, rule)
+		}
+	}
+}
+
+// policySetMiddleware dispatches each request to a copy of l carrying the
+// policy and bucket prefix of the rule it matches: route rules first, then
+// method rules.
+func (l *Limiter) policySetMiddleware(next http.Handler) http.Handler {
+	set := &PolicySet{}
+	if l.policySet != nil {
+		set.rules = append(set.rules, l.policySet.rules...)
+	}
+	set.rules = append(set.rules, l.methodRules...)
+	base := *l
+	base.policySet, base.methodRules = nil, nil
+	fallback := base.handler(next)
+	handlers := make([]http.Handler, len(set.rules))
+	for i := range set.rules {
+		rl := base
+		rl.policy = set.rules[i].policy
+		rl.bucketPrefix = set.rules[i].bucketName() + ":"
+		handlers[i] = rl.handler(next)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if i := set.match(r.Method, r.URL.Path); i >= 0 {
+			handlers[i].ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
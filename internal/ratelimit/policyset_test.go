@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicySet_Match(t *testing.T) {
+	set := NewPolicySet()
+	for _, rule := range []struct {
+		pattern string
+		scope   string
+	}{
+		{"/healthz", "health"},
+		{"GET /api/users/*", "users_read"},
+		{"POST,PUT /api/**", "api_write"},
+		{"/api/**", "api"},
+	} {
+		if err := set.Add(rule.pattern, Policy{Scope: rule.scope}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		method, path, want string
+	}{
+		{"GET", "/healthz", "health"},
+		{"POST", "/healthz/", "health"},
+		{"GET", "/api/users/42", "users_read"},
+		{"HEAD", "/api/users/42", "users_read"},
+		{"GET", "/api/users/42/posts", "api"},
+		{"PUT", "/api/users/42", "api_write"},
+		{"DELETE", "/api/users/42", "api"},
+		{"GET", "/api", "api"},
+		{"GET", "/apix", ""},
+		{"GET", "/", ""},
+	}
+	for _, c := range cases {
+		p, ok := set.Match(c.method, c.path)
+		if got := p.Scope; got != c.want || ok != (c.want != "") {
+			t.Errorf("%s %s: got %q (%v), want %q", c.method, c.path, got, ok, c.want)
+		}
+	}
+}
+
+func TestPolicySet_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"", "api/users", "GET api", ", /x", "/a/**/b"} {
+		if err := NewPolicySet().Add(pattern, Policy{}); err == nil {
+			t.Errorf("%q: expected an error", pattern)
+		}
+	}
+}
+
+func TestMiddleware_PolicySet(t *testing.T) {
+	initTestConfig()
+	set := NewPolicySet()
+	set.Add("POST /api/login", Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"})
+	set.Add("/static/**", Policy{Scope: "static"}) // disabled: exempt
+	set.Add("GET /api/exports/*", Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1})
+
+	store := NewMockStore()
+	def := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	h := NewLimiter(store, def, KeyByIP(), WithPolicySet(set)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPost, "/api/login"},
+		{http.MethodGet, "/static/app.js"},
+		{http.MethodGet, "/api/exports/7"},
+		{http.MethodGet, "/api/login"},
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(req.method, req.path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s: got %d", req.method, req.path, rr.Code)
+		}
+	}
+
+	calls := store.Calls()
+	want := []struct {
+		key   string
+		limit int
+	}{
+		{"login:ip:192.0.2.1", 5},
+		{"GET /api/exports/*:ip:192.0.2.1", 10},
+		{"ip:192.0.2.1", 100},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %+v", calls)
+	}
+	for i, w := range want {
+		if calls[i].Key != w.key || calls[i].Policy.Limit != w.limit {
+			t.Errorf("call %d: got key=%q limit=%d, want key=%q limit=%d", i, calls[i].Key, calls[i].Policy.Limit, w.key, w.limit)
+		}
+	}
+}
+
+func TestMiddleware_MethodPolicies(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	def := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	reads := Policy{Limit: 300, Window: time.Minute, Enabled: true, Cost: 1, Scope: "reads"}
+	writes := Policy{Limit: 30, Window: time.Minute, Enabled: true, Cost: 1}
+	routes := NewPolicySet()
+	routes.Add("POST /api/login", Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "login"})
+	h := NewLimiter(store, def, KeyByIP(),
+		WithMethodPolicies(map[string]Policy{"GET": reads, "POST, PUT,DELETE": writes, "bad method": reads}),
+		WithPolicySet(routes),
+	).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodOptions} {
+		path := "/api/items/1"
+		if method == http.MethodPost {
+			path = "/api/login"
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+	}
+
+	var keys []string
+	for _, c := range store.Calls() {
+		keys = append(keys, c.Key)
+	}
+	want := []string{
+		"reads:ip:192.0.2.1",
+		"reads:ip:192.0.2.1",
+		"POST,PUT,DELETE:ip:192.0.2.1",
+		"login:ip:192.0.2.1",
+		"ip:192.0.2.1",
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("got %q", keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("got %q, want %q", keys, want)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Published proxy IP ranges (Cloudflare, Fastly, AWS)
+// ──────────────────────────────────────────────
+
+// proxyRangesMaxBody caps a downloaded range list; AWS's is the largest.
+const proxyRangesMaxBody = 16 << 20
+
+// ProxyRangeSource is a published list of proxy IP ranges.
+type ProxyRangeSource struct {
+	Name  string
+	URL   string
+	Parse func(body []byte) ([]string, error)
+}
+
+// CloudflareSource returns Cloudflare's edge ranges, from its IPs API.
+func CloudflareSource() ProxyRangeSource {
+	return ProxyRangeSource{
+		Name: "cloudflare",
+		URL:  "https://api.cloudflare.com/client/v4/ips",
+		Parse: func(body []byte) ([]string, error) {
+			var doc struct {
+				Result struct {
+					IPv4 []string `json:"ipv4_cidrs"`
+					IPv6 []string `json:"ipv6_cidrs"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				return nil, err
+			}
+			return append(doc.Result.IPv4, doc.Result.IPv6...), nil
+		},
+	}
+}
+
+// FastlySource returns Fastly's edge ranges, from its public IP list.
+func FastlySource() ProxyRangeSource {
+	return ProxyRangeSource{
+		Name: "fastly",
+		URL:  "https://api.fastly.com/public-ip-list",
+		Parse: func(body []byte) ([]string, error) {
+			var doc struct {
+				IPv4 []string `json:"addresses"`
+				IPv6 []string `json:"ipv6_addresses"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				return nil, err
+			}
+			return append(doc.IPv4, doc.IPv6...), nil
+		},
+	}
+}
+
+// AWSSource returns the ranges AWS publishes for service, e.g.
+// "CLOUDFRONT_ORIGIN_FACING", optionally only in the given regions.
+//
+// Do not trust "EC2" or "AMAZON": those ranges are shared by every AWS
+// customer. Load balancers reach their targets from private addresses in
+// your VPC, so list the VPC CIDR in RATE_LIMIT_TRUSTED_PROXIES instead.
+func AWSSource(service string, regions ...string) ProxyRangeSource {
+	name := "aws:" + service
+	if len(regions) > 0 {
+		name += ":" + strings.Join(regions, ":")
+	}
+	return ProxyRangeSource{
+		Name: name,
+		URL:  "https://ip-ranges.amazonaws.com/ip-ranges.json",
+		Parse: func(body []byte) ([]string, error) {
+			var doc struct {
+				IPv4 []struct {
+					Prefix  string `json:"ip_prefix"`
+					Region  string `json:"region"`
+					Service string `json:"service"`
+				} `json:"prefixes"`
+				IPv6 []struct {
+					Prefix  string `json:"ipv6_prefix"`
+					Region  string `json:"region"`
+					Service string `json:"service"`
+				} `json:"ipv6_prefixes"`
+			}
+			if err := json.Unmarshal(body, &doc); err != nil {
+				return nil, err
+			}
+			match := func(svc, region string) bool {
+				if !strings.EqualFold(svc, service) {
+					return false
+				}
+				if len(regions) == 0 {
+					return true
+				}
+				for _, r := range regions {
+					if strings.EqualFold(r, region) {
+						return true
+					}
+				}
+				return false
+			}
+			var out []string
+			for _, p := range doc.IPv4 {
+				if match(p.Service, p.Region) {
+					out = append(out, p.Prefix)
+				}
+			}
+			for _, p := range doc.IPv6 {
+				if match(p.Service, p.Region) {
+					out = append(out, p.Prefix)
+				}
+			}
+			return out, nil
+		},
+	}
+}
+
+// ParseProxyRangeSources resolves RATE_LIMIT_PROXY_RANGES names:
+// "cloudflare", "fastly" and "aws:<service>[:<region>...]".
+func ParseProxyRangeSources(names []string) ([]ProxyRangeSource, error) {
+	var sources []ProxyRangeSource
+	for _, name := range names {
+		parts := strings.Split(strings.TrimSpace(name), ":")
+		switch {
+		case parts[0] == "cloudflare" && len(parts) == 1:
+			sources = append(sources, CloudflareSource())
+		case parts[0] == "fastly" && len(parts) == 1:
+			sources = append(sources, FastlySource())
+		case parts[0] == "aws" && len(parts) >= 2 && parts[1] != "":
+			sources = append(sources, AWSSource(parts[1], parts[2:]...))
+		default:
+			return nil, fmt.Errorf("unknown proxy range source %q", name)
+		}
+	}
+	return sources, nil
+}
+
+// ProxyRangeUpdater keeps published proxy ranges trusted next to
+// RATE_LIMIT_TRUSTED_PROXIES, refetching them every interval. A source that
+// fails to download or parse, or returns no valid ranges, keeps its last
+// good list, so a provider outage never drops trust. Lists are cached in a
+// file, when one is set, so a restart during an outage still starts with
+// them. Run one updater per process: each replaces the fetched ranges.
+type ProxyRangeUpdater struct {
+	sources   []ProxyRangeSource
+	interval  time.Duration
+	cachePath string
+	client    *http.Client
+
+	mu     sync.Mutex
+	ranges map[string][]string // by source name
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewProxyRangeUpdater creates an updater for sources. interval defaults to
+// a day; cachePath may be empty to disable the cache file.
+func NewProxyRangeUpdater(sources []ProxyRangeSource, interval time.Duration, cachePath string) *ProxyRangeUpdater {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &ProxyRangeUpdater{
+		sources:   sources,
+		interval:  interval,
+		cachePath: cachePath,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		ranges:    make(map[string][]string),
+		stop:      make(chan struct{}),
+	}
+}
+
+// NewProxyRangeUpdaterFromConfig creates an updater from the
+// RATE_LIMIT_PROXY_RANGES* settings, or returns nil when none are set.
+func NewProxyRangeUpdaterFromConfig() (*ProxyRangeUpdater, error) {
+	cfg := config.RateLimit
+	if len(cfg.ProxyRanges) == 0 {
+		return nil, nil
+	}
+	sources, err := ParseProxyRangeSources(cfg.ProxyRanges)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(cfg.ProxyRangesRefresh) * time.Second
+	return NewProxyRangeUpdater(sources, interval, cfg.ProxyRangesCache), nil
+}
+
+// Start loads the cache file, fetches the lists once if there was no
+// cache, and refreshes them in the background until Close.
+func (u *ProxyRangeUpdater) Start() {
+	if err := u.loadCache(); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[ratelimit] proxy range cache unreadable: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), u.client.Timeout)
+		u.Refresh(ctx)
+		cancel()
+	}
+	u.done = make(chan struct{})
+	go u.loop()
+}
+
+// Close stops background refreshes.
+func (u *ProxyRangeUpdater) Close() error {
+	u.stopOnce.Do(func() { close(u.stop) })
+	if u.done != nil {
+		<-u.done
+	}
+	return nil
+}
+
+func (u *ProxyRangeUpdater) loop() {
+	defer close(u.done)
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), u.client.Timeout)
+			u.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Refresh fetches every source now and publishes the result. Sources that
+// fail keep their previous ranges; the returned error joins their errors.
+func (u *ProxyRangeUpdater) Refresh(ctx context.Context) error {
+	var failed []string
+	for _, src := range u.sources {
+		ranges, err := u.fetch(ctx, src)
+		if err != nil {
+			log.Printf("[ratelimit] proxy ranges %s: %v (keeping %d cached ranges)", src.Name, err, len(u.sourceRanges(src.Name)))
+			failed = append(failed, src.Name+": "+err.Error())
+			continue
+		}
+		u.mu.Lock()
+		u.ranges[src.Name] = ranges
+		u.mu.Unlock()
+	}
+	u.publish()
+	if err := u.saveCache(); err != nil {
+		log.Printf("[ratelimit] proxy range cache not written: %v", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("proxy ranges: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Ranges returns every range currently trusted by the updater, sorted.
+func (u *ProxyRangeUpdater) Ranges() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var all []string
+	for _, r := range u.ranges {
+		all = append(all, r...)
+	}
+	sort.Strings(all)
+	return all
+}
+
+func (u *ProxyRangeUpdater) sourceRanges(name string) []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ranges[name]
+}
+
+func (u *ProxyRangeUpdater) fetch(ctx context.Context, src ProxyRangeSource) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, proxyRangesMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := src.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []string
+	for _, r := range raw {
+		if p, err := netip.ParsePrefix(strings.TrimSpace(r)); err == nil {
+			ranges = append(ranges, p.Masked().String())
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no valid ranges in response")
+	}
+	return ranges, nil
+}
+
+func (u *ProxyRangeUpdater) publish() {
+	all := u.Ranges()
+	setFetchedProxies(all)
+	log.Printf("[ratelimit] trusting %d published proxy ranges", len(all))
+}
+
+// loadCache publishes the ranges of the configured sources found in the
+// cache file.
+func (u *ProxyRangeUpdater) loadCache() error {
+	if u.cachePath == "" {
+		return os.ErrNotExist
+	}
+	data, err := os.ReadFile(u.cachePath)
+	if err != nil {
+		return err
+	}
+	var cached map[string][]string
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	for _, src := range u.sources {
+		if r := cached[src.Name]; len(r) > 0 {
+			u.ranges[src.Name] = r
+		}
+	}
+	n := len(u.ranges)
+	u.mu.Unlock()
+	if n == 0 {
+		return os.ErrNotExist
+	}
+	u.publish()
+	return nil
+}
+
+// saveCache writes the ranges to the cache file through a temporary file,
+// so a crash never leaves a truncated cache behind.
+func (u *ProxyRangeUpdater) saveCache() error {
+	if u.cachePath == "" {
+		return nil
+	}
+	u.mu.Lock()
+	data, err := json.Marshal(u.ranges)
+	u.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(u.cachePath), filepath.Base(u.cachePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), u.cachePath)
+}
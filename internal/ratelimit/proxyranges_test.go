@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestProxyRangeUpdater(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	defer setFetchedProxies(nil)
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+
+	var failing atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result":{"ipv4_cidrs":["173.245.48.0/20","bogus"],"ipv6_cidrs":["2400:cb00::/32"]}}`))
+	}))
+	defer ts.Close()
+
+	src := CloudflareSource()
+	src.URL = ts.URL
+	cache := filepath.Join(t.TempDir(), "ranges.json")
+	u := NewProxyRangeUpdater([]ProxyRangeSource{src}, time.Hour, cache)
+	if err := u.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "173.245.48.9:443"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("fetched range should be trusted, got %s", ip)
+	}
+	r.RemoteAddr = "10.1.1.1:443"
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("static range should still be trusted, got %s", ip)
+	}
+
+	// A failed refresh keeps the last good list.
+	failing.Store(true)
+	if err := u.Refresh(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := u.Ranges(); len(got) != 2 {
+		t.Fatalf("expected the previous ranges, got %v", got)
+	}
+
+	// A new process starts from the cache while the source is down.
+	setFetchedProxies(nil)
+	restarted := NewProxyRangeUpdater([]ProxyRangeSource{src}, time.Hour, cache)
+	restarted.Start()
+	defer restarted.Close()
+	r.RemoteAddr = "173.245.48.9:443"
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("cached range should be trusted, got %s", ip)
+	}
+}
+
+func TestAWSSource(t *testing.T) {
+	body := []byte(`{"prefixes":[
+		{"ip_prefix":"3.0.0.0/15","region":"us-east-1","service":"CLOUDFRONT_ORIGIN_FACING"},
+		{"ip_prefix":"3.2.0.0/15","region":"eu-west-1","service":"CLOUDFRONT_ORIGIN_FACING"},
+		{"ip_prefix":"3.4.0.0/15","region":"us-east-1","service":"EC2"}],
+		"ipv6_prefixes":[{"ipv6_prefix":"2600:9000::/28","region":"us-east-1","service":"CLOUDFRONT_ORIGIN_FACING"}]}`)
+	got, err := AWSSource("CLOUDFRONT_ORIGIN_FACING", "us-east-1").Parse(body)
+	if err != nil || len(got) != 2 || got[0] != "3.0.0.0/15" || got[1] != "2600:9000::/28" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}
+
+func TestParseProxyRangeSources(t *testing.T) {
+	sources, err := ParseProxyRangeSources([]string{"cloudflare", "fastly", "aws:CLOUDFRONT_ORIGIN_FACING:us-east-1"})
+	if err != nil || len(sources) != 3 || sources[2].Name != "aws:CLOUDFRONT_ORIGIN_FACING:us-east-1" {
+		t.Fatalf("got %+v, %v", sources, err)
+	}
+	if _, err := ParseProxyRangeSources([]string{"akamai"}); err == nil {
+		t.Fatal("expected an error for an unknown source")
+	}
+}
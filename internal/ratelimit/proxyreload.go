@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Trusted proxy reload
+// ──────────────────────────────────────────────
+
+// TrustedProxies returns the trusted proxy list in force: the last one set
+// with SetTrustedProxies, or RATE_LIMIT_TRUSTED_PROXIES. Ranges fetched by
+// a ProxyRangeUpdater are not included.
+func TrustedProxies() []string {
+	trustedMu.Lock()
+	defer trustedMu.Unlock()
+	if runtimeProxies != nil {
+		return append([]string(nil), *runtimeProxies...)
+	}
+	if config.RateLimit == nil {
+		return nil
+	}
+	return append([]string(nil), config.RateLimit.TrustedProxies...)
+}
+
+// SetTrustedProxies replaces the trusted proxy list from the next request,
+// e.g. when the load balancer IPs change during a migration. The whole list
+// is rejected if any entry is not an IP or CIDR, so a typo cannot make
+// every request appear to come from the proxy.
+func SetTrustedProxies(entries []string) error {
+	if _, err := ParseIPSet(entries); err != nil {
+		return err
+	}
+	entries = append([]string{}, entries...)
+	trustedMu.Lock()
+	runtimeProxies = &entries
+	proxiesGen.Add(1)
+	trustedMu.Unlock()
+	log.Printf("[ratelimit] trusted proxies set: %d entries", len(entries))
+	return nil
+}
+
+// ReloadTrustedProxies reads RATE_LIMIT_TRUSTED_PROXIES again, from the
+// environment or the config file (RATE_LIMIT_CONFIG_FILE), and applies it.
+func ReloadTrustedProxies() error {
+	return SetTrustedProxies(config.ReadTrustedProxies())
+}
+
+// ReloadTrustedProxiesOnSignal reloads the trusted proxies whenever the
+// process receives one of sigs (SIGHUP when none are given), until the
+// returned stop function is called. A failed reload is logged and keeps
+// the current list.
+func ReloadTrustedProxiesOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+				if err := ReloadTrustedProxies(); err != nil {
+					log.Printf("[ratelimit] trusted proxy reload failed: %v (keeping current list)", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// TrustedProxiesHandler serves the trusted proxy list:
+//
+//	GET  /               the list in force
+//	PUT  /               replace it with a JSON array of IPs and CIDRs
+//	POST /?action=reload read it again from the environment or config file
+//
+// Mount it behind admin authentication.
+func TrustedProxiesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch {
+		case r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, TrustedProxies())
+			return
+		case r.Method == http.MethodPut:
+			var entries []string
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&entries); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be a JSON array of IPs and CIDRs"})
+				return
+			}
+			err = SetTrustedProxies(entries)
+		case r.Method == http.MethodPost && r.URL.Query().Get("action") == "reload":
+			err = ReloadTrustedProxies()
+		case r.Method == http.MethodPost:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": `action must be "reload"`})
+			return
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, TrustedProxies())
+	})
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gohst/internal/config"
+)
+
+func resetTrustedProxies() {
+	trustedMu.Lock()
+	runtimeProxies = nil
+	proxiesGen.Add(1)
+	trustedMu.Unlock()
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(resetTrustedProxies)
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	clientIP := func(peer string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = peer + ":443"
+		r.Header.Set("X-Forwarded-For", "203.0.113.7")
+		return ClientIP(r)
+	}
+
+	if ip := clientIP("172.16.0.5"); ip != "172.16.0.5" {
+		t.Fatalf("expected an untrusted peer to be the client, got %s", ip)
+	}
+	if err := SetTrustedProxies([]string{"172.16.0.0/12"}); err != nil {
+		t.Fatal(err)
+	}
+	if ip := clientIP("172.16.0.5"); ip != "203.0.113.7" {
+		t.Errorf("expected the new load balancer to be trusted, got %s", ip)
+	}
+	if ip := clientIP("10.0.0.5"); ip != "10.0.0.5" {
+		t.Errorf("expected the old range to be dropped, got %s", ip)
+	}
+
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "not-an-ip"}); err == nil {
+		t.Error("expected an invalid entry to be rejected")
+	}
+	if got := TrustedProxies(); len(got) != 1 || got[0] != "172.16.0.0/12" {
+		t.Errorf("expected a rejected list to keep the current one, got %v", got)
+	}
+}
+
+func TestTrustedProxiesHandler(t *testing.T) {
+	initTestConfig()
+	t.Cleanup(resetTrustedProxies)
+	h := TrustedProxiesHandler()
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := serve(http.MethodPut, "/", `["192.0.2.0/24"]`); rr.Code != http.StatusOK {
+		t.Fatalf("PUT: expected 200, got %d %s", rr.Code, rr.Body)
+	}
+	var got []string
+	if err := json.NewDecoder(serve(http.MethodGet, "/", "").Body).Decode(&got); err != nil || len(got) != 1 || got[0] != "192.0.2.0/24" {
+		t.Errorf("GET: got %v %v", got, err)
+	}
+	if rr := serve(http.MethodPut, "/", `["bogus"]`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid entry, got %d", rr.Code)
+	}
+	t.Setenv("RATE_LIMIT_TRUSTED_PROXIES", "198.51.100.1")
+	t.Setenv("RATE_LIMIT_CONFIG_FILE", "")
+	if rr := serve(http.MethodPost, "/?action=reload", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "198.51.100.1") {
+		t.Errorf("reload: got %d %s", rr.Code, rr.Body)
+	}
+}
@@ -11,15 +11,80 @@ import (
 // Factory helpers
 // ──────────────────────────────────────────────
 
-// NewStore creates a Store based on the current config ("memory" or "redis").
+// NewStore creates a Store based on the current config ("memory", "redis",
+// "tiered" or "gossip"). Keys are hashed before they reach the backend when
+// RATE_LIMIT_ANONYMIZE is set. Shared stores are wrapped in a BudgetStore when
+// RATE_LIMIT_LATENCY_BUDGET_MS is set, and in a DenyCacheStore when
+// RATE_LIMIT_DENY_CACHE_MIN_RETRY is set.
 func NewStore() Store {
-	switch config.RateLimit.Store {
+	cfg := config.RateLimit
+	store := newBaseStore(cfg.Store, cfg.RedisPrefix)
+	if cfg.Fallback && cfg.Store == "redis" {
+		retry := time.Duration(cfg.FallbackRetry) * time.Second
+		log.Printf("[ratelimit] falling back to per-instance limiting on Redis errors (retry every %s)", retry)
+		store = NewFallbackStore(store, retry)
+	}
+	if from := cfg.MigrateFrom; from != "" {
+		ms := NewMigrationStore(newBaseStore(from, cfg.MigrateFromPrefix), store)
+		ms.ReadOld(cfg.MigrateRead == "old")
+		log.Printf("[ratelimit] migrating from %s store: writing both, reading %s", from, cfg.MigrateRead)
+		store = ms
+	}
+	if anon := configAnonymizer(); anon != nil {
+		log.Printf("[ratelimit] anonymizing keys (salt rotates every %ds)", cfg.AnonymizeRotate)
+		store = NewAnonymizingStore(store, anon)
+	}
+	if ms := cfg.LatencyBudgetMs; ms > 0 && cfg.Store != "memory" {
+		budget := time.Duration(ms) * time.Millisecond
+		sustain := time.Duration(cfg.LatencyBudgetSustain) * time.Second
+		log.Printf("[ratelimit] latency budget %s (sustained %s, then %s mode)", budget, sustain, cfg.LatencyBudgetMode)
+		store = NewBudgetStore(store, budget, sustain, BudgetMode(cfg.LatencyBudgetMode), nil)
+	}
+	if minRetry := config.RateLimit.DenyCacheMinRetry; minRetry > 0 && config.RateLimit.Store != "memory" {
+		ttl := time.Duration(config.RateLimit.DenyCacheTTL) * time.Second
+		log.Printf("[ratelimit] caching deny decisions (retryAfter >= %ds, ttl <= %s)", minRetry, ttl)
+		store = NewDenyCacheStore(store, minRetry, ttl)
+	}
+	if overrides := NewKeyOverridesFromConfig(); overrides != nil {
+		store = NewKeyOverrideStore(store, overrides)
+	}
+	return store
+}
+
+// newBaseStore creates a backend of the given kind without decorators.
+// prefix is the Redis key prefix for Redis-backed kinds.
+func newBaseStore(kind, prefix string) Store {
+	switch kind {
 	case "redis":
 		log.Println("[ratelimit] using Redis store")
-		return NewRedisStore()
+		return NewRedisStoreWithPrefix(prefix)
+	case "tiered":
+		interval := time.Duration(config.RateLimit.TieredSyncMs) * time.Millisecond
+		log.Printf("[ratelimit] using tiered store (local + Redis, sync every %s)", interval)
+		return NewTieredStore(NewRedisStoreWithPrefix(prefix), interval, WithTieredMaxKeys(config.RateLimit.MemoryMaxKeys))
+	case "gossip":
+		cfg := config.RateLimit
+		local := NewMemoryStore(2*time.Minute, WithMaxKeys(cfg.MemoryMaxKeys))
+		interval := time.Duration(cfg.GossipIntervalMs) * time.Millisecond
+		gs, err := NewGossipStore(local, cfg.GossipBind, cfg.GossipPeers, interval, []byte(cfg.GossipSecret))
+		if err != nil {
+			log.Printf("[ratelimit] gossip store unavailable, using in-memory store: %v", err)
+			return local
+		}
+		if cfg.GossipSecret == "" {
+			log.Println("[ratelimit] warning: RATE_LIMIT_GOSSIP_SECRET is empty; gossip packets are unauthenticated")
+		}
+		log.Printf("[ratelimit] using gossip store on %s (%d peers)", gs.Addr(), len(cfg.GossipPeers))
+		return gs
 	default:
 		log.Println("[ratelimit] using in-memory store")
-		return NewMemoryStore(2 * time.Minute)
+		opts := []MemoryOption{WithMaxKeys(config.RateLimit.MemoryMaxKeys)}
+		if path := config.RateLimit.MemorySnapshotPath; path != "" {
+			interval := time.Duration(config.RateLimit.MemorySnapshotInterval) * time.Second
+			log.Printf("[ratelimit] memory snapshots enabled (%s every %s)", path, interval)
+			opts = append(opts, WithSnapshot(path, interval))
+		}
+		return NewMemoryStore(2*time.Minute, opts...)
 	}
 }
 
@@ -32,6 +97,31 @@ func NewLogStoreFromConfig() LogStore {
 	return NopLogStore{}
 }
 
+// NewPenaltyBoxFromConfig creates a PenaltyBox on list from the
+// RATE_LIMIT_PENALTY_* settings. A nil list keeps bans per instance.
+func NewPenaltyBoxFromConfig(list BanList) *PenaltyBox {
+	cfg := config.RateLimit
+	if list == nil {
+		list = NewMemoryBanList()
+	}
+	return NewPenaltyBoxWithList(list,
+		cfg.PenaltyStrikes,
+		time.Duration(cfg.PenaltyWindow)*time.Second,
+		time.Duration(cfg.PenaltyBan)*time.Second,
+	)
+}
+
+// NewSlowGuardFromConfig creates a SlowGuard keyed by keyFunc using the
+// RATE_LIMIT_SLOW_* timeouts. Pass the same box to your limiters so slow
+// offenders are banned everywhere.
+func NewSlowGuardFromConfig(keyFunc KeyFunc, box *PenaltyBox) *SlowGuard {
+	cfg := config.RateLimit
+	return NewSlowGuard(keyFunc, box,
+		time.Duration(cfg.SlowHeaderTimeout)*time.Second,
+		time.Duration(cfg.SlowBodyTimeout)*time.Second,
+	)
+}
+
 // ──────────────────────────────────────────────
 // Convenience constructors – create a ready-to-use Limiter for common cases.
 // ──────────────────────────────────────────────
@@ -54,9 +144,11 @@ func NewAPIDefaultLimiter(store Store, opts ...Option) *Limiter {
 // NewAuthSensitiveLimiter creates a tight limiter for login/reset endpoints.
 // `identifierField` is the form field name (e.g. "email") used to build
 // composite keys so that brute-force attacks on a specific account are
-// limited even if the attacker rotates IPs slightly.
+// limited even if the attacker rotates IPs slightly. Email aliases are folded
+// with NormalizeEmail, so "+tag" and Gmail dot variants share one bucket.
 func NewAuthSensitiveLimiter(store Store, identifierField string, opts ...Option) *Limiter {
-	return NewLimiter(store, AuthSensitivePolicy(), KeyByIPAndIdentifier(identifierField), opts...)
+	keyFunc := KeyByIPAndIdentifier(identifierField, WithIdentifierNormalizer(NormalizeEmail))
+	return NewLimiter(store, AuthSensitivePolicy(), keyFunc, opts...)
 }
 
 // NewExportsLimiter creates a very tight limiter with concurrency cap.
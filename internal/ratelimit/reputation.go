@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// IP reputation / denylist feeds
+// ──────────────────────────────────────────────
+
+// reputationMaxBody caps a downloaded feed.
+const reputationMaxBody = 32 << 20
+
+// ReputationInfo is the verdict of a ReputationProvider.
+type ReputationInfo struct {
+	Listed bool
+	List   string // name of the list that matched, for logs
+}
+
+// ReputationProvider reports whether an IP address is known-bad. Lookups
+// run on every request and must be fast and safe for concurrent use.
+type ReputationProvider interface {
+	LookupReputation(ip net.IP) (ReputationInfo, error)
+}
+
+// ReputationProviderFunc adapts a function to ReputationProvider.
+type ReputationProviderFunc func(ip net.IP) (ReputationInfo, error)
+
+// LookupReputation implements ReputationProvider.
+func (f ReputationProviderFunc) LookupReputation(ip net.IP) (ReputationInfo, error) { return f(ip) }
+
+// AnyReputation lists an IP when any of providers does; the first match
+// is reported.
+func AnyReputation(providers ...ReputationProvider) ReputationProvider {
+	return ReputationProviderFunc(func(ip net.IP) (ReputationInfo, error) {
+		for _, p := range providers {
+			if info, err := p.LookupReputation(ip); err == nil && info.Listed {
+				return info, nil
+			}
+		}
+		return ReputationInfo{}, nil
+	})
+}
+
+// ClientReputation looks up r's client IP (see ClientIP) with provider.
+// Lookup errors count as not listed.
+func ClientReputation(r *http.Request, provider ReputationProvider) (ReputationInfo, bool) {
+	ip := net.ParseIP(ClientIP(r))
+	if ip == nil {
+		return ReputationInfo{}, false
+	}
+	info, err := provider.LookupReputation(ip)
+	if err != nil || !info.Listed {
+		return ReputationInfo{}, false
+	}
+	return info, true
+}
+
+// ReputationList is a named denylist of IPs and CIDRs. Its contents can be
+// replaced at any time, e.g. by a ReputationFeed, without blocking lookups.
+type ReputationList struct {
+	name string
+	set  atomic.Pointer[IPSet]
+}
+
+// NewReputationList creates a list holding entries (IPs or CIDRs).
+func NewReputationList(name string, entries []string) (*ReputationList, error) {
+	set, err := ParseIPSet(entries)
+	if err != nil {
+		return nil, err
+	}
+	l := &ReputationList{name: name}
+	l.set.Store(set)
+	return l, nil
+}
+
+// LoadReputationFile creates a list from a file with one IP or CIDR per
+// line. Text after "#" or ";" is a comment, as is anything after the
+// first field, so Spamhaus DROP and FireHOL netsets load as-is. Invalid
+// lines are skipped.
+func LoadReputationFile(name, path string) (*ReputationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &ReputationList{name: name}
+	if n := l.load(data); n == 0 {
+		return nil, fmt.Errorf("%s: no valid entries", path)
+	}
+	return l, nil
+}
+
+// Name returns the list's name.
+func (l *ReputationList) Name() string { return l.name }
+
+// Replace swaps in a new set of entries.
+func (l *ReputationList) Replace(set *IPSet) { l.set.Store(set) }
+
+// LookupReputation implements ReputationProvider.
+func (l *ReputationList) LookupReputation(ip net.IP) (ReputationInfo, error) {
+	if l.set.Load().Contains(ip.String()) {
+		return ReputationInfo{Listed: true, List: l.name}, nil
+	}
+	return ReputationInfo{}, nil
+}
+
+// load replaces the list with the valid entries of a feed body and
+// returns their number. An empty result leaves the list unchanged.
+func (l *ReputationList) load(data []byte) int {
+	entries := parseIPList(data)
+	if len(entries) == 0 {
+		return 0
+	}
+	set, _ := parseIPSetLenient(entries)
+	l.set.Store(set)
+	return len(entries)
+}
+
+// parseIPList returns the first field of every non-comment line.
+func parseIPList(data []byte) []string {
+	var entries []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			if _, errs := parseIPSetLenient(fields[:1]); len(errs) == 0 {
+				entries = append(entries, fields[0])
+			}
+		}
+	}
+	return entries
+}
+
+// ReputationFeed keeps a ReputationList in sync with a published feed,
+// reloading it every interval. source is an http(s) URL or a file path.
+// A reload that fails, or yields no valid entries, keeps the current
+// contents, so an outage of the feed never empties the list.
+type ReputationFeed struct {
+	list     *ReputationList
+	source   string
+	interval time.Duration
+	client   *http.Client
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewReputationFeed creates a feed loading source into list. interval
+// defaults to an hour.
+func NewReputationFeed(list *ReputationList, source string, interval time.Duration) *ReputationFeed {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &ReputationFeed{
+		list:     list,
+		source:   source,
+		interval: interval,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start loads the feed once, then reloads it in the background until Close.
+func (f *ReputationFeed) Start() {
+	ctx, cancel := context.WithTimeout(context.Background(), f.client.Timeout)
+	f.Refresh(ctx)
+	cancel()
+	f.done = make(chan struct{})
+	go f.loop()
+}
+
+// Close stops background reloads.
+func (f *ReputationFeed) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	if f.done != nil {
+		<-f.done
+	}
+	return nil
+}
+
+func (f *ReputationFeed) loop() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), f.client.Timeout)
+			f.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Refresh reloads the feed now.
+func (f *ReputationFeed) Refresh(ctx context.Context) error {
+	data, err := f.read(ctx)
+	if err == nil && f.list.load(data) == 0 {
+		err = fmt.Errorf("no valid entries")
+	}
+	if err != nil {
+		log.Printf("[ratelimit] reputation feed %s: %v (keeping current list)", f.list.name, err)
+		return err
+	}
+	return nil
+}
+
+func (f *ReputationFeed) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(f.source, "http://") && !strings.HasPrefix(f.source, "https://") {
+		return os.ReadFile(f.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, reputationMaxBody))
+}
+
+// ──────────────────────────────────────────────
+// Limiter integration
+// ──────────────────────────────────────────────
+
+type reputationConfig struct {
+	provider ReputationProvider
+	strict   *Policy
+}
+
+// WithReputation checks every request's client IP with provider before the
+// bucket check. Listed IPs are blocked with a 403 when strict is nil;
+// otherwise they are charged against strict instead of the limiter's
+// policy, in a separate "reputation:<key>" bucket.
+func WithReputation(provider ReputationProvider, strict *Policy) Option {
+	return func(l *Limiter) { l.reputation = &reputationConfig{provider: provider, strict: strict} }
+}
+
+// checkReputation reports whether r's client is on a denylist.
+func (l *Limiter) checkReputation(r *http.Request) bool {
+	if l.reputation == nil {
+		return false
+	}
+	_, listed := ClientReputation(r, l.reputation.provider)
+	return listed
+}
+
+// blockResponse rejects a request from a denylisted client outright.
+func (l *Limiter) blockResponse(w http.ResponseWriter, r *http.Request, key, keyType string) {
+	l.logDenied(r, Result{}, key, keyType, "reputation")
+	writeErrorResponse(w, r, l.policy, http.StatusForbidden,
+		"Request blocked.",
+		"Requests from your network are not accepted.",
+		0)
+}
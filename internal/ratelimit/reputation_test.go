@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadReputationFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop.txt")
+	data := "; Spamhaus DROP List\n1.10.16.0/20 ; SBL256894\n# comment\n203.0.113.7\nnot-an-ip\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadReputationFile("drop", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"1.10.20.1": true, "203.0.113.7": true, "203.0.113.8": false} {
+		if info, _ := list.LookupReputation(net.ParseIP(ip)); info.Listed != want {
+			t.Errorf("%s: listed=%v, want %v", ip, info.Listed, want)
+		}
+	}
+}
+
+func TestReputationFeed_KeepsListOnFailure(t *testing.T) {
+	body := "198.51.100.0/24\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	list, _ := NewReputationList("feed", nil)
+	feed := NewReputationFeed(list, ts.URL, time.Hour)
+	if err := feed.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	body = "<html>maintenance</html>"
+	if err := feed.Refresh(context.Background()); err == nil {
+		t.Fatal("expected an error for a feed without entries")
+	}
+	if info, _ := list.LookupReputation(net.ParseIP("198.51.100.9")); !info.Listed || info.List != "feed" {
+		t.Fatalf("list should keep its entries, got %+v", info)
+	}
+}
+
+func TestMiddleware_Reputation(t *testing.T) {
+	initTestConfig()
+	list, _ := NewReputationList("bad", []string{"6.6.6.0/24"})
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	serve := func(h http.Handler, remote string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote + ":1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	// Block outright.
+	store := NewMockStore()
+	blocking := NewLimiter(store, p, KeyByIP(), WithReputation(list, nil)).Middleware(ok)
+	if code := serve(blocking, "6.6.6.6"); code != http.StatusForbidden {
+		t.Fatalf("listed IP: expected 403, got %d", code)
+	}
+	if code := serve(blocking, "7.7.7.7"); code != http.StatusOK {
+		t.Fatalf("other IP: expected 200, got %d", code)
+	}
+	if calls := store.Calls(); len(calls) != 1 || calls[0].Key != "ip:7.7.7.7" {
+		t.Fatalf("blocked requests should not reach the store, got %+v", calls)
+	}
+
+	// Stricter policy in its own bucket.
+	store = NewMockStore()
+	strict := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "api_reputation"}
+	throttling := NewLimiter(store, p, KeyByIP(), WithReputation(list, &strict)).Middleware(ok)
+	serve(throttling, "6.6.6.6")
+	if calls := store.Calls(); len(calls) != 1 || calls[0].Key != "reputation:ip:6.6.6.6" || calls[0].Policy.Limit != 1 {
+		t.Fatalf("got %+v", calls)
+	}
+}
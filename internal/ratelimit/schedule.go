@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Scheduled policy variants
+// ──────────────────────────────────────────────
+
+// PolicySchedule is a PolicyProvider that applies overrides on a
+// timetable: looser export limits at night, tighter ones during business
+// hours, or a strict profile for the length of a flash sale. Entries are
+// tried in the order they were added and the first active one for a scope
+// wins. Add all entries before passing the schedule to WithPolicyProvider.
+type PolicySchedule struct {
+	loc     *time.Location
+	entries []scheduleEntry
+	now     func() time.Time
+}
+
+type scheduleEntry struct {
+	scope    string
+	override PolicyOverride
+
+	// Recurring window: days (nil is every day) and minutes since midnight.
+	days       *[7]bool
+	start, end int // end <= start spans midnight; both -1 for whole days
+
+	// One-off event, when from is set.
+	from, until time.Time
+}
+
+// NewPolicySchedule creates an empty schedule evaluated in loc, or in UTC
+// when loc is nil.
+func NewPolicySchedule(loc *time.Location) *PolicySchedule {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &PolicySchedule{loc: loc, now: time.Now}
+}
+
+// Add applies o to scope during a recurring window: a day list, a time
+// range, or both, e.g. "Mon-Fri 09:00-18:00", "22:00-06:00" or "Sat,Sun".
+// A range ending before it starts runs past midnight into the next day.
+func (s *PolicySchedule) Add(scope, when string, o PolicyOverride) error {
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("schedule %q: %v", when, err)
+	}
+	e := scheduleEntry{scope: scope, override: o, start: -1, end: -1}
+	fields := strings.Fields(when)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("schedule %q: want [days] [HH:MM-HH:MM]", when)
+	}
+	for _, f := range fields {
+		var err error
+		if f[0] >= '0' && f[0] <= '9' {
+			if e.start >= 0 {
+				return fmt.Errorf("schedule %q: more than one time range", when)
+			}
+			e.start, e.end, err = parseTimeRange(f)
+		} else {
+			if e.days != nil {
+				return fmt.Errorf("schedule %q: more than one day list", when)
+			}
+			e.days, err = parseDays(f)
+		}
+		if err != nil {
+			return fmt.Errorf("schedule %q: %v", when, err)
+		}
+	}
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+// AddEvent applies o to scope from from until until, e.g. for a flash sale.
+func (s *PolicySchedule) AddEvent(scope string, from, until time.Time, o PolicyOverride) error {
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("event: %v", err)
+	}
+	if !until.After(from) {
+		return fmt.Errorf("event: ends before it starts")
+	}
+	s.entries = append(s.entries, scheduleEntry{scope: scope, override: o, from: from, until: until})
+	return nil
+}
+
+// LookupPolicy implements PolicyProvider.
+func (s *PolicySchedule) LookupPolicy(scope string) (PolicyOverride, bool) {
+	if s == nil {
+		return PolicyOverride{}, false
+	}
+	now := s.now().In(s.loc)
+	for i := range s.entries {
+		if e := &s.entries[i]; e.scope == scope && e.active(now) {
+			return e.override, true
+		}
+	}
+	return PolicyOverride{}, false
+}
+
+func (e *scheduleEntry) active(t time.Time) bool {
+	if !e.from.IsZero() {
+		return !t.Before(e.from) && t.Before(e.until)
+	}
+	day := t.Weekday()
+	if e.start < 0 {
+		return e.onDay(day)
+	}
+	m := t.Hour()*60 + t.Minute()
+	if e.start < e.end {
+		return e.onDay(day) && m >= e.start && m < e.end
+	}
+	// Overnight: the evening of a listed day, or the morning after it.
+	return (e.onDay(day) && m >= e.start) || (e.onDay((day+6)%7) && m < e.end)
+}
+
+func (e *scheduleEntry) onDay(d time.Weekday) bool {
+	return e.days == nil || e.days[d]
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseDays parses "Mon-Fri", "Sat,Sun" or "Fri-Mon" (wrapping).
+func parseDays(s string) (*[7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := weekdays[strings.ToLower(first)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[strings.ToLower(last)]; !ok {
+				return nil, fmt.Errorf("unknown day %q", last)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return &days, nil
+}
+
+// parseTimeRange parses "HH:MM-HH:MM" into minutes since midnight.
+func parseTimeRange(s string) (int, int, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("time range %q: want HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(last)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("time range %q is empty", s)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
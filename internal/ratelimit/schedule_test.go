@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicySchedule(t *testing.T) {
+	loc := time.FixedZone("test", 2*3600)
+	s := NewPolicySchedule(loc)
+	sale, business, night, weekend := 5, 20, 100, 60
+	saleStart := time.Date(2026, 11, 27, 9, 0, 0, 0, loc) // a Friday
+	if err := s.AddEvent("exports", saleStart, saleStart.Add(12*time.Hour), PolicyOverride{Limit: &sale}); err != nil {
+		t.Fatal(err)
+	}
+	for _, add := range []struct {
+		when  string
+		limit *int
+	}{
+		{"Mon-Fri 09:00-18:00", &business},
+		{"Mon-Fri 22:00-06:00", &night},
+		{"Sat,Sun", &weekend},
+	} {
+		if err := s.Add("exports", add.when, PolicyOverride{Limit: add.limit}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		at   time.Time
+		want int // 0: no override
+	}{
+		{time.Date(2026, 11, 24, 10, 0, 0, 0, loc), business},     // Tuesday morning
+		{time.Date(2026, 11, 24, 18, 0, 0, 0, loc), 0},            // end is exclusive
+		{time.Date(2026, 11, 24, 23, 30, 0, 0, loc), night},       // Tuesday night
+		{time.Date(2026, 11, 25, 5, 59, 0, 0, loc), night},        // Wednesday early morning
+		{time.Date(2026, 11, 27, 12, 0, 0, 0, loc), sale},         // flash sale wins over business hours
+		{time.Date(2026, 11, 28, 3, 0, 0, 0, loc), night},         // Friday night runs into Saturday
+		{time.Date(2026, 11, 28, 12, 0, 0, 0, loc), weekend},      // Saturday
+		{time.Date(2026, 11, 30, 3, 0, 0, 0, loc), 0},             // Sunday night is not a weekday night
+		{time.Date(2026, 11, 24, 8, 0, 0, 0, time.UTC), business}, // 10:00 in loc
+	}
+	for _, c := range cases {
+		s.now = func() time.Time { return c.at }
+		o, ok := s.LookupPolicy("exports")
+		got := 0
+		if ok {
+			got = *o.Limit
+		}
+		if got != c.want {
+			t.Errorf("%s: got %d, want %d", c.at, got, c.want)
+		}
+	}
+	if _, ok := s.LookupPolicy("other"); ok {
+		t.Error("expected no override for another scope")
+	}
+}
+
+func TestPolicySchedule_InvalidWindows(t *testing.T) {
+	s := NewPolicySchedule(nil)
+	for _, when := range []string{"", "Mon-Fry", "9-17", "09:00-09:00", "25:00-26:00", "Mon Tue", "09:00-10:00 11:00-12:00", "Mon 09:00-10:00 x"} {
+		if err := s.Add("x", when, PolicyOverride{}); err == nil {
+			t.Errorf("%q: expected an error", when)
+		}
+	}
+	now := time.Now()
+	if err := s.AddEvent("x", now, now, PolicyOverride{}); err == nil {
+		t.Error("expected an error for an empty event")
+	}
+}
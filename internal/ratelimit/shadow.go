@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Shadow (dry-run) mode
+// ──────────────────────────────────────────────
+
+// WithShadow runs the limiter in shadow mode: every request is checked and
+// charged as usual, and denials are logged and counted tagged "shadow", but
+// the request always reaches the next handler. Use it to observe a new
+// limit on production traffic before enforcing it.
+//
+// The response carries none of the limiter's headers, cookies or deny
+// bodies, and WithOnLimit is not called. The headers a denial would have
+// sent are recorded in its LogEntry instead. Shadow denials never escalate,
+// strike toward a ban or tarpit the request. RATE_LIMIT_SHADOW_SCOPES shadows
+// limiters by policy scope without a code change.
+func WithShadow() Option {
+	return func(l *Limiter) { l.shadow = true }
+}
+
+// shadowed reports whether requests under l are only observed.
+func (l *Limiter) shadowed() bool {
+	if l.shadow {
+		return true
+	}
+	return config.RateLimit != nil && l.policy.Scope != "" && slices.Contains(config.RateLimit.ShadowScopes, l.policy.Scope)
+}
+
+var shadowDenied sync.Map // scope -> *atomic.Uint64
+
+// ShadowDenials returns, per policy scope, how many requests shadowed
+// limiters would have rejected since start.
+func ShadowDenials() map[string]uint64 {
+	out := map[string]uint64{}
+	shadowDenied.Range(func(scope, n any) bool {
+		out[scope.(string)] = n.(*atomic.Uint64).Load()
+		return true
+	})
+	return out
+}
+
+func countShadowDenial(scope string) {
+	n, _ := shadowDenied.LoadOrStore(scope, new(atomic.Uint64))
+	n.(*atomic.Uint64).Add(1)
+}
+
+type shadowPassKey struct{}
+
+// shadowPass carries the real response and request of a shadowed request
+// through the enforcing handler.
+type shadowPass struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	next   http.Handler
+	served bool
+}
+
+// shadowHandler runs the enforcing handler of l against a discarded
+// response. The next handler is served with the real response, from inside
+// the enforcing handler when the request passes, so concurrency slots are
+// held as they would be, and afterwards when it was rejected.
+func (l *Limiter) shadowHandler(next http.Handler) http.Handler {
+	s := *l
+	s.shadow = true
+	enforce := s.enforce(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		pass := r.Context().Value(shadowPassKey{}).(*shadowPass)
+		pass.served = true
+		pass.next.ServeHTTP(pass.w, pass.r)
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pass := &shadowPass{w: w, r: r, next: next}
+		enforce.ServeHTTP(discardWriter{header: http.Header{}}, r.WithContext(context.WithValue(r.Context(), shadowPassKey{}, pass)))
+		if !pass.served {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// shadowDeny records a denial of a shadowed limiter, with the headers the
+// enforcing limiter would have sent. It leaves the escalation level alone,
+// so turning enforcement on does not start keys at a raised backoff.
+func (l *Limiter) shadowDeny(r *http.Request, result Result, key, keyType, reason string) {
+	w := discardWriter{header: http.Header{}}
+	l.setDenyHeaders(w, l.policy.denyStatus(reason), result, keyType)
+	l.logDenial(r, result, key, keyType, reason, w.header)
+}
+
+// discardWriter is the response of a shadowed limiter.
+type discardWriter struct {
+	header http.Header
+}
+
+func (d discardWriter) Header() http.Header         { return d.header }
+func (d discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestShadow_NeverBlocks(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	logs := &recordingLogStore{}
+	p := Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1, Scope: "shadow_new", Escalation: 3}
+	onLimit := func(http.ResponseWriter, *http.Request, Result) bool {
+		t.Error("WithOnLimit must not run in shadow mode")
+		return true
+	}
+	before := ShadowDenials()["shadow_new"]
+	handler := NewLimiter(store, p, KeyByIP(), WithShadow(), WithLogStore(logs), WithOnLimit(onLimit)).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }))
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusTeapot {
+			t.Fatalf("request %d: expected the next handler, got %d", i, rr.Code)
+		}
+		if rr.Header().Get("X-RateLimit-Limit") != "" || rr.Header().Get("Retry-After") != "" {
+			t.Errorf("request %d: expected no rate-limit headers, got %v", i, rr.Header())
+		}
+	}
+	if len(logs.entries) != 2 || !logs.entries[0].Shadow {
+		t.Fatalf("expected two shadow denials logged, got %+v", logs.entries)
+	}
+	if h := logs.entries[0].Headers; h.Get("Retry-After") == "" || h.Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("expected the entry to record the headers the denial would have sent, got %v", h)
+	}
+	if n := ShadowDenials()["shadow_new"] - before; n != 2 {
+		t.Errorf("expected 2 shadow denials counted, got %d", n)
+	}
+	escalations.mu.Lock()
+	defer escalations.mu.Unlock()
+	for bucket := range escalations.entries {
+		if strings.HasPrefix(bucket, "shadow_new|") {
+			t.Errorf("expected shadow denials not to escalate, got state for %q", bucket)
+		}
+	}
+}
+
+func TestShadow_ByScope(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.ShadowScopes = []string{"shadow_cfg"}
+	store := NewMockStore()
+	store.DenyAll(10)
+	served := false
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { served = true })
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "shadow_cfg"}
+	NewLimiter(store, p, KeyByIP()).Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !served {
+		t.Error("expected a scope in RATE_LIMIT_SHADOW_SCOPES to be shadowed")
+	}
+
+	served = false
+	p.Scope = "enforced"
+	rr := httptest.NewRecorder()
+	NewLimiter(store, p, KeyByIP()).Middleware(next).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if served || rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected other scopes to be enforced, got %d", rr.Code)
+	}
+}
+
+func TestShadow_HoldsConcurrencySlot(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	cs := NewMemoryConcurrencyStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "shadow_conc", ConcurrencyLimit: 1}
+	logs := &recordingLogStore{}
+	var handler http.Handler
+	inner := true
+	handler = NewLimiter(store, p, KeyByIP(), WithConcurrency(cs), WithShadow(), WithLogStore(logs)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			if inner {
+				inner = false
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(logs.entries) != 1 {
+		t.Errorf("expected the nested request to be a shadow concurrency denial, got %+v", logs.entries)
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"net/http"
+)
+
+// ──────────────────────────────────────────────
+// Request-size sanity limits
+// ──────────────────────────────────────────────
+
+// checkRequestSize validates r against the size limits in p. It returns the
+// HTTP status to reject with (431 or 413) and a short reason, or 0 when the
+// request is within limits.
+//
+// Requests with an unknown Content-Length (chunked) are not rejected here;
+// the middleware caps their body with http.MaxBytesReader instead.
+func checkRequestSize(r *http.Request, p Policy) (status int, reason string) {
+	if p.MaxHeaderCount > 0 || p.MaxHeaderBytes > 0 {
+		count, size := headerStats(r.Header)
+		if p.MaxHeaderCount > 0 && count > p.MaxHeaderCount {
+			return http.StatusRequestHeaderFieldsTooLarge, "header_count"
+		}
+		if p.MaxHeaderBytes > 0 && size > p.MaxHeaderBytes {
+			return http.StatusRequestHeaderFieldsTooLarge, "header_size"
+		}
+	}
+	if p.MaxBodyBytes > 0 && r.ContentLength > p.MaxBodyBytes {
+		return http.StatusRequestEntityTooLarge, "body_size"
+	}
+	return 0, ""
+}
+
+// headerStats returns the number of header lines and their approximate wire
+// size ("Name: value\r\n" per value).
+func headerStats(h http.Header) (count, size int) {
+	for name, values := range h {
+		for _, v := range values {
+			count++
+			size += len(name) + len(v) + 4
+		}
+	}
+	return count, size
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckRequestSize(t *testing.T) {
+	p := Policy{MaxHeaderCount: 3, MaxHeaderBytes: 100, MaxBodyBytes: 10}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("small"))
+	if status, _ := checkRequestSize(r, p); status != 0 {
+		t.Fatalf("expected request within limits, got %d", status)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, h := range []string{"A", "B", "C", "D"} {
+		r.Header.Set("X-"+h, "1")
+	}
+	if status, reason := checkRequestSize(r, p); status != http.StatusRequestHeaderFieldsTooLarge || reason != "header_count" {
+		t.Fatalf("expected 431 header_count, got %d %s", status, reason)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Big", strings.Repeat("x", 200))
+	if status, reason := checkRequestSize(r, p); status != http.StatusRequestHeaderFieldsTooLarge || reason != "header_size" {
+		t.Fatalf("expected 431 header_size, got %d %s", status, reason)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("this body is too long"))
+	if status, reason := checkRequestSize(r, p); status != http.StatusRequestEntityTooLarge || reason != "body_size" {
+		t.Fatalf("expected 413 body_size, got %d %s", status, reason)
+	}
+}
+
+func TestMiddleware_OversizeChargesTokens(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test",
+		MaxBodyBytes: 4, OversizeCost: 5}
+	limiter := NewLimiter(store, p, KeyByIP())
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large"))
+	req.RemoteAddr = "1.2.3.4:1234"
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rr.Code)
+	}
+
+	res := store.Allow(context.Background(), "ip:1.2.3.4", p, 1)
+	if res.Remaining != 4 {
+		t.Fatalf("oversize request should have cost 5 tokens, remaining %d", res.Remaining)
+	}
+}
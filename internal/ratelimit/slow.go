@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Slowloris / slow-body protection
+// ──────────────────────────────────────────────
+
+// SlowGuard enforces read timeouts on request headers and bodies and strikes
+// the offending key in a PenaltyBox each time a client holds a connection
+// open too slowly. Repeat offenders are then banned by any Limiter sharing
+// the same box.
+//
+// Body timeouts are keyed with the guard's KeyFunc. Header timeouts fire
+// before a request exists, so they are keyed by peer IP ("ip:<addr>", the
+// same format as KeyByIP).
+type SlowGuard struct {
+	keyFunc       KeyFunc
+	box           *PenaltyBox
+	bodyTimeout   time.Duration
+	headerTimeout time.Duration
+	conns         sync.Map // net.Conn -> *connTrack
+}
+
+// connTrack follows a connection through its lifecycle so a header timeout
+// can be told apart from a normal close.
+type connTrack struct {
+	mu         sync.Mutex
+	state      http.ConnState
+	readSince  time.Time // when the server began waiting for the next request
+	dispatched bool      // a handler ran for the current request
+}
+
+type connTrackKey struct{}
+
+// NewSlowGuard creates a SlowGuard. A zero timeout disables that check.
+func NewSlowGuard(keyFunc KeyFunc, box *PenaltyBox, headerTimeout, bodyTimeout time.Duration) *SlowGuard {
+	return &SlowGuard{
+		keyFunc:       keyFunc,
+		box:           box,
+		headerTimeout: headerTimeout,
+		bodyTimeout:   bodyTimeout,
+	}
+}
+
+// ConfigureServer sets the server's ReadHeaderTimeout and installs
+// connection hooks that strike peers whose headers never arrive in time.
+// Existing ConnState / ConnContext hooks are preserved.
+func (g *SlowGuard) ConfigureServer(srv *http.Server) {
+	if g.headerTimeout <= 0 {
+		return
+	}
+	srv.ReadHeaderTimeout = g.headerTimeout
+
+	prevCtx := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if prevCtx != nil {
+			ctx = prevCtx(ctx, c)
+		}
+		tr := &connTrack{state: http.StateNew, readSince: time.Now()}
+		g.conns.Store(c, tr)
+		return context.WithValue(ctx, connTrackKey{}, tr)
+	}
+
+	prevState := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		g.trackState(c, state)
+		if prevState != nil {
+			prevState(c, state)
+		}
+	}
+}
+
+// trackState updates the connection record and strikes the peer when a
+// connection closes mid-headers after the header timeout.
+func (g *SlowGuard) trackState(c net.Conn, state http.ConnState) {
+	v, ok := g.conns.Load(c)
+	if !ok {
+		return
+	}
+	tr := v.(*connTrack)
+
+	tr.mu.Lock()
+	prev := tr.state
+	tr.state = state
+	switch state {
+	case http.StateIdle:
+		tr.readSince = time.Now()
+		tr.dispatched = false
+	case http.StateClosed, http.StateHijacked:
+		// Go marks a connection Active once any request bytes arrive, so
+		// Active → Closed without a dispatch means the headers never completed.
+		slow := state == http.StateClosed && prev == http.StateActive && !tr.dispatched &&
+			time.Since(tr.readSince) >= g.headerTimeout
+		tr.mu.Unlock()
+		g.conns.Delete(c)
+		if slow {
+			g.strike("ip:"+normalizeIP(extractIP(c.RemoteAddr().String())), "header")
+		}
+		return
+	}
+	tr.mu.Unlock()
+}
+
+// Middleware marks the request as dispatched and bounds body reads by the
+// body timeout, striking the request's key if the deadline is hit.
+func (g *SlowGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tr, ok := r.Context().Value(connTrackKey{}).(*connTrack); ok {
+			tr.mu.Lock()
+			tr.dispatched = true
+			tr.mu.Unlock()
+		}
+
+		if g.bodyTimeout > 0 && r.Body != nil && r.Body != http.NoBody {
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(time.Now().Add(g.bodyTimeout)); err == nil {
+				r.Body = &slowBody{ReadCloser: r.Body, onTimeout: func() {
+					key, _ := g.keyFunc(r)
+					g.strike(key, "body")
+				}}
+				// Clear the deadline so it does not leak into the next
+				// keep-alive request on this connection.
+				defer rc.SetReadDeadline(time.Time{})
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *SlowGuard) strike(key, reason string) {
+	if g.box == nil {
+		return
+	}
+	banned := g.box.Strike(key)
+	log.Printf("[ratelimit] SLOW %s timeout | key=%s banned=%t", reason, truncateKey(key), banned)
+}
+
+// slowBody reports the first read-deadline error on a request body.
+type slowBody struct {
+	io.ReadCloser
+	once      sync.Once
+	onTimeout func()
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && isTimeout(err) {
+		b.once.Do(b.onTimeout)
+	}
+	return n, err
+}
+
+// isTimeout reports whether err is a network deadline error.
+func isTimeout(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
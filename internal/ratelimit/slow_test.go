@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlowGuard_BodyTimeoutStrikes(t *testing.T) {
+	initTestConfig()
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	guard := NewSlowGuard(KeyByIP(), box, 0, 50*time.Millisecond)
+
+	done := make(chan struct{})
+	srv := httptest.NewServer(guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		_, _ = io.ReadAll(r.Body)
+	})))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Promise 100 bytes, send 1, then stall.
+	_, _ = conn.Write([]byte("POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 100\r\n\r\na"))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler should return after the body timeout")
+	}
+
+	if _, banned := box.Banned("ip:127.0.0.1"); !banned {
+		t.Fatal("slow body should strike the client key")
+	}
+}
+
+func TestSlowGuard_HeaderTimeoutStrikes(t *testing.T) {
+	initTestConfig()
+	box := NewPenaltyBox(1, time.Minute, time.Minute)
+	guard := NewSlowGuard(KeyByIP(), box, 50*time.Millisecond, 0)
+
+	srv := httptest.NewUnstartedServer(guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	guard.ConfigureServer(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Partial request line, never finished.
+	_, _ = conn.Write([]byte("GET / HT"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, banned := box.Banned("ip:127.0.0.1"); banned {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("slow headers should strike the peer IP")
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// Spoofed forwarding-header detection
+// ──────────────────────────────────────────────
+
+// Reasons reported by SuspiciousHeaders.
+const (
+	// SpoofUntrustedForwarding: an untrusted peer sent forwarding headers.
+	SpoofUntrustedForwarding = "untrusted_forwarding"
+	// SpoofHeaderConflict: X-Real-IP and X-Forwarded-For name different clients.
+	SpoofHeaderConflict = "header_conflict"
+	// SpoofMalformed: X-Forwarded-For or X-Real-IP contains a non-IP value.
+	SpoofMalformed = "malformed"
+)
+
+// SpoofEvent describes a request with suspicious forwarding headers.
+type SpoofEvent struct {
+	PeerIP   string   // TCP peer address
+	ClientIP string   // resolved client IP (see ClientIP)
+	Key      string   // limiter key
+	Scope    string   // limiter policy scope
+	Reasons  []string // Spoof* constants
+}
+
+// SpoofHandler is called for every suspicious request. It must not block.
+type SpoofHandler func(r *http.Request, ev SpoofEvent)
+
+// spoofConfig is the limiter's detection setup.
+type spoofConfig struct {
+	onEvent SpoofHandler
+	strict  *Policy
+}
+
+// WithSpoofDetection checks every request's forwarding headers. onEvent
+// (may be nil, in which case events are logged) receives each suspicious
+// request. When strict is non-nil, suspicious requests are charged against
+// strict instead of the limiter's policy, in a separate "spoof:<key>" bucket.
+func WithSpoofDetection(onEvent SpoofHandler, strict *Policy) Option {
+	return func(l *Limiter) { l.spoof = &spoofConfig{onEvent: onEvent, strict: strict} }
+}
+
+// SuspiciousHeaders returns the reasons r's forwarding headers look forged,
+// or nil if they look legitimate.
+func SuspiciousHeaders(r *http.Request) []string {
+	trusted := trustedProxySet()
+	xff := r.Header.Get("X-Forwarded-For")
+	xri := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+
+	if !trustedPeer(r) {
+		if hasForwardingHeaders(r) {
+			return []string{SpoofUntrustedForwarding}
+		}
+		return nil
+	}
+
+	var reasons []string
+	if !validForwardedIPs(xff, xri) {
+		reasons = append(reasons, SpoofMalformed)
+	}
+	if xri != "" && xff != "" {
+		fwd := forwardedClientIP(xff, trusted)
+		if hops := trustedHops(); hops > 0 {
+			fwd = hopClientIP(forwardedFor(r), hops)
+		}
+		if fwd != "" && fwd != normalizeIP(xri) {
+			reasons = append(reasons, SpoofHeaderConflict)
+		}
+	}
+	return reasons
+}
+
+// validForwardedIPs reports whether every X-Forwarded-For entry and the
+// X-Real-IP value parse as IP addresses.
+func validForwardedIPs(xff, xri string) bool {
+	if xri != "" {
+		if _, err := netip.ParseAddr(xri); err != nil {
+			return false
+		}
+	}
+	if xff == "" {
+		return true
+	}
+	for _, part := range strings.Split(xff, ",") {
+		if _, err := netip.ParseAddr(strings.TrimSpace(part)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSpoof reports suspicious requests and returns the key and policy
+// the rate check should use.
+func (l *Limiter) checkSpoof(r *http.Request, key string) (string, Policy, bool) {
+	if l.spoof == nil {
+		return key, l.policy, false
+	}
+	reasons := SuspiciousHeaders(r)
+	if len(reasons) == 0 {
+		return key, l.policy, false
+	}
+
+	ev := SpoofEvent{
+		PeerIP:   extractIP(r.RemoteAddr),
+		ClientIP: ClientIP(r),
+		Key:      key,
+		Scope:    l.policy.Scope,
+		Reasons:  reasons,
+	}
+	if l.spoof.onEvent != nil {
+		l.spoof.onEvent(r, ev)
+	} else {
+		logSpoofEvent(r, ev)
+	}
+
+	if l.spoof.strict == nil {
+		return key, l.policy, false
+	}
+	return "spoof:" + key, *l.spoof.strict, true
+}
+
+func logSpoofEvent(r *http.Request, ev SpoofEvent) {
+	log.Printf("[ratelimit] suspicious forwarding headers %s %s | peer=%s client=%s scope=%s reasons=%s",
+		r.Method, r.URL.Path, ev.PeerIP, ev.ClientIP, ev.Scope, strings.Join(ev.Reasons, ","))
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestSuspiciousHeaders(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		xri    string
+		want   []string
+	}{
+		{"clean proxy", "10.0.0.1:1", "5.6.7.8", "5.6.7.8", nil},
+		{"clean direct", "1.2.3.4:1", "", "", nil},
+		{"untrusted with XFF", "1.2.3.4:1", "5.6.7.8", "", []string{SpoofUntrustedForwarding}},
+		{"untrusted with X-Real-IP", "1.2.3.4:1", "", "5.6.7.8", []string{SpoofUntrustedForwarding}},
+		{"conflict", "10.0.0.1:1", "5.6.7.8", "9.9.9.9", []string{SpoofHeaderConflict}},
+		{"malformed", "10.0.0.1:1", "evil, 5.6.7.8", "", []string{SpoofMalformed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xri != "" {
+				req.Header.Set("X-Real-IP", tt.xri)
+			}
+			if got := SuspiciousHeaders(req); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("SuspiciousHeaders = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_SpoofDetectionStrictPolicy(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	var events []SpoofEvent
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	strict := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test_spoof"}
+	limiter := NewLimiter(store, p, KeyByIP(), WithSpoofDetection(func(r *http.Request, ev SpoofEvent) {
+		events = append(events, ev)
+	}, &strict))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(xff string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve("8.8.8.8"); code != http.StatusOK {
+		t.Fatalf("1st spoofed request: expected 200, got %d", code)
+	}
+	if code := serve("8.8.8.8"); code != http.StatusTooManyRequests {
+		t.Fatalf("2nd spoofed request: expected 429, got %d", code)
+	}
+	// Clean requests from the same IP use the normal bucket.
+	if code := serve(""); code != http.StatusOK {
+		t.Fatalf("clean request: expected 200, got %d", code)
+	}
+	if len(events) != 2 || events[0].Reasons[0] != SpoofUntrustedForwarding || events[0].Key != "ip:1.2.3.4" {
+		t.Fatalf("events = %+v", events)
+	}
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Key anonymization (privacy)
+// ──────────────────────────────────────────────
+
+// Anonymizer hashes whole keys with a salt that rotates every period, so
+// persisted keys carry no client IPs or identifiers and hashes from
+// earlier periods cannot be linked to current ones without the secret.
+// The salt of each period is derived from the secret, so every instance
+// sharing a secret computes the same hashes.
+type Anonymizer struct {
+	secret []byte
+	rotate time.Duration
+
+	mu    sync.Mutex
+	epoch int64
+	salt  []byte
+}
+
+// NewAnonymizer creates an Anonymizer whose salt rotates every rotate (one
+// day when rotate <= 0). An empty secret is replaced by a random one,
+// which anonymizes just as well but gives each instance, and each
+// restart, its own buckets.
+func NewAnonymizer(secret []byte, rotate time.Duration) *Anonymizer {
+	if rotate <= 0 {
+		rotate = 24 * time.Hour
+	}
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic("ratelimit: reading random anonymizer secret: " + err.Error())
+		}
+		log.Println("[ratelimit] warning: RATE_LIMIT_ANONYMIZE_SECRET is empty; using a random per-process secret")
+	}
+	return &Anonymizer{secret: secret, rotate: rotate, epoch: -1}
+}
+
+// Hash returns the hex HMAC-SHA256 of v under the current period's salt.
+func (a *Anonymizer) Hash(v string) string {
+	mac := hmac.New(sha256.New, a.currentSalt(time.Now()))
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Key returns the anonymized form of a store key.
+func (a *Anonymizer) Key(key string) string { return "anon:" + a.Hash(key) }
+
+func (a *Anonymizer) currentSalt(now time.Time) []byte {
+	epoch := now.UnixNano() / int64(a.rotate)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if epoch != a.epoch {
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write([]byte("epoch:" + strconv.FormatInt(epoch, 10)))
+		a.salt, a.epoch = mac.Sum(nil), epoch
+	}
+	return a.salt
+}
+
+// AnonymizingStore wraps a store so every key reaching it is replaced by
+// its Anonymizer hash: Redis (or a memory snapshot) then never holds a
+// client IP or identifier. Decorators above it, such as the deny cache,
+// still see plain keys in process memory.
+//
+// When the salt rotates every key changes, so each bucket starts full once
+// per rotation period. Keep the period much longer than policy windows.
+type AnonymizingStore struct {
+	inner Store
+	anon  *Anonymizer
+}
+
+// NewAnonymizingStore wraps inner, hashing keys with anon.
+func NewAnonymizingStore(inner Store, anon *Anonymizer) *AnonymizingStore {
+	return &AnonymizingStore{inner: inner, anon: anon}
+}
+
+// Allow implements Store.
+func (s *AnonymizingStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	return s.inner.Allow(ctx, s.anon.Key(key), policy, cost)
+}
+
+// AllowMulti implements MultiStore when the wrapped store does.
+func (s *AnonymizingStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	hashed := make([]AllowRequest, len(reqs))
+	for i, req := range reqs {
+		req.Key = s.anon.Key(req.Key)
+		hashed[i] = req
+	}
+	return AllowMulti(ctx, s.inner, hashed)
+}
+
+// Reset implements Store.
+func (s *AnonymizingStore) Reset(key string) error { return s.inner.Reset(s.anon.Key(key)) }
+
+// Close implements Store.
+func (s *AnonymizingStore) Close() error { return s.inner.Close() }
+
+// Inner returns the wrapped store.
+func (s *AnonymizingStore) Inner() Store { return s.inner }
+
+// configAnonymizer returns the process-wide Anonymizer for the
+// RATE_LIMIT_ANONYMIZE_* settings, or nil when anonymization is off.
+func configAnonymizer() *Anonymizer {
+	cfg := config.RateLimit
+	if cfg == nil || !cfg.Anonymize {
+		return nil
+	}
+	sharedAnon.mu.Lock()
+	defer sharedAnon.mu.Unlock()
+	if sharedAnon.anon == nil || sharedAnon.secret != cfg.AnonymizeSecret || sharedAnon.rotate != cfg.AnonymizeRotate {
+		sharedAnon.anon = NewAnonymizer([]byte(cfg.AnonymizeSecret), time.Duration(cfg.AnonymizeRotate)*time.Second)
+		sharedAnon.secret, sharedAnon.rotate = cfg.AnonymizeSecret, cfg.AnonymizeRotate
+	}
+	return sharedAnon.anon
+}
+
+var sharedAnon struct {
+	mu     sync.Mutex
+	anon   *Anonymizer
+	secret string
+	rotate int
+}
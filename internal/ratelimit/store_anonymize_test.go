@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func TestAnonymizingStore_HashesKeys(t *testing.T) {
+	inner := NewMockStore()
+	anon := NewAnonymizer([]byte("secret"), time.Hour)
+	store := NewAnonymizingStore(inner, anon)
+
+	p := Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1}
+	store.Allow(context.Background(), "ip:203.0.113.7", p, 1)
+	store.Reset("ip:203.0.113.7")
+
+	calls := inner.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", calls)
+	}
+	want := anon.Key("ip:203.0.113.7")
+	for _, c := range calls {
+		if c.Key != want || strings.Contains(c.Key, "203.0.113.7") {
+			t.Fatalf("%s reached the store with key %q, want %q", c.Op, c.Key, want)
+		}
+	}
+
+	// Instances sharing the secret agree on the hash.
+	if NewAnonymizer([]byte("secret"), time.Hour).Key("ip:203.0.113.7") != want {
+		t.Fatal("same secret should give the same key")
+	}
+}
+
+func TestAnonymizer_SaltRotates(t *testing.T) {
+	a := NewAnonymizer([]byte("secret"), time.Hour)
+	now := time.Now()
+	first := string(a.currentSalt(now))
+	if string(a.currentSalt(now)) != first {
+		t.Fatal("salt should be stable within a period")
+	}
+	if string(a.currentSalt(now.Add(time.Hour))) == first {
+		t.Fatal("salt should change in the next period")
+	}
+}
+
+type recordingLogStore struct{ entries []LogEntry }
+
+func (s *recordingLogStore) Log(e LogEntry) error {
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func TestAnonymize_LogTable(t *testing.T) {
+	initTestConfig()
+	defer initTestConfig()
+	config.RateLimit.Anonymize = true
+	config.RateLimit.AnonymizeSecret = "secret"
+	config.RateLimit.AnonymizeRotate = 3600
+
+	logs := &recordingLogStore{}
+	store := NewMockStore()
+	store.DenyAll(10)
+	policy := Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	limiter := NewLimiter(store, policy, KeyByIP(), WithLogStore(logs))
+	h := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(logs.entries) != 1 {
+		t.Fatalf("expected one log entry, got %d", len(logs.entries))
+	}
+	e := logs.entries[0]
+	if strings.Contains(e.KeyHash, "203.0.113.7") || strings.Contains(e.ClientIP, "203.0.113.7") {
+		t.Fatalf("log entry carries the raw IP: %+v", e)
+	}
+	if !strings.HasPrefix(e.KeyHash, "anon:") || len(e.ClientIP) != 40 {
+		t.Fatalf("unexpected anonymized entry: %+v", e)
+	}
+}
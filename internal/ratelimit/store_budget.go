@@ -0,0 +1,290 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Latency budget (self-protection)
+// ──────────────────────────────────────────────
+
+// BudgetMode is what a BudgetStore does for a scope whose store latency is
+// over budget.
+type BudgetMode string
+
+const (
+	// BudgetLocal limits with a per-instance memory store instead.
+	BudgetLocal BudgetMode = "local"
+
+	// BudgetBypass allows every request without limiting.
+	BudgetBypass BudgetMode = "bypass"
+)
+
+const (
+	budgetSamples    = 128 // latency samples kept per scope
+	budgetMinSamples = 20  // samples needed before p99 is trusted
+	budgetProbes     = 3   // consecutive fast probes needed to recover
+)
+
+// budgetProbeInterval is the gap between recovery probes (a var for tests).
+var budgetProbeInterval = time.Second
+
+// BudgetEvent describes a scope switching into or out of its fallback mode.
+type BudgetEvent struct {
+	Scope   string
+	Mode    BudgetMode
+	P99     time.Duration // measured p99 (trip) or last probe latency (recovery)
+	Budget  time.Duration
+	Tripped bool // true when entering the fallback, false on recovery
+}
+
+// BudgetStore wraps a shared store and watches its Allow latency per policy
+// scope. When a scope's p99 stays above budget for the sustain period, that
+// scope switches to local-only limiting or bypass, and an alert fires, so a
+// slow Redis degrades limiting instead of every request.
+//
+// While tripped, one request per second is sent to the inner store as a
+// probe once the sustain period has passed again; after three consecutive
+// probes within budget the scope switches back.
+type BudgetStore struct {
+	inner   Store
+	local   Store // nil in bypass mode
+	budget  time.Duration
+	sustain time.Duration
+	mode    BudgetMode
+	onEvent func(BudgetEvent)
+
+	mu     sync.Mutex
+	scopes map[string]*scopeBudget
+}
+
+type scopeBudget struct {
+	samples [budgetSamples]time.Duration
+	n, next int
+
+	overSince  time.Time // zero while p99 is within budget
+	tripped    bool
+	trippedAt  time.Time
+	lastProbe  time.Time
+	goodProbes int
+}
+
+// NewBudgetStore wraps inner with a latency budget. onEvent is called when a
+// scope trips or recovers; nil logs the event.
+func NewBudgetStore(inner Store, budget, sustain time.Duration, mode BudgetMode, onEvent func(BudgetEvent)) *BudgetStore {
+	if mode != BudgetBypass {
+		mode = BudgetLocal
+	}
+	if onEvent == nil {
+		onEvent = logBudgetEvent
+	}
+	b := &BudgetStore{
+		inner:   inner,
+		budget:  budget,
+		sustain: sustain,
+		mode:    mode,
+		onEvent: onEvent,
+		scopes:  make(map[string]*scopeBudget),
+	}
+	if mode == BudgetLocal {
+		b.local = NewMemoryStore(2 * time.Minute)
+	}
+	return b
+}
+
+// Inner returns the wrapped store.
+func (b *BudgetStore) Inner() Store { return b.inner }
+
+// Allow implements Store.
+func (b *BudgetStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	probe, fallback := b.route(policy.Scope)
+	if fallback {
+		if b.local != nil {
+			return b.local.Allow(ctx, key, policy, cost)
+		}
+		max := policy.Limit + policy.Burst
+		return Result{Allowed: true, Limit: max, Remaining: max}
+	}
+
+	start := time.Now()
+	res := b.inner.Allow(ctx, key, policy, cost)
+	b.observe(policy.Scope, time.Since(start), probe)
+	return res
+}
+
+// AllowMulti implements MultiStore. The batch uses the fallback when any of
+// its scopes does.
+func (b *BudgetStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	var probes []string
+	for _, req := range reqs {
+		probe, fallback := b.route(req.Policy.Scope)
+		if fallback {
+			if b.local != nil {
+				return AllowMulti(ctx, b.local, reqs)
+			}
+			results := make([]Result, len(reqs))
+			for i, req := range reqs {
+				max := req.Policy.Limit + req.Policy.Burst
+				results[i] = Result{Allowed: true, Limit: max, Remaining: max}
+			}
+			return results
+		}
+		if probe {
+			probes = append(probes, req.Policy.Scope)
+		}
+	}
+
+	start := time.Now()
+	results := AllowMulti(ctx, b.inner, reqs)
+	elapsed := time.Since(start)
+	seen := make(map[string]bool, len(reqs))
+	for _, req := range reqs {
+		if scope := req.Policy.Scope; !seen[scope] {
+			seen[scope] = true
+			b.observe(scope, elapsed, slices.Contains(probes, scope))
+		}
+	}
+	return results
+}
+
+// Reset implements Store. The key is also cleared from the local fallback.
+func (b *BudgetStore) Reset(key string) error {
+	if b.local != nil {
+		_ = b.local.Reset(key)
+	}
+	return b.inner.Reset(key)
+}
+
+// Close implements Store.
+func (b *BudgetStore) Close() error {
+	if b.local != nil {
+		return errors.Join(b.inner.Close(), b.local.Close())
+	}
+	return b.inner.Close()
+}
+
+// Degraded returns the scopes currently in fallback mode, sorted.
+func (b *BudgetStore) Degraded() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []string
+	for scope, sb := range b.scopes {
+		if sb.tripped {
+			out = append(out, scope)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Ping implements Healther by delegating to the wrapped store.
+func (b *BudgetStore) Ping(ctx context.Context) error { return pingInner(ctx, b.inner) }
+
+// Status implements Healther. Any tripped scope makes the store unhealthy.
+func (b *BudgetStore) Status(ctx context.Context) HealthStatus {
+	st := CheckHealth(ctx, b.inner)
+	if scopes := b.Degraded(); len(scopes) > 0 && st.Healthy {
+		st.Healthy = false
+		st.Message = fmt.Sprintf("rate limiter degraded: store over %s latency budget, %s for %s",
+			b.budget, b.modeDescription(), strings.Join(scopes, ", "))
+	}
+	return st
+}
+
+// route reports whether the next request for scope is a recovery probe, or
+// must use the fallback.
+func (b *BudgetStore) route(scope string) (probe, fallback bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sb := b.scopes[scope]
+	if sb == nil || !sb.tripped {
+		return false, false
+	}
+	now := time.Now()
+	if now.Sub(sb.trippedAt) >= b.sustain && now.Sub(sb.lastProbe) >= budgetProbeInterval {
+		sb.lastProbe = now
+		return true, false
+	}
+	return false, true
+}
+
+func (b *BudgetStore) observe(scope string, elapsed time.Duration, probe bool) {
+	var ev *BudgetEvent
+
+	b.mu.Lock()
+	sb := b.scopes[scope]
+	if sb == nil {
+		sb = &scopeBudget{}
+		b.scopes[scope] = sb
+	}
+	switch {
+	case probe:
+		if elapsed > b.budget {
+			sb.goodProbes = 0
+			break
+		}
+		sb.goodProbes++
+		if sb.goodProbes >= budgetProbes {
+			*sb = scopeBudget{}
+			ev = &BudgetEvent{Scope: scope, Mode: b.mode, P99: elapsed, Budget: b.budget}
+		}
+	case !sb.tripped:
+		sb.samples[sb.next] = elapsed
+		sb.next = (sb.next + 1) % budgetSamples
+		if sb.n < budgetSamples {
+			sb.n++
+		}
+		if sb.n < budgetMinSamples || sb.next%8 != 0 {
+			break
+		}
+		p99 := sb.p99()
+		now := time.Now()
+		if p99 <= b.budget {
+			sb.overSince = time.Time{}
+			break
+		}
+		if sb.overSince.IsZero() {
+			sb.overSince = now
+		}
+		if now.Sub(sb.overSince) >= b.sustain {
+			sb.tripped, sb.trippedAt, sb.goodProbes = true, now, 0
+			ev = &BudgetEvent{Scope: scope, Mode: b.mode, P99: p99, Budget: b.budget, Tripped: true}
+		}
+	}
+	b.mu.Unlock()
+
+	if ev != nil {
+		b.onEvent(*ev)
+	}
+}
+
+// p99 returns the 99th percentile of the recorded samples.
+func (sb *scopeBudget) p99() time.Duration {
+	s := make([]time.Duration, sb.n)
+	copy(s, sb.samples[:sb.n])
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[(len(s)*99)/100]
+}
+
+func (b *BudgetStore) modeDescription() string {
+	if b.mode == BudgetBypass {
+		return "bypassing"
+	}
+	return "limiting per instance"
+}
+
+func logBudgetEvent(e BudgetEvent) {
+	if e.Tripped {
+		log.Printf("[ratelimit] ALERT: scope=%s store p99 %s over %s budget, switching to %s mode", e.Scope, e.P99, e.Budget, e.Mode)
+		return
+	}
+	log.Printf("[ratelimit] scope=%s store latency back within %s budget, leaving %s mode", e.Scope, e.Budget, e.Mode)
+}
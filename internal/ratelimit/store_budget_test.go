@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBudgetStore_TripsAndRecovers(t *testing.T) {
+	defer func(d time.Duration) { budgetProbeInterval = d }(budgetProbeInterval)
+	budgetProbeInterval = 0
+
+	ctx := context.Background()
+	inner := NewMockStore()
+	inner.SetLatency(3 * time.Millisecond)
+
+	var events []BudgetEvent
+	store := NewBudgetStore(inner, time.Millisecond, 0, BudgetLocal, func(e BudgetEvent) { events = append(events, e) })
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "api"}
+	other := p
+	other.Scope = "other"
+
+	for i := 0; i < 2*budgetMinSamples && len(events) == 0; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+	if len(events) != 1 || !events[0].Tripped || events[0].Scope != "api" || events[0].P99 < time.Millisecond {
+		t.Fatalf("expected one trip event for api, got %+v", events)
+	}
+	if got := store.Degraded(); len(got) != 1 || got[0] != "api" {
+		t.Fatalf("Degraded() = %v", got)
+	}
+	if st := store.Status(ctx); st.Healthy {
+		t.Fatal("a tripped scope should make the store unhealthy")
+	}
+
+	// Tripped: the local fallback enforces the 1-token limit on its own.
+	budgetProbeInterval = time.Hour
+	store.route("api") // consume the first probe slot
+	calls := inner.CallCount("allow")
+	if !store.Allow(ctx, "k", p, 1).Allowed || store.Allow(ctx, "k", p, 1).Allowed {
+		t.Fatal("local fallback should allow once, then deny")
+	}
+	if inner.CallCount("allow") != calls {
+		t.Fatal("tripped scope should not reach the inner store")
+	}
+	store.Allow(ctx, "k", other, 1)
+	if inner.CallCount("allow") != calls+1 {
+		t.Fatal("other scopes should still use the inner store")
+	}
+
+	// Three fast probes restore the scope.
+	budgetProbeInterval = 0
+	inner.SetLatency(0)
+	for i := 0; i < budgetProbes; i++ {
+		store.Allow(ctx, "k2", p, 1)
+	}
+	if len(events) != 2 || events[1].Tripped {
+		t.Fatalf("expected a recovery event, got %+v", events)
+	}
+	if len(store.Degraded()) != 0 {
+		t.Fatal("scope should have recovered")
+	}
+}
+
+func TestBudgetStore_Bypass(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMockStore()
+	inner.DenyAll(10)
+	inner.SetLatency(3 * time.Millisecond)
+	store := NewBudgetStore(inner, time.Millisecond, 0, BudgetBypass, func(BudgetEvent) {})
+	defer store.Close()
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	for i := 0; i < 2*budgetMinSamples && len(store.Degraded()) == 0; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+	if len(store.Degraded()) != 1 {
+		t.Fatal("scope should have tripped")
+	}
+	store.route("api") // consume the first probe slot
+	if res := store.Allow(ctx, "k", p, 1); !res.Allowed || res.Err != nil {
+		t.Fatalf("bypass mode should allow, got %+v", res)
+	}
+}
+
+func TestBudgetStore_FastStoreNeverTrips(t *testing.T) {
+	ctx := context.Background()
+	store := NewBudgetStore(NewMemoryStore(time.Minute), time.Second, 0, BudgetLocal, func(e BudgetEvent) {
+		t.Errorf("unexpected event %+v", e)
+	})
+	defer store.Close()
+
+	p := Policy{Limit: 1000, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	for i := 0; i < 200; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+}
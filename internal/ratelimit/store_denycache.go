@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Deny-decision cache (store decorator)
+// ──────────────────────────────────────────────
+
+// denyCacheMaxEntries bounds the cache so an attack spread across many keys
+// cannot exhaust memory; once full, new denials are simply not cached.
+const denyCacheMaxEntries = 50000
+
+// DenyCacheStore wraps a Store and remembers deny decisions for keys that are
+// deep in denial. While a key's cached deny is live, Allow answers locally
+// without touching the inner store, removing the Redis round trip for the
+// hottest abusive keys.
+//
+// Caching is exact: a denied token-bucket request consumes nothing, so the
+// inner store would keep denying until RetryAfter elapses anyway. Entries
+// never outlive the RetryAfter they were created with, and only answer
+// requests costing at least as much as the denied one; cheaper requests
+// may still fit the bucket and go to the inner store.
+type DenyCacheStore struct {
+	inner         Store
+	minRetryAfter int           // only cache denials with at least this RetryAfter (seconds)
+	maxTTL        time.Duration // cap on how long a deny is cached
+
+	mu      sync.Mutex
+	entries map[string]map[string]denyEntry // key -> scope -> entry
+	size    int
+}
+
+type denyEntry struct {
+	result  Result
+	cost    int // cost of the denied request
+	created time.Time
+	expires time.Time
+}
+
+// NewDenyCacheStore wraps inner. Denials with RetryAfter >= minRetryAfter are
+// cached for min(RetryAfter, maxTTL).
+func NewDenyCacheStore(inner Store, minRetryAfter int, maxTTL time.Duration) *DenyCacheStore {
+	if minRetryAfter < 1 {
+		minRetryAfter = 1
+	}
+	return &DenyCacheStore{
+		inner:         inner,
+		minRetryAfter: minRetryAfter,
+		maxTTL:        maxTTL,
+		entries:       make(map[string]map[string]denyEntry),
+	}
+}
+
+// Allow returns a cached deny when one is live, otherwise asks the inner store.
+func (s *DenyCacheStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	now := time.Now()
+	if res, ok := s.lookup(key, policy.Scope, cost, now); ok {
+		return res
+	}
+
+	res := s.inner.Allow(ctx, key, policy, cost)
+	if !res.Allowed && res.RetryAfter >= s.minRetryAfter {
+		ttl := time.Duration(res.RetryAfter) * time.Second
+		if s.maxTTL > 0 && ttl > s.maxTTL {
+			ttl = s.maxTTL
+		}
+		s.store(key, policy.Scope, denyEntry{result: res, cost: cost, created: now, expires: now.Add(ttl)}, now)
+	}
+	return res
+}
+
+// AllowMulti implements MultiStore. A batch with a live cached deny is
+// denied without asking the inner store; the other buckets are reported
+// as denied with no RetryAfter.
+func (s *DenyCacheStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	now := time.Now()
+	results := make([]Result, len(reqs))
+	cached := false
+	for i, req := range reqs {
+		if res, ok := s.lookup(req.Key, req.Policy.Scope, req.Cost, now); ok {
+			results[i], cached = res, true
+		} else {
+			results[i] = Result{Limit: req.Policy.Limit + req.Policy.Burst}
+		}
+	}
+	if cached {
+		return results
+	}
+
+	results = AllowMulti(ctx, s.inner, reqs)
+	for i, res := range results {
+		if !res.Allowed && res.RetryAfter >= s.minRetryAfter {
+			ttl := time.Duration(res.RetryAfter) * time.Second
+			if s.maxTTL > 0 && ttl > s.maxTTL {
+				ttl = s.maxTTL
+			}
+			s.store(reqs[i].Key, reqs[i].Policy.Scope, denyEntry{result: res, cost: reqs[i].Cost, created: now, expires: now.Add(ttl)}, now)
+		}
+	}
+	return results
+}
+
+// Inner returns the wrapped store.
+func (s *DenyCacheStore) Inner() Store { return s.inner }
+
+// lookup returns the cached result for key/scope with RetryAfter counted
+// down to the present, if it was a denial of a request costing no more
+// than cost.
+func (s *DenyCacheStore) lookup(key, scope string, cost int, now time.Time) (Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key][scope]
+	if !ok {
+		return Result{}, false
+	}
+	if !now.Before(e.expires) {
+		s.delete(key, scope)
+		return Result{}, false
+	}
+	if cost < e.cost {
+		return Result{}, false
+	}
+	res := e.result
+	res.RetryAfter -= int(now.Sub(e.created).Seconds())
+	if res.RetryAfter < 1 {
+		res.RetryAfter = 1
+	}
+	return res, true
+}
+
+func (s *DenyCacheStore) store(key, scope string, e denyEntry, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size >= denyCacheMaxEntries {
+		s.sweep(now)
+		if s.size >= denyCacheMaxEntries {
+			return
+		}
+	}
+	scopes, ok := s.entries[key]
+	if !ok {
+		scopes = make(map[string]denyEntry)
+		s.entries[key] = scopes
+	}
+	if _, exists := scopes[scope]; !exists {
+		s.size++
+	}
+	scopes[scope] = e
+}
+
+// delete removes one entry. The caller must hold s.mu.
+func (s *DenyCacheStore) delete(key, scope string) {
+	scopes, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if _, exists := scopes[scope]; exists {
+		delete(scopes, scope)
+		s.size--
+	}
+	if len(scopes) == 0 {
+		delete(s.entries, key)
+	}
+}
+
+// sweep drops expired entries. The caller must hold s.mu.
+func (s *DenyCacheStore) sweep(now time.Time) {
+	for key, scopes := range s.entries {
+		for scope, e := range scopes {
+			if !now.Before(e.expires) {
+				s.delete(key, scope)
+			}
+		}
+	}
+}
+
+// Reset clears cached denials for key and resets it in the inner store.
+func (s *DenyCacheStore) Reset(key string) error {
+	s.mu.Lock()
+	s.size -= len(s.entries[key])
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return s.inner.Reset(key)
+}
+
+// Close closes the inner store.
+func (s *DenyCacheStore) Close() error {
+	return s.inner.Close()
+}
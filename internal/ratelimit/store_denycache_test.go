@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingStore wraps a Store and counts Allow calls.
+type countingStore struct {
+	Store
+	calls int
+}
+
+func (c *countingStore) Allow(ctx context.Context, key string, p Policy, cost int) Result {
+	c.calls++
+	return c.Store.Allow(ctx, key, p, cost)
+}
+
+func TestDenyCacheStore_SkipsInnerWhileDenied(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{Store: NewMemoryStore(time.Minute)}
+	store := NewDenyCacheStore(inner, 5, time.Minute)
+	defer store.Close()
+
+	// 1 token per hour: a denial carries a long RetryAfter.
+	p := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+
+	store.Allow(ctx, "k", p, 1)
+	if res := store.Allow(ctx, "k", p, 1); res.Allowed {
+		t.Fatal("2nd request should be denied")
+	}
+	calls := inner.calls
+
+	for i := 0; i < 10; i++ {
+		res := store.Allow(ctx, "k", p, 1)
+		if res.Allowed || res.RetryAfter < 1 {
+			t.Fatalf("cached result should be a deny with RetryAfter, got %+v", res)
+		}
+	}
+	if inner.calls != calls {
+		t.Fatalf("inner store should not be called while deny is cached (%d extra calls)", inner.calls-calls)
+	}
+
+	// A different scope is not affected by the cached deny.
+	other := p
+	other.Scope = "other"
+	store.Allow(ctx, "k", other, 1)
+	if inner.calls != calls+1 {
+		t.Fatal("different scope should reach the inner store")
+	}
+}
+
+func TestDenyCacheStore_CheaperRequestReachesInner(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{Store: NewMemoryStore(time.Minute)}
+	store := NewDenyCacheStore(inner, 5, time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	if res := store.Allow(ctx, "k", p, 8); !res.Allowed {
+		t.Fatal("first request should be allowed")
+	}
+	if res := store.Allow(ctx, "k", p, 5); res.Allowed {
+		t.Fatal("a request over the 2 tokens left should be denied")
+	}
+	calls := inner.calls
+	if res := store.Allow(ctx, "k", p, 6); res.Allowed || inner.calls != calls {
+		t.Errorf("expected a costlier request to get the cached deny, got %+v after %d calls", res, inner.calls-calls)
+	}
+	if res := store.Allow(ctx, "k", p, 1); !res.Allowed || inner.calls != calls+1 {
+		t.Errorf("expected a request that fits the bucket to reach the inner store, got %+v", res)
+	}
+}
+
+func TestDenyCacheStore_ShortDenyNotCached(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStore{Store: NewMemoryStore(time.Minute)}
+	store := NewDenyCacheStore(inner, 30, time.Minute)
+	defer store.Close()
+
+	// 1 token per second: RetryAfter is ~1s, below the 30s threshold.
+	p := Policy{Limit: 1, Window: time.Second, Enabled: true, Cost: 1, Scope: "test"}
+	store.Allow(ctx, "k", p, 1)
+	store.Allow(ctx, "k", p, 1)
+	store.Allow(ctx, "k", p, 1)
+	if inner.calls != 3 {
+		t.Fatalf("short denials should not be cached, inner calls = %d", inner.calls)
+	}
+}
+
+func TestDenyCacheStore_ResetClearsCache(t *testing.T) {
+	ctx := context.Background()
+	store := NewDenyCacheStore(NewMemoryStore(time.Minute), 5, time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	store.Allow(ctx, "k", p, 1)
+	store.Allow(ctx, "k", p, 1)
+
+	if err := store.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Allow(ctx, "k", p, 1).Allowed {
+		t.Fatal("should be allowed after reset")
+	}
+}
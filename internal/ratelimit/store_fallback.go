@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Outage fallback (shared store → memory)
+// ──────────────────────────────────────────────
+
+// FallbackStore wraps a shared store, usually Redis, and switches to a
+// per-instance memory store as soon as the shared store fails. Limits are
+// then enforced by each instance on its own instead of failing open, which
+// is when attackers hit hardest.
+//
+// While degraded, the shared store is pinged every retry interval, and
+// traffic moves back to it on the first successful ping. Buckets built up in
+// memory are not copied back.
+type FallbackStore struct {
+	inner Store
+	local Store
+	retry time.Duration
+
+	mu            sync.Mutex
+	degradedSince time.Time // zero while the shared store is in use
+	lastErr       error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewFallbackStore wraps inner with a memory fallback. retry defaults to
+// five seconds.
+func NewFallbackStore(inner Store, retry time.Duration) *FallbackStore {
+	if retry <= 0 {
+		retry = 5 * time.Second
+	}
+	return &FallbackStore{
+		inner: inner,
+		local: NewMemoryStore(2 * time.Minute),
+		retry: retry,
+		stop:  make(chan struct{}),
+	}
+}
+
+// Inner returns the wrapped store.
+func (s *FallbackStore) Inner() Store { return s.inner }
+
+// Allow implements Store. A request that hits a failing shared store is
+// decided by the memory store.
+func (s *FallbackStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	if s.Degraded() {
+		return s.local.Allow(ctx, key, policy, cost)
+	}
+	res := s.inner.Allow(ctx, key, policy, cost)
+	if res.Err == nil || ctx.Err() != nil {
+		return res
+	}
+	s.trip(res.Err)
+	return s.local.Allow(ctx, key, policy, cost)
+}
+
+// AllowMulti implements MultiStore. A batch that hits a failing shared
+// store is decided by the memory store as a whole.
+func (s *FallbackStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	if s.Degraded() {
+		return AllowMulti(ctx, s.local, reqs)
+	}
+	results := AllowMulti(ctx, s.inner, reqs)
+	for _, res := range results {
+		if res.Err != nil && ctx.Err() == nil {
+			s.trip(res.Err)
+			return AllowMulti(ctx, s.local, reqs)
+		}
+	}
+	return results
+}
+
+// Reset implements Store. The key is also cleared from the memory store.
+func (s *FallbackStore) Reset(key string) error {
+	_ = s.local.Reset(key)
+	return s.inner.Reset(key)
+}
+
+// Close implements Store.
+func (s *FallbackStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+	return errors.Join(s.inner.Close(), s.local.Close())
+}
+
+// Degraded reports whether requests are being limited per instance.
+func (s *FallbackStore) Degraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.degradedSince.IsZero()
+}
+
+// DegradedSince returns when the store switched to memory, or the zero
+// time while the shared store is in use.
+func (s *FallbackStore) DegradedSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.degradedSince
+}
+
+// Ping implements Healther by delegating to the wrapped store.
+func (s *FallbackStore) Ping(ctx context.Context) error { return pingInner(ctx, s.inner) }
+
+// Status implements Healther. The store is unhealthy while degraded.
+func (s *FallbackStore) Status(ctx context.Context) HealthStatus {
+	st := CheckHealth(ctx, s.inner)
+	s.mu.Lock()
+	since, lastErr := s.degradedSince, s.lastErr
+	s.mu.Unlock()
+	if !since.IsZero() {
+		st.Healthy = false
+		st.Message = fmt.Sprintf("rate limiter degraded: shared store unavailable since %s (%v), limiting per instance",
+			since.UTC().Format(time.RFC3339), lastErr)
+	}
+	return st
+}
+
+// trip switches to the memory store and starts reconnecting.
+func (s *FallbackStore) trip(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.degradedSince.IsZero() {
+		return
+	}
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	s.degradedSince, s.lastErr = time.Now(), err
+	log.Printf("[ratelimit] ALERT: shared store failed (%v), limiting per instance until it recovers", err)
+	s.wg.Add(1)
+	go s.reconnect()
+}
+
+// reconnect pings the shared store every retry interval until it answers.
+func (s *FallbackStore) reconnect() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.retry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.retry)
+			err := pingInner(ctx, s.inner)
+			cancel()
+			if err != nil {
+				s.mu.Lock()
+				s.lastErr = err
+				s.mu.Unlock()
+				continue
+			}
+			s.mu.Lock()
+			down := time.Since(s.degradedSince)
+			s.degradedSince, s.lastErr = time.Time{}, nil
+			s.mu.Unlock()
+			log.Printf("[ratelimit] shared store recovered after %s, leaving per-instance mode", down.Round(time.Second))
+			return
+		}
+	}
+}
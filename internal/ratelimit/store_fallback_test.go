@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFallbackStore(t *testing.T) {
+	inner := NewMockStore()
+	s := NewFallbackStore(inner, 10*time.Millisecond)
+	defer s.Close()
+	ctx := context.Background()
+	p := Policy{Limit: 2, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+
+	inner.FailWith(errors.New("redis down"))
+	if res := s.Allow(ctx, "ip:1", p, 1); !res.Allowed || res.Err != nil {
+		t.Fatalf("expected the memory store to decide, got %+v", res)
+	}
+	if !s.Degraded() {
+		t.Fatal("expected a store error to switch to memory")
+	}
+	s.Allow(ctx, "ip:1", p, 1)
+	if res := s.Allow(ctx, "ip:1", p, 1); res.Allowed {
+		t.Error("expected limits to be enforced per instance while degraded")
+	}
+	if n := inner.CallCount("allow"); n != 1 {
+		t.Errorf("expected the failing store to be skipped while degraded, got %d calls", n)
+	}
+	if st := s.Status(ctx); st.Healthy {
+		t.Error("expected a degraded store to report unhealthy")
+	}
+
+	inner.FailWith(nil)
+	deadline := time.Now().Add(time.Second)
+	for s.Degraded() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s.Degraded() {
+		t.Fatal("expected a successful ping to restore the shared store")
+	}
+	s.Allow(ctx, "ip:1", p, 1)
+	if n := inner.CallCount("allow"); n != 2 {
+		t.Errorf("expected traffic back on the shared store, got %d calls", n)
+	}
+}
@@ -0,0 +1,381 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Gossip-replicated memory store (small clusters without Redis)
+// ──────────────────────────────────────────────
+
+// gossipMaxDeltas bounds deltas per datagram so packets stay well under
+// typical MTU-safe UDP sizes.
+const gossipMaxDeltas = 16
+
+// gossipMaxAge is how far a datagram's send time may be from the receiver's
+// clock, in either direction, before it is dropped as a replay. It bounds
+// how long a receiver must remember a sender's sequence numbers.
+const gossipMaxAge = 30 * time.Second
+
+// gossipReplayWindow is how many sequence numbers behind a sender's newest
+// one are still accepted, so datagrams reordered in flight are not lost.
+const gossipReplayWindow = 64
+
+// GossipStore keeps buckets in a local MemoryStore and periodically sends
+// the tokens it consumed to its peers over UDP. Peers subtract those tokens
+// from their own copy of the bucket, so a 2–3 node cluster converges on the
+// shared limit instead of each node granting the full limit.
+//
+// Enforcement is approximate: packets can be lost or arrive late, and each
+// node can over-admit by up to one interval of traffic. Datagrams are signed
+// with HMAC-SHA256 when a secret is set; without one any host that can reach
+// the port can drain buckets, so always set a secret outside development.
+// Each datagram carries the sender's ID, a sequence number and its send
+// time; receivers drop datagrams older than gossipMaxAge and sequence
+// numbers they have already applied, so a captured datagram cannot be
+// replayed to drain buckets again.
+type GossipStore struct {
+	local    *MemoryStore
+	conn     *net.UDPConn
+	secret   []byte
+	interval time.Duration
+	node     string
+
+	mu        sync.Mutex
+	peers     []*net.UDPAddr
+	pending   map[string]*gossipPending
+	seq       uint64
+	seen      map[string]*gossipSeen
+	lastSweep time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type gossipPending struct {
+	policy   Policy
+	consumed float64
+}
+
+// gossipSeen is the replay state of one sender: its newest sequence number
+// and a bitmap of the gossipReplayWindow numbers before it (bit i set means
+// max-i was applied).
+type gossipSeen struct {
+	max  uint64
+	bits uint64
+	at   time.Time
+}
+
+// gossipMessage is the wire format: a batch of consumption deltas, with the
+// sender's ID, sequence number and send time (Unix milliseconds).
+type gossipMessage struct {
+	Node   string        `json:"n"`
+	Seq    uint64        `json:"s"`
+	SentMs int64         `json:"t"`
+	Deltas []gossipDelta `json:"d"`
+}
+
+// gossipDelta carries every policy field that shapes a bucket, so applying
+// it on a peer does not retune that peer's bucket (e.g. drop its carry-over).
+type gossipDelta struct {
+	Key       string  `json:"k"`
+	Limit     int     `json:"l"`
+	Burst     int     `json:"b"`
+	WindowMs  int64   `json:"w"`
+	CarryOver float64 `json:"o,omitempty"`
+	Consumed  float64 `json:"c"`
+}
+
+// NewGossipStore listens on bind (e.g. ":7946"), gossips to peers every
+// interval, and uses local for decisions. The local store is closed with
+// the gossip store.
+func NewGossipStore(local *MemoryStore, bind string, peers []string, interval time.Duration, secret []byte) (*GossipStore, error) {
+	laddr, err := net.ResolveUDPAddr("udp", bind)
+	if err != nil {
+		return nil, fmt.Errorf("resolve gossip bind %q: %w", bind, err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen gossip: %w", err)
+	}
+
+	s := &GossipStore{
+		local:    local,
+		conn:     conn,
+		secret:   secret,
+		interval: interval,
+		node:     connID(),
+		pending:  make(map[string]*gossipPending),
+		seen:     make(map[string]*gossipSeen),
+		stop:     make(chan struct{}),
+	}
+	for _, p := range peers {
+		if err := s.AddPeer(p); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	s.wg.Add(2)
+	go s.sendLoop()
+	go s.recvLoop()
+	return s, nil
+}
+
+// Addr returns the local UDP address the store is listening on.
+func (s *GossipStore) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// AddPeer adds a peer address ("host:port") to gossip to.
+func (s *GossipStore) AddPeer(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("resolve gossip peer %q: %w", addr, err)
+	}
+	s.mu.Lock()
+	s.peers = append(s.peers, raddr)
+	s.mu.Unlock()
+	return nil
+}
+
+// Allow decides locally and records consumption for the next gossip round.
+func (s *GossipStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	res := s.local.Allow(ctx, key, policy, cost)
+	if res.Allowed {
+		s.mu.Lock()
+		p, ok := s.pending[key]
+		if !ok {
+			p = &gossipPending{policy: policy}
+			s.pending[key] = p
+		}
+		p.consumed += float64(cost)
+		s.mu.Unlock()
+	}
+	return res
+}
+
+// AllowMulti implements MultiStore with the local store's batch.
+func (s *GossipStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	results := s.local.AllowMulti(ctx, reqs)
+	if !AllAllowed(results) {
+		return results
+	}
+	s.mu.Lock()
+	for _, req := range reqs {
+		p, ok := s.pending[req.Key]
+		if !ok {
+			p = &gossipPending{policy: req.Policy}
+			s.pending[req.Key] = p
+		}
+		p.consumed += float64(req.Cost)
+	}
+	s.mu.Unlock()
+	return results
+}
+
+// Reset removes the key locally only; peers keep their view until it expires.
+func (s *GossipStore) Reset(key string) error {
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+	return s.local.Reset(key)
+}
+
+// Close flushes pending deltas, stops gossiping and closes the local store.
+func (s *GossipStore) Close() error {
+	close(s.stop)
+	s.flush()
+	s.conn.Close()
+	s.wg.Wait()
+	return s.local.Close()
+}
+
+func (s *GossipStore) sendLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush sends all pending deltas to every peer.
+func (s *GossipStore) flush() {
+	s.mu.Lock()
+	if len(s.pending) == 0 || len(s.peers) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	deltas := make([]gossipDelta, 0, len(s.pending))
+	for k, p := range s.pending {
+		deltas = append(deltas, gossipDelta{
+			Key:       k,
+			Limit:     p.policy.Limit,
+			Burst:     p.policy.Burst,
+			WindowMs:  p.policy.Window.Milliseconds(),
+			CarryOver: p.policy.CarryOver,
+			Consumed:  p.consumed,
+		})
+	}
+	s.pending = make(map[string]*gossipPending)
+	peers := append([]*net.UDPAddr(nil), s.peers...)
+	seq := s.seq
+	s.seq += uint64((len(deltas) + gossipMaxDeltas - 1) / gossipMaxDeltas)
+	s.mu.Unlock()
+
+	for start := 0; start < len(deltas); start += gossipMaxDeltas {
+		end := start + gossipMaxDeltas
+		if end > len(deltas) {
+			end = len(deltas)
+		}
+		seq++
+		pkt, err := s.encode(gossipMessage{
+			Node:   s.node,
+			Seq:    seq,
+			SentMs: time.Now().UnixMilli(),
+			Deltas: deltas[start:end],
+		})
+		if err != nil {
+			log.Printf("[ratelimit] gossip encode error: %v", err)
+			continue
+		}
+		for _, peer := range peers {
+			if _, err := s.conn.WriteToUDP(pkt, peer); err != nil {
+				log.Printf("[ratelimit] gossip send to %s failed: %v", peer, err)
+			}
+		}
+	}
+}
+
+func (s *GossipStore) recvLoop() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.stop:
+				return
+			default:
+				continue
+			}
+		}
+		msg, ok := s.decode(buf[:n])
+		if !ok || !s.fresh(msg, time.Now()) {
+			continue
+		}
+		s.apply(msg)
+	}
+}
+
+// fresh reports whether msg is neither stale nor a replay, and records its
+// sequence number. Datagrams from this node (looped back by a peer list
+// that includes it) are never fresh.
+func (s *GossipStore) fresh(msg gossipMessage, now time.Time) bool {
+	if msg.Node == "" || msg.Node == s.node || msg.Seq == 0 {
+		return false
+	}
+	sent := time.UnixMilli(msg.SentMs)
+	if sent.Before(now.Add(-gossipMaxAge)) || sent.After(now.Add(gossipMaxAge)) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > gossipMaxAge {
+		// Datagrams from a sender idle this long fail the age check above,
+		// so its sequence numbers no longer need remembering.
+		for node, seen := range s.seen {
+			if now.Sub(seen.at) > 2*gossipMaxAge {
+				delete(s.seen, node)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	seen, ok := s.seen[msg.Node]
+	if !ok {
+		s.seen[msg.Node] = &gossipSeen{max: msg.Seq, bits: 1, at: now}
+		return true
+	}
+	switch {
+	case msg.Seq > seen.max:
+		if shift := msg.Seq - seen.max; shift < gossipReplayWindow {
+			seen.bits = seen.bits<<shift | 1
+		} else {
+			seen.bits = 1
+		}
+		seen.max = msg.Seq
+	default:
+		back := seen.max - msg.Seq
+		if back >= gossipReplayWindow || seen.bits&(1<<back) != 0 {
+			return false
+		}
+		seen.bits |= 1 << back
+	}
+	seen.at = now
+	return true
+}
+
+// apply subtracts a peer's consumption from the local buckets.
+func (s *GossipStore) apply(msg gossipMessage) {
+	ctx := context.Background()
+	for _, d := range msg.Deltas {
+		if d.WindowMs <= 0 || d.Consumed <= 0 {
+			continue
+		}
+		p := Policy{Limit: d.Limit, Burst: d.Burst, Window: time.Duration(d.WindowMs) * time.Millisecond, CarryOver: d.CarryOver}
+		_, _ = s.local.Sync(ctx, d.Key, p, d.Consumed)
+	}
+}
+
+// encode serialises msg, prefixed by an HMAC-SHA256 tag when a secret is set.
+func (s *GossipStore) encode(msg gossipMessage) ([]byte, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.secret) == 0 {
+		return body, nil
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return append(mac.Sum(nil), body...), nil
+}
+
+// decode verifies and parses a datagram. Unsigned or tampered packets are
+// dropped when a secret is configured.
+func (s *GossipStore) decode(pkt []byte) (gossipMessage, bool) {
+	var msg gossipMessage
+	body := pkt
+	if len(s.secret) > 0 {
+		if len(pkt) < sha256.Size {
+			return msg, false
+		}
+		tag, rest := pkt[:sha256.Size], pkt[sha256.Size:]
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(rest)
+		if !hmac.Equal(tag, mac.Sum(nil)) {
+			return msg, false
+		}
+		body = rest
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return msg, false
+	}
+	return msg, true
+}
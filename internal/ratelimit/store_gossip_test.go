@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newGossipPair(t *testing.T, secretA, secretB string) (*GossipStore, *GossipStore) {
+	t.Helper()
+	a, err := NewGossipStore(NewMemoryStore(time.Minute), "127.0.0.1:0", nil, 10*time.Millisecond, []byte(secretA))
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	b, err := NewGossipStore(NewMemoryStore(time.Minute), "127.0.0.1:0", nil, 10*time.Millisecond, []byte(secretB))
+	if err != nil {
+		a.Close()
+		t.Skipf("udp unavailable: %v", err)
+	}
+	if err := a.AddPeer(b.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddPeer(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestGossipStore_ReplicatesConsumption(t *testing.T) {
+	ctx := context.Background()
+	a, b := newGossipPair(t, "s3cret", "s3cret")
+
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	for i := 0; i < 10; i++ {
+		if !a.Allow(ctx, "k", p, 1).Allowed {
+			t.Fatalf("request %d on node a should be allowed", i+1)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		res, _ := b.local.Sync(ctx, "k", p, 0)
+		if res < 1 {
+			if b.Allow(ctx, "k", p, 1).Allowed {
+				t.Fatal("node b should deny once a's consumption arrives")
+			}
+			return
+		}
+	}
+	t.Fatal("node b never received a's consumption")
+}
+
+func TestGossipStore_KeepsCarryOver(t *testing.T) {
+	ctx := context.Background()
+	a, b := newGossipPair(t, "s3cret", "s3cret")
+
+	p := Policy{Limit: 10, Window: time.Hour, CarryOver: 0.5, Enabled: true, Cost: 1, Scope: "test"}
+	b.Allow(ctx, "k", p, 1)
+	// Give b's bucket carried-over budget beyond Limit+Burst.
+	sh := b.local.shard("k")
+	sh.mu.Lock()
+	sh.entries["k"].bucket.Tokens = 15
+	sh.mu.Unlock()
+
+	a.Allow(ctx, "k", p, 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		tokens, _ := b.local.Sync(ctx, "k", p, 0)
+		if tokens < 14.5 {
+			if tokens < 13.5 {
+				t.Fatalf("peer delta should only subtract a's request, got %.2f tokens", tokens)
+			}
+			return
+		}
+	}
+	t.Fatal("node b never received a's consumption")
+}
+
+func TestGossipStore_RejectsBadSignature(t *testing.T) {
+	ctx := context.Background()
+	a, b := newGossipPair(t, "secret-a", "secret-b")
+
+	p := Policy{Limit: 5, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	for i := 0; i < 5; i++ {
+		a.Allow(ctx, "k", p, 1)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if !b.Allow(ctx, "k", p, 1).Allowed {
+		t.Fatal("packets signed with a different secret must be ignored")
+	}
+}
+
+func TestGossipStore_RejectsReplays(t *testing.T) {
+	a, b := newGossipPair(t, "s3cret", "s3cret")
+	now := time.Now()
+
+	msg := func(seq uint64, sent time.Time) gossipMessage {
+		pkt, err := a.encode(gossipMessage{Node: a.node, Seq: seq, SentMs: sent.UnixMilli()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := b.decode(pkt)
+		if !ok {
+			t.Fatal("expected a signed datagram to decode")
+		}
+		return m
+	}
+
+	cases := []struct {
+		name string
+		msg  gossipMessage
+		want bool
+	}{
+		{"first", msg(100, now), true},
+		{"replayed", msg(100, now), false},
+		{"reordered", msg(98, now), true},
+		{"reordered replay", msg(98, now), false},
+		{"newer", msg(101, now), true},
+		{"beyond the window", msg(101-gossipReplayWindow, now), false},
+		{"stale", msg(102, now.Add(-2*gossipMaxAge)), false},
+		{"from the future", msg(103, now.Add(2*gossipMaxAge)), false},
+		{"own datagram", gossipMessage{Node: b.node, Seq: 1, SentMs: now.UnixMilli()}, false},
+	}
+	for _, c := range cases {
+		if got := b.fresh(c.msg, now); got != c.want {
+			t.Errorf("%s: expected fresh=%v, got %v", c.name, c.want, got)
+		}
+	}
+}
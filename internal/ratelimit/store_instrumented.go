@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Store instrumentation
+// ──────────────────────────────────────────────
+
+// StoreHooks are optional callbacks fired by an InstrumentedStore after each
+// operation. Use them to feed Prometheus, StatsD, tracing, etc. Hooks run on
+// the request path, so keep them fast.
+type StoreHooks struct {
+	// OnAllow fires after every Allow with the result and its latency.
+	OnAllow func(key string, policy Policy, result Result, elapsed time.Duration)
+
+	// OnReset fires after every Reset.
+	OnReset func(key string, err error, elapsed time.Duration)
+
+	// OnError fires when an operation reports an error ("allow" or "reset").
+	OnError func(op, key string, err error)
+}
+
+// StoreMetrics is a snapshot of an InstrumentedStore's counters.
+type StoreMetrics struct {
+	Allows uint64 // Allow calls that admitted the request
+	Denies uint64 // Allow calls that rejected the request
+	Resets uint64
+	Errors uint64 // backend errors from Allow (Result.Err) or Reset
+
+	AllowLatencyTotal time.Duration // sum of Allow latencies
+	AllowLatencyMax   time.Duration
+}
+
+// AllowLatencyAvg returns the mean Allow latency.
+func (m StoreMetrics) AllowLatencyAvg() time.Duration {
+	n := m.Allows + m.Denies
+	if n == 0 {
+		return 0
+	}
+	return m.AllowLatencyTotal / time.Duration(n)
+}
+
+// InstrumentedStore wraps a Store, counting outcomes and latency and firing
+// StoreHooks. It is safe for concurrent use.
+type InstrumentedStore struct {
+	inner Store
+	hooks StoreHooks
+
+	allows, denies, resets, errors atomic.Uint64
+	latencyTotal, latencyMax       atomic.Int64 // nanoseconds
+}
+
+// NewInstrumentedStore wraps inner with counters and the given hooks.
+func NewInstrumentedStore(inner Store, hooks StoreHooks) *InstrumentedStore {
+	return &InstrumentedStore{inner: inner, hooks: hooks}
+}
+
+// Inner returns the wrapped store.
+func (s *InstrumentedStore) Inner() Store { return s.inner }
+
+// Allow delegates to the inner store and records the outcome.
+func (s *InstrumentedStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	start := time.Now()
+	res := s.inner.Allow(ctx, key, policy, cost)
+	s.record(key, policy, res, time.Since(start))
+	return res
+}
+
+// record counts one outcome and fires the hooks.
+func (s *InstrumentedStore) record(key string, policy Policy, res Result, elapsed time.Duration) {
+	if res.Allowed {
+		s.allows.Add(1)
+	} else {
+		s.denies.Add(1)
+	}
+	s.latencyTotal.Add(int64(elapsed))
+	for {
+		cur := s.latencyMax.Load()
+		if int64(elapsed) <= cur || s.latencyMax.CompareAndSwap(cur, int64(elapsed)) {
+			break
+		}
+	}
+
+	if res.Err != nil {
+		s.errors.Add(1)
+		if s.hooks.OnError != nil {
+			s.hooks.OnError("allow", key, res.Err)
+		}
+	}
+	if s.hooks.OnAllow != nil {
+		s.hooks.OnAllow(key, policy, res, elapsed)
+	}
+}
+
+// AllowMulti implements MultiStore, recording each result of the batch with
+// the latency of the whole batch.
+func (s *InstrumentedStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	start := time.Now()
+	results := AllowMulti(ctx, s.inner, reqs)
+	elapsed := time.Since(start)
+	for i, res := range results {
+		s.record(reqs[i].Key, reqs[i].Policy, res, elapsed)
+	}
+	return results
+}
+
+// Reset delegates to the inner store and records the outcome.
+func (s *InstrumentedStore) Reset(key string) error {
+	start := time.Now()
+	err := s.inner.Reset(key)
+	elapsed := time.Since(start)
+
+	s.resets.Add(1)
+	if err != nil {
+		s.errors.Add(1)
+		if s.hooks.OnError != nil {
+			s.hooks.OnError("reset", key, err)
+		}
+	}
+	if s.hooks.OnReset != nil {
+		s.hooks.OnReset(key, err, elapsed)
+	}
+	return err
+}
+
+// Close closes the inner store.
+func (s *InstrumentedStore) Close() error {
+	return s.inner.Close()
+}
+
+// Metrics returns a snapshot of the counters.
+func (s *InstrumentedStore) Metrics() StoreMetrics {
+	return StoreMetrics{
+		Allows:            s.allows.Load(),
+		Denies:            s.denies.Load(),
+		Resets:            s.resets.Load(),
+		Errors:            s.errors.Load(),
+		AllowLatencyTotal: time.Duration(s.latencyTotal.Load()),
+		AllowLatencyMax:   time.Duration(s.latencyMax.Load()),
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// errStore always fails open with an error, like RedisStore when Redis is down.
+type errStore struct{ err error }
+
+func (e errStore) Allow(_ context.Context, _ string, p Policy, _ int) Result {
+	return Result{Allowed: true, Limit: p.Limit, Remaining: p.Limit, Err: e.err}
+}
+func (e errStore) Reset(string) error { return e.err }
+func (e errStore) Close() error       { return nil }
+
+func TestInstrumentedStore_Counters(t *testing.T) {
+	ctx := context.Background()
+	var hookCalls int
+	store := NewInstrumentedStore(NewMemoryStore(time.Minute), StoreHooks{
+		OnAllow: func(string, Policy, Result, time.Duration) { hookCalls++ },
+	})
+	defer store.Close()
+
+	p := Policy{Limit: 2, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	for i := 0; i < 3; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+	_ = store.Reset("k")
+
+	m := store.Metrics()
+	if m.Allows != 2 || m.Denies != 1 || m.Resets != 1 || m.Errors != 0 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+	if hookCalls != 3 {
+		t.Fatalf("OnAllow should fire for every call, got %d", hookCalls)
+	}
+	if m.AllowLatencyMax < m.AllowLatencyAvg() {
+		t.Fatal("max latency should be >= average")
+	}
+}
+
+func TestInstrumentedStore_Errors(t *testing.T) {
+	boom := errors.New("redis: connection refused")
+	var ops []string
+	store := NewInstrumentedStore(errStore{err: boom}, StoreHooks{
+		OnError: func(op, _ string, err error) {
+			if !errors.Is(err, boom) {
+				t.Errorf("unexpected error %v", err)
+			}
+			ops = append(ops, op)
+		},
+	})
+
+	store.Allow(context.Background(), "k", Policy{Limit: 1, Window: time.Minute}, 1)
+	_ = store.Reset("k")
+
+	if m := store.Metrics(); m.Errors != 2 {
+		t.Fatalf("expected 2 errors, got %d", m.Errors)
+	}
+	if len(ops) != 2 || ops[0] != "allow" || ops[1] != "reset" {
+		t.Fatalf("unexpected error hook calls: %v", ops)
+	}
+}
@@ -1,7 +1,15 @@
 package ratelimit
 
 import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,47 +17,184 @@ import (
 // In-memory Store (dev / single-instance)
 // ──────────────────────────────────────────────
 
+// memShardCount is the number of independently locked shards. Keys are
+// spread by FNV-1a hash so unrelated keys rarely contend on the same lock.
+const memShardCount = 256
+
+// memMinKeysPerShard is the smallest per-shard cap WithMaxKeys allows, so a
+// few hot keys hashed to one shard do not keep evicting each other.
+const memMinKeysPerShard = 4
+
 type memEntry struct {
+	key       string
 	bucket    *Bucket
-	expiresAt time.Time // for cleanup
+	policy    Policy        // the bucket was last tuned to
+	expiresAt time.Time     // for cleanup
+	elem      *list.Element // position in the shard's LRU list
 }
 
-// MemoryStore is a thread-safe, in-process rate-limit store backed by a
-// token-bucket per key. Expired entries are swept periodically.
-type MemoryStore struct {
+// memShard is one lock-protected slice of the key space. The LRU list holds
+// entries most-recently-used first.
+type memShard struct {
 	mu      sync.Mutex
 	entries map[string]*memEntry
-	stop    chan struct{}
+	lru     *list.List
+	max     int // 0 = unbounded
+}
+
+// MemoryStore is a thread-safe, in-process rate-limit store backed by a
+// token-bucket per key. Keys are sharded across memShardCount maps to
+// avoid a single global lock. Expired entries are swept periodically and,
+// when a key cap is set, the least-recently-used keys are evicted first.
+type MemoryStore struct {
+	shards    [memShardCount]*memShard
+	stop      chan struct{}
+	maxKeys   int
+	evictions atomic.Uint64
+
+	snapshotPath     string
+	snapshotInterval time.Duration
+}
+
+// MemoryOption configures a MemoryStore.
+type MemoryOption func(*MemoryStore)
+
+// WithMaxKeys caps the number of keys held in memory. When full, the least
+// recently used key is evicted, so a flood of spoofed identities cannot grow
+// the store without bound between sweeps. The cap is split evenly across
+// shards and enforced per shard, so it is rounded up to a multiple of
+// memShardCount, and raised to memMinKeysPerShard keys per shard (1024 in
+// all) when smaller. Stats reports the cap in effect. 0 means unbounded.
+func WithMaxKeys(n int) MemoryOption {
+	return func(s *MemoryStore) { s.maxKeys = n }
+}
+
+// WithSnapshot persists buckets to path every interval and restores them on
+// start, so single-instance deployments keep their counters across deploys.
+// A final snapshot is written on Close. An interval of 0 snapshots only on
+// Close.
+func WithSnapshot(path string, interval time.Duration) MemoryOption {
+	return func(s *MemoryStore) {
+		s.snapshotPath = path
+		s.snapshotInterval = interval
+	}
+}
+
+// MemoryStats is a point-in-time view of a MemoryStore.
+type MemoryStats struct {
+	Keys      int    // keys currently held
+	MaxKeys   int    // cap in effect, after rounding (0 = unbounded)
+	Evictions uint64 // keys evicted by the LRU cap since start
 }
 
 // NewMemoryStore creates a MemoryStore with a background cleanup goroutine
 // that runs every `cleanupInterval`.
-func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+func NewMemoryStore(cleanupInterval time.Duration, opts ...MemoryOption) *MemoryStore {
 	s := &MemoryStore{
-		entries: make(map[string]*memEntry),
-		stop:    make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	perShard := 0
+	if s.maxKeys > 0 {
+		perShard = (s.maxKeys + memShardCount - 1) / memShardCount
+		if perShard < memMinKeysPerShard {
+			log.Printf("[ratelimit] memory key cap %d raised to %d, the minimum", s.maxKeys, memMinKeysPerShard*memShardCount)
+			perShard = memMinKeysPerShard
+		}
+		s.maxKeys = perShard * memShardCount
+	}
+	for i := range s.shards {
+		s.shards[i] = &memShard{
+			entries: make(map[string]*memEntry),
+			lru:     list.New(),
+			max:     perShard,
+		}
+	}
+	if s.snapshotPath != "" {
+		if err := s.LoadSnapshot(s.snapshotPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("[ratelimit] could not restore memory snapshot %s: %v", s.snapshotPath, err)
+		}
+		if s.snapshotInterval > 0 {
+			go s.snapshotLoop()
+		}
 	}
 	go s.cleanup(cleanupInterval)
 	return s
 }
 
-// Allow checks whether the key is within its rate limit.
-func (s *MemoryStore) Allow(key string, policy Policy, cost int) Result {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Stats returns the current key count and eviction total.
+func (s *MemoryStore) Stats() MemoryStats {
+	st := MemoryStats{MaxKeys: s.maxKeys, Evictions: s.evictions.Load()}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		st.Keys += len(sh.entries)
+		sh.mu.Unlock()
+	}
+	return st
+}
 
-	now := time.Now()
-	e, ok := s.entries[key]
-	if !ok {
-		b := NewBucket(policy)
-		e = &memEntry{
-			bucket:    b,
-			expiresAt: now.Add(policy.Window * 2), // keep alive for 2 windows
+// get returns the entry for key, creating it (and evicting the LRU entry if
+// the shard is full) when missing. The caller must hold sh.mu.
+func (s *MemoryStore) get(sh *memShard, key string, policy Policy) *memEntry {
+	if e, ok := sh.entries[key]; ok {
+		sh.lru.MoveToFront(e.elem)
+		if e.policy != policy {
+			// Retune once when the policy changes, e.g. after a reload,
+			// rather than on every hit.
+			e.bucket.Retune(policy, time.Now())
+			e.policy = policy
 		}
-		s.entries[key] = e
+		return e
+	}
+	e := s.insert(sh, key, NewBucket(policy))
+	e.policy = policy
+	return e
+}
+
+// insert adds a new entry for key, evicting the LRU entry if the shard is
+// full. The caller must hold sh.mu and ensure key is not present.
+func (s *MemoryStore) insert(sh *memShard, key string, b *Bucket) *memEntry {
+	e := &memEntry{key: key, bucket: b}
+	e.elem = sh.lru.PushFront(e)
+	sh.entries[key] = e
+	if sh.max > 0 && len(sh.entries) > sh.max {
+		oldest := sh.lru.Back()
+		sh.remove(oldest.Value.(*memEntry))
+		s.evictions.Add(1)
 	}
-	// update expiry on every touch
-	e.expiresAt = now.Add(policy.Window * 2)
+	return e
+}
+
+// remove deletes e from the shard. The caller must hold sh.mu.
+func (sh *memShard) remove(e *memEntry) {
+	sh.lru.Remove(e.elem)
+	delete(sh.entries, e.key)
+}
+
+// shard returns the shard responsible for key.
+func (s *MemoryStore) shard(key string) *memShard {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *MemoryStore) shardIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % memShardCount)
+}
+
+// Allow checks whether the key is within its rate limit. The context is
+// accepted for interface compatibility; in-memory checks never block.
+func (s *MemoryStore) Allow(_ context.Context, key string, policy Policy, cost int) Result {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := time.Now()
+	e := s.get(sh, key, policy)
+	// keep alive for 2 windows (more with carry-over), refreshed on every touch
+	e.expiresAt = now.Add(policy.keepAlive())
 
 	remaining, allowed := e.bucket.Allow(cost, now)
 
@@ -68,21 +213,111 @@ func (s *MemoryStore) Allow(key string, policy Policy, cost int) Result {
 	return res
 }
 
+// AllowMulti implements MultiStore. The shards involved are locked in index
+// order, so concurrent batches cannot deadlock.
+func (s *MemoryStore) AllowMulti(_ context.Context, reqs []AllowRequest) []Result {
+	locked := make(map[*memShard]bool, len(reqs))
+	var order []int
+	for _, req := range reqs {
+		sh := s.shard(req.Key)
+		if !locked[sh] {
+			locked[sh] = true
+			order = append(order, s.shardIndex(req.Key))
+		}
+	}
+	sort.Ints(order)
+	for _, i := range order {
+		s.shards[i].mu.Lock()
+	}
+	defer func() {
+		for _, i := range order {
+			s.shards[i].mu.Unlock()
+		}
+	}()
+
+	now := time.Now()
+	entries := make([]*memEntry, len(reqs))
+	ok := true
+	for i, req := range reqs {
+		e := s.get(s.shard(req.Key), req.Key, req.Policy)
+		e.expiresAt = now.Add(req.Policy.keepAlive())
+		e.bucket.refill(now)
+		entries[i] = e
+		if e.bucket.Tokens < float64(req.Cost) {
+			ok = false
+		}
+	}
+
+	results := make([]Result, len(reqs))
+	for i, req := range reqs {
+		b := entries[i].bucket
+		affordable := b.Tokens >= float64(req.Cost)
+		if ok {
+			b.Tokens -= float64(req.Cost)
+		}
+		res := Result{
+			Allowed:   ok,
+			Limit:     req.Policy.Limit + req.Policy.Burst,
+			Remaining: int(b.Tokens),
+			ResetAt:   b.ResetUnix(),
+		}
+		if !affordable {
+			res.Allowed = false
+			res.Remaining = 0
+			res.RetryAfter = int(b.RetryAfter(req.Cost))
+			if res.RetryAfter < 1 {
+				res.RetryAfter = 1
+			}
+		} else if !ok {
+			// This bucket could pay, but another in the batch could not.
+			res.Allowed = true
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// Sync implements BucketSyncer so a MemoryStore can back a TieredStore.
+func (s *MemoryStore) Sync(_ context.Context, key string, policy Policy, consumed float64) (float64, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := time.Now()
+	e := s.get(sh, key, policy)
+	e.expiresAt = now.Add(policy.keepAlive())
+
+	e.bucket.refill(now)
+	e.bucket.Tokens -= consumed
+	if e.bucket.Tokens < 0 {
+		e.bucket.Tokens = 0
+	}
+	return e.bucket.Tokens, nil
+}
+
 // Reset removes a key from the store (e.g. after successful login).
 func (s *MemoryStore) Reset(key string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.entries, key)
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if e, ok := sh.entries[key]; ok {
+		sh.remove(e)
+	}
 	return nil
 }
 
-// Close stops the background cleanup goroutine.
+// Close stops the background goroutines and, when snapshotting is enabled,
+// writes a final snapshot so the next start resumes from current state.
 func (s *MemoryStore) Close() error {
 	close(s.stop)
+	if s.snapshotPath != "" {
+		return s.SaveSnapshot(s.snapshotPath)
+	}
 	return nil
 }
 
-// cleanup periodically removes expired entries.
+// cleanup periodically removes expired entries, one shard at a time so
+// requests on other shards are never blocked by the sweep.
 func (s *MemoryStore) cleanup(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -91,13 +326,15 @@ func (s *MemoryStore) cleanup(interval time.Duration) {
 		case <-s.stop:
 			return
 		case now := <-ticker.C:
-			s.mu.Lock()
-			for k, e := range s.entries {
-				if now.After(e.expiresAt) {
-					delete(s.entries, k)
+			for _, sh := range s.shards {
+				sh.mu.Lock()
+				for _, e := range sh.entries {
+					if now.After(e.expiresAt) {
+						sh.remove(e)
+					}
 				}
+				sh.mu.Unlock()
 			}
-			s.mu.Unlock()
 		}
 	}
 }
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// MemoryStore snapshot / restore
+// ──────────────────────────────────────────────
+
+// snapshotVersion is bumped whenever the on-disk format changes.
+const snapshotVersion = 1
+
+type memSnapshot struct {
+	Version int                `json:"version"`
+	TakenAt time.Time          `json:"taken_at"`
+	Entries []memSnapshotEntry `json:"entries"`
+}
+
+type memSnapshotEntry struct {
+	Key        string    `json:"key"`
+	Tokens     float64   `json:"tokens"`
+	MaxTokens  float64   `json:"max_tokens"`
+	RefillRate float64   `json:"refill_rate"`
+	LastRefill time.Time `json:"last_refill"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Snapshot writes every live bucket to w as JSON. Shards are locked one at a
+// time, so the snapshot is consistent per key but not across keys.
+func (s *MemoryStore) Snapshot(w io.Writer) error {
+	snap := memSnapshot{Version: snapshotVersion, TakenAt: time.Now()}
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, e := range sh.entries {
+			snap.Entries = append(snap.Entries, memSnapshotEntry{
+				Key:        e.key,
+				Tokens:     e.bucket.Tokens,
+				MaxTokens:  e.bucket.MaxTokens,
+				RefillRate: e.bucket.RefillRate,
+				LastRefill: e.bucket.LastRefill,
+				ExpiresAt:  e.expiresAt,
+			})
+		}
+		sh.mu.Unlock()
+	}
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// Restore loads buckets written by Snapshot. Expired entries are skipped and
+// keys already present in the store are left untouched. Buckets refill
+// naturally on their next use, so downtime is credited correctly.
+func (s *MemoryStore) Restore(r io.Reader) error {
+	var snap memSnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	now := time.Now()
+	for _, se := range snap.Entries {
+		if now.After(se.ExpiresAt) {
+			continue
+		}
+		sh := s.shard(se.Key)
+		sh.mu.Lock()
+		if _, exists := sh.entries[se.Key]; !exists {
+			e := s.insert(sh, se.Key, &Bucket{
+				Tokens:     se.Tokens,
+				MaxTokens:  se.MaxTokens,
+				RefillRate: se.RefillRate,
+				LastRefill: se.LastRefill,
+			})
+			e.expiresAt = se.ExpiresAt
+		}
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+// SaveSnapshot writes a snapshot to path atomically (temp file + rename), so
+// a crash mid-write never leaves a truncated snapshot behind.
+func (s *MemoryStore) SaveSnapshot(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot restores from the snapshot file at path.
+func (s *MemoryStore) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
+
+// snapshotLoop writes a snapshot every snapshotInterval until the store closes.
+func (s *MemoryStore) snapshotLoop() {
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.SaveSnapshot(s.snapshotPath); err != nil {
+				log.Printf("[ratelimit] memory snapshot failed: %v", err)
+			}
+		}
+	}
+}
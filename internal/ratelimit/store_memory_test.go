@@ -1,24 +1,31 @@
 package ratelimit
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestMemoryStore_AllowUpToLimit(t *testing.T) {
+	ctx := context.Background()
 	store := NewMemoryStore(time.Minute)
 	defer store.Close()
 
 	p := Policy{Limit: 5, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
 
 	for i := 0; i < 5; i++ {
-		res := store.Allow("test-key", p, 1)
+		res := store.Allow(ctx, "test-key", p, 1)
 		if !res.Allowed {
 			t.Fatalf("request %d should be allowed", i+1)
 		}
 	}
 
-	res := store.Allow("test-key", p, 1)
+	res := store.Allow(ctx, "test-key", p, 1)
 	if res.Allowed {
 		t.Fatal("6th request should be denied")
 	}
@@ -28,35 +35,65 @@ func TestMemoryStore_AllowUpToLimit(t *testing.T) {
 }
 
 func TestMemoryStore_DifferentKeysIndependent(t *testing.T) {
+	ctx := context.Background()
 	store := NewMemoryStore(time.Minute)
 	defer store.Close()
 
 	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
 
-	res := store.Allow("key-a", p, 1)
+	res := store.Allow(ctx, "key-a", p, 1)
 	if !res.Allowed {
 		t.Fatal("key-a should be allowed")
 	}
-	res = store.Allow("key-a", p, 1)
+	res = store.Allow(ctx, "key-a", p, 1)
 	if res.Allowed {
 		t.Fatal("key-a should be denied after limit")
 	}
 
 	// key-b is independent
-	res = store.Allow("key-b", p, 1)
+	res = store.Allow(ctx, "key-b", p, 1)
 	if !res.Allowed {
 		t.Fatal("key-b should be allowed (independent bucket)")
 	}
 }
 
+func TestMemoryStore_PolicyChangeRetunesBucket(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	for i := 0; i < 5; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+
+	// Lowering the limit caps the tokens left at the new capacity.
+	p.Limit = 2
+	res := store.Allow(ctx, "k", p, 1)
+	if !res.Allowed || res.Limit != 2 || res.Remaining != 1 {
+		t.Fatalf("after lowering: got %+v", res)
+	}
+	store.Allow(ctx, "k", p, 1)
+	if res := store.Allow(ctx, "k", p, 1); res.Allowed {
+		t.Fatal("expected the lowered limit to apply")
+	}
+
+	// Raising it keeps the tokens already spent.
+	p.Limit = 20
+	if res := store.Allow(ctx, "k", p, 1); res.Allowed {
+		t.Fatalf("expected an empty bucket to stay empty, got %+v", res)
+	}
+}
+
 func TestMemoryStore_Reset(t *testing.T) {
+	ctx := context.Background()
 	store := NewMemoryStore(time.Minute)
 	defer store.Close()
 
 	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
 
-	store.Allow("reset-key", p, 1)
-	res := store.Allow("reset-key", p, 1)
+	store.Allow(ctx, "reset-key", p, 1)
+	res := store.Allow(ctx, "reset-key", p, 1)
 	if res.Allowed {
 		t.Fatal("should be denied")
 	}
@@ -64,19 +101,20 @@ func TestMemoryStore_Reset(t *testing.T) {
 	// Reset the key
 	store.Reset("reset-key")
 
-	res = store.Allow("reset-key", p, 1)
+	res = store.Allow(ctx, "reset-key", p, 1)
 	if !res.Allowed {
 		t.Fatal("should be allowed after reset")
 	}
 }
 
 func TestMemoryStore_Headers(t *testing.T) {
+	ctx := context.Background()
 	store := NewMemoryStore(time.Minute)
 	defer store.Close()
 
 	p := Policy{Limit: 10, Window: time.Minute, Burst: 5, Enabled: true, Cost: 1, Scope: "test"}
 
-	res := store.Allow("header-key", p, 1)
+	res := store.Allow(ctx, "header-key", p, 1)
 	if !res.Allowed {
 		t.Fatal("should be allowed")
 	}
@@ -90,3 +128,160 @@ func TestMemoryStore_Headers(t *testing.T) {
 		t.Fatal("resetAt should be a positive unix timestamp")
 	}
 }
+
+func TestMemoryStore_ConcurrentSameKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 100, Window: time.Hour, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if store.Allow(ctx, "shared", p, 1).Allowed {
+					allowed.Add(1)
+				}
+				store.Allow(ctx, fmt.Sprintf("other-%d-%d", g, i), p, 1)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 100 {
+		t.Fatalf("expected exactly 100 admissions on the shared key, got %d", got)
+	}
+}
+
+func BenchmarkMemoryStore_AllowParallel(b *testing.B) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 1 << 30, Window: time.Minute, Enabled: true, Cost: 1}
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("k-%d", n.Add(1))
+		for pb.Next() {
+			store.Allow(ctx, key, p, 1)
+		}
+	})
+}
+
+// keysInShard returns n distinct keys that hash to the same shard.
+func keysInShard(s *MemoryStore, n int) []string {
+	var keys []string
+	target := s.shard("seed")
+	for i := 0; len(keys) < n; i++ {
+		k := fmt.Sprintf("k%d", i)
+		if s.shard(k) == target {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestMemoryStore_MaxKeysEvictsLRU(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, WithMaxKeys(memMinKeysPerShard*memShardCount))
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Minute, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+	k := keysInShard(store, memMinKeysPerShard+1)
+	last := k[memMinKeysPerShard]
+
+	for _, key := range k[:memMinKeysPerShard] {
+		store.Allow(ctx, key, p, 1)
+	}
+	store.Allow(ctx, k[0], p, 1) // k[0] is now most recently used
+	store.Allow(ctx, last, p, 1) // evicts k[1]
+
+	if st := store.Stats(); st.Keys != memMinKeysPerShard || st.Evictions != 1 {
+		t.Fatalf("expected %d keys and 1 eviction, got %+v", memMinKeysPerShard, st)
+	}
+	if store.Allow(ctx, k[0], p, 1).Allowed {
+		t.Fatal("recently used key should still be tracked")
+	}
+	if !store.Allow(ctx, k[1], p, 1).Allowed {
+		t.Fatal("evicted key should start with a fresh bucket")
+	}
+	if store.Allow(ctx, last, p, 1).Allowed {
+		t.Fatal("recently used key should still be tracked")
+	}
+}
+
+func TestMemoryStore_MaxKeysBoundsFlood(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, WithMaxKeys(memMinKeysPerShard*memShardCount))
+	defer store.Close()
+
+	p := Policy{Limit: 1, Window: time.Minute, Enabled: true, Cost: 1}
+	for i := 0; i < 5000; i++ {
+		store.Allow(ctx, fmt.Sprintf("spoofed-%d", i), p, 1)
+	}
+	if st := store.Stats(); st.Keys > st.MaxKeys {
+		t.Fatalf("store should hold at most %d keys, got %d", st.MaxKeys, st.Keys)
+	}
+}
+
+func TestMemoryStore_MaxKeysReportsEffectiveCap(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		expected int
+	}{
+		{"unbounded", 0, 0},
+		{"below the minimum", 10, memMinKeysPerShard * memShardCount},
+		{"rounded up", 100001, 391 * memShardCount},
+		{"exact", 2048, 2048},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore(time.Minute, WithMaxKeys(tt.max))
+			defer store.Close()
+			if got := store.Stats().MaxKeys; got != tt.expected {
+				t.Errorf("expected an effective cap of %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rl.json")
+	p := Policy{Limit: 3, Window: time.Hour, Burst: 0, Enabled: true, Cost: 1, Scope: "test"}
+
+	first := NewMemoryStore(time.Minute, WithSnapshot(path, 0))
+	for i := 0; i < 3; i++ {
+		first.Allow(ctx, "login", p, 1)
+	}
+	if err := first.Close(); err != nil { // writes the snapshot
+		t.Fatal(err)
+	}
+
+	second := NewMemoryStore(time.Minute, WithSnapshot(path, 0))
+	defer second.Close()
+	if second.Allow(ctx, "login", p, 1).Allowed {
+		t.Fatal("restored bucket should still be exhausted")
+	}
+	if !second.Allow(ctx, "fresh", p, 1).Allowed {
+		t.Fatal("unknown key should start full")
+	}
+}
+
+func TestMemoryStore_RestoreSkipsExpired(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	snap := `{"version":1,"entries":[{"key":"old","tokens":0,"max_tokens":1,"refill_rate":0.001,"expires_at":"2000-01-01T00:00:00Z"}]}`
+	if err := store.Restore(strings.NewReader(snap)); err != nil {
+		t.Fatal(err)
+	}
+	if st := store.Stats(); st.Keys != 0 {
+		t.Fatalf("expired entries should be skipped, got %d keys", st.Keys)
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ──────────────────────────────────────────────
+// Dual-write migration store
+// ──────────────────────────────────────────────
+
+// MigrationStore writes every request to two stores and answers from one of
+// them. Use it to switch backends (memory → Redis, or between two Redis
+// prefixes during a script change) without resetting every bucket: run it
+// reading the old store for at least two policy windows so the new store
+// warms up, then read the new store, then drop the old one.
+//
+// Both stores are consulted concurrently, so latency is that of the slower
+// one. Errors from the store not being read are counted, not returned.
+type MigrationStore struct {
+	old, new Store
+	readOld  atomic.Bool
+
+	shadowErrors atomic.Uint64
+}
+
+// NewMigrationStore creates a MigrationStore that reads from newStore.
+func NewMigrationStore(oldStore, newStore Store) *MigrationStore {
+	return &MigrationStore{old: oldStore, new: newStore}
+}
+
+// ReadOld selects which store answers requests. It is safe to flip at
+// runtime, e.g. from an admin endpoint.
+func (m *MigrationStore) ReadOld(v bool) { m.readOld.Store(v) }
+
+// ShadowErrors returns how many errors the non-answering store has reported.
+func (m *MigrationStore) ShadowErrors() uint64 { return m.shadowErrors.Load() }
+
+// stores returns the answering store first.
+func (m *MigrationStore) stores() (primary, shadow Store) {
+	if m.readOld.Load() {
+		return m.old, m.new
+	}
+	return m.new, m.old
+}
+
+// Allow implements Store.
+func (m *MigrationStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	primary, shadow := m.stores()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if res := shadow.Allow(ctx, key, policy, cost); res.Err != nil {
+			m.shadowErrors.Add(1)
+		}
+	}()
+	res := primary.Allow(ctx, key, policy, cost)
+	wg.Wait()
+	return res
+}
+
+// AllowMulti implements MultiStore, batching in both stores.
+func (m *MigrationStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	primary, shadow := m.stores()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, res := range AllowMulti(ctx, shadow, reqs) {
+			if res.Err != nil {
+				m.shadowErrors.Add(1)
+				return
+			}
+		}
+	}()
+	results := AllowMulti(ctx, primary, reqs)
+	wg.Wait()
+	return results
+}
+
+// Inner returns the answering store.
+func (m *MigrationStore) Inner() Store {
+	primary, _ := m.stores()
+	return primary
+}
+
+// Reset implements Store. The key is removed from both stores.
+func (m *MigrationStore) Reset(key string) error {
+	primary, shadow := m.stores()
+	if err := shadow.Reset(key); err != nil {
+		m.shadowErrors.Add(1)
+	}
+	return primary.Reset(key)
+}
+
+// Close implements Store and closes both stores.
+func (m *MigrationStore) Close() error {
+	return errors.Join(m.new.Close(), m.old.Close())
+}
+
+// Ping implements Healther for the answering store.
+func (m *MigrationStore) Ping(ctx context.Context) error {
+	primary, _ := m.stores()
+	return pingInner(ctx, primary)
+}
+
+// Status implements Healther for the answering store.
+func (m *MigrationStore) Status(ctx context.Context) HealthStatus {
+	primary, _ := m.stores()
+	return CheckHealth(ctx, primary)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrationStore_WritesBothReadsSelected(t *testing.T) {
+	ctx := context.Background()
+	oldStore := NewMemoryStore(time.Minute)
+	newStore := NewMemoryStore(time.Minute)
+	m := NewMigrationStore(oldStore, newStore)
+	defer m.Close()
+
+	p := Policy{Limit: 3, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+
+	// Warm-up phase: answer from the old store, shadow-write the new one.
+	m.ReadOld(true)
+	oldStore.Allow(ctx, "k", p, 2) // consumption from before the migration
+	if res := m.Allow(ctx, "k", p, 1); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("old-store result = %+v, want allowed with 0 remaining", res)
+	}
+
+	// Cut over: the new store has seen the shadow write.
+	m.ReadOld(false)
+	if res := m.Allow(ctx, "k", p, 1); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("new-store result = %+v, want allowed with 1 remaining", res)
+	}
+	if res := oldStore.Allow(ctx, "k", p, 1); res.Allowed {
+		t.Fatal("old store should still receive writes after the cut-over")
+	}
+}
+
+func TestMigrationStore_ShadowErrorsAreCounted(t *testing.T) {
+	ctx := context.Background()
+	oldStore := NewMockStore()
+	oldStore.FailWith(errors.New("old redis gone"))
+	m := NewMigrationStore(oldStore, NewMemoryStore(time.Minute))
+	defer m.Close()
+
+	p := Policy{Limit: 3, Window: time.Hour, Enabled: true, Cost: 1, Scope: "test"}
+	if res := m.Allow(ctx, "k", p, 1); res.Err != nil || !res.Allowed {
+		t.Fatalf("result = %+v, want clean allow from the new store", res)
+	}
+	if err := m.Reset("k"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if n := m.ShadowErrors(); n != 2 {
+		t.Fatalf("shadow errors = %d, want 2", n)
+	}
+}
@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Mock store (tests)
+// ──────────────────────────────────────────────
+
+// MockCall records one call made against a MockStore.
+type MockCall struct {
+	Op     string // "allow", "reset", "close", "acquire" or "release"
+	Key    string
+	Policy Policy // allow only
+	Cost   int    // allow only
+	Limit  int    // acquire only
+}
+
+// MockStore is a Store and ConcurrencyStore for unit tests. By default every
+// request is allowed and concurrency is counted exactly; responses, latency
+// and failures can be programmed per test, and every call is recorded. It is
+// safe for concurrent use.
+//
+//	store := ratelimit.NewMockStore()
+//	store.QueueResult("ip:1.2.3.4", ratelimit.Result{Allowed: false, RetryAfter: 30})
+//	store.FailWith(errors.New("redis down"))
+type MockStore struct {
+	mu       sync.Mutex
+	allowFn  func(key string, policy Policy, cost int) Result
+	queued   map[string][]Result
+	latency  time.Duration
+	err      error
+	inflight map[string]int
+	calls    []MockCall
+	closed   bool
+}
+
+// NewMockStore returns a MockStore that allows everything.
+func NewMockStore() *MockStore {
+	return &MockStore{
+		queued:   make(map[string][]Result),
+		inflight: make(map[string]int),
+	}
+}
+
+// SetAllowFunc replaces the default allow-everything behaviour. fn is called
+// for every Allow that has no queued result.
+func (m *MockStore) SetAllowFunc(fn func(key string, policy Policy, cost int) Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowFn = fn
+}
+
+// DenyAll makes every Allow return a denial with the given Retry-After.
+func (m *MockStore) DenyAll(retryAfter int) {
+	m.SetAllowFunc(func(_ string, p Policy, _ int) Result {
+		return Result{
+			Allowed:    false,
+			Limit:      p.Limit + p.Burst,
+			RetryAfter: retryAfter,
+			ResetAt:    time.Now().Unix() + int64(retryAfter),
+		}
+	})
+}
+
+// QueueResult queues results to be returned, in order, by the next Allow
+// calls for key. Queued results take precedence over the allow function.
+func (m *MockStore) QueueResult(key string, results ...Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queued[key] = append(m.queued[key], results...)
+}
+
+// SetLatency delays every Allow by d. If ctx ends first, Allow fails open
+// with Result.Err set to the context error, like the Redis store.
+func (m *MockStore) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = d
+}
+
+// FailWith simulates a backend outage: Allow fails open with Result.Err set,
+// Acquire fails open, and Reset, Release and Ping return err. nil clears it.
+func (m *MockStore) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Allow implements Store.
+func (m *MockStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Op: "allow", Key: key, Policy: policy, Cost: cost})
+	latency, err := m.latency, m.err
+	m.mu.Unlock()
+
+	max := policy.Limit + policy.Burst
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return Result{Allowed: true, Limit: max, Remaining: max, Err: ctx.Err()}
+		}
+	}
+	if err != nil {
+		return Result{Allowed: true, Limit: max, Remaining: max, Err: err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if q := m.queued[key]; len(q) > 0 {
+		m.queued[key] = q[1:]
+		return q[0]
+	}
+	if m.allowFn != nil {
+		return m.allowFn(key, policy, cost)
+	}
+	return Result{Allowed: true, Limit: max, Remaining: max}
+}
+
+// Reset implements Store. Queued results for key are discarded.
+func (m *MockStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Op: "reset", Key: key})
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.queued, key)
+	return nil
+}
+
+// Close implements Store.
+func (m *MockStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Op: "close"})
+	m.closed = true
+	return nil
+}
+
+// Acquire implements ConcurrencyStore.
+func (m *MockStore) Acquire(key string, limit int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Op: "acquire", Key: key, Limit: limit})
+	if m.err != nil {
+		return true, m.err // fail open
+	}
+	if m.inflight[key] >= limit {
+		return false, nil
+	}
+	m.inflight[key]++
+	return true, nil
+}
+
+// Release implements ConcurrencyStore.
+func (m *MockStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Op: "release", Key: key})
+	if m.err != nil {
+		return m.err
+	}
+	if m.inflight[key] > 0 {
+		m.inflight[key]--
+	}
+	if m.inflight[key] == 0 {
+		delete(m.inflight, key)
+	}
+	return nil
+}
+
+// Ping implements Healther. It fails while FailWith is set.
+func (m *MockStore) Ping(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// Status implements Healther.
+func (m *MockStore) Status(ctx context.Context) HealthStatus {
+	return pingStatus(ctx, "mock", globalFailMode(), m.Ping)
+}
+
+// ──────────────────────────────────────────────
+// Inspection
+// ──────────────────────────────────────────────
+
+// Calls returns a copy of every recorded call, oldest first.
+func (m *MockStore) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallCount returns how many calls of op were recorded.
+func (m *MockStore) CallCount(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, c := range m.calls {
+		if c.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// ClearCalls forgets all recorded calls.
+func (m *MockStore) ClearCalls() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+// InFlight returns the current concurrency count for key.
+func (m *MockStore) InFlight(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inflight[key]
+}
+
+// Closed reports whether Close was called.
+func (m *MockStore) Closed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
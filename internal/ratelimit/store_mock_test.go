@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMockStore_QueuedResultsThenDefault(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockStore()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+
+	m.QueueResult("k", Result{Allowed: false, RetryAfter: 7})
+	if res := m.Allow(ctx, "k", p, 1); res.Allowed || res.RetryAfter != 7 {
+		t.Fatalf("1st result = %+v, want queued denial", res)
+	}
+	if res := m.Allow(ctx, "k", p, 1); !res.Allowed || res.Remaining != 5 {
+		t.Fatalf("2nd result = %+v, want default allow", res)
+	}
+
+	m.DenyAll(3)
+	if res := m.Allow(ctx, "other", p, 1); res.Allowed || res.RetryAfter != 3 {
+		t.Fatalf("DenyAll result = %+v", res)
+	}
+	if n := m.CallCount("allow"); n != 3 {
+		t.Fatalf("allow calls = %d, want 3", n)
+	}
+	if c := m.Calls()[0]; c.Key != "k" || c.Policy.Scope != "test" || c.Cost != 1 {
+		t.Fatalf("recorded call = %+v", c)
+	}
+}
+
+func TestMockStore_FaultsFailOpen(t *testing.T) {
+	m := NewMockStore()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	boom := errors.New("boom")
+
+	m.FailWith(boom)
+	if res := m.Allow(context.Background(), "k", p, 1); !res.Allowed || !errors.Is(res.Err, boom) {
+		t.Fatalf("result = %+v, want fail-open with Err", res)
+	}
+	if ok, err := m.Acquire("k", 1); !ok || !errors.Is(err, boom) {
+		t.Fatalf("Acquire = %v, %v, want fail-open with err", ok, err)
+	}
+	if err := m.Reset("k"); !errors.Is(err, boom) {
+		t.Fatalf("Reset err = %v", err)
+	}
+	m.FailWith(nil)
+
+	m.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if res := m.Allow(ctx, "k", p, 1); !res.Allowed || !errors.Is(res.Err, context.DeadlineExceeded) {
+		t.Fatalf("result = %+v, want deadline fail-open", res)
+	}
+}
+
+func TestMiddleware_WithMockStore(t *testing.T) {
+	initTestConfig()
+	m := NewMockStore()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test", ConcurrencyLimit: 1}
+	limiter := NewLimiter(m, p, KeyByIP(), WithConcurrency(m))
+
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := m.InFlight("ip:1.2.3.4"); n != 1 {
+			t.Errorf("in-flight during request = %d, want 1", n)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if n := m.InFlight("ip:1.2.3.4"); n != 0 {
+		t.Fatalf("in-flight after request = %d, want 0", n)
+	}
+
+	m.QueueResult("ip:1.2.3.4", Result{Allowed: false, Limit: 5, RetryAfter: 42})
+	rr := serve()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "42" {
+		t.Fatalf("Retry-After = %q, want 42", got)
+	}
+}
@@ -0,0 +1,250 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gohst/internal/config"
+	"gohst/internal/db"
+)
+
+// ──────────────────────────────────────────────
+// Per-key limit overrides (store decorator)
+// ──────────────────────────────────────────────
+
+// KeyOverrideStore wraps a Store and applies per-key policy overrides, so
+// one customer can be granted a custom limit ("this partner gets
+// 5000/min") without new code or a limiter of its own.
+//
+// Overrides come from a PolicyProvider looked up by name: a client key
+// such as "apikey:partner-42", which applies in every scope, or a scope and
+// a key separated by a space ("api_default apikey:partner-42"), which
+// wins in that scope. Bucket keys carrying a prefix (route rules,
+// reputation or Tor buckets, ...) match the client key they end with,
+// which starts at the first "<type>:" segment of a known key type.
+//
+// The store only sees the limit, window and burst of an override, and
+// Enabled, which exempts the key; the other fields are ignored. Wrap the
+// store outside any AnonymizingStore, which hides the keys.
+type KeyOverrideStore struct {
+	inner     Store
+	overrides PolicyProvider
+}
+
+// NewKeyOverrideStore wraps inner with the overrides of provider.
+func NewKeyOverrideStore(inner Store, overrides PolicyProvider) *KeyOverrideStore {
+	return &KeyOverrideStore{inner: inner, overrides: overrides}
+}
+
+// Allow charges key against its overridden policy, or policy when it has
+// no override.
+func (s *KeyOverrideStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	if o, ok := s.lookup(policy.Scope, key); ok {
+		policy = o.Apply(policy)
+		if !policy.Enabled {
+			limit := policy.Limit + policy.Burst
+			return Result{Allowed: true, Limit: limit, Remaining: limit}
+		}
+	}
+	return s.inner.Allow(ctx, key, policy, cost)
+}
+
+// AllowMulti implements MultiStore. Exempt keys are left out of the batch
+// and allowed.
+func (s *KeyOverrideStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	results := make([]Result, len(reqs))
+	batch := make([]AllowRequest, 0, len(reqs))
+	index := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if o, ok := s.lookup(req.Policy.Scope, req.Key); ok {
+			req.Policy = o.Apply(req.Policy)
+			if !req.Policy.Enabled {
+				limit := req.Policy.Limit + req.Policy.Burst
+				results[i] = Result{Allowed: true, Limit: limit, Remaining: limit}
+				continue
+			}
+		}
+		batch = append(batch, req)
+		index = append(index, i)
+	}
+	if len(batch) > 0 {
+		for j, res := range AllowMulti(ctx, s.inner, batch) {
+			results[index[j]] = res
+		}
+	}
+	return results
+}
+
+// Inner returns the wrapped store.
+func (s *KeyOverrideStore) Inner() Store { return s.inner }
+
+// lookup finds the override of key, or of the client key it ends with,
+// scoped overrides first.
+func (s *KeyOverrideStore) lookup(scope, key string) (PolicyOverride, bool) {
+	candidates := []string{key}
+	if ck := clientKey(key); ck != "" && ck != key {
+		candidates = append(candidates, ck)
+	}
+	for _, k := range candidates {
+		if scope != "" {
+			if o, ok := s.overrides.LookupPolicy(scope + " " + k); ok {
+				return o, true
+			}
+		}
+		if o, ok := s.overrides.LookupPolicy(k); ok {
+			return o, true
+		}
+	}
+	return PolicyOverride{}, false
+}
+
+// clientKeyTypes are the key types a key function renders as a "<type>:"
+// prefix.
+var clientKeyTypes = map[string]bool{
+	KeyTypeToken: true, KeyTypeUser: true, KeyTypeSession: true, KeyTypeIP: true,
+	KeyTypeIPUA: true, KeyTypeIPRoute: true, KeyTypeIPIdent: true, KeyTypeAPIKey: true,
+	KeyTypeHeader: true, KeyTypeCookie: true, KeyTypeASN: true, KeyTypeGeo: true,
+	KeyTypeGraphQL: true, KeyTypeService: true, KeyTypeGateway: true, KeyTypeJWT: true,
+	KeyTypeOrigin: true, KeyTypeTenant: true, KeyTypeTLS: true,
+}
+
+// clientKey returns the client key a bucket key ends with: the key from its
+// first segment naming a key type, so "reputation:apikey:x" yields
+// "apikey:x". Everything after that segment belongs to the client key, so
+// a tenant ID such as "apikey:x" in "tenant:apikey:x" is never taken for
+// another key type. It returns "" when no segment names a key type.
+func clientKey(key string) string {
+	for rest := key; ; {
+		typ, after, found := strings.Cut(rest, ":")
+		if !found {
+			return ""
+		}
+		if clientKeyTypes[typ] {
+			return rest
+		}
+		rest = after
+	}
+}
+
+// Reset removes a key from the inner store.
+func (s *KeyOverrideStore) Reset(key string) error { return s.inner.Reset(key) }
+
+// Close closes the inner store.
+func (s *KeyOverrideStore) Close() error { return s.inner.Close() }
+
+// Ping implements Healther by delegating to the wrapped store.
+func (s *KeyOverrideStore) Ping(ctx context.Context) error { return pingInner(ctx, s.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (s *KeyOverrideStore) Status(ctx context.Context) HealthStatus { return CheckHealth(ctx, s.inner) }
+
+// NewKeyOverridesFromConfig creates the per-key override source selected by
+// RATE_LIMIT_KEY_OVERRIDES ("redis" or "db"), cached for
+// RATE_LIMIT_KEY_OVERRIDES_TTL, or returns nil when it is not set.
+func NewKeyOverridesFromConfig() *CachedPolicyProvider {
+	cfg := config.RateLimit
+	ttl := time.Duration(cfg.KeyOverridesTTL) * time.Second
+	switch cfg.KeyOverrides {
+	case "redis":
+		log.Printf("[ratelimit] loading per-key overrides from Redis (cached %s)", ttl)
+		return NewCachedPolicyProvider(RedisKeyOverrideLoader(NewRedisStore()), ttl)
+	case "db":
+		log.Printf("[ratelimit] loading per-key overrides from the database (cached %s)", ttl)
+		primary := db.GetPrimaryDB()
+		if primary == nil {
+			log.Println("[ratelimit] warning: no primary DB available for key overrides")
+			return NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+				return nil, fmt.Errorf("database not available")
+			}, ttl)
+		}
+		return NewCachedPolicyProvider(DBKeyOverrideLoader(primary.DB), ttl)
+	}
+	return nil
+}
+
+// keyOverridesHash is the Redis hash of per-key overrides, under the store
+// prefix.
+const keyOverridesHash = "key_overrides"
+
+// RedisKeyOverrideLoader loads overrides from the "key_overrides" hash of
+// s: one field per key (or "scope key") holding a JSON override, e.g.
+// HSET gohst:rl:key_overrides apikey:partner-42 '{"limit":5000}'. Invalid
+// fields are logged and skipped.
+func RedisKeyOverrideLoader(s *RedisStore) PolicyLoadFunc {
+	return func(ctx context.Context) (map[string]PolicyOverride, error) {
+		ctx, cancel := s.withTimeout(ctx)
+		defer cancel()
+		fields, err := s.client.HGetAll(ctx, s.prefix+keyOverridesHash).Result()
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]PolicyOverride, len(fields))
+		for name, data := range fields {
+			dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+			dec.DisallowUnknownFields()
+			var o PolicyOverride
+			if err := dec.Decode(&o); err == nil {
+				err = o.Validate()
+			}
+			if err != nil {
+				log.Printf("[ratelimit] skipping key override %q from Redis: %v", truncateKey(name), err)
+				continue
+			}
+			out[name] = o
+		}
+		return out, nil
+	}
+}
+
+// DBKeyOverrideLoader loads overrides from the rate_limit_key_overrides
+// table. A NULL scope applies the row in every scope, and NULL columns
+// keep the key's policy. Rows with invalid values are logged and skipped.
+func DBKeyOverrideLoader(conn *sql.DB) PolicyLoadFunc {
+	return func(ctx context.Context) (map[string]PolicyOverride, error) {
+		query := `
+			SELECT rate_key, scope, request_limit, window_seconds, burst, enabled
+			FROM rate_limit_key_overrides`
+
+		rows, err := conn.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		out := make(map[string]PolicyOverride)
+		for rows.Next() {
+			var (
+				key                  string
+				scope                sql.NullString
+				limit, window, burst sql.NullInt64
+				enabled              sql.NullBool
+			)
+			if err := rows.Scan(&key, &scope, &limit, &window, &burst, &enabled); err != nil {
+				return nil, err
+			}
+			o := PolicyOverride{Limit: nullInt(limit), Burst: nullInt(burst)}
+			if window.Valid {
+				w := PolicyWindow(time.Duration(window.Int64) * time.Second)
+				o.Window = &w
+			}
+			if enabled.Valid {
+				o.Enabled = &enabled.Bool
+			}
+			if err := o.Validate(); err != nil {
+				log.Printf("[ratelimit] skipping key override %q from the database: %v", truncateKey(key), err)
+				continue
+			}
+			if scope.Valid && scope.String != "" {
+				key = scope.String + " " + key
+			}
+			out[key] = o
+		}
+		return out, rows.Err()
+	}
+}
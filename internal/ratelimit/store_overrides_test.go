@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeyOverrideStore(t *testing.T) {
+	partner, searchLimit, off := 5000, 50, false
+	overrides := NewCachedPolicyProvider(func(context.Context) (map[string]PolicyOverride, error) {
+		return map[string]PolicyOverride{
+			"apikey:partner":        {Limit: &partner},
+			"search apikey:partner": {Limit: &searchLimit},
+			"apikey:internal":       {Enabled: &off},
+		}, nil
+	}, time.Hour)
+	inner := NewMockStore()
+	s := NewKeyOverrideStore(inner, overrides)
+	ctx := context.Background()
+	api := Policy{Limit: 100, Window: time.Minute, Burst: 10, Enabled: true, Cost: 1, Scope: "api"}
+	search := api
+	search.Scope = "search"
+
+	s.Allow(ctx, "apikey:partner", api, 1)
+	s.Allow(ctx, "reputation:apikey:partner", api, 1) // prefixed bucket key
+	s.Allow(ctx, "search:apikey:partner", search, 1)  // scoped override wins
+	s.Allow(ctx, "apikey:other", api, 1)
+	s.Allow(ctx, "tenant:apikey:partner", api, 1)            // tenant ID, not an API key
+	s.Allow(ctx, "reputation:tenant:apikey:partner", api, 1) // the same, prefixed
+	s.Allow(ctx, "x:partner", api, 1)                        // no key type
+	calls := inner.Calls()
+	want := []int{5000, 5000, 50, 100, 100, 100, 100}
+	if len(calls) != len(want) {
+		t.Fatalf("got %+v", calls)
+	}
+	for i, limit := range want {
+		if calls[i].Policy.Limit != limit || calls[i].Policy.Burst != 10 {
+			t.Errorf("call %d (%s): expected limit %d, got %d/%d", i, calls[i].Key, limit, calls[i].Policy.Limit, calls[i].Policy.Burst)
+		}
+	}
+
+	inner.ClearCalls()
+	s.AllowMulti(ctx, []AllowRequest{
+		{Key: "reputation:apikey:partner", Policy: api, Cost: 1},
+		{Key: "tenant:apikey:partner", Policy: api, Cost: 1},
+	})
+	if calls := inner.Calls(); len(calls) != 2 || calls[0].Policy.Limit != 5000 || calls[1].Policy.Limit != 100 {
+		t.Errorf("expected AllowMulti to match only the API key, got %+v", calls)
+	}
+
+	inner.ClearCalls()
+	inner.DenyAll(10)
+	if res := s.Allow(ctx, "apikey:internal", api, 1); !res.Allowed {
+		t.Error("expected a disabled override to exempt the key")
+	}
+	if n := len(inner.Calls()); n != 0 {
+		t.Errorf("expected an exempt key not to reach the store, got %d calls", n)
+	}
+}
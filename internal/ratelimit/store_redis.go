@@ -2,7 +2,12 @@ package ratelimit
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"log"
+	"os"
 	"strconv"
 	"time"
 
@@ -20,30 +25,104 @@ import (
 // An atomic Lua script performs the refill-then-consume operation so that
 // concurrent requests can never over-admit.
 type RedisStore struct {
-	client *redis.Client
-	prefix string
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration // per-command deadline; 0 means caller's ctx only
 }
 
 // NewRedisStore creates a RedisStore. It reads connection details from the
-// rate-limit config (falling back to session Redis config).
+// rate-limit config (falling back to session Redis config). When TLS is
+// configured the connection is encrypted; a username enables Redis 6 ACL auth.
 func NewRedisStore() *RedisStore {
+	return NewRedisStoreWithPrefix(config.RateLimit.RedisPrefix)
+}
+
+// NewRedisStoreWithPrefix is NewRedisStore with a custom key prefix, e.g. to
+// keep the old key layout alive during a migration.
+func NewRedisStoreWithPrefix(prefix string) *RedisStore {
 	cfg := config.RateLimit.Redis
 	host := cfg.Host
 	port := cfg.Port
 	password := cfg.Password
 	db := cfg.DB
-	prefix := config.RateLimit.RedisPrefix
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     host + ":" + strconv.Itoa(port),
-		Password: password,
-		DB:       db,
-	})
+	timeout := time.Duration(config.RateLimit.RedisTimeoutMs) * time.Millisecond
+
+	opts := &redis.Options{
+		Addr:         host + ":" + strconv.Itoa(port),
+		Username:     cfg.Username,
+		Password:     password,
+		DB:           db,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		// Honour request-context deadlines, not just the static timeouts.
+		ContextTimeoutEnabled: true,
+	}
+	if cfg.TLS != nil {
+		tlsCfg, err := buildTLSConfig(cfg.TLS, host)
+		if err != nil {
+			// Keep TLS on with system roots rather than silently downgrading.
+			log.Printf("[ratelimit] redis TLS config error, using system roots: %v", err)
+			tlsCfg = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		}
+		opts.TLSConfig = tlsCfg
+	}
+
+	client := redis.NewClient(opts)
 
 	return &RedisStore{
-		client: client,
-		prefix: prefix,
+		client:  client,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+// withTimeout derives a context bounded by the configured command timeout so
+// a slow Redis can never block a request indefinitely.
+func (s *RedisStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// buildTLSConfig converts a config.TLSConfig into a *tls.Config. The CA bundle
+// is appended to the system pool so public and private CAs both verify.
+func buildTLSConfig(c *config.TLSConfig, host string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.ServerName != "" {
+		tlsCfg.ServerName = c.ServerName
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
 	}
+
+	return tlsCfg, nil
 }
 
 // luaTokenBucket is an atomic Lua script that:
@@ -52,11 +131,12 @@ func NewRedisStore() *RedisStore {
 //  3. returns [allowed(0/1), remaining, retryAfterMs, resetAtUnix]
 //
 // KEYS[1] = bucket key
-// ARGV[1] = max_tokens  (limit + burst)
+// ARGV[1] = max_tokens  (limit + burst + carry-over)
 // ARGV[2] = refill_rate (tokens per second, as float string)
 // ARGV[3] = cost
 // ARGV[4] = now_ms      (current unix time in milliseconds)
 // ARGV[5] = ttl_seconds  (key expiry)
+// ARGV[6] = start_tokens (limit + burst)
 var luaTokenBucket = redis.NewScript(`
 local key       = KEYS[1]
 local max       = tonumber(ARGV[1])
@@ -64,14 +144,15 @@ local rate      = tonumber(ARGV[2])
 local cost      = tonumber(ARGV[3])
 local now_ms    = tonumber(ARGV[4])
 local ttl       = tonumber(ARGV[5])
+local start     = tonumber(ARGV[6]) or max
 
 local data = redis.call("HMGET", key, "tokens", "last_ms")
 local tokens  = tonumber(data[1])
 local last_ms = tonumber(data[2])
 
 if tokens == nil then
-    -- first request: start with full bucket
-    tokens  = max
+    -- first request: start with full bucket, without carry-over
+    tokens  = start
     last_ms = now_ms
 end
 
@@ -111,14 +192,15 @@ return {allowed, remaining, retry_ms, reset_at}
 `)
 
 // Allow checks the rate limit for a key.
-func (s *RedisStore) Allow(key string, policy Policy, cost int) Result {
-	ctx := context.Background()
+func (s *RedisStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 	fullKey := s.prefix + key
 
-	maxTokens := float64(policy.Limit + policy.Burst)
+	maxTokens := policy.capacity()
 	refillRate := float64(policy.Limit) / policy.Window.Seconds()
 	nowMs := time.Now().UnixMilli()
-	ttl := int(policy.Window.Seconds()) * 2 // keep key for 2 windows
+	ttl := int(policy.keepAlive().Seconds()) // keep key for 2 windows, more with carry-over
 
 	vals, err := luaTokenBucket.Run(ctx, s.client, []string{fullKey},
 		fmt.Sprintf("%.4f", maxTokens),
@@ -126,6 +208,7 @@ func (s *RedisStore) Allow(key string, policy Policy, cost int) Result {
 		cost,
 		nowMs,
 		ttl,
+		policy.Limit+policy.Burst,
 	).Int64Slice()
 
 	if err != nil {
@@ -134,6 +217,7 @@ func (s *RedisStore) Allow(key string, policy Policy, cost int) Result {
 			Allowed:   true,
 			Limit:     policy.Limit + policy.Burst,
 			Remaining: policy.Limit + policy.Burst,
+			Err:       err,
 		}
 	}
 
@@ -156,9 +240,280 @@ func (s *RedisStore) Allow(key string, policy Policy, cost int) Result {
 	}
 }
 
+// luaTokenBucketMulti checks several buckets atomically: every bucket is
+// refilled, and tokens are consumed from all of them only if all can afford
+// their cost. Returns a flat array of [allowed, remaining, retryMs, resetAt]
+// per key, where allowed is 1 for buckets that could afford their cost.
+//
+// KEYS[i]          = bucket key i
+// ARGV[1]          = now_ms
+// ARGV[2+5(i-1)..] = max_tokens, refill_rate, cost, ttl_seconds, start_tokens for key i
+var luaTokenBucketMulti = redis.NewScript(`
+local now_ms = tonumber(ARGV[1])
+local n      = #KEYS
+local state  = {}
+local all_ok = true
+
+for i = 1, n do
+    local base  = 2 + (i - 1) * 5
+    local max   = tonumber(ARGV[base])
+    local rate  = tonumber(ARGV[base + 1])
+    local cost  = tonumber(ARGV[base + 2])
+    local ttl   = tonumber(ARGV[base + 3])
+    local start = tonumber(ARGV[base + 4])
+
+    local data = redis.call("HMGET", KEYS[i], "tokens", "last_ms")
+    local tokens  = tonumber(data[1])
+    local last_ms = tonumber(data[2])
+    if tokens == nil then
+        tokens  = start
+        last_ms = now_ms
+    end
+    local elapsed_s = (now_ms - last_ms) / 1000.0
+    if elapsed_s > 0 then
+        tokens = math.min(max, tokens + elapsed_s * rate)
+        last_ms = now_ms
+    end
+    local ok = tokens >= cost
+    if not ok then
+        all_ok = false
+    end
+    state[i] = {max = max, rate = rate, cost = cost, ttl = ttl, tokens = tokens, last_ms = last_ms, ok = ok}
+end
+
+local out = {}
+for i = 1, n do
+    local s = state[i]
+    local retry_ms = 0
+    if all_ok then
+        s.tokens = s.tokens - s.cost
+    elseif not s.ok then
+        retry_ms = math.ceil(((s.cost - s.tokens) / s.rate) * 1000)
+    end
+
+    redis.call("HMSET", KEYS[i], "tokens", tostring(s.tokens), "last_ms", tostring(s.last_ms))
+    redis.call("EXPIRE", KEYS[i], s.ttl)
+
+    local reset_s = 0
+    if s.max - s.tokens > 0 and s.rate > 0 then
+        reset_s = (s.max - s.tokens) / s.rate
+    end
+    local allowed = 0
+    if s.ok then
+        allowed = 1
+    end
+    local remaining = math.floor(s.tokens)
+    if not s.ok then
+        remaining = 0
+    end
+    table.insert(out, allowed)
+    table.insert(out, remaining)
+    table.insert(out, retry_ms)
+    table.insert(out, math.floor(now_ms / 1000) + math.ceil(reset_s))
+end
+return out
+`)
+
+// AllowMulti implements MultiStore with a single Lua invocation, so stacked
+// policies cost one Redis round trip instead of one each.
+func (s *RedisStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys := make([]string, len(reqs))
+	args := make([]interface{}, 0, 1+5*len(reqs))
+	args = append(args, time.Now().UnixMilli())
+	for i, req := range reqs {
+		keys[i] = s.prefix + req.Key
+		p := req.Policy
+		args = append(args,
+			fmt.Sprintf("%.4f", p.capacity()),
+			fmt.Sprintf("%.4f", float64(p.Limit)/p.Window.Seconds()),
+			req.Cost,
+			int(p.keepAlive().Seconds()),
+			p.Limit+p.Burst,
+		)
+	}
+
+	results := make([]Result, len(reqs))
+	vals, err := luaTokenBucketMulti.Run(ctx, s.client, keys, args...).Int64Slice()
+	if err != nil || len(vals) != 4*len(reqs) {
+		if err == nil {
+			err = fmt.Errorf("unexpected reply length %d", len(vals))
+		}
+		// Fail open, as Allow does.
+		for i, req := range reqs {
+			max := req.Policy.Limit + req.Policy.Burst
+			results[i] = Result{Allowed: true, Limit: max, Remaining: max, Err: err}
+		}
+		return results
+	}
+
+	for i, req := range reqs {
+		v := vals[i*4 : i*4+4]
+		res := Result{
+			Allowed:   v[0] == 1,
+			Limit:     req.Policy.Limit + req.Policy.Burst,
+			Remaining: int(v[1]),
+			ResetAt:   v[3],
+		}
+		if !res.Allowed {
+			res.RetryAfter = int(v[2]) / 1000
+			if res.RetryAfter < 1 {
+				res.RetryAfter = 1
+			}
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// luaTokenBucketSync refills a bucket, subtracts tokens consumed elsewhere
+// (clamped at zero) and returns the remaining tokens as a string so the
+// fractional part survives the Redis reply conversion.
+//
+// KEYS[1] = bucket key
+// ARGV[1] = max_tokens
+// ARGV[2] = refill_rate
+// ARGV[3] = consumed
+// ARGV[4] = now_ms
+// ARGV[5] = ttl_seconds
+// ARGV[6] = start_tokens
+var luaTokenBucketSync = redis.NewScript(`
+local key      = KEYS[1]
+local max      = tonumber(ARGV[1])
+local rate     = tonumber(ARGV[2])
+local consumed = tonumber(ARGV[3])
+local now_ms   = tonumber(ARGV[4])
+local ttl      = tonumber(ARGV[5])
+local start    = tonumber(ARGV[6]) or max
+
+local data = redis.call("HMGET", key, "tokens", "last_ms")
+local tokens  = tonumber(data[1])
+local last_ms = tonumber(data[2])
+
+if tokens == nil then
+    tokens  = start
+    last_ms = now_ms
+end
+
+local elapsed_s = (now_ms - last_ms) / 1000.0
+if elapsed_s > 0 then
+    tokens = math.min(max, tokens + elapsed_s * rate)
+    last_ms = now_ms
+end
+
+tokens = math.max(0, tokens - consumed)
+
+redis.call("HMSET", key, "tokens", tostring(tokens), "last_ms", tostring(last_ms))
+redis.call("EXPIRE", key, ttl)
+
+return tostring(tokens)
+`)
+
+// Sync implements BucketSyncer so a RedisStore can back a TieredStore.
+func (s *RedisStore) Sync(ctx context.Context, key string, policy Policy, consumed float64) (float64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	maxTokens := policy.capacity()
+	refillRate := float64(policy.Limit) / policy.Window.Seconds()
+	ttl := int(policy.keepAlive().Seconds())
+
+	out, err := luaTokenBucketSync.Run(ctx, s.client, []string{s.prefix + key},
+		fmt.Sprintf("%.4f", maxTokens),
+		fmt.Sprintf("%.4f", refillRate),
+		fmt.Sprintf("%.4f", consumed),
+		time.Now().UnixMilli(),
+		ttl,
+		policy.Limit+policy.Burst,
+	).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(out, 64)
+}
+
+// luaTokenBucketSyncMulti is luaTokenBucketSync for several buckets in one
+// call. Returns the remaining tokens of each key, as strings.
+//
+// KEYS[i]          = bucket key i
+// ARGV[1]          = now_ms
+// ARGV[2+5(i-1)..] = max_tokens, refill_rate, consumed, ttl_seconds, start_tokens for key i
+var luaTokenBucketSyncMulti = redis.NewScript(`
+local now_ms = tonumber(ARGV[1])
+local out    = {}
+
+for i = 1, #KEYS do
+    local base     = 2 + (i - 1) * 5
+    local max      = tonumber(ARGV[base])
+    local rate     = tonumber(ARGV[base + 1])
+    local consumed = tonumber(ARGV[base + 2])
+    local ttl      = tonumber(ARGV[base + 3])
+    local start    = tonumber(ARGV[base + 4]) or max
+
+    local data = redis.call("HMGET", KEYS[i], "tokens", "last_ms")
+    local tokens  = tonumber(data[1])
+    local last_ms = tonumber(data[2])
+    if tokens == nil then
+        tokens  = start
+        last_ms = now_ms
+    end
+    local elapsed_s = (now_ms - last_ms) / 1000.0
+    if elapsed_s > 0 then
+        tokens = math.min(max, tokens + elapsed_s * rate)
+        last_ms = now_ms
+    end
+
+    tokens = math.max(0, tokens - consumed)
+
+    redis.call("HMSET", KEYS[i], "tokens", tostring(tokens), "last_ms", tostring(last_ms))
+    redis.call("EXPIRE", KEYS[i], ttl)
+    out[i] = tostring(tokens)
+end
+return out
+`)
+
+// SyncMulti implements MultiSyncer with a single Lua invocation, so a
+// TieredStore flush costs one Redis round trip per batch instead of one per
+// key.
+func (s *RedisStore) SyncMulti(ctx context.Context, reqs []SyncRequest) ([]float64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys := make([]string, len(reqs))
+	args := make([]interface{}, 0, 1+5*len(reqs))
+	args = append(args, time.Now().UnixMilli())
+	for i, req := range reqs {
+		keys[i] = s.prefix + req.Key
+		p := req.Policy
+		args = append(args,
+			fmt.Sprintf("%.4f", p.capacity()),
+			fmt.Sprintf("%.4f", float64(p.Limit)/p.Window.Seconds()),
+			fmt.Sprintf("%.4f", req.Consumed),
+			int(p.keepAlive().Seconds()),
+			p.Limit+p.Burst,
+		)
+	}
+
+	out, err := luaTokenBucketSyncMulti.Run(ctx, s.client, keys, args...).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]float64, len(out))
+	for i, v := range out {
+		if tokens[i], err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
 // Reset removes a key from the store.
 func (s *RedisStore) Reset(key string) error {
-	return s.client.Del(context.Background(), s.prefix+key).Err()
+	ctx, cancel := s.withTimeout(context.Background())
+	defer cancel()
+	return s.client.Del(ctx, s.prefix+key).Err()
 }
 
 // Close shuts down the Redis client.
@@ -173,18 +528,35 @@ func (s *RedisStore) Close() error {
 // RedisConcurrencyStore manages per-key concurrency using Redis INCR/DECR
 // with a safety TTL so keys auto-expire if a release is missed.
 type RedisConcurrencyStore struct {
-	client *redis.Client
-	prefix string
-	ttl    time.Duration // safety TTL for auto-release
+	client  *redis.Client
+	prefix  string
+	ttl     time.Duration // safety TTL for auto-release
+	timeout time.Duration // per-command deadline (RATE_LIMIT_REDIS_TIMEOUT_MS)
 }
 
 // NewRedisConcurrencyStore creates a concurrency store backed by Redis.
+// Commands give up after RATE_LIMIT_REDIS_TIMEOUT_MS, like RedisStore's.
 func NewRedisConcurrencyStore(client *redis.Client, prefix string, ttl time.Duration) *RedisConcurrencyStore {
+	var timeout time.Duration
+	if cfg := config.RateLimit; cfg != nil {
+		timeout = time.Duration(cfg.RedisTimeoutMs) * time.Millisecond
+	}
 	return &RedisConcurrencyStore{
-		client: client,
-		prefix: prefix + "conc:",
-		ttl:    ttl,
+		client:  client,
+		prefix:  prefix + "conc:",
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+// withTimeout bounds a command by the configured timeout. The store's
+// methods take no context, so a hung Redis would otherwise hold the
+// request, or the release after it, forever.
+func (r *RedisConcurrencyStore) withTimeout() (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
+	return context.WithTimeout(context.Background(), r.timeout)
 }
 
 // Acquire tries to increment the in-flight counter atomically.
@@ -202,24 +574,111 @@ return 1
 `)
 
 func (r *RedisConcurrencyStore) Acquire(key string, limit int) (bool, error) {
-	ctx := context.Background()
+	ctx, cancel := r.withTimeout()
+	defer cancel()
 	res, err := luaConcAcquire.Run(ctx, r.client, []string{r.prefix + key}, limit, int(r.ttl.Seconds())).Int64()
 	if err != nil {
-		return true, nil // fail open
+		return true, err // fail open; the caller decides from err
 	}
 	return res == 1, nil
 }
 
-// Release decrements the in-flight counter.
+// luaConcRelease decrements the in-flight counter, deleting the key instead
+// of going below one. Doing this in one script means a release can never
+// delete a slot taken by a concurrent Acquire, and releasing an expired or
+// missing key is a no-op rather than a negative count.
+var luaConcRelease = redis.NewScript(`
+local key = KEYS[1]
+local cur = tonumber(redis.call("GET", key) or "0")
+if cur <= 1 then
+    redis.call("DEL", key)
+    return 0
+end
+return redis.call("DECR", key)
+`)
+
+// Release decrements the in-flight counter. Extra releases are ignored.
 func (r *RedisConcurrencyStore) Release(key string) error {
-	ctx := context.Background()
-	fullKey := r.prefix + key
-	res, err := r.client.Decr(ctx, fullKey).Result()
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	return luaConcRelease.Run(ctx, r.client, []string{r.prefix + key}).Err()
+}
+
+// Leases of a key live in the sorted set <prefix>conc:lease:<key>, one
+// member per holder scored by the time its lease ends, apart from the
+// counters of Acquire.
+func (r *RedisConcurrencyStore) leaseKey(key string) string { return r.prefix + "lease:" + key }
+
+// luaConcLease takes a lease for ARGV[1] unless the key already holds
+// limit live leases, dropping the ended ones first.
+//
+// KEYS[1] = lease set
+// ARGV[1] = holder, ARGV[2] = limit, ARGV[3] = now_ms, ARGV[4] = ttl_ms
+var luaConcLease = redis.NewScript(`
+local key    = KEYS[1]
+local now_ms = tonumber(ARGV[3])
+local ttl_ms = tonumber(ARGV[4])
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now_ms)
+if redis.call("ZCARD", key) >= tonumber(ARGV[2]) then
+    return 0
+end
+redis.call("ZADD", key, now_ms + ttl_ms, ARGV[1])
+redis.call("PEXPIRE", key, ttl_ms)
+return 1
+`)
+
+// luaConcRenew extends the lease of ARGV[1], if it has not ended. Returns
+// 0 when the lease is gone.
+var luaConcRenew = redis.NewScript(`
+local key    = KEYS[1]
+local now_ms = tonumber(ARGV[2])
+local ttl_ms = tonumber(ARGV[3])
+local ends   = redis.call("ZSCORE", key, ARGV[1])
+if not ends or tonumber(ends) <= now_ms then
+    return 0
+end
+redis.call("ZADD", key, now_ms + ttl_ms, ARGV[1])
+redis.call("PEXPIRE", key, ttl_ms)
+return 1
+`)
+
+// errLeaseEnded reports a lease that ended before its holder renewed it.
+var errLeaseEnded = errors.New("ratelimit: concurrency lease ended")
+
+// AcquireLease implements ConcurrencyLeaser. Each lease ends ttl after it
+// was last renewed, so only open streams keep their slots, and the slots
+// of a crashed instance free themselves.
+func (r *RedisConcurrencyStore) AcquireLease(key string, limit int) (string, bool, error) {
+	lease := connID()
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	res, err := luaConcLease.Run(ctx, r.client, []string{r.leaseKey(key)},
+		lease, limit, time.Now().UnixMilli(), r.ttl.Milliseconds()).Int64()
 	if err != nil {
-		return err
+		return "", true, err // fail open; the caller decides from err
 	}
-	if res <= 0 {
-		r.client.Del(ctx, fullKey)
+	return lease, res == 1, nil
+}
+
+// RenewLease implements ConcurrencyLeaser.
+func (r *RedisConcurrencyStore) RenewLease(key, lease string) error {
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	res, err := luaConcRenew.Run(ctx, r.client, []string{r.leaseKey(key)},
+		lease, time.Now().UnixMilli(), r.ttl.Milliseconds()).Int64()
+	if err == nil && res == 0 {
+		err = errLeaseEnded
 	}
-	return nil
+	return err
 }
+
+// ReleaseLease implements ConcurrencyLeaser. Releasing an ended lease is a
+// no-op.
+func (r *RedisConcurrencyStore) ReleaseLease(key, lease string) error {
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	return r.client.ZRem(ctx, r.leaseKey(key), lease).Err()
+}
+
+// LeaseInterval implements ConcurrencyLeaser.
+func (r *RedisConcurrencyStore) LeaseInterval() time.Duration { return r.ttl / 2 }
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gohst/internal/config"
+)
+
+func TestBuildTLSConfig_ServerName(t *testing.T) {
+	cfg, err := buildTLSConfig(&config.TLSConfig{}, "redis.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ServerName != "redis.example.com" {
+		t.Fatalf("expected host as server name, got %q", cfg.ServerName)
+	}
+
+	cfg, _ = buildTLSConfig(&config.TLSConfig{ServerName: "override.example.com"}, "10.0.0.5")
+	if cfg.ServerName != "override.example.com" {
+		t.Fatalf("expected override server name, got %q", cfg.ServerName)
+	}
+}
+
+func TestBuildTLSConfig_MissingCA(t *testing.T) {
+	_, err := buildTLSConfig(&config.TLSConfig{CAFile: "/does/not/exist.pem"}, "localhost")
+	if err == nil {
+		t.Fatal("expected error for missing CA file")
+	}
+}
+
+func TestBuildTLSConfig_InvalidCA(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := buildTLSConfig(&config.TLSConfig{CAFile: path}, "localhost")
+	if err == nil {
+		t.Fatal("expected error for CA file without certificates")
+	}
+}
+
+// hangingListener accepts connections and never replies, simulating a stalled Redis.
+func hangingListener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisStore_TimeoutFailsOpen(t *testing.T) {
+	addr := hangingListener(t)
+	store := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true}),
+		prefix:  "test:",
+		timeout: 50 * time.Millisecond,
+	}
+	defer store.Close()
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1}
+	start := time.Now()
+	res := store.Allow(context.Background(), "slow", p, 1)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Allow should give up after the timeout, took %s", elapsed)
+	}
+	if !res.Allowed {
+		t.Fatal("store errors should fail open")
+	}
+}
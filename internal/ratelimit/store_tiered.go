@@ -0,0 +1,326 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Two-tier store (local cache in front of a shared store)
+// ──────────────────────────────────────────────
+
+// BucketSyncer is implemented by shared stores that can absorb consumption
+// recorded elsewhere. Sync refills the shared bucket, subtracts `consumed`
+// tokens (never going below zero) and returns the tokens left.
+type BucketSyncer interface {
+	Sync(ctx context.Context, key string, policy Policy, consumed float64) (tokens float64, err error)
+}
+
+// SyncRequest is one bucket of a SyncMulti batch: the tokens consumed
+// from key under Policy since its last sync.
+type SyncRequest struct {
+	Key      string
+	Policy   Policy
+	Consumed float64
+}
+
+// MultiSyncer is implemented by BucketSyncers that can sync several buckets
+// in one operation (one Lua call for Redis). It returns the tokens left in
+// each bucket, in the order of reqs.
+type MultiSyncer interface {
+	SyncMulti(ctx context.Context, reqs []SyncRequest) ([]float64, error)
+}
+
+// tieredSyncBatch bounds the buckets sent to a MultiSyncer at once, so one
+// flush of many keys does not block the backend on a single long call.
+const tieredSyncBatch = 256
+
+// TieredStore answers every Allow from a process-local token bucket and
+// pushes the consumed tokens to a shared backend on a fixed interval. Each
+// sync also pulls back the shared token count, so the local view converges
+// on the global one. Only buckets that consumed tokens since the last
+// sync are sent, batched when the backend implements MultiSyncer.
+//
+// This trades strictness for latency: between syncs each instance can admit
+// up to one interval's worth of traffic that another instance has already
+// spent. That is fine for generous limits (public browsing) but tight limits
+// (auth, exports) should use the backend store directly.
+type TieredStore struct {
+	mu       sync.Mutex
+	local    map[string]*tierEntry
+	lru      *list.List    // of *tierEntry, most recently used first
+	maxKeys  int           // 0 = unbounded
+	evicted  []SyncRequest // debts of evicted keys, pushed by the next flush
+	remote   BucketSyncer
+	closer   Store // closed with the tiered store; may be nil
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type tierEntry struct {
+	key       string
+	elem      *list.Element
+	bucket    *Bucket
+	policy    Policy
+	pending   float64 // tokens consumed locally since the last sync
+	lastTouch time.Time
+}
+
+// TieredOption configures a TieredStore.
+type TieredOption func(*TieredStore)
+
+// WithTieredMaxKeys caps the local buckets at n, evicting the least
+// recently used one when a new key would exceed it. Tokens an evicted key
+// consumed are still pushed by the next sync. 0 means unbounded.
+func WithTieredMaxKeys(n int) TieredOption {
+	return func(s *TieredStore) { s.maxKeys = n }
+}
+
+// NewTieredStore creates a TieredStore syncing to remote every interval. If
+// remote also implements Store it is closed when the tiered store closes.
+func NewTieredStore(remote BucketSyncer, interval time.Duration, opts ...TieredOption) *TieredStore {
+	s := &TieredStore{
+		local:    make(map[string]*tierEntry),
+		lru:      list.New(),
+		remote:   remote,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if st, ok := remote.(Store); ok {
+		s.closer = st
+	}
+	go s.loop()
+	return s
+}
+
+// Allow decides locally and records the consumed cost for the next sync.
+func (s *TieredStore) Allow(_ context.Context, key string, policy Policy, cost int) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entry(key, policy, now)
+	remaining, allowed := e.bucket.Allow(cost, now)
+	if allowed {
+		e.pending += float64(cost)
+	}
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit + policy.Burst,
+		Remaining: remaining,
+		ResetAt:   e.bucket.ResetUnix(),
+	}
+	if !allowed {
+		res.RetryAfter = int(e.bucket.RetryAfter(cost))
+		if res.RetryAfter < 1 {
+			res.RetryAfter = 1
+		}
+	}
+	return res
+}
+
+// AllowMulti implements MultiStore: tokens are taken from every local
+// bucket or from none.
+func (s *TieredStore) AllowMulti(_ context.Context, reqs []AllowRequest) []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entries := make([]*tierEntry, len(reqs))
+	ok := true
+	for i, req := range reqs {
+		e := s.entry(req.Key, req.Policy, now)
+		e.bucket.refill(now)
+		entries[i] = e
+		if e.bucket.Tokens < float64(req.Cost) {
+			ok = false
+		}
+	}
+
+	results := make([]Result, len(reqs))
+	for i, req := range reqs {
+		e := entries[i]
+		affordable := e.bucket.Tokens >= float64(req.Cost)
+		if ok {
+			e.bucket.Tokens -= float64(req.Cost)
+			e.pending += float64(req.Cost)
+		}
+		res := Result{
+			Allowed:   affordable,
+			Limit:     req.Policy.Limit + req.Policy.Burst,
+			Remaining: int(e.bucket.Tokens),
+			ResetAt:   e.bucket.ResetUnix(),
+		}
+		if !affordable {
+			res.Remaining = 0
+			res.RetryAfter = max(int(e.bucket.RetryAfter(req.Cost)), 1)
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// entry returns the local entry of key, retuned to policy. The caller
+// must hold s.mu.
+func (s *TieredStore) entry(key string, policy Policy, now time.Time) *tierEntry {
+	e, ok := s.local[key]
+	if !ok {
+		e = &tierEntry{key: key, bucket: NewBucket(policy), policy: policy}
+		e.elem = s.lru.PushFront(e)
+		s.local[key] = e
+		if s.maxKeys > 0 && len(s.local) > s.maxKeys {
+			s.evict(s.lru.Back().Value.(*tierEntry))
+		}
+	} else {
+		s.lru.MoveToFront(e.elem)
+		if e.policy != policy {
+			e.bucket.Retune(policy, now)
+			e.policy = policy
+		}
+	}
+	e.lastTouch = now
+	return e
+}
+
+// evict drops the least recently used entry e, keeping what it owes the
+// backend for the next flush. The caller must hold s.mu.
+func (s *TieredStore) evict(e *tierEntry) {
+	if e.pending > 0 {
+		s.evicted = append(s.evicted, SyncRequest{Key: e.key, Policy: e.policy, Consumed: e.pending})
+	}
+	s.remove(e)
+}
+
+// remove deletes e from the map and the LRU list. The caller must hold s.mu.
+func (s *TieredStore) remove(e *tierEntry) {
+	s.lru.Remove(e.elem)
+	delete(s.local, e.key)
+}
+
+// Reset removes the key locally and, when possible, from the backend.
+func (s *TieredStore) Reset(key string) error {
+	s.mu.Lock()
+	if e, ok := s.local[key]; ok {
+		s.remove(e)
+	}
+	s.evicted = slices.DeleteFunc(s.evicted, func(req SyncRequest) bool { return req.Key == key })
+	s.mu.Unlock()
+	if s.closer != nil {
+		return s.closer.Reset(key)
+	}
+	return nil
+}
+
+// Close stops the sync loop, flushes pending consumption and closes the
+// backend store.
+func (s *TieredStore) Close() error {
+	close(s.stop)
+	<-s.done
+	s.flush()
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+func (s *TieredStore) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush syncs the local buckets that consumed tokens since the last sync
+// with the backend, along with the debts of keys evicted since. Keys idle
+// for more than two windows are dropped once they owe the backend nothing.
+func (s *TieredStore) flush() {
+	s.mu.Lock()
+	now := time.Now()
+	batch := make([]SyncRequest, 0, len(s.local)+len(s.evicted))
+	batch = append(batch, s.evicted...)
+	s.evicted = nil
+	for k, e := range s.local {
+		if e.pending == 0 {
+			if now.Sub(e.lastTouch) > 2*e.policy.Window {
+				s.remove(e)
+			}
+			continue
+		}
+		batch = append(batch, SyncRequest{Key: k, Policy: e.policy, Consumed: e.pending})
+		e.pending = 0
+	}
+	s.mu.Unlock()
+
+	ctx := context.Background()
+	for len(batch) > 0 {
+		chunk := batch[:min(len(batch), tieredSyncBatch)]
+		batch = batch[len(chunk):]
+		tokens, errs := s.sync(ctx, chunk)
+
+		s.mu.Lock()
+		now := time.Now()
+		for i, req := range chunk {
+			e, ok := s.local[req.Key]
+			if errs[i] != nil {
+				// Keep the delta for the next round; local decisions continue.
+				if ok {
+					e.pending += req.Consumed
+				} else {
+					s.evicted = append(s.evicted, req)
+				}
+				log.Printf("[ratelimit] tiered sync error key=%s: %v", truncateKey(req.Key), errs[i])
+				continue
+			}
+			if !ok {
+				continue
+			}
+			// Anything consumed locally while the sync was in flight is still
+			// owed to the backend, so subtract it from the fresh global count.
+			e.bucket.Tokens = max(tokens[i]-e.pending, 0)
+			e.bucket.LastRefill = now
+		}
+		s.mu.Unlock()
+	}
+}
+
+// sync pushes reqs to the backend in one call when it implements
+// MultiSyncer, and one at a time otherwise. It returns the tokens left and
+// the error of each request.
+func (s *TieredStore) sync(ctx context.Context, reqs []SyncRequest) ([]float64, []error) {
+	tokens, errs := make([]float64, len(reqs)), make([]error, len(reqs))
+	if ms, ok := s.remote.(MultiSyncer); ok {
+		out, err := ms.SyncMulti(ctx, reqs)
+		if err == nil && len(out) != len(reqs) {
+			err = fmt.Errorf("sync returned %d buckets for %d", len(out), len(reqs))
+		}
+		if err != nil {
+			for i := range errs {
+				errs[i] = err
+			}
+			return tokens, errs
+		}
+		return out, errs
+	}
+	for i, req := range reqs {
+		tokens[i], errs[i] = s.remote.Sync(ctx, req.Key, req.Policy, req.Consumed)
+	}
+	return tokens, errs
+}
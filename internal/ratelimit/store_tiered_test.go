@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTieredStore_AllowsLocally(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore(time.Minute)
+	store := NewTieredStore(backend, time.Hour)
+	defer store.Close()
+
+	p := Policy{Limit: 3, Window: time.Minute, Enabled: true, Cost: 1}
+	for i := 0; i < 3; i++ {
+		if !store.Allow(ctx, "k", p, 1).Allowed {
+			t.Fatalf("request %d should be allowed", i+1)
+		}
+	}
+	if store.Allow(ctx, "k", p, 1).Allowed {
+		t.Fatal("4th request should be denied locally")
+	}
+}
+
+func TestTieredStore_SyncSharesConsumption(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore(time.Minute)
+	defer backend.Close()
+
+	// Two instances sharing one backend; long intervals so we flush manually.
+	a := NewTieredStore(backend, time.Hour)
+	b := NewTieredStore(backend, time.Hour)
+	a.closer, b.closer = nil, nil
+	defer a.Close()
+	defer b.Close()
+
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1}
+
+	// b sees the key first so it has a local bucket to refresh.
+	b.Allow(ctx, "k", p, 1)
+	b.flush()
+
+	for i := 0; i < 9; i++ {
+		a.Allow(ctx, "k", p, 1)
+	}
+	a.flush()
+
+	// b pulls the global count back with its next sync, which pushes the
+	// request it admitted in between.
+	b.Allow(ctx, "k", p, 1)
+	b.flush()
+	if b.Allow(ctx, "k", p, 1).Allowed {
+		t.Fatal("b should see a's consumption after sync")
+	}
+}
+
+// countingSyncer is a MultiSyncer that records the buckets of each call.
+type countingSyncer struct {
+	*MemoryStore
+	calls [][]SyncRequest
+}
+
+func (c *countingSyncer) SyncMulti(ctx context.Context, reqs []SyncRequest) ([]float64, error) {
+	c.calls = append(c.calls, reqs)
+	tokens := make([]float64, len(reqs))
+	for i, req := range reqs {
+		tokens[i], _ = c.MemoryStore.Sync(ctx, req.Key, req.Policy, req.Consumed)
+	}
+	return tokens, nil
+}
+
+func TestTieredStore_SyncsOnlyPendingInBatches(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingSyncer{MemoryStore: NewMemoryStore(time.Minute)}
+	store := NewTieredStore(backend, time.Hour)
+	defer store.Close()
+
+	p := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1}
+	n := tieredSyncBatch + 10
+	for i := 0; i < n; i++ {
+		store.Allow(ctx, fmt.Sprintf("k%d", i), p, 1)
+	}
+	store.flush()
+	if len(backend.calls) != 2 || len(backend.calls[0]) != tieredSyncBatch || len(backend.calls[1]) != 10 {
+		t.Fatalf("expected %d keys in two batches, got %d calls", n, len(backend.calls))
+	}
+
+	backend.calls = nil
+	store.Allow(ctx, "k0", p, 1)
+	store.flush()
+	if len(backend.calls) != 1 || len(backend.calls[0]) != 1 || backend.calls[0][0].Key != "k0" {
+		t.Errorf("expected only the key that consumed tokens to sync, got %v", backend.calls)
+	}
+}
+
+func TestTieredStore_MaxKeysEvictsLRU(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryStore(time.Minute)
+	store := NewTieredStore(backend, time.Hour, WithTieredMaxKeys(2))
+	store.closer = nil
+	defer backend.Close()
+	defer store.Close()
+
+	p := Policy{Limit: 10, Window: time.Hour, Enabled: true, Cost: 1}
+	store.Allow(ctx, "a", p, 3)
+	store.Allow(ctx, "b", p, 1)
+	store.Allow(ctx, "a", p, 1) // a is now the most recently used
+	store.Allow(ctx, "c", p, 1)
+
+	store.mu.Lock()
+	_, hasA := store.local["a"]
+	_, hasB := store.local["b"]
+	n := len(store.local)
+	store.mu.Unlock()
+	if n != 2 || !hasA || hasB {
+		t.Fatalf("expected b to be evicted, keeping a and c; got %d keys (a=%v b=%v)", n, hasA, hasB)
+	}
+
+	// The evicted key's consumption still reaches the backend.
+	store.flush()
+	if tokens, _ := backend.Sync(ctx, "b", p, 0); tokens > 9.01 {
+		t.Errorf("expected b's request to be synced after eviction, backend has %.2f tokens", tokens)
+	}
+	if tokens, _ := backend.Sync(ctx, "a", p, 0); tokens > 6.01 {
+		t.Errorf("expected a's 4 tokens to be synced, backend has %.2f tokens", tokens)
+	}
+}
+
+func TestTieredStore_FailedBatchKeepsPending(t *testing.T) {
+	addr := hangingListener(t)
+	rs := &RedisStore{
+		client:  redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true}),
+		prefix:  "test:",
+		timeout: 50 * time.Millisecond,
+	}
+	store := NewTieredStore(rs, time.Hour)
+	store.closer = nil
+	defer rs.Close()
+	defer store.Close()
+
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1}
+	store.Allow(context.Background(), "k", p, 2)
+	start := time.Now()
+	store.flush()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the batch to give up after the timeout, took %s", elapsed)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if e := store.local["k"]; e == nil || e.pending != 2 {
+		t.Errorf("expected a failed sync to keep the consumption for the next round, got %+v", e)
+	}
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Per-key consumption timeline (debugging)
+// ──────────────────────────────────────────────
+
+// timelineMaxKeys caps how many keys a TimelineStore tracks at once.
+const timelineMaxKeys = 10000
+
+// TimelineEvent is one recorded decision for a key.
+type TimelineEvent struct {
+	At         time.Time `json:"at"`
+	Scope      string    `json:"scope"`
+	Cost       int       `json:"cost"`
+	Allowed    bool      `json:"allowed"`
+	Limit      int       `json:"limit"`
+	Remaining  int       `json:"remaining"`
+	RetryAfter int       `json:"retry_after"`
+	Reset      bool      `json:"reset,omitempty"` // the key was reset
+}
+
+// TimelineStore wraps a Store and keeps the last few decisions per key, so
+// "why was this burst denied" can be answered by charting one key's recent
+// consumption. Events older than the retention are dropped.
+type TimelineStore struct {
+	inner     Store
+	perKey    int
+	retention time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*timeline
+}
+
+type timeline struct {
+	events []TimelineEvent // ring buffer
+	next   int
+	full   bool
+	last   time.Time
+}
+
+// NewTimelineStore wraps inner, keeping up to perKey events per key for
+// retention.
+func NewTimelineStore(inner Store, perKey int, retention time.Duration) *TimelineStore {
+	if perKey < 1 {
+		perKey = 100
+	}
+	return &TimelineStore{
+		inner:     inner,
+		perKey:    perKey,
+		retention: retention,
+		keys:      make(map[string]*timeline),
+	}
+}
+
+// Inner returns the wrapped store.
+func (t *TimelineStore) Inner() Store { return t.inner }
+
+// Allow implements Store and records the decision.
+func (t *TimelineStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	res := t.inner.Allow(ctx, key, policy, cost)
+	t.record(key, TimelineEvent{
+		At:         time.Now(),
+		Scope:      policy.Scope,
+		Cost:       cost,
+		Allowed:    res.Allowed,
+		Limit:      res.Limit,
+		Remaining:  res.Remaining,
+		RetryAfter: res.RetryAfter,
+	})
+	return res
+}
+
+// AllowMulti implements MultiStore and records each decision.
+func (t *TimelineStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	results := AllowMulti(ctx, t.inner, reqs)
+	now := time.Now()
+	for i, res := range results {
+		t.record(reqs[i].Key, TimelineEvent{
+			At:         now,
+			Scope:      reqs[i].Policy.Scope,
+			Cost:       reqs[i].Cost,
+			Allowed:    res.Allowed,
+			Limit:      res.Limit,
+			Remaining:  res.Remaining,
+			RetryAfter: res.RetryAfter,
+		})
+	}
+	return results
+}
+
+// Reset implements Store and records the reset.
+func (t *TimelineStore) Reset(key string) error {
+	err := t.inner.Reset(key)
+	if err == nil {
+		t.record(key, TimelineEvent{At: time.Now(), Reset: true})
+	}
+	return err
+}
+
+// Close implements Store.
+func (t *TimelineStore) Close() error { return t.inner.Close() }
+
+// Timeline returns key's recorded events within the retention, oldest first.
+func (t *TimelineStore) Timeline(key string) []TimelineEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tl, ok := t.keys[key]
+	if !ok {
+		return nil
+	}
+	var ordered []TimelineEvent
+	if tl.full {
+		ordered = append(ordered, tl.events[tl.next:]...)
+	}
+	ordered = append(ordered, tl.events[:tl.next]...)
+
+	cutoff := time.Now().Add(-t.retention)
+	out := ordered[:0]
+	for _, ev := range ordered {
+		if t.retention <= 0 || ev.At.After(cutoff) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func (t *TimelineStore) record(key string, ev TimelineEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tl, ok := t.keys[key]
+	if !ok {
+		if len(t.keys) >= timelineMaxKeys {
+			t.sweep(ev.At)
+			if len(t.keys) >= timelineMaxKeys {
+				return
+			}
+		}
+		tl = &timeline{events: make([]TimelineEvent, t.perKey)}
+		t.keys[key] = tl
+	}
+	tl.events[tl.next] = ev
+	tl.next = (tl.next + 1) % t.perKey
+	if tl.next == 0 {
+		tl.full = true
+	}
+	tl.last = ev.At
+}
+
+// sweep drops keys with no events inside the retention. The caller must
+// hold t.mu.
+func (t *TimelineStore) sweep(now time.Time) {
+	for key, tl := range t.keys {
+		if t.retention <= 0 || now.Sub(tl.last) > t.retention {
+			delete(t.keys, key)
+		}
+	}
+}
+
+// TimelineHandler serves GET ?key=<key> as JSON:
+//
+//	{"key": "ip:1.2.3.4", "events": [{"at": "...", "scope": "...", "allowed": true, ...}]}
+//
+// It exposes raw keys, so mount it behind admin authentication.
+func TimelineHandler(t *TimelineStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key is required"})
+			return
+		}
+		events := t.Timeline(key)
+		if events == nil {
+			events = []TimelineEvent{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"key": key, "events": events})
+	})
+}
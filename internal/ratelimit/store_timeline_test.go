@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimelineStore_RecordsDecisions(t *testing.T) {
+	ctx := context.Background()
+	store := NewTimelineStore(NewMemoryStore(time.Minute), 10, time.Minute)
+	defer store.Close()
+
+	p := Policy{Limit: 2, Window: time.Minute, Enabled: true, Cost: 1, Scope: "test"}
+	for i := 0; i < 3; i++ {
+		store.Allow(ctx, "k", p, 1)
+	}
+	store.Reset("k")
+
+	events := store.Timeline("k")
+	if len(events) != 4 {
+		t.Fatalf("want 4 events, got %d", len(events))
+	}
+	if !events[0].Allowed || !events[1].Allowed || events[2].Allowed {
+		t.Fatalf("want allow, allow, deny; got %+v", events[:3])
+	}
+	if events[1].Remaining != 0 || events[2].RetryAfter < 1 || events[0].Scope != "test" {
+		t.Fatalf("unexpected event fields: %+v", events[:3])
+	}
+	if !events[3].Reset {
+		t.Fatal("last event should record the reset")
+	}
+	if store.Timeline("other") != nil {
+		t.Fatal("unknown key should have no timeline")
+	}
+}
+
+func TestTimelineStore_RingKeepsNewest(t *testing.T) {
+	ctx := context.Background()
+	store := NewTimelineStore(NewMockStore(), 3, time.Minute)
+
+	for cost := 1; cost <= 5; cost++ {
+		store.Allow(ctx, "k", Policy{Limit: 10, Window: time.Minute}, cost)
+	}
+	events := store.Timeline("k")
+	if len(events) != 3 {
+		t.Fatalf("want 3 events, got %d", len(events))
+	}
+	for i, ev := range events {
+		if ev.Cost != i+3 {
+			t.Fatalf("event %d: want cost %d (oldest first), got %d", i, i+3, ev.Cost)
+		}
+	}
+}
+
+func TestTimelineHandler(t *testing.T) {
+	store := NewTimelineStore(NewMockStore(), 10, time.Minute)
+	store.Allow(context.Background(), "ip:1.2.3.4", Policy{Limit: 5, Window: time.Minute, Scope: "api"}, 1)
+	h := TimelineHandler(store)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?key=ip:1.2.3.4", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d", rec.Code)
+	}
+	var body struct {
+		Key    string          `json:"key"`
+		Events []TimelineEvent `json:"events"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Key != "ip:1.2.3.4" || len(body.Events) != 1 || body.Events[0].Scope != "api" {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?key=nobody", nil))
+	if !strings.Contains(rec.Body.String(), `"events":[]`) {
+		t.Fatalf("unknown key should return an empty list, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing key: want 400, got %d", rec.Code)
+	}
+}
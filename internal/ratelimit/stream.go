@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Long-lived connections (SSE, long-poll)
+// ──────────────────────────────────────────────
+
+// ConcurrencyLeaser is implemented by concurrency stores that track each
+// held slot as a lease of its own, which ends unless its holder renews it,
+// such as RedisConcurrencyStore. A StreamLimiter takes leases instead of
+// counting slots, and renews the leases of open streams every
+// LeaseInterval: renewing a shared counter would also keep alive the slots
+// of holders that are gone.
+type ConcurrencyLeaser interface {
+	// AcquireLease takes a lease on one of limit slots of key. On backend
+	// errors implementations return ("", true, err).
+	AcquireLease(key string, limit int) (lease string, ok bool, err error)
+	// RenewLease extends lease, or fails if it has already ended.
+	RenewLease(key, lease string) error
+	// ReleaseLease frees the slot of lease.
+	ReleaseLease(key, lease string) error
+	LeaseInterval() time.Duration
+}
+
+// StreamLimiter caps the concurrent long-lived requests, such as
+// Server-Sent Events streams and long polls, each key holds open. A slot
+// is taken when the request arrives and released when the handler
+// returns, however long the stream lasts. Keys are "stream:<key>".
+//
+// Requests over the cap get a retry hint: EventSource clients a
+// text/event-stream response with a retry field, which makes browsers
+// reconnect later instead of giving up, and others a 429 with Retry-After.
+type StreamLimiter struct {
+	store      ConcurrencyStore
+	keyFunc    KeyFunc
+	limit      int
+	retryAfter int
+}
+
+// NewStreamLimiter creates a StreamLimiter allowing limit open streams per
+// key. Denied clients are asked to retry after retryAfter, five seconds
+// when zero.
+func NewStreamLimiter(store ConcurrencyStore, keyFunc KeyFunc, limit int, retryAfter time.Duration) *StreamLimiter {
+	if limit < 1 {
+		panic("ratelimit: stream limit must be positive")
+	}
+	secs := int(retryAfter / time.Second)
+	if secs < 1 {
+		secs = 5
+	}
+	return &StreamLimiter{store: store, keyFunc: keyFunc, limit: limit, retryAfter: secs}
+}
+
+// Middleware returns an http middleware enforcing the stream cap.
+func (s *StreamLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.RateLimit.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, keyType := s.keyFunc(r)
+		slot := "stream:" + key
+		release, ok, err := s.acquire(slot)
+		if err != nil {
+			// Fail open: a stream cap is not worth dropping every stream.
+			failedOpen.Add(1)
+			log.Printf("[ratelimit] stream acquire error key=%s, failing open: %v", truncateKey(key), err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			if config.RateLimit.LogLevel != "quiet" {
+				log.Printf("[ratelimit] DENIED %s %s | type=%s key=%s reason=streams limit=%d",
+					r.Method, r.URL.Path, keyType, truncateKey(key), s.limit)
+			}
+			s.denyResponse(w, r)
+			return
+		}
+		defer func() {
+			if err := release(); err != nil {
+				log.Printf("[ratelimit] stream release error key=%s: %v", truncateKey(key), err)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire takes a slot of key, as a lease renewed until release when the
+// store is a ConcurrencyLeaser.
+func (s *StreamLimiter) acquire(key string) (release func() error, ok bool, err error) {
+	lc, leased := s.store.(ConcurrencyLeaser)
+	if !leased || lc.LeaseInterval() <= 0 {
+		ok, err := s.store.Acquire(key, s.limit)
+		return func() error { return s.store.Release(key) }, ok, err
+	}
+	lease, ok, err := lc.AcquireLease(key, s.limit)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	go renewLease(lc, key, lease, stop, done)
+	return func() error {
+		close(stop)
+		<-done
+		return lc.ReleaseLease(key, lease)
+	}, true, nil
+}
+
+// renewLease keeps lease from ending until stop is closed, and closes done
+// once it has stopped renewing.
+func renewLease(lc ConcurrencyLeaser, key, lease string, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(lc.LeaseInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := lc.RenewLease(key, lease); err != nil {
+				log.Printf("[ratelimit] stream renew error key=%s: %v", truncateKey(key), err)
+			}
+		}
+	}
+}
+
+// denyResponse asks a client over the cap to come back later.
+func (s *StreamLimiter) denyResponse(w http.ResponseWriter, r *http.Request) {
+	retryAfter := setRetryAfter(w, s.retryAfter)
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		// EventSource gives up on any status but 200; a retry field and
+		// an empty stream make it reconnect after the delay instead.
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\nevent: rate_limited\ndata: {\"retry_after\":%d}\n\n", retryAfter*1000, retryAfter)
+		return
+	}
+	writeErrorResponse(w, r, Policy{}, http.StatusTooManyRequests,
+		fmt.Sprintf("Too many open streams: at most %d at a time.", s.limit),
+		fmt.Sprintf("You have too many open connections. Please close one or try again in %d seconds.", retryAfter),
+		s.retryAfter)
+}
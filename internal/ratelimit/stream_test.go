@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"gohst/internal/config"
+)
+
+func TestStreamLimiter_CapsOpenStreams(t *testing.T) {
+	initTestConfig()
+	open, release := make(chan struct{}), make(chan struct{})
+	s := NewStreamLimiter(NewMemoryConcurrencyStore(), KeyByIP(), 1, 3*time.Second)
+	handler := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		open <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	}()
+	<-open
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "retry: 3000\n") {
+		t.Errorf("expected an SSE retry hint, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/poll", nil))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "3" {
+		t.Errorf("expected a 429 with Retry-After for long polls, got %d %v", rr.Code, rr.Header())
+	}
+
+	close(release)
+	wg.Wait()
+	go func() { <-open }()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("expected the slot released when the stream ended, got %d", rr.Code)
+	}
+}
+
+// leasingConcStore leases the slots of a memory concurrency store and
+// counts renewals.
+type leasingConcStore struct {
+	*MemoryConcurrencyStore
+	renewals atomic.Int32
+	released atomic.Value
+}
+
+func (s *leasingConcStore) AcquireLease(key string, limit int) (string, bool, error) {
+	ok, err := s.Acquire(key, limit)
+	return "lease-1", ok, err
+}
+
+func (s *leasingConcStore) RenewLease(_, lease string) error {
+	if lease == "lease-1" {
+		s.renewals.Add(1)
+	}
+	return nil
+}
+
+func (s *leasingConcStore) ReleaseLease(key, lease string) error {
+	s.released.Store(lease)
+	return s.Release(key)
+}
+
+func (s *leasingConcStore) LeaseInterval() time.Duration { return 5 * time.Millisecond }
+
+func TestStreamLimiter_RenewsLeases(t *testing.T) {
+	initTestConfig()
+	store := &leasingConcStore{MemoryConcurrencyStore: NewMemoryConcurrencyStore()}
+	handler := NewStreamLimiter(store, KeyByIP(), 1, 0).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	if store.renewals.Load() == 0 {
+		t.Error("expected the lease renewed while the stream was open")
+	}
+	if store.released.Load() != "lease-1" {
+		t.Errorf("expected the stream's own lease released, got %v", store.released.Load())
+	}
+	n := store.renewals.Load()
+	time.Sleep(20 * time.Millisecond)
+	if store.renewals.Load() != n {
+		t.Error("expected renewals to stop when the stream ended")
+	}
+}
+
+func TestStreamLimiter_RetryAfterCapped(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.RetryAfterMax = 2
+	s := NewStreamLimiter(NewMemoryConcurrencyStore(), KeyByIP(), 1, time.Minute)
+	if ok, _ := s.store.Acquire("stream:ip:192.0.2.1", 1); !ok {
+		t.Fatal("expected to take the only slot")
+	}
+	handler := s.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Retry-After") != "2" || !strings.HasPrefix(rr.Body.String(), "retry: 2000\n") {
+		t.Errorf("expected the retry hint capped at RATE_LIMIT_RETRY_AFTER_MAX, got %v %q", rr.Header(), rr.Body.String())
+	}
+}
+
+func TestRedisConcurrencyStore_LeaseTimeoutFailsOpen(t *testing.T) {
+	addr := hangingListener(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, ContextTimeoutEnabled: true, ReadTimeout: 50 * time.Millisecond})
+	defer client.Close()
+	store := NewRedisConcurrencyStore(client, "test:", time.Minute)
+
+	if _, ok, err := store.AcquireLease("stream:k", 1); err == nil || !ok {
+		t.Errorf("expected a failing Redis to fail open with an error, got ok=%t err=%v", ok, err)
+	}
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gohst/internal/config"
+)
+
+// ──────────────────────────────────────────────
+// Tarpit
+// ──────────────────────────────────────────────
+
+// TarpitStats counts tarpitted denials since start.
+type TarpitStats struct {
+	Held    int64  // connections being held now
+	Total   uint64 // denials that were held
+	Skipped uint64 // denials answered at once because RATE_LIMIT_TARPIT_MAX_CONNS or _MAX_KEYS was reached
+}
+
+var tarpits = &tarpitTracker{entries: map[string]*tarpitEntry{}}
+
+// Tarpits returns the process-wide tarpit counters.
+func Tarpits() TarpitStats {
+	return TarpitStats{Held: tarpits.held.Load(), Total: tarpits.total.Load(), Skipped: tarpits.skipped.Load()}
+}
+
+// tarpitTracker counts denials per key, for at most TarpitMaxKeys keys,
+// and the connections held across every tarpitting limiter.
+type tarpitTracker struct {
+	mu        sync.Mutex
+	entries   map[string]*tarpitEntry
+	lastSweep time.Time
+
+	held    atomic.Int64
+	total   atomic.Uint64
+	skipped atomic.Uint64
+}
+
+type tarpitEntry struct {
+	denials int
+	firstAt time.Time // start of the current denial window
+	window  time.Duration
+	holding bool // a denial of the key is being held
+}
+
+// acquire records a denial of bucket under p. It returns how long to hold
+// it, and the function releasing the hold, or 0 when the denial is answered
+// at once: the key is not far enough over its limit, one of its denials is
+// already held, the process holds as many connections as it may, or it
+// tracks as many keys as it may and bucket is not one of them.
+func (t *tarpitTracker) acquire(bucket string, p Policy) (time.Duration, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	e, ok := t.entries[bucket]
+	if !ok {
+		if max := config.RateLimit.TarpitMaxKeys; max > 0 && len(t.entries) >= max {
+			t.skipped.Add(1)
+			return 0, nil
+		}
+	}
+	if !ok || now.Sub(e.firstAt) > e.window && !e.holding {
+		e = &tarpitEntry{firstAt: now, window: p.Window}
+		t.entries[bucket] = e
+	}
+	e.denials++
+	after := p.TarpitAfter
+	if after == 0 {
+		after = p.Limit
+	}
+	if e.denials <= after || e.holding {
+		return 0, nil
+	}
+	if t.held.Load() >= int64(config.RateLimit.TarpitMaxConns) {
+		t.skipped.Add(1)
+		return 0, nil
+	}
+	e.holding = true
+	t.held.Add(1)
+	t.total.Add(1)
+
+	// Jitter between a fifth of the delay and all of it, so held clients
+	// cannot tell a tarpit from a slow server.
+	floor := p.TarpitDelay / 5
+	delay := floor + rand.N(p.TarpitDelay-floor+1)
+	return delay, func() {
+		t.mu.Lock()
+		e.holding = false
+		t.mu.Unlock()
+		t.held.Add(-1)
+	}
+}
+
+// sweep drops entries whose window has elapsed. It runs at most once a
+// minute so acquire stays cheap.
+func (t *tarpitTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = now
+	for k, e := range t.entries {
+		if now.Sub(e.firstAt) > e.window && !e.holding {
+			delete(t.entries, k)
+		}
+	}
+}
+
+// tarpit holds a denial of key when the policy tarpits and the key is far
+// over its limit. It returns early when the client goes away. Shadowed
+// limiters, store errors, concurrency denials and greylisting are never
+// held.
+func (l *Limiter) tarpit(r *http.Request, key, reason string) {
+	if l.policy.TarpitDelay <= 0 || l.shadow {
+		return
+	}
+	switch reason {
+	case "store_error", "concurrency", "greylist":
+		return
+	}
+	delay, release := tarpits.acquire(l.policy.Scope+"|"+l.bucketPrefix+key, l.policy)
+	if delay == 0 {
+		return
+	}
+	defer release()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
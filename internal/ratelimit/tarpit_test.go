@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gohst/internal/config"
+)
+
+func resetTarpits() {
+	tarpits.mu.Lock()
+	clear(tarpits.entries)
+	tarpits.mu.Unlock()
+}
+
+func TestMiddleware_Tarpit(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TarpitMaxConns = 10
+	resetTarpits()
+	store := NewMockStore()
+	store.DenyAll(30)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "tarpit_test",
+		TarpitDelay: 250 * time.Millisecond, TarpitAfter: 2}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(ctx context.Context) (int, time.Duration) {
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return rr.Code, time.Since(start)
+	}
+	for i := 0; i < 2; i++ {
+		if code, took := serve(context.Background()); code != http.StatusTooManyRequests || took > 40*time.Millisecond {
+			t.Fatalf("denial %d: expected a fast 429, got %d after %s", i+1, code, took)
+		}
+	}
+	if code, took := serve(context.Background()); code != http.StatusTooManyRequests || took < 50*time.Millisecond {
+		t.Errorf("expected the third denial to be held at least 50ms, got %d after %s", code, took)
+	}
+
+	// One held denial per key: the others are answered at once.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan time.Duration)
+	go func() {
+		_, took := serve(ctx)
+		done <- took
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, took := serve(context.Background()); took > 40*time.Millisecond {
+		t.Errorf("expected a second denial of a held key to be fast, took %s", took)
+	}
+	if got := Tarpits().Held; got != 1 {
+		t.Errorf("expected 1 held connection, got %d", got)
+	}
+	cancel()
+	if took := <-done; took > 200*time.Millisecond {
+		t.Errorf("expected a held denial to end when the client goes away, took %s", took)
+	}
+	if got := Tarpits().Held; got != 0 {
+		t.Errorf("expected no held connections after release, got %d", got)
+	}
+}
+
+func TestMiddleware_TarpitMaxConns(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TarpitMaxConns = 0
+	resetTarpits()
+	store := NewMockStore()
+	store.DenyAll(30)
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "tarpit_capped",
+		TarpitDelay: time.Second, TarpitAfter: 1}
+	handler := NewLimiter(store, p, KeyByIP()).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	skipped := Tarpits().Skipped
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Errorf("expected no denial to be held without connection slots, took %s", took)
+	}
+	if got := Tarpits().Skipped - skipped; got != 2 {
+		t.Errorf("expected 2 skipped tarpits, got %d", got)
+	}
+}
+
+func TestMiddleware_TarpitMaxKeys(t *testing.T) {
+	initTestConfig()
+	config.RateLimit.TarpitMaxConns = 10
+	config.RateLimit.TarpitMaxKeys = 2
+	resetTarpits()
+	p := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "tarpit_keys",
+		TarpitDelay: time.Second, TarpitAfter: 1}
+
+	skipped := Tarpits().Skipped
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if delay, _ := tarpits.acquire(key, p); delay != 0 {
+			t.Fatalf("%s: expected the first denial to be answered at once", key)
+		}
+	}
+	tarpits.mu.Lock()
+	n := len(tarpits.entries)
+	tarpits.mu.Unlock()
+	if n != 2 {
+		t.Errorf("expected the tracker capped at 2 keys, got %d", n)
+	}
+	if got := Tarpits().Skipped - skipped; got != 2 {
+		t.Errorf("expected 2 skipped tarpits for untracked keys, got %d", got)
+	}
+
+	// Tracked keys still tarpit.
+	delay, release := tarpits.acquire("a", p)
+	if delay == 0 {
+		t.Fatal("expected a tracked key far over its limit to be held")
+	}
+	release()
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import "math"
+
+// ──────────────────────────────────────────────
+// Per-tier policy multipliers
+// ──────────────────────────────────────────────
+
+// WithTierMultipliers scales the limiter's policy by the key type the key
+// function returned, so one fallback chain can give each tier its own
+// budget: with KeyByTokenElseUserElseIP and
+//
+//	map[string]float64{KeyTypeToken: 1, KeyTypeUser: 0.5, KeyTypeIP: 0.25}
+//
+// bare IPs get a quarter of what an API token gets. Limit and Burst are
+// scaled (Limit to at least 1); the window is kept. Key types without an
+// entry use the policy unchanged. Tiers already live in separate buckets,
+// since each tier's keys have their own prefix.
+//
+// The multiplier also applies to a geo policy picked by WithGeoPolicies,
+// but not to the strict spoof or reputation policies.
+func WithTierMultipliers(multipliers map[string]float64) Option {
+	tiers := make(map[string]float64, len(multipliers))
+	for keyType, m := range multipliers {
+		if m > 0 {
+			tiers[keyType] = m
+		}
+	}
+	return func(l *Limiter) { l.tiers = tiers }
+}
+
+// tierPolicy returns p scaled for keyType.
+func (l *Limiter) tierPolicy(p Policy, keyType string) Policy {
+	m, ok := l.tiers[keyType]
+	if !ok {
+		return p
+	}
+	return scalePolicy(p, m)
+}
+
+// scalePolicy multiplies the Limit (to at least 1) and Burst of p by m.
+func scalePolicy(p Policy, m float64) Policy {
+	if m == 1 {
+		return p
+	}
+	p.Limit = max(1, int(math.Round(float64(p.Limit)*m)))
+	p.Burst = max(0, int(math.Round(float64(p.Burst)*m)))
+	return p
+}
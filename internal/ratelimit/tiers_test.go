@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTierMultipliers(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Burst: 20, Enabled: true, Cost: 1, Scope: "api"}
+	limiter := NewLimiter(store, p, KeyByTokenElseUserElseIP(),
+		WithTierMultipliers(map[string]float64{KeyTypeToken: 1, KeyTypeIP: 0.25}))
+	handler := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	withToken := httptest.NewRequest(http.MethodGet, "/", nil)
+	withToken.Header.Set("Authorization", "Bearer abc")
+	handler.ServeHTTP(httptest.NewRecorder(), withToken)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	calls := store.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", calls)
+	}
+	if got := calls[0].Policy; got.Limit != 100 || got.Burst != 20 {
+		t.Fatalf("token tier: got limit %d burst %d", got.Limit, got.Burst)
+	}
+	if got := calls[1].Policy; got.Limit != 25 || got.Burst != 5 || got.Window != time.Minute {
+		t.Fatalf("ip tier: got %+v", got)
+	}
+}
+
+func TestTierPolicy_MinimumLimit(t *testing.T) {
+	l := &Limiter{}
+	WithTierMultipliers(map[string]float64{KeyTypeIP: 0.01, KeyTypeUser: -1})(l)
+	p := Policy{Limit: 10, Burst: 2, Window: time.Minute}
+	if got := l.tierPolicy(p, KeyTypeIP); got.Limit != 1 || got.Burst != 0 {
+		t.Fatalf("got %+v", got)
+	}
+	// Non-positive multipliers are ignored.
+	if got := l.tierPolicy(p, KeyTypeUser); got != p {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"net/http"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Tor exit nodes
+// ──────────────────────────────────────────────
+
+// TorExitListURL is the Tor Project's list of exit node addresses, one IP
+// per line.
+const TorExitListURL = "https://check.torproject.org/torbulkexitlist"
+
+// NewTorExitList returns an empty "tor" list and a feed keeping it in sync
+// with TorExitListURL every interval (an hour when <= 0). Call Start on
+// the feed at boot and Close on shutdown.
+func NewTorExitList(interval time.Duration) (*ReputationList, *ReputationFeed) {
+	list := &ReputationList{name: "tor"}
+	list.set.Store(&IPSet{})
+	return list, NewReputationFeed(list, TorExitListURL, interval)
+}
+
+// TorChallengeFunc may answer a request from a Tor exit with a challenge,
+// such as a CAPTCHA page. Return true when it has written the response;
+// false lets the request through to the rate check, e.g. once the client
+// has passed the challenge.
+type TorChallengeFunc func(w http.ResponseWriter, r *http.Request) bool
+
+type torConfig struct {
+	exits     ReputationProvider
+	policy    *Policy
+	challenge TorChallengeFunc
+}
+
+// WithTor gives requests from Tor exit nodes (see NewTorExitList) their own
+// handling instead of a hard block. challenge, when non-nil, runs first.
+// Requests it lets through are charged against policy in a separate
+// "tor:<key>" bucket, or against the limiter's policy when policy is nil.
+// Many Tor users share each exit address, so expect IP keys to fill up
+// faster than usual.
+func WithTor(exits ReputationProvider, policy *Policy, challenge TorChallengeFunc) Option {
+	return func(l *Limiter) { l.tor = &torConfig{exits: exits, policy: policy, challenge: challenge} }
+}
+
+// checkTor reports whether r comes from a Tor exit node.
+func (l *Limiter) checkTor(r *http.Request) bool {
+	if l.tor == nil {
+		return false
+	}
+	_, listed := ClientReputation(r, l.tor.exits)
+	return listed
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Tor(t *testing.T) {
+	initTestConfig()
+	path := filepath.Join(t.TempDir(), "exits.txt")
+	os.WriteFile(path, []byte("185.220.101.1\n185.220.101.2\n"), 0o600)
+	exits, _ := NewTorExitList(time.Hour)
+	if err := NewReputationFeed(exits, path, time.Hour).Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api"}
+	torPolicy := Policy{Limit: 10, Window: time.Minute, Enabled: true, Cost: 1, Scope: "api_tor"}
+	challenge := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-Challenge-Passed") != "" {
+			return false
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return true
+	}
+	h := NewLimiter(store, p, KeyByIP(), WithTor(exits, &torPolicy, challenge)).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	serve := func(remote string, passed bool) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote + ":1234"
+		if passed {
+			r.Header.Set("X-Challenge-Passed", "1")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	if code := serve("185.220.101.1", false); code != http.StatusUnauthorized {
+		t.Fatalf("expected the challenge, got %d", code)
+	}
+	if code := serve("185.220.101.1", true); code != http.StatusOK {
+		t.Fatalf("expected 200 after the challenge, got %d", code)
+	}
+	if code := serve("9.9.9.9", false); code != http.StatusOK {
+		t.Fatalf("non-Tor client: expected 200, got %d", code)
+	}
+
+	calls := store.Calls()
+	if len(calls) != 2 || calls[0].Key != "tor:ip:185.220.101.1" || calls[0].Policy.Limit != 10 || calls[1].Key != "ip:9.9.9.9" {
+		t.Fatalf("got %+v", calls)
+	}
+}
@@ -0,0 +1,364 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Policy tuner (limit suggestions)
+// ──────────────────────────────────────────────
+
+const (
+	tunerMinRequests = 1000  // requests needed before a scope gets a suggestion
+	tunerMinWindows  = 3     // closed windows needed before a scope gets a suggestion
+	tunerMaxKeys     = 10000 // keys tracked per scope and window
+	tunerPeakSamples = 4096  // per-key window totals kept per scope
+)
+
+// TunerGuardrails bound what PolicyTuner.Apply may change.
+type TunerGuardrails struct {
+	MaxStep  float64 // largest relative change per Apply, e.g. 0.5 = ±50%; 0 means 0.5
+	MinLimit int     // never go below this limit; 0 means 1
+	MaxLimit int     // never go above this limit; 0 means no cap
+}
+
+// Suggestion is the tuner's verdict on one scope.
+type Suggestion struct {
+	Scope          string  `json:"scope"`
+	Limit          int     `json:"limit"` // current (effective) values
+	Burst          int     `json:"burst"`
+	Window         int     `json:"window"` // seconds
+	Requests       uint64  `json:"requests"`
+	DenyRate       float64 `json:"deny_rate"`       // fraction of requests denied
+	DeniedKeyRate  float64 `json:"denied_key_rate"` // fraction of keys denied at least once per window
+	PeakP99        int     `json:"peak_p99"`        // cost per window used by the 99th-percentile key
+	SuggestedLimit int     `json:"suggested_limit"` // equal to Limit when no change is suggested
+	SuggestedBurst int     `json:"suggested_burst"`
+	Reason         string  `json:"reason"`
+	Applied        bool    `json:"applied"` // an override from Apply is active
+}
+
+// PolicyTuner watches per-scope traffic and suggests limit/burst changes,
+// e.g. "this limit denies 0.0% of traffic and could be halved". It only
+// suggests: nothing changes until Apply is called for a scope, and then
+// only within the guardrails.
+//
+// Feed it live traffic with NewTunerStore, or replay historical traffic
+// with Observe.
+type PolicyTuner struct {
+	guard TunerGuardrails
+
+	mu        sync.Mutex
+	scopes    map[string]*scopeTraffic
+	overrides map[string][2]int // scope → limit, burst
+}
+
+type scopeTraffic struct {
+	policy      Policy // last seen, before overrides
+	requests    uint64
+	denied      uint64
+	windowStart time.Time
+	windows     int
+
+	keys       map[string]int // cost per key in the current window
+	deniedKeys map[string]struct{}
+	keyTotal   uint64 // keys seen, summed over closed windows
+	deniedKeyN uint64 // keys denied, summed over closed windows
+
+	peaks []int // ring of per-key window totals
+	next  int
+}
+
+// NewPolicyTuner creates a tuner that applies suggestions within guard.
+func NewPolicyTuner(guard TunerGuardrails) *PolicyTuner {
+	if guard.MaxStep <= 0 {
+		guard.MaxStep = 0.5
+	}
+	if guard.MinLimit < 1 {
+		guard.MinLimit = 1
+	}
+	return &PolicyTuner{
+		guard:     guard,
+		scopes:    make(map[string]*scopeTraffic),
+		overrides: make(map[string][2]int),
+	}
+}
+
+// Observe records one decision. policy is the policy as configured, before
+// any override.
+func (t *PolicyTuner) Observe(policy Policy, key string, cost int, allowed bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := t.scopes[policy.Scope]
+	if st == nil {
+		st = &scopeTraffic{
+			windowStart: at,
+			keys:        make(map[string]int),
+			deniedKeys:  make(map[string]struct{}),
+		}
+		t.scopes[policy.Scope] = st
+	}
+	st.policy = policy
+	if window := policy.Window; window > 0 && at.Sub(st.windowStart) >= window {
+		st.closeWindow()
+		st.windowStart = at
+	}
+
+	st.requests++
+	if _, ok := st.keys[key]; ok || len(st.keys) < tunerMaxKeys {
+		st.keys[key] += cost
+		if !allowed {
+			st.deniedKeys[key] = struct{}{}
+		}
+	}
+	if !allowed {
+		st.denied++
+	}
+}
+
+func (st *scopeTraffic) closeWindow() {
+	for _, n := range st.keys {
+		if len(st.peaks) < tunerPeakSamples {
+			st.peaks = append(st.peaks, n)
+		} else {
+			st.peaks[st.next] = n
+			st.next = (st.next + 1) % tunerPeakSamples
+		}
+	}
+	st.keyTotal += uint64(len(st.keys))
+	st.deniedKeyN += uint64(len(st.deniedKeys))
+	st.windows++
+	st.keys = make(map[string]int)
+	st.deniedKeys = make(map[string]struct{})
+}
+
+// Suggestions returns a suggestion for every scope with enough traffic,
+// sorted by scope.
+func (t *PolicyTuner) Suggestions() []Suggestion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]Suggestion, 0, len(t.scopes))
+	for scope := range t.scopes {
+		if s, ok := t.suggest(scope); ok {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Scope < out[j].Scope })
+	return out
+}
+
+// suggest builds the suggestion for scope. The caller must hold t.mu.
+func (t *PolicyTuner) suggest(scope string) (Suggestion, bool) {
+	st := t.scopes[scope]
+	if st == nil || st.requests < tunerMinRequests || st.windows < tunerMinWindows {
+		return Suggestion{}, false
+	}
+	p := t.effective(st.policy)
+	s := Suggestion{
+		Scope:          scope,
+		Limit:          p.Limit,
+		Burst:          p.Burst,
+		Window:         int(p.Window.Seconds()),
+		Requests:       st.requests,
+		DenyRate:       float64(st.denied) / float64(st.requests),
+		PeakP99:        percentile(st.peaks, 0.99),
+		SuggestedLimit: p.Limit,
+		SuggestedBurst: p.Burst,
+		Reason:         "limit matches observed traffic",
+	}
+	_, s.Applied = t.overrides[scope]
+	if st.keyTotal > 0 {
+		s.DeniedKeyRate = float64(st.deniedKeyN) / float64(st.keyTotal)
+	}
+
+	capacity := p.Limit + p.Burst
+	switch {
+	case st.denied == 0 && s.PeakP99*2 <= capacity && p.Limit > 1:
+		s.SuggestedLimit, s.SuggestedBurst = p.Limit/2, p.Burst/2
+		s.Reason = fmt.Sprintf("denies 0.0%% of traffic and the 99th-percentile key uses %d of %d per window; the limit could be halved",
+			s.PeakP99, capacity)
+	case s.DeniedKeyRate > 0.05 && s.PeakP99 > capacity:
+		scale := float64(s.PeakP99) * 1.2 / float64(capacity)
+		s.SuggestedLimit = int(math.Ceil(float64(p.Limit) * scale))
+		s.SuggestedBurst = int(math.Ceil(float64(p.Burst) * scale))
+		s.Reason = fmt.Sprintf("denies %.1f%% of traffic across %.1f%% of keys, not just a few heavy hitters; the limit may be too tight",
+			s.DenyRate*100, s.DeniedKeyRate*100)
+	}
+	return s, true
+}
+
+// Apply overrides scope's limit and burst with its current suggestion,
+// clamped to the guardrails, and returns the applied suggestion. The
+// scope's traffic history is cleared, so the next suggestion reflects the
+// new limits.
+func (t *PolicyTuner) Apply(scope string) (Suggestion, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.suggest(scope)
+	if !ok {
+		return Suggestion{}, fmt.Errorf("ratelimit: not enough traffic to tune scope %q", scope)
+	}
+	s.SuggestedLimit = t.clamp(s.Limit, s.SuggestedLimit)
+	s.SuggestedBurst = clampStep(s.Burst, s.SuggestedBurst, t.guard.MaxStep)
+	t.overrides[scope] = [2]int{s.SuggestedLimit, s.SuggestedBurst}
+	delete(t.scopes, scope)
+	s.Applied = true
+	return s, nil
+}
+
+// Revert removes scope's override.
+func (t *PolicyTuner) Revert(scope string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.overrides, scope)
+}
+
+// Override returns policy with any applied override for its scope.
+func (t *PolicyTuner) Override(policy Policy) Policy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.effective(policy)
+}
+
+// effective applies the override for policy's scope. The caller must hold t.mu.
+func (t *PolicyTuner) effective(policy Policy) Policy {
+	if o, ok := t.overrides[policy.Scope]; ok {
+		policy.Limit, policy.Burst = o[0], o[1]
+	}
+	return policy
+}
+
+func (t *PolicyTuner) clamp(current, suggested int) int {
+	n := clampStep(current, suggested, t.guard.MaxStep)
+	if n < t.guard.MinLimit {
+		n = t.guard.MinLimit
+	}
+	if t.guard.MaxLimit > 0 && n > t.guard.MaxLimit {
+		n = t.guard.MaxLimit
+	}
+	return n
+}
+
+// clampStep limits suggested to within ±step (relative) of current.
+func clampStep(current, suggested int, step float64) int {
+	lo := int(math.Floor(float64(current) * (1 - step)))
+	hi := int(math.Ceil(float64(current) * (1 + step)))
+	return min(max(suggested, lo), hi)
+}
+
+// percentile returns the q-th percentile of values (0 when empty).
+func percentile(values []int, q float64) int {
+	if len(values) == 0 {
+		return 0
+	}
+	s := append([]int(nil), values...)
+	sort.Ints(s)
+	return s[int(float64(len(s)-1)*q)]
+}
+
+// ──────────────────────────────────────────────
+// Store wrapper and admin handler
+// ──────────────────────────────────────────────
+
+// TunerStore wraps a Store, feeding every decision to a PolicyTuner and
+// enforcing the tuner's applied overrides.
+type TunerStore struct {
+	inner Store
+	tuner *PolicyTuner
+}
+
+// NewTunerStore wraps inner with tuner.
+func NewTunerStore(inner Store, tuner *PolicyTuner) *TunerStore {
+	return &TunerStore{inner: inner, tuner: tuner}
+}
+
+// Inner returns the wrapped store.
+func (s *TunerStore) Inner() Store { return s.inner }
+
+// Tuner returns the tuner fed by this store.
+func (s *TunerStore) Tuner() *PolicyTuner { return s.tuner }
+
+// Allow implements Store.
+func (s *TunerStore) Allow(ctx context.Context, key string, policy Policy, cost int) Result {
+	res := s.inner.Allow(ctx, key, s.tuner.Override(policy), cost)
+	if res.Err == nil {
+		s.tuner.Observe(policy, key, cost, res.Allowed, time.Now())
+	}
+	return res
+}
+
+// AllowMulti implements MultiStore.
+func (s *TunerStore) AllowMulti(ctx context.Context, reqs []AllowRequest) []Result {
+	tuned := make([]AllowRequest, len(reqs))
+	for i, req := range reqs {
+		req.Policy = s.tuner.Override(req.Policy)
+		tuned[i] = req
+	}
+	results := AllowMulti(ctx, s.inner, tuned)
+	now := time.Now()
+	for i, res := range results {
+		if res.Err == nil {
+			s.tuner.Observe(reqs[i].Policy, reqs[i].Key, reqs[i].Cost, res.Allowed, now)
+		}
+	}
+	return results
+}
+
+// Reset implements Store.
+func (s *TunerStore) Reset(key string) error { return s.inner.Reset(key) }
+
+// Close implements Store.
+func (s *TunerStore) Close() error { return s.inner.Close() }
+
+// Ping implements Healther by delegating to the wrapped store.
+func (s *TunerStore) Ping(ctx context.Context) error { return pingInner(ctx, s.inner) }
+
+// Status implements Healther by delegating to the wrapped store.
+func (s *TunerStore) Status(ctx context.Context) HealthStatus { return CheckHealth(ctx, s.inner) }
+
+// TunerHandler serves the tuner's admin API:
+//
+//	GET  /            suggestions for every scope
+//	POST /?scope=x&action=apply|revert
+//
+// Mount it behind admin authentication.
+func TunerHandler(t *PolicyTuner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, t.Suggestions())
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		scope := r.URL.Query().Get("scope")
+		if scope == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "scope is required"})
+			return
+		}
+		switch r.URL.Query().Get("action") {
+		case "apply":
+			s, err := t.Apply(scope)
+			if err != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, s)
+		case "revert":
+			t.Revert(scope)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": `action must be "apply" or "revert"`})
+		}
+	})
+}
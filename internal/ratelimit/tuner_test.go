@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// replay feeds windows of traffic for p: each of keys makes perKey requests
+// per window, and requests beyond capacity are denied.
+func replay(t *PolicyTuner, p Policy, windows, keys, perKey int) {
+	start := time.Unix(1700000000, 0)
+	for w := 0; w <= windows; w++ {
+		at := start.Add(time.Duration(w) * p.Window)
+		for k := 0; k < keys; k++ {
+			for i := 0; i < perKey; i++ {
+				t.Observe(p, fmt.Sprintf("ip:%d", k), 1, i < p.Limit+p.Burst, at)
+			}
+		}
+	}
+}
+
+func TestPolicyTuner_SuggestsHalvingUnusedLimit(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	p := Policy{Limit: 100, Burst: 20, Window: time.Minute, Scope: "api"}
+	replay(tuner, p, 4, 50, 10)
+
+	got := tuner.Suggestions()
+	if len(got) != 1 {
+		t.Fatalf("want 1 suggestion, got %+v", got)
+	}
+	s := got[0]
+	if s.DenyRate != 0 || s.PeakP99 != 10 || s.SuggestedLimit != 50 || s.SuggestedBurst != 10 {
+		t.Fatalf("unexpected suggestion: %+v", s)
+	}
+}
+
+func TestPolicyTuner_SuggestsRaisingWidespreadDenials(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	p := Policy{Limit: 8, Burst: 2, Window: time.Minute, Scope: "api"}
+	replay(tuner, p, 4, 50, 20) // every key needs 20, capacity is 10
+
+	s := tuner.Suggestions()[0]
+	if s.DeniedKeyRate < 0.99 || s.SuggestedLimit <= p.Limit {
+		t.Fatalf("expected a raise, got %+v", s)
+	}
+}
+
+func TestPolicyTuner_NotEnoughTraffic(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	replay(tuner, Policy{Limit: 100, Window: time.Minute, Scope: "api"}, 1, 5, 1)
+	if got := tuner.Suggestions(); len(got) != 0 {
+		t.Fatalf("want no suggestions, got %+v", got)
+	}
+	if _, err := tuner.Apply("api"); err == nil {
+		t.Fatal("Apply without enough traffic should fail")
+	}
+}
+
+func TestPolicyTuner_ApplyWithinGuardrails(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{MaxStep: 0.25, MinLimit: 80})
+	p := Policy{Limit: 100, Burst: 20, Window: time.Minute, Scope: "api"}
+	replay(tuner, p, 4, 50, 10)
+
+	s, err := tuner.Apply("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SuggestedLimit != 80 || s.SuggestedBurst != 15 {
+		t.Fatalf("want limit 80 / burst 15 after clamping, got %d / %d", s.SuggestedLimit, s.SuggestedBurst)
+	}
+	if got := tuner.Override(p); got.Limit != 80 || got.Burst != 15 {
+		t.Fatalf("override not applied: %+v", got)
+	}
+
+	tuner.Revert("api")
+	if got := tuner.Override(p); got.Limit != 100 || got.Burst != 20 {
+		t.Fatalf("override not reverted: %+v", got)
+	}
+}
+
+func TestTunerStore_EnforcesOverride(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	inner := NewMockStore()
+	store := NewTunerStore(inner, tuner)
+
+	p := Policy{Limit: 100, Window: time.Minute, Scope: "api"}
+	tuner.overrides["api"] = [2]int{40, 0}
+	store.Allow(context.Background(), "k", p, 1)
+	if calls := inner.Calls(); calls[0].Policy.Limit != 40 {
+		t.Fatalf("inner store saw limit %d, want 40", calls[0].Policy.Limit)
+	}
+}
+
+func TestTunerHandler(t *testing.T) {
+	tuner := NewPolicyTuner(TunerGuardrails{})
+	replay(tuner, Policy{Limit: 100, Burst: 20, Window: time.Minute, Scope: "api"}, 4, 50, 10)
+	h := TunerHandler(tuner)
+
+	for _, tt := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/", http.StatusOK},
+		{http.MethodPost, "/?scope=api&action=apply", http.StatusOK},
+		{http.MethodPost, "/?scope=api&action=apply", http.StatusConflict}, // history cleared by the first apply
+		{http.MethodPost, "/?scope=api&action=revert", http.StatusNoContent},
+		{http.MethodPost, "/?scope=api&action=bogus", http.StatusBadRequest},
+		{http.MethodPost, "/?action=apply", http.StatusBadRequest},
+		{http.MethodDelete, "/", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: want %d, got %d", tt.method, tt.target, tt.want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+)
+
+// ──────────────────────────────────────────────
+// Upload cost accounting
+// ──────────────────────────────────────────────
+
+// UploadTokenBytes is the body size one token pays for under UploadPolicy.
+const UploadTokenBytes = 1 << 10
+
+// uploadChargeTokens is how many tokens a metered body reads before they
+// are charged, so a large stream costs one store call per 64 tokens rather
+// than one per token. Small buckets are charged in smaller batches.
+const uploadChargeTokens = 64
+
+// ErrUploadRateLimited is returned by the body of a streamed upload once it
+// has read more than the key's byte budget.
+var ErrUploadRateLimited = errors.New("ratelimit: upload exceeds the rate limit")
+
+// ContentLengthCost returns a CostFunc charging one token per started
+// bytesPerToken of the declared Content-Length. Requests without a body
+// or with an unknown length (chunked) are charged the policy's Cost.
+func ContentLengthCost(bytesPerToken int64) CostFunc {
+	if bytesPerToken < 1 {
+		bytesPerToken = 1
+	}
+	return func(r *http.Request) int {
+		if r.ContentLength <= 0 {
+			return 0
+		}
+		tokens := (r.ContentLength + bytesPerToken - 1) / bytesPerToken
+		if tokens > math.MaxInt32 {
+			return math.MaxInt32
+		}
+		return int(tokens)
+	}
+}
+
+// WithUploadCost charges uploads by size: one token per started
+// bytesPerToken. Requests with a Content-Length pay for it up front, as
+// with ContentLengthCost. Bodies of unknown length pay the policy's Cost
+// up front and are then charged as they are read; once the key runs out
+// of budget, reads fail with ErrUploadRateLimited.
+//
+// A CostFunc set with WithCostFunc takes precedence for the up-front
+// charge. Shadowed limiters do not meter bodies.
+func WithUploadCost(bytesPerToken int64) Option {
+	if bytesPerToken < 1 {
+		bytesPerToken = 1
+	}
+	return func(l *Limiter) {
+		l.uploadUnit = bytesPerToken
+		if l.costFunc == nil {
+			l.costFunc = ContentLengthCost(bytesPerToken)
+		}
+	}
+}
+
+// meterBody wraps the body of r in a meteredBody when l charges streamed
+// uploads and r does not declare its length.
+func (l *Limiter) meterBody(r *http.Request, bucket string, policy Policy, key, keyType string) {
+	if l.uploadUnit == 0 || r.ContentLength >= 0 || r.Body == nil || r.Body == http.NoBody || l.shadowed() {
+		return
+	}
+	batch := int64(min(float64(uploadChargeTokens), policy.capacity()))
+	r.Body = &meteredBody{
+		ReadCloser: r.Body,
+		l:          l,
+		r:          r,
+		bucket:     bucket,
+		policy:     policy,
+		key:        key,
+		keyType:    keyType,
+		batch:      max(batch, 1),
+	}
+}
+
+// meteredBody charges the bytes read from a request body to a bucket.
+type meteredBody struct {
+	io.ReadCloser
+	l       *Limiter
+	r       *http.Request
+	bucket  string
+	policy  Policy
+	key     string
+	keyType string
+	batch   int64 // tokens charged per store call
+	pending int64 // bytes read but not yet charged
+	err     error
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.pending += int64(n)
+	unit := b.l.uploadUnit
+	for b.pending >= b.batch*unit {
+		b.pending -= b.batch * unit
+		if !b.charge(int(b.batch)) {
+			return n, b.err
+		}
+	}
+	if err == io.EOF && b.pending > 0 {
+		// Charge the last started token.
+		tokens := (b.pending + unit - 1) / unit
+		b.pending = 0
+		if !b.charge(int(tokens)) {
+			return n, b.err
+		}
+	}
+	return n, err
+}
+
+// charge takes tokens from the bucket, and reports whether the upload may
+// go on. Store errors follow the policy's fail mode.
+func (b *meteredBody) charge(tokens int) bool {
+	l := b.l
+	result := l.store.Allow(b.r.Context(), b.bucket, b.policy, tokens)
+	if result.Err != nil {
+		if l.allowOnStoreError("allow", b.key, result.Err) {
+			return true
+		}
+		result = l.failClosedResult()
+	}
+	if result.Allowed {
+		return true
+	}
+	l.logDenied(b.r, result, b.key, b.keyType, "upload")
+	b.err = ErrUploadRateLimited
+	return false
+}
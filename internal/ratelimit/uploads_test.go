@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentLengthCost(t *testing.T) {
+	cost := ContentLengthCost(UploadTokenBytes)
+	for _, tc := range []struct {
+		length int64
+		want   int
+	}{
+		{0, 0},
+		{-1, 0},
+		{1, 1},
+		{UploadTokenBytes, 1},
+		{UploadTokenBytes + 1, 2},
+		{500 << 20, 512000},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		r.ContentLength = tc.length
+		if got := cost(r); got != tc.want {
+			t.Errorf("length %d: expected cost %d, got %d", tc.length, tc.want, got)
+		}
+	}
+}
+
+func TestMiddleware_UploadCost(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	limiter := NewLimiter(store, UploadPolicy(10*UploadTokenBytes), KeyByIP(), WithUploadCost(UploadTokenBytes))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	post := func(size int) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", size))))
+		return rr
+	}
+	if rr := post(4 * UploadTokenBytes); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "6" {
+		t.Fatalf("expected a 4 KiB upload to pass and cost 4 tokens, got %d remaining=%s", rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+	}
+	if rr := post(8 * UploadTokenBytes); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the byte budget is spent, got %d", rr.Code)
+	}
+	if rr := post(20 * UploadTokenBytes); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an upload larger than the whole budget, got %d", rr.Code)
+	}
+	// Requests without a body still pay the policy's Cost.
+	if rr := post(0); rr.Code != http.StatusOK || rr.Header().Get("X-RateLimit-Remaining") != "5" {
+		t.Errorf("expected an empty post to cost 1 token, got %d remaining=%s", rr.Code, rr.Header().Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestMiddleware_UploadCostStreamed(t *testing.T) {
+	initTestConfig()
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	limiter := NewLimiter(store, UploadPolicy(10*UploadTokenBytes), KeyByIP(), WithUploadCost(UploadTokenBytes))
+	var readErr error
+	var read int
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		read, readErr = len(body), err
+	}))
+
+	stream := func(size int) {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", size)))
+		req.ContentLength = -1 // chunked
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	stream(2*UploadTokenBytes + 1)
+	if readErr != nil || read != 2*UploadTokenBytes+1 {
+		t.Fatalf("expected a small stream to be read in full, got %d bytes, err %v", read, readErr)
+	}
+	// 1 token up front plus 3 for the started KiBs, then 1 for this one.
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "5" {
+		t.Errorf("expected 5 tokens left after the stream, got %s", got)
+	}
+
+	stream(20 * UploadTokenBytes)
+	if !errors.Is(readErr, ErrUploadRateLimited) {
+		t.Errorf("expected ErrUploadRateLimited once the stream outgrows the budget, got %v", readErr)
+	}
+	if read >= 20*UploadTokenBytes {
+		t.Errorf("expected the stream to be cut short, read %d bytes", read)
+	}
+}
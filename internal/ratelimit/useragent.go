@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ──────────────────────────────────────────────
+// User-agent classes and per-class policies
+// ──────────────────────────────────────────────
+
+// UAClass is a coarse classification of a User-Agent header.
+type UAClass string
+
+const (
+	UABrowser  UAClass = "browser"  // a desktop or mobile browser
+	UABot      UAClass = "bot"      // a self-declared crawler, spider or preview bot
+	UAHeadless UAClass = "headless" // an automated browser (HeadlessChrome, Puppeteer, ...)
+	UACLI      UAClass = "cli"      // an HTTP library or command-line client (curl, python-requests, ...)
+	UAUnknown  UAClass = "unknown"  // empty or unrecognised
+)
+
+// uaHeadlessTokens mark automated browsers, which otherwise look like the
+// browser they drive.
+var uaHeadlessTokens = []string{"headlesschrome", "phantomjs", "puppeteer", "playwright", "selenium", "webdriver", "slimerjs"}
+
+// uaCLIPrefixes are the product tokens HTTP libraries and tools send.
+var uaCLIPrefixes = []string{
+	"curl/", "wget/", "python-requests/", "python-urllib/", "python-httpx/", "aiohttp/",
+	"go-http-client/", "okhttp/", "axios/", "node-fetch/", "undici", "got ",
+	"java/", "apache-httpclient/", "libwww-perl/", "lwp::", "httpie/", "powershell/",
+	"ruby", "faraday ", "guzzlehttp/", "php/", "dart:io", "insomnia/", "postmanruntime/",
+}
+
+// uaBotTokens mark self-declared bots. A bare "bot" would also match
+// phone models such as "CUBOT X19", so only "bot" followed by the
+// punctuation of a product token counts, as does a "+http" contact URL.
+var uaBotTokens = []string{
+	"bot/", "bot-", "bot;", "bot)", "+http", "crawl", "spider", "slurp",
+	"facebookexternalhit", "mediapartners", "preview", "scrapy",
+}
+
+// uaBrowserTokens are engine or product tokens real browsers send after
+// "Mozilla/5.0".
+var uaBrowserTokens = []string{"chrome/", "firefox/", "safari/", "edg/", "opr/", "gecko/", "applewebkit/"}
+
+// ClassifyUserAgent maps a User-Agent header to its UAClass. The header is
+// client-controlled, so a class only says what the client claims to be:
+// use a class to be stricter with what declares itself a script, not to
+// trust what declares itself a browser. Verified crawlers are handled by
+// CrawlerVerifier.
+func ClassifyUserAgent(ua string) UAClass {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return UAUnknown
+	}
+	for _, token := range uaHeadlessTokens {
+		if strings.Contains(ua, token) {
+			return UAHeadless
+		}
+	}
+	for _, prefix := range uaCLIPrefixes {
+		if strings.HasPrefix(ua, prefix) {
+			return UACLI
+		}
+	}
+	for _, token := range uaBotTokens {
+		if strings.Contains(ua, token) {
+			return UABot
+		}
+	}
+	if strings.HasPrefix(ua, "mozilla/5.0") {
+		for _, token := range uaBrowserTokens {
+			if strings.Contains(ua, token) {
+				return UABrowser
+			}
+		}
+	}
+	return UAUnknown
+}
+
+// WithUAPolicies charges each User-Agent class listed in policies against
+// its own policy, in a separate "ua:<class>:<key>" bucket; unlisted classes
+// keep the limiter's policy. For example, give UACLI and UAHeadless a
+// tight policy and UABrowser a generous one. Class policies take
+// precedence over geo policies; verified crawlers use their crawler
+// policy (see WithCrawlerPolicy).
+func WithUAPolicies(policies map[UAClass]Policy) Option {
+	return func(l *Limiter) { l.uaPolicies = policies }
+}
+
+// uaPolicy returns the class bucket and policy for r, if its class has one.
+func (l *Limiter) uaPolicy(r *http.Request, key string) (string, Policy, bool) {
+	if len(l.uaPolicies) == 0 {
+		return "", Policy{}, false
+	}
+	class := ClassifyUserAgent(r.UserAgent())
+	p, ok := l.uaPolicies[class]
+	if !ok {
+		return "", Policy{}, false
+	}
+	return "ua:" + string(class) + ":" + key, p, true
+}
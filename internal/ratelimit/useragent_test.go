@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want UAClass
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", UABrowser},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", UABrowser},
+		{"Mozilla/5.0 (Linux; Android 9; CUBOT X19) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", UABrowser},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/126.0.0.0 Safari/537.36", UAHeadless},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", UABot},
+		{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)", UABot},
+		{"facebookexternalhit/1.1", UABot},
+		{"curl/8.5.0", UACLI},
+		{"python-requests/2.32.3", UACLI},
+		{"Go-http-client/2.0", UACLI},
+		{"", UAUnknown},
+		{"SomethingElse/1.0", UAUnknown},
+	}
+	for _, tc := range tests {
+		if got := ClassifyUserAgent(tc.ua); got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.ua, got, tc.want)
+		}
+	}
+}
+
+func TestMiddleware_UAPolicies(t *testing.T) {
+	initTestConfig()
+	store := NewMockStore()
+	p := Policy{Limit: 100, Window: time.Minute, Enabled: true, Cost: 1, Scope: "browse"}
+	cli := Policy{Limit: 5, Window: time.Minute, Enabled: true, Cost: 1, Scope: "browse_cli"}
+	h := NewLimiter(store, p, KeyByIP(), WithUAPolicies(map[UAClass]Policy{UACLI: cli})).
+		Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, ua := range []string{"curl/8.5.0", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", ua)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	calls := store.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %+v", calls)
+	}
+	if calls[0].Key != "ua:cli:ip:192.0.2.1" || calls[0].Policy.Limit != 5 {
+		t.Fatalf("cli: got %+v", calls[0])
+	}
+	if calls[1].Key != "ip:192.0.2.1" || calls[1].Policy.Limit != 100 {
+		t.Fatalf("browser: got %+v", calls[1])
+	}
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// WebSocket message limits
+// ──────────────────────────────────────────────
+
+// ErrMessageRateLimited is returned by LimitedConn.ReadMessage after the
+// connection was closed for sending too many messages.
+var ErrMessageRateLimited = errors.New("ratelimit: websocket closed for exceeding the message rate limit")
+
+// WebSocket close frame values used by LimitedConn.
+const (
+	wsCloseMessage = 8 // opcode of a close frame
+
+	// WSClosePolicyViolation is the close code sent on sustained abuse
+	// (RFC 6455, 7.4.1).
+	WSClosePolicyViolation = 1008
+)
+
+// WebSocketConn is the part of an upgraded WebSocket connection that a
+// MessageLimiter uses. *websocket.Conn from gorilla/websocket implements
+// it; other libraries need a small adapter.
+type WebSocketConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+}
+
+// MessageLimiter applies a policy to the inbound messages of WebSocket
+// connections, which the HTTP middleware never sees after the upgrade.
+// Each message costs the policy's Cost. Messages over the limit are
+// dropped, and once maxDenials messages were denied within window the
+// connection is closed with WSClosePolicyViolation. Allowed messages in
+// between do not reset the count, so a client cannot stay just over the
+// limit by spacing its messages.
+type MessageLimiter struct {
+	store      Store
+	policy     Policy
+	maxDenials int
+	window     time.Duration
+}
+
+// NewMessageLimiter creates a MessageLimiter backed by store. maxDenials
+// defaults to 10, and window to a minute.
+func NewMessageLimiter(store Store, policy Policy, maxDenials int, window time.Duration) *MessageLimiter {
+	if maxDenials < 1 {
+		maxDenials = 10
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	if policy.Cost < 1 {
+		policy.Cost = 1
+	}
+	return &MessageLimiter{store: store, policy: policy, maxDenials: maxDenials, window: window}
+}
+
+// Wrap limits the messages read from conn. Connections wrapped with the
+// same key share one bucket, e.g. a key from the upgrade request's
+// KeyFunc limits each user or IP across all their connections. An empty
+// key gives the connection a bucket of its own.
+//
+// Read through the returned LimitedConn and keep writing to conn.
+func (m *MessageLimiter) Wrap(conn WebSocketConn, key string) *LimitedConn {
+	if key == "" {
+		key = "conn:" + connID()
+	}
+	return &LimitedConn{conn: conn, limiter: m, key: "ws:" + key}
+}
+
+// LimitedConn is a WebSocket connection whose inbound messages are limited.
+type LimitedConn struct {
+	conn    WebSocketConn
+	limiter *MessageLimiter
+	key     string
+
+	mu     sync.Mutex
+	denied []time.Time // times of the denials within the window, oldest first
+	closed bool
+}
+
+// ReadMessage returns the next message within the limit. Messages over it
+// are read and dropped. Once the connection is closed for abuse it returns
+// ErrMessageRateLimited.
+func (c *LimitedConn) ReadMessage() (int, []byte, error) {
+	for {
+		messageType, p, err := c.conn.ReadMessage()
+		if err != nil {
+			if c.limitedClose() {
+				return messageType, nil, ErrMessageRateLimited
+			}
+			return messageType, p, err
+		}
+		if c.allow() {
+			return messageType, p, nil
+		}
+		if c.limitedClose() {
+			return messageType, nil, ErrMessageRateLimited
+		}
+	}
+}
+
+// Denials returns how many messages were denied within the window.
+func (c *LimitedConn) Denials() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	return len(c.denied)
+}
+
+// expire forgets denials older than the window. The caller must hold c.mu.
+func (c *LimitedConn) expire(now time.Time) {
+	cutoff := now.Add(-c.limiter.window)
+	i := 0
+	for i < len(c.denied) && !c.denied[i].After(cutoff) {
+		i++
+	}
+	c.denied = c.denied[i:]
+}
+
+// allow spends the cost of one message, closing the connection when too
+// many messages were denied within the window.
+func (c *LimitedConn) allow() bool {
+	m := c.limiter
+	res := m.store.Allow(context.Background(), c.key, m.policy, m.policy.Cost)
+	if res.Err != nil {
+		if m.policy.failClosed() {
+			failedClosed.Add(1)
+			res.Allowed = false
+		} else {
+			failedOpen.Add(1)
+			res.Allowed = true
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if res.Allowed {
+		return true
+	}
+	now := time.Now()
+	c.expire(now)
+	c.denied = append(c.denied, now)
+	if len(c.denied) >= m.maxDenials && !c.closed {
+		c.closed = true
+		log.Printf("[ratelimit] websocket closed: %d messages denied within %s | scope=%s key=%s",
+			len(c.denied), m.window, m.policy.Scope, truncateKey(c.key))
+		msg := make([]byte, 2, 2+len("rate limit exceeded"))
+		binary.BigEndian.PutUint16(msg, WSClosePolicyViolation)
+		msg = append(msg, "rate limit exceeded"...)
+		_ = c.conn.WriteControl(wsCloseMessage, msg, time.Now().Add(time.Second))
+		_ = c.conn.Close()
+	}
+	return false
+}
+
+// limitedClose reports whether the connection was closed for abuse.
+func (c *LimitedConn) limitedClose() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// connID returns a random connection ID, unique across instances sharing
+// a store.
+func connID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeWSConn serves queued text messages and records control frames.
+type fakeWSConn struct {
+	messages [][]byte
+	control  [][]byte
+	closed   bool
+}
+
+func (c *fakeWSConn) ReadMessage() (int, []byte, error) {
+	if c.closed || len(c.messages) == 0 {
+		return -1, nil, io.EOF
+	}
+	p := c.messages[0]
+	c.messages = c.messages[1:]
+	return 1, p, nil
+}
+
+func (c *fakeWSConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	if messageType == wsCloseMessage {
+		c.control = append(c.control, data)
+	}
+	return nil
+}
+
+func (c *fakeWSConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestMessageLimiter_DropsThenCloses(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	conn := &fakeWSConn{}
+	for i := 0; i < 10; i++ {
+		conn.messages = append(conn.messages, []byte{byte(i)})
+	}
+	limited := NewMessageLimiter(store, Policy{Limit: 2, Window: time.Minute, Enabled: true, Scope: "ws"}, 3, time.Minute).Wrap(conn, "user:1")
+
+	for i := 0; i < 2; i++ {
+		if _, p, err := limited.ReadMessage(); err != nil || p[0] != byte(i) {
+			t.Fatalf("message %d: expected it within the limit, got %v %v", i, p, err)
+		}
+	}
+	if _, _, err := limited.ReadMessage(); !errors.Is(err, ErrMessageRateLimited) {
+		t.Fatalf("expected the connection closed for abuse, got %v", err)
+	}
+	if !conn.closed || len(conn.control) != 1 || binary.BigEndian.Uint16(conn.control[0]) != WSClosePolicyViolation {
+		t.Errorf("expected a 1008 close frame, got %v (closed %t)", conn.control, conn.closed)
+	}
+	if len(conn.messages) != 5 {
+		t.Errorf("expected 3 messages dropped before closing, %d left", len(conn.messages))
+	}
+}
+
+func TestMessageLimiter_KeysShareBuckets(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	m := NewMessageLimiter(store, Policy{Limit: 1, Window: time.Minute, Enabled: true, Scope: "ws"}, 10, 0)
+	a := &fakeWSConn{messages: [][]byte{{1}}}
+	b := &fakeWSConn{messages: [][]byte{{2}}}
+	if _, _, err := m.Wrap(a, "user:1").ReadMessage(); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	if _, _, err := m.Wrap(b, "user:1").ReadMessage(); err != io.EOF {
+		t.Errorf("expected the user's second connection to share the bucket and drop its message, got %v", err)
+	}
+	c := &fakeWSConn{messages: [][]byte{{3}}}
+	if _, _, err := m.Wrap(c, "").ReadMessage(); err != nil {
+		t.Errorf("expected a per-connection bucket for an empty key, got %v", err)
+	}
+}
+
+func TestMessageLimiter_CountsDenialsInWindow(t *testing.T) {
+	store := NewMockStore()
+	conn := &fakeWSConn{}
+	limited := NewMessageLimiter(store, Policy{Limit: 5, Window: time.Minute, Enabled: true, Scope: "ws"}, 3, 50*time.Millisecond).Wrap(conn, "user:1")
+	deny, allow := Result{Allowed: false, RetryAfter: 1}, Result{Allowed: true}
+
+	// Allowed messages between denials do not reset the count.
+	store.QueueResult("ws:user:1", deny, allow, deny)
+	for i := 0; i < 3; i++ {
+		limited.allow()
+	}
+	if got := limited.Denials(); got != 2 {
+		t.Fatalf("expected 2 denials in the window, got %d", got)
+	}
+
+	// Denials older than the window are forgotten.
+	time.Sleep(60 * time.Millisecond)
+	if got := limited.Denials(); got != 0 {
+		t.Fatalf("expected old denials forgotten, got %d", got)
+	}
+	store.QueueResult("ws:user:1", deny, allow, deny)
+	for i := 0; i < 3; i++ {
+		limited.allow()
+	}
+	if conn.closed {
+		t.Fatal("expected the connection kept open below the denial cap")
+	}
+	store.QueueResult("ws:user:1", deny)
+	limited.allow()
+	if !conn.closed {
+		t.Error("expected the connection closed after 3 denials within the window")
+	}
+}